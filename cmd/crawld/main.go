@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"os"
+
 	"github.com/johnstcn/freshcomics/internal/store"
 	"github.com/johnstcn/freshcomics/pkg/crawld"
 
-	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,20 +23,83 @@ func main() {
 	}
 	log.SetReportCaller(cfg.LogCallerTrace)
 
-	conn, err := sqlx.Connect("postgres", cfg.DSN)
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		preview(cfg, os.Args[2:])
+		return
+	}
+
+	conn, err := store.Open(cfg.DSN)
 	if err != nil {
 		log.WithError(err).Fatal("could not connect to database")
 	}
 
-	pgstore, err := store.NewPGStore(conn)
+	migrator, err := store.NewMigrator(conn)
+	if err != nil {
+		log.WithError(err).Fatal("load migrations")
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := store.MigrateCommand(migrator, os.Args[2:], os.Stdout); err != nil {
+			log.WithError(err).Fatal("migrate")
+		}
+		return
+	}
+	if err := migrator.Up(); err != nil {
+		log.WithError(err).Fatal("migrate")
+	}
+
+	st, err := store.New(conn, nil)
 	if err != nil {
-		log.WithError(err).Fatal("init pgstore")
+		log.WithError(err).Fatal("init store")
 	}
 
-	d, err := crawld.New(cfg, pgstore)
+	d, err := crawld.New(cfg, st)
 	if err != nil {
 		log.WithError(err).Fatal("init crawld")
 	}
 
-	log.Fatal(d.Run())
+	if err := d.Run(); err != nil {
+		log.WithError(err).Fatal("run crawld")
+	}
+}
+
+// preview crawls a candidate SiteDef read from a JSON file without persisting anything
+// and writes the extracted values for each page to stdout.
+func preview(cfg crawld.Config, args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	defPath := fs.String("def", "-", "path to a JSON-encoded SiteDef, or - for stdin")
+	pages := fs.Int("pages", crawld.DefaultPreviewPages, "number of pages to crawl")
+	_ = fs.Parse(args)
+
+	in := os.Stdin
+	if *defPath != "-" {
+		f, err := os.Open(*defPath)
+		if err != nil {
+			log.WithError(err).Fatal("open site def")
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var def store.SiteDef
+	if err := json.NewDecoder(in).Decode(&def); err != nil {
+		log.WithError(err).Fatal("decode site def")
+	}
+	if def.CrawlStrategy == "" {
+		def.CrawlStrategy = store.CrawlStrategyPage
+	}
+
+	if err := crawld.ValidateSiteDef(def); err != nil {
+		log.WithError(err).Fatal("invalid site def")
+	}
+
+	results, err := crawld.NewPreviewer(cfg).Preview(def, *pages)
+	if err != nil {
+		log.WithError(err).Fatal("preview site def")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(results); err != nil {
+		log.WithError(err).Fatal("write preview")
+	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/auth"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/johnstcn/freshcomics/pkg/crawld"
+)
+
+const (
+	// demoUser and demoPassword are the credentials of the admin account created in demo mode
+	demoUser     = "demo"
+	demoPassword = "freshcomics"
+)
+
+// seedDemo fills s with an admin account, a SiteDef of a real comic, and a SiteDef with a few updates
+// so that there is something to read. Both are inactive, so the demo makes no outbound requests until
+// an admin activates the real comic for the in-process crawler to pick up.
+func seedDemo(s store.Store) error {
+	hash, err := auth.HashPassword(demoPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := s.CreateUser(store.User{Name: demoUser, PasswordHash: hash, Role: store.RoleAdmin}); err != nil {
+		return fmt.Errorf("create demo user: %w", err)
+	}
+
+	if _, err := s.CreateSiteDef(store.SiteDef{
+		Name:          "Emma & The Granny Fairies",
+		StartURL:      "http://grannyfairies.com/p1-once.html",
+		URLTemplate:   "http://grannyfairies.com/%s.html",
+		NextPageXPath: `//p[@class="nav"]/a[@class="on"]/@href`,
+		RefRegexp:     `([^/]+)\.html$`,
+		TitleXPath:    `//img[@class="comic"]/@alt`,
+		TitleRegexp:   "(.+)",
+		CrawlStrategy: store.CrawlStrategyPage,
+	}); err != nil {
+		return fmt.Errorf("create demo site def: %w", err)
+	}
+
+	exampleID, err := s.CreateSiteDef(store.SiteDef{
+		Name:          "Example Comic",
+		StartURL:      "https://example.com/comic/1",
+		URLTemplate:   "https://example.com/comic/%s",
+		NextPageXPath: `//a[@rel="next"]/@href`,
+		RefRegexp:     `([^/]+)/?$`,
+		TitleXPath:    "//title/text()",
+		TitleRegexp:   "(.+)",
+		CrawlStrategy: store.CrawlStrategyPage,
+	})
+	if err != nil {
+		return fmt.Errorf("create demo site def: %w", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := s.CreateSiteUpdate(store.SiteUpdate{
+			SiteDefID: exampleID,
+			Ref:       fmt.Sprint(i),
+			URL:       fmt.Sprintf("https://example.com/comic/%d", i),
+			Title:     fmt.Sprintf("Example Comic #%d", i),
+			SeenAt:    time.Now().Add(time.Duration(i-3) * 24 * time.Hour),
+		}); err != nil {
+			return fmt.Errorf("create demo site update: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// startDemoCrawler runs the crawl daemon against s in the background, configured from the
+// same CRAWLD_ environment variables as crawld
+func startDemoCrawler(s store.Store) error {
+	cfg, err := crawld.NewConfig()
+	if err != nil {
+		return err
+	}
+	d, err := crawld.New(cfg, s)
+	if err != nil {
+		return err
+	}
+	d.Start()
+	return nil
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/exp/slices"
@@ -13,15 +15,26 @@ import (
 
 	"github.com/johnstcn/freshcomics/internal/api"
 	"github.com/johnstcn/freshcomics/internal/app"
+	"github.com/johnstcn/freshcomics/internal/auth"
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/clicks"
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
 	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/johnstcn/freshcomics/pkg/crawld"
 )
 
 func main() {
 	var (
-		host string
-		port int
-		dsn  string
-		log  = slog.New(slog.NewTextHandler(os.Stdout))
+		host      string
+		port      int
+		dsn       string
+		userAgent string
+		publicURL string
+		geoIPDB   string
+		proxies   string
+		imageArgs blob.Args
+		demo      bool
+		log       = slog.New(slog.NewTextHandler(os.Stdout))
 	)
 
 	flag.StringVar(&host, "host", "0.0.0.0", "listen on this host")
@@ -43,28 +56,155 @@ func main() {
 		"postgresql://localhost:5432/freshcomics"+
 			"?user=freshcomics"+
 			"&password=freshcomics"+
-			"&sslmode=disable", "postgresql connection string")
+			"&sslmode=disable", "database connection string; use sqlite:PATH for a SQLite database")
 	if val, ok := os.LookupEnv("FRESHCOMICS_DB"); ok {
 		dsn = val
 	}
 
+	flag.StringVar(&userAgent, "useragent", "freshcomics/preview", "user agent used when previewing site defs")
+	if val, ok := os.LookupEnv("FRESHCOMICS_USERAGENT"); ok {
+		userAgent = val
+	}
+
+	flag.StringVar(&publicURL, "publicurl", "", "public URL of the server used in feed links; derived from each request if empty")
+	if val, ok := os.LookupEnv("FRESHCOMICS_PUBLICURL"); ok {
+		publicURL = val
+	}
+
+	flag.StringVar(&geoIPDB, "geoipdb", "", "path to a MaxMind GeoIP database used to locate clicks; clicks are not located if empty")
+	if val, ok := os.LookupEnv("FRESHCOMICS_GEOIPDB"); ok {
+		geoIPDB = val
+	}
+
+	flag.StringVar(&proxies, "trustedproxies", "", "comma-separated addresses or CIDR ranges of proxies trusted to set X-Forwarded-For")
+	if val, ok := os.LookupEnv("FRESHCOMICS_TRUSTEDPROXIES"); ok {
+		proxies = val
+	}
+
+	flag.StringVar(&imageArgs.Dir, "imagedir", "", "directory of images archived by crawld; archived images are not served if empty")
+	if val, ok := os.LookupEnv("FRESHCOMICS_IMAGEDIR"); ok {
+		imageArgs.Dir = val
+	}
+
+	flag.StringVar(&imageArgs.Endpoint, "images3endpoint", "", "URL of an S3-compatible API holding images archived by crawld; used instead of -imagedir if set")
+	if val, ok := os.LookupEnv("FRESHCOMICS_IMAGES3ENDPOINT"); ok {
+		imageArgs.Endpoint = val
+	}
+
+	flag.StringVar(&imageArgs.Bucket, "images3bucket", "", "bucket holding images archived by crawld")
+	if val, ok := os.LookupEnv("FRESHCOMICS_IMAGES3BUCKET"); ok {
+		imageArgs.Bucket = val
+	}
+
+	flag.StringVar(&imageArgs.Region, "images3region", "us-east-1", "region of -images3bucket")
+	if val, ok := os.LookupEnv("FRESHCOMICS_IMAGES3REGION"); ok {
+		imageArgs.Region = val
+	}
+
+	// credentials are only read from the environment so they don't show up in process listings
+	imageArgs.AccessKey = os.Getenv("FRESHCOMICS_IMAGES3ACCESSKEY")
+	imageArgs.SecretKey = os.Getenv("FRESHCOMICS_IMAGES3SECRETKEY")
+
+	flag.BoolVar(&demo, "demo", false, "serve sample data from memory and crawl in-process instead of using a database; nothing is persisted")
+	if val, ok := os.LookupEnv("FRESHCOMICS_DEMO"); ok {
+		if boolVal, err := strconv.ParseBool(val); err != nil {
+			log.Error("invalid demo env", "val", val)
+			os.Exit(1)
+		} else {
+			demo = boolVal
+		}
+	}
+
 	if slices.Contains(os.Args, "-help") {
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	flag.Parse()
+	args := flag.Args()
 
-	conn, err := sqlx.Connect("postgres", dsn)
-	if err != nil {
-		log.Error("connect to db", "err", err)
-		os.Exit(1)
+	var conn *sqlx.DB
+	if !demo {
+		var err error
+		conn, err = store.Open(dsn)
+		if err != nil {
+			log.Error("connect to db", "err", err)
+			os.Exit(1)
+		}
+
+		migrator, err := store.NewMigrator(conn)
+		if err != nil {
+			log.Error("load migrations", "err", err)
+			os.Exit(1)
+		}
+		if len(args) > 0 && args[0] == "migrate" {
+			if err := store.MigrateCommand(migrator, args[1:], os.Stdout); err != nil {
+				log.Error("migrate", "err", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		if err := migrator.Up(); err != nil {
+			log.Error("migrate", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var geoIP ipinfo.IPInfoer
+	var err error
+	if geoIPDB != "" {
+		geoIP, err = ipinfo.OpenFile(geoIPDB)
+		if err != nil {
+			log.Error("open geoip db", "err", err)
+			os.Exit(1)
+		}
 	}
 
-	store, err := store.NewPGStore(conn)
+	trustedProxies, err := api.ParseTrustedProxies(proxies)
 	if err != nil {
-		log.Error("init store", "err", err)
+		log.Error("parse trusted proxies", "err", err)
 		os.Exit(1)
 	}
 
+	var images blob.Store
+	if imageArgs.Dir != "" || imageArgs.Endpoint != "" {
+		images, err = blob.New(&imageArgs)
+		if err != nil {
+			log.Error("open image archive", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var st store.Store
+	if demo {
+		st = store.NewMemStore(geoIP)
+		if err := seedDemo(st); err != nil {
+			log.Error("seed demo data", "err", err)
+			os.Exit(1)
+		}
+		if err := startDemoCrawler(st); err != nil {
+			log.Error("start demo crawler", "err", err)
+			os.Exit(1)
+		}
+		log.Info("demo mode: nothing is persisted", "user", demoUser, "password", demoPassword)
+	} else {
+		st, err = store.New(conn, geoIP)
+		if err != nil {
+			log.Error("init store", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(args) > 0 && args[0] == "useradd" {
+		if err := addUser(st, args[1:]); err != nil {
+			log.Error("add user", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	recorder := clicks.NewRecorder(st, log, clicks.DefaultQueueSize)
+	defer recorder.Close()
+
 	listenAddress := fmt.Sprintf("%s:%d", host, port)
 	mux := http.NewServeMux()
 	app.New(app.Deps{
@@ -72,9 +212,17 @@ func main() {
 		Logger: log,
 	})
 	api.New(api.Deps{
-		Mux:    mux,
-		Store:  store,
-		Logger: log,
+		Mux:   mux,
+		Store: st,
+		Previewer: crawld.NewPreviewer(crawld.Config{
+			UserAgent:        userAgent,
+			FetchTimeoutSecs: 10,
+		}),
+		PublicURL:      publicURL,
+		Clicks:         recorder,
+		TrustedProxies: trustedProxies,
+		Images:         images,
+		Logger:         log,
 	})
 
 	log.Info("listen", "host", host, "port", port)
@@ -82,3 +230,46 @@ func main() {
 		log.Error("listen and serve", "err", err)
 	}
 }
+
+// addUser creates a local user account. The password is read from the
+// FRESHCOMICS_PASSWORD environment variable if set, otherwise from stdin.
+func addUser(s store.UserStore, args []string) error {
+	var (
+		name  string
+		admin bool
+	)
+	fs := flag.NewFlagSet("useradd", flag.ExitOnError)
+	fs.StringVar(&name, "name", "", "name of the user")
+	fs.BoolVar(&admin, "admin", false, "grant the admin role")
+	_ = fs.Parse(args)
+
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	password, ok := os.LookupEnv("FRESHCOMICS_PASSWORD")
+	if !ok {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	role := store.RoleUser
+	if admin {
+		role = store.RoleAdmin
+	}
+
+	_, err = s.CreateUser(store.User{
+		Name:         name,
+		PasswordHash: hash,
+		Role:         role,
+	})
+	return err
+}
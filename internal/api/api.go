@@ -2,33 +2,94 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"golang.org/x/exp/slog"
 
+	"github.com/johnstcn/freshcomics/internal/blob"
 	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/johnstcn/freshcomics/pkg/crawld"
 )
 
 type handler struct {
 	*http.ServeMux
-	store store.Store
-	log   *slog.Logger
+	store          store.Store
+	previewer      crawld.Previewer
+	publicURL      string
+	clicks         ClickRecorder
+	trustedProxies []*net.IPNet
+	images         blob.Store
+	log            *slog.Logger
 }
 
 type Deps struct {
-	Mux    *http.ServeMux
-	Store  store.Store
+	Mux       *http.ServeMux
+	Store     store.Store
+	Previewer crawld.Previewer
+	// PublicURL is the URL the server is reachable at, used for absolute links in feeds.
+	// If empty, it is derived from each request.
+	PublicURL string
+	// Clicks records clicks on the /r/{id} redirect. Clicks are not recorded if nil.
+	Clicks ClickRecorder
+	// TrustedProxies are the proxies whose X-Forwarded-For headers are believed
+	TrustedProxies []*net.IPNet
+	// Images is the image archive crawld downloads to. Archived images are not served if nil.
+	Images blob.Store
 	Logger *slog.Logger
 }
 
 func New(deps Deps) {
 	f := &handler{
-		ServeMux: deps.Mux,
-		store:    deps.Store,
-		log:      deps.Logger,
+		ServeMux:       deps.Mux,
+		store:          deps.Store,
+		previewer:      deps.Previewer,
+		publicURL:      deps.PublicURL,
+		clicks:         deps.Clicks,
+		trustedProxies: deps.TrustedProxies,
+		images:         deps.Images,
+		log:            deps.Logger,
 	}
 
 	f.HandleFunc("/api/comics/", f.listComics)
+	f.HandleFunc("POST /api/register", f.register)
+	f.HandleFunc("POST /api/login", f.login)
+	f.HandleFunc("POST /api/logout", f.logout)
+	f.HandleFunc("GET /api/me", f.requireUser(f.whoami))
+	f.HandleFunc("GET /api/me/feed", f.requireUser(f.getFeedStatus))
+	f.HandleFunc("POST /api/me/feed", f.requireUser(f.createFeedToken))
+	f.HandleFunc("POST /api/me/feed/reset", f.requireUser(f.resetFeedToken))
+	f.HandleFunc("GET /api/feeds/all/{format}", f.allFeed)
+	f.HandleFunc("GET /api/feeds/sitedefs/{id}/{format}", f.siteDefFeed)
+	f.HandleFunc("GET /api/feeds/users/{token}/{format}", f.userFeed)
+	f.HandleFunc("GET /r/{id}", f.redirect)
+	f.HandleFunc("GET /api/subscriptions/{$}", f.requireUser(f.listSubscriptions))
+	f.HandleFunc("PUT /api/subscriptions/{id}", f.requireUser(f.subscribe))
+	f.HandleFunc("DELETE /api/subscriptions/{id}", f.requireUser(f.unsubscribe))
+	f.HandleFunc("POST /api/updates/{id}/read", f.requireUser(f.markRead(false)))
+	f.HandleFunc("POST /api/updates/{id}/read-through", f.requireUser(f.markRead(true)))
+	f.HandleFunc("GET /api/unread/{$}", f.requireUser(f.listUnreadComics))
+	f.HandleFunc("GET /api/updates/{id}/images", f.listUpdateImages)
+	f.HandleFunc("GET /images/{hash}", f.serveImage)
+	f.HandleFunc("GET /api/admin/stats/sitedefs", f.requireAdmin(f.siteDefClicks))
+	f.HandleFunc("GET /api/admin/stats/sitedefs/{id}", f.requireAdmin(f.siteDefClickSeries))
+	f.HandleFunc("GET /api/admin/stats/updates", f.requireAdmin(f.siteUpdateClicks))
+	f.HandleFunc("GET /api/admin/stats/countries", f.requireAdmin(f.locationClicks(false)))
+	f.HandleFunc("GET /api/admin/stats/regions", f.requireAdmin(f.locationClicks(true)))
+	f.HandleFunc("GET /api/admin/stats/trending", f.requireAdmin(f.trendingComics))
+	f.HandleFunc("GET /api/admin/sitedefs/{$}", f.requireAdmin(f.listSiteDefs))
+	f.HandleFunc("POST /api/admin/sitedefs/{$}", f.requireAdmin(f.createSiteDef))
+	f.HandleFunc("POST /api/admin/sitedefs/preview", f.requireAdmin(f.previewSiteDef))
+	f.HandleFunc("GET /api/admin/sitedefs/{id}", f.requireAdmin(f.getSiteDef))
+	f.HandleFunc("PUT /api/admin/sitedefs/{id}", f.requireAdmin(f.updateSiteDef))
+	f.HandleFunc("POST /api/admin/sitedefs/{id}/activate", f.requireAdmin(f.setSiteDefActive(true)))
+	f.HandleFunc("POST /api/admin/sitedefs/{id}/deactivate", f.requireAdmin(f.setSiteDefActive(false)))
+	f.HandleFunc("POST /api/admin/sitedefs/{id}/crawl", f.requireAdmin(f.crawlSiteDef))
+	f.HandleFunc("GET /api/admin/sitedefs/{id}/backfill", f.requireAdmin(f.getBackfill))
+	f.HandleFunc("POST /api/admin/sitedefs/{id}/backfill", f.requireAdmin(f.backfillSiteDef))
 }
 
 type ListComicsResponse struct {
@@ -36,13 +97,36 @@ type ListComicsResponse struct {
 	Error string        `json:"error"`
 }
 
+// listComics returns the latest update of every comic, newest first. If the sort query parameter
+// is popular, comics with the most clicks in the time window given by days come first.
 func (h *handler) listComics(w http.ResponseWriter, r *http.Request) {
 	resp := ListComicsResponse{
 		Data:  []store.Comic{},
 		Error: "",
 	}
+
+	var (
+		data []store.Comic
+		err  error
+	)
+	switch sort := r.URL.Query().Get("sort"); sort {
+	case "", "latest":
+		data, err = h.store.GetComics()
+	case "popular":
+		var since time.Time
+		if since, _, err = statsParams(r); err != nil {
+			resp.Error = err.Error()
+			h.writeJSON(w, http.StatusBadRequest, resp, "listComics")
+			return
+		}
+		data, err = h.store.GetPopularComics(since)
+	default:
+		resp.Error = fmt.Sprintf("invalid sort %q", sort)
+		h.writeJSON(w, http.StatusBadRequest, resp, "listComics")
+		return
+	}
+
 	code := http.StatusOK
-	data, err := h.store.GetComics()
 	if err != nil {
 		h.log.Error("get data from store", "err", err, "handler", "listComics")
 		code = http.StatusInternalServerError
@@ -51,9 +135,27 @@ func (h *handler) listComics(w http.ResponseWriter, r *http.Request) {
 		resp.Data = data
 	}
 
+	h.writeJSON(w, code, resp, "listComics")
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, code int, resp interface{}, handler string) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		h.log.Error("write response", "err", err, "handler", "listComics")
+		h.log.Error("write response", "err", err, "handler", handler)
+	}
+}
+
+// intParam returns the value of the named query parameter, which must be between 1 and max,
+// or def if it is not given
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("%s must be between 1 and %d", name, max)
 	}
+	return n, nil
 }
@@ -1,54 +1,169 @@
 package api_test
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/johnstcn/freshcomics/internal/api"
+	"github.com/johnstcn/freshcomics/internal/auth"
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/feed"
 	"github.com/johnstcn/freshcomics/internal/store"
 	mock_store "github.com/johnstcn/freshcomics/internal/store/mocks"
 	"github.com/johnstcn/freshcomics/internal/testutil/slogtest"
+	"github.com/johnstcn/freshcomics/pkg/crawld"
+	mock_crawld "github.com/johnstcn/freshcomics/pkg/crawld/mocks"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
+var testSiteDef = store.SiteDef{
+	ID:            1,
+	Name:          "Test Comic",
+	Active:        true,
+	StartURL:      "http://example.com/1",
+	URLTemplate:   "http://example.com/%s",
+	NextPageXPath: `//a[@rel="next"]/@href`,
+	RefRegexp:     `([^/]+)/?$`,
+	TitleXPath:    `//title/text()`,
+	TitleRegexp:   `(.+)`,
+	CrawlStrategy: store.CrawlStrategyPage,
+}
+
+var testAdmin = store.User{
+	ID:   1,
+	Name: "admin",
+	Role: store.RoleAdmin,
+}
+
+var testUser = store.User{
+	ID:   2,
+	Name: "user",
+	Role: store.RoleUser,
+}
+
+func doJSON(t *testing.T, c *http.Client, method, url string, body interface{}, opts ...func(*http.Request)) *http.Response {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	require.NoError(t, err)
+	for _, opt := range opts {
+		opt(req)
+	}
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+	return res
+}
+
+func withSession(token string) func(*http.Request) {
+	return func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: api.SessionCookieName, Value: token})
+	}
+}
+
 type WebTestSuite struct {
 	suite.Suite
 }
 
+// fakeClicks is a ClickRecorder that remembers every click
+type fakeClicks struct {
+	mu    sync.Mutex
+	ids   []store.SiteUpdateID
+	addrs []string
+}
+
+func (c *fakeClicks) Record(id store.SiteUpdateID, addr net.IP) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = append(c.ids, id)
+	c.addrs = append(c.addrs, addr.String())
+	return true
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Parallel()
+	nets, err := api.ParseTrustedProxies(" 10.0.0.0/8,192.0.2.1 ,,2001:db8::1")
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.Equal(t, "10.0.0.0/8", nets[0].String())
+	assert.Equal(t, "192.0.2.1/32", nets[1].String())
+	assert.Equal(t, "2001:db8::1/128", nets[2].String())
+
+	_, err = api.ParseTrustedProxies("10.0.0.0/8,bogus")
+	assert.Error(t, err)
+	_, err = api.ParseTrustedProxies("10.0.0.0/99")
+	assert.Error(t, err)
+}
+
 func TestWeb(t *testing.T) {
 	t.Parallel()
 	type params struct {
-		Store  *mock_store.MockStore
-		Srv    *httptest.Server
-		Client *http.Client
+		Store     *mock_store.MockStore
+		Previewer *mock_crawld.MockPreviewer
+		Clicks    *fakeClicks
+		Images    blob.Store
+		Srv       *httptest.Server
+		Client    *http.Client
 	}
 	setup := func(t *testing.T) params {
 		t.Helper()
 		mux := http.NewServeMux()
 		ctrl := gomock.NewController(t)
 		store := mock_store.NewMockStore(ctrl)
+		previewer := mock_crawld.NewMockPreviewer(ctrl)
+		clicks := &fakeClicks{}
 		t.Cleanup(ctrl.Finish)
 		log := slogtest.New(t)
+		trusted, err := api.ParseTrustedProxies("127.0.0.1, ::1")
+		require.NoError(t, err)
+		images, err := blob.New(&blob.Args{Dir: t.TempDir()})
+		require.NoError(t, err)
 		api.New(api.Deps{
-			Mux:    mux,
-			Store:  store,
-			Logger: log,
+			Mux:            mux,
+			Store:          store,
+			Previewer:      previewer,
+			Clicks:         clicks,
+			TrustedProxies: trusted,
+			Images:         images,
+			Logger:         log,
 		})
 		srv := httptest.NewServer(mux)
 		t.Cleanup(srv.Close)
 		return params{
-			Store:  store,
-			Srv:    srv,
-			Client: srv.Client(),
+			Store:     store,
+			Previewer: previewer,
+			Clicks:    clicks,
+			Images:    images,
+			Srv:       srv,
+			Client:    srv.Client(),
 		}
 	}
 
+	// loginAs returns a request option carrying a session cookie for the given User
+	loginAs := func(p params, u store.User) func(*http.Request) {
+		token := fmt.Sprintf("token-%d", u.ID)
+		p.Store.EXPECT().GetSessionUser(auth.HashToken(token)).AnyTimes().Return(u, nil)
+		return withSession(token)
+	}
+
 	t.Run("api/comics/list", func(t *testing.T) {
 		t.Parallel()
 		t.Run("OK", func(t *testing.T) {
@@ -65,6 +180,21 @@ func TestWeb(t *testing.T) {
 			assert.Equal(t, comics, list.Data)
 			assert.Empty(t, list.Error)
 		})
+		t.Run("Media", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			publishedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			comics := []store.Comic{{
+				ID: 1, Name: "Test Comic", Title: "One", URL: "https://example.com/1", SeenAt: publishedAt.Add(time.Hour),
+				ImageURLs: store.StringList{"https://example.com/1.png"}, AltText: "hover text", PublishedAt: &publishedAt,
+			}}
+			p.Store.EXPECT().GetComics().Times(1).Return(comics, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/comics/", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var list api.ListComicsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+			assert.Equal(t, comics, list.Data)
+		})
 		t.Run("Err", func(t *testing.T) {
 			t.Parallel()
 			p := setup(t)
@@ -80,4 +210,1059 @@ func TestWeb(t *testing.T) {
 			assert.EqualError(t, testErr, list.Error)
 		})
 	})
+	t.Run("api/admin/sitedefs/list", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDefs(true).Times(1).Return([]store.SiteDef{testSiteDef}, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var list api.ListSiteDefsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+			assert.Equal(t, []store.SiteDef{testSiteDef}, list.Data)
+			assert.Empty(t, list.Error)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Store.EXPECT().GetSiteDefs(true).Times(1).Return(nil, testErr)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			var list api.ListSiteDefsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+			assert.Empty(t, list.Data)
+			assert.EqualError(t, testErr, list.Error)
+		})
+	})
+
+	t.Run("api/admin/sitedefs/get", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/1", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, testSiteDef, got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("NotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(store.SiteDefID(2)).Times(1).Return(store.SiteDef{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/2", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("BadID", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/abc", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+
+	t.Run("api/admin/sitedefs/create", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			newDef := testSiteDef
+			newDef.ID = 0
+			p.Store.EXPECT().CreateSiteDef(newDef).Times(1).Return(store.SiteDefID(3), nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/", newDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusCreated, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.EqualValues(t, 3, got.Data.ID)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			newDef := testSiteDef
+			newDef.TitleXPath = "//title["
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/", newDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Contains(t, got.Error, "invalid title rule")
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Store.EXPECT().CreateSiteDef(gomock.Any()).Times(1).Return(store.SiteDefID(0), testErr)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		})
+	})
+
+	t.Run("api/admin/sitedefs/update", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			updated := testSiteDef
+			updated.Name = "Updated Name"
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().UpdateSiteDef(updated).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/admin/sitedefs/1", updated, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, updated, got.Data)
+		})
+		t.Run("KeepsBrokenReason", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			broken := testSiteDef
+			broken.Active = false
+			broken.BrokenReason = "8 crawls in a row failed"
+			updated := broken
+			updated.TitleXPath = "//h1/text()"
+			updated.BrokenReason = ""
+			want := updated
+			want.BrokenReason = broken.BrokenReason
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(broken, nil)
+			p.Store.EXPECT().UpdateSiteDef(want).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/admin/sitedefs/1", updated, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("ActivateClearsBrokenReason", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			broken := testSiteDef
+			broken.Active = false
+			broken.BrokenReason = "8 crawls in a row failed"
+			updated := broken
+			updated.Active = true
+			want := updated
+			want.BrokenReason = ""
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(broken, nil)
+			p.Store.EXPECT().UpdateSiteDef(want).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/admin/sitedefs/1", updated, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data.BrokenReason)
+		})
+		t.Run("NotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(store.SiteDefID(2)).Times(1).Return(store.SiteDef{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/admin/sitedefs/2", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			updated := testSiteDef
+			updated.RefRegexp = "("
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/admin/sitedefs/1", updated, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+
+	t.Run("api/admin/sitedefs/activate", func(t *testing.T) {
+		t.Parallel()
+		t.Run("Deactivate", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			deactivated := testSiteDef
+			deactivated.Active = false
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().UpdateSiteDef(deactivated).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/deactivate", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.False(t, got.Data.Active)
+		})
+		t.Run("Activate", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			inactive := testSiteDef
+			inactive.Active = false
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(inactive, nil)
+			p.Store.EXPECT().UpdateSiteDef(testSiteDef).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/activate", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.True(t, got.Data.Active)
+		})
+		t.Run("ActivateBroken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			broken := testSiteDef
+			broken.Active = false
+			broken.BrokenReason = "8 crawls in a row failed"
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(broken, nil)
+			p.Store.EXPECT().UpdateSiteDef(testSiteDef).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/activate", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data.BrokenReason)
+		})
+	})
+	t.Run("api/admin/sitedefs/crawl", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			ended := store.CrawlInfo{ID: 3, SiteDefID: testSiteDef.ID, EndedAt: pq.NullTime{Time: time.Now(), Valid: true}}
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetCrawlInfo(testSiteDef.ID).Times(1).Return([]store.CrawlInfo{ended}, nil)
+			p.Store.EXPECT().GetLastURL(testSiteDef.ID).Times(1).Return("http://example.com/5", nil)
+			p.Store.EXPECT().CreateCrawlInfo(testSiteDef.ID, "http://example.com/5").Times(1).Return(store.CrawlInfoID(4), nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/crawl", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusAccepted, res.StatusCode)
+			var got api.CrawlSiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, store.CrawlInfoID(4), got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("NeverCrawled", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetCrawlInfo(testSiteDef.ID).Times(1).Return([]store.CrawlInfo{}, nil)
+			p.Store.EXPECT().GetLastURL(testSiteDef.ID).Times(1).Return("", sql.ErrNoRows)
+			p.Store.EXPECT().CreateCrawlInfo(testSiteDef.ID, testSiteDef.StartURL).Times(1).Return(store.CrawlInfoID(1), nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/crawl", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusAccepted, res.StatusCode)
+		})
+		t.Run("InProgress", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			pending := store.CrawlInfo{ID: 3, SiteDefID: testSiteDef.ID}
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetCrawlInfo(testSiteDef.ID).Times(1).Return([]store.CrawlInfo{pending}, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/crawl", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			var got api.CrawlSiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, store.CrawlInfoID(3), got.Data)
+		})
+		t.Run("NotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(store.SiteDefID(2)).Times(1).Return(store.SiteDef{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/2/crawl", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetCrawlInfo(testSiteDef.ID).Times(1).Return(nil, errors.New("boom"))
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/crawl", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		})
+	})
+	t.Run("api/admin/sitedefs/backfill", func(t *testing.T) {
+		t.Parallel()
+		backfillDef := testSiteDef
+		backfillDef.PrevPageXPath = `//a[@rel="prev"]/@href`
+		backfillDef.BackfillURL = "http://example.com/"
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			ended := time.Now()
+			seenAt := time.Now().Add(-time.Hour)
+			created := store.Backfill{SiteDefID: backfillDef.ID, URL: backfillDef.BackfillURL, MaxPages: 50, DatedBefore: seenAt}
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			gomock.InOrder(
+				p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(store.Backfill{SiteDefID: backfillDef.ID, EndedAt: &ended}, nil),
+				p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(created, nil),
+			)
+			p.Store.EXPECT().GetSiteUpdates(backfillDef.ID).Times(1).Return([]store.SiteUpdate{{SiteDefID: backfillDef.ID, SeenAt: seenAt}}, nil)
+			p.Store.EXPECT().CreateBackfill(gomock.Any()).Times(1).DoAndReturn(func(b store.Backfill) error {
+				assert.Equal(t, backfillDef.BackfillURL, b.URL)
+				assert.Equal(t, 50, b.MaxPages)
+				assert.True(t, b.DatedBefore.Equal(seenAt))
+				return nil
+			})
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/backfill?max_pages=50", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusAccepted, res.StatusCode)
+			var got api.BackfillResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, backfillDef.BackfillURL, got.Data.URL)
+			assert.Nil(t, got.Data.EndedAt)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("InProgress", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			running := store.Backfill{SiteDefID: backfillDef.ID, URL: "http://example.com/4", Pages: 2}
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(running, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/backfill", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			var got api.BackfillResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, 2, got.Data.Pages)
+		})
+		t.Run("NoPrevPageRule", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetBackfill(testSiteDef.ID).Times(1).Return(store.Backfill{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/backfill", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("BadMaxPages", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/backfill?max_pages=0", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(store.Backfill{}, sql.ErrNoRows)
+			p.Store.EXPECT().GetSiteUpdates(backfillDef.ID).Times(1).Return([]store.SiteUpdate{}, nil)
+			p.Store.EXPECT().CreateBackfill(gomock.Any()).Times(1).Return(errors.New("boom"))
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/1/backfill", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		})
+		t.Run("Get", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(store.Backfill{SiteDefID: backfillDef.ID, Pages: 7, Seen: 5}, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/1/backfill", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.BackfillResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, 7, got.Data.Pages)
+			assert.Equal(t, 5, got.Data.Seen)
+		})
+		t.Run("GetNotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(backfillDef.ID).Times(1).Return(backfillDef, nil)
+			p.Store.EXPECT().GetBackfill(backfillDef.ID).Times(1).Return(store.Backfill{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/1/backfill", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+	})
+	t.Run("api/admin/sitedefs/preview", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			pages := []crawld.PreviewPage{
+				{URL: "http://example.com/1", Ref: "1", Title: "One", NextPage: "http://example.com/2"},
+				{URL: "http://example.com/2", Ref: "2", Title: "Two", Error: "no matches for next_page rule"},
+			}
+			p.Previewer.EXPECT().Preview(testSiteDef, 2).Times(1).Return(pages, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/preview?pages=2", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.PreviewSiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, pages, got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("DefaultPages", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Previewer.EXPECT().Preview(testSiteDef, crawld.DefaultPreviewPages).Times(1).Return([]crawld.PreviewPage{}, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/preview", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("BadPages", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/preview?pages=1000", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Invalid", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			invalid := testSiteDef
+			invalid.NextPageXPath = "//a["
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/preview", invalid, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Previewer.EXPECT().Preview(testSiteDef, crawld.DefaultPreviewPages).Times(1).Return(nil, testErr)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/admin/sitedefs/preview", testSiteDef, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadGateway, res.StatusCode)
+			var got api.PreviewSiteDefResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.EqualError(t, testErr, got.Error)
+		})
+	})
+	t.Run("api/auth", func(t *testing.T) {
+		t.Parallel()
+		hash, err := auth.HashPassword("password123")
+		require.NoError(t, err)
+		withHash := testUser
+		withHash.PasswordHash = hash
+
+		t.Run("AdminUnauthorized", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/", nil)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+		t.Run("AdminExpiredSession", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSessionUser(auth.HashToken("expired")).Times(1).Return(store.User{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/", nil, withSession("expired"))
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+		t.Run("AdminForbidden", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/sitedefs/", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusForbidden, res.StatusCode)
+		})
+		t.Run("LoginOK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUserByName(testUser.Name).Times(1).Return(withHash, nil)
+			p.Store.EXPECT().CreateSession(gomock.Any()).Times(1).DoAndReturn(func(sess store.Session) error {
+				assert.Equal(t, testUser.ID, sess.UserID)
+				assert.True(t, sess.ExpiresAt.After(sess.CreatedAt))
+				return nil
+			})
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/login", api.Credentials{Name: testUser.Name, Password: "password123"})
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.UserResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, testUser.Name, got.Data.Name)
+			assert.Empty(t, got.Data.PasswordHash)
+			require.Len(t, res.Cookies(), 1)
+			assert.Equal(t, api.SessionCookieName, res.Cookies()[0].Name)
+			assert.True(t, res.Cookies()[0].HttpOnly)
+		})
+		t.Run("LoginBadPassword", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUserByName(testUser.Name).Times(1).Return(withHash, nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/login", api.Credentials{Name: testUser.Name, Password: "wrong password"})
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+			assert.Empty(t, res.Cookies())
+		})
+		t.Run("LoginUnknownUser", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUserByName("nobody").Times(1).Return(store.User{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/login", api.Credentials{Name: "nobody", Password: "password123"})
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+		t.Run("RegisterOK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().CreateUser(gomock.Any()).Times(1).DoAndReturn(func(u store.User) (store.UserID, error) {
+				assert.Equal(t, store.RoleUser, u.Role)
+				assert.NoError(t, auth.CheckPassword(u.PasswordHash, "password123"))
+				return store.UserID(5), nil
+			})
+			p.Store.EXPECT().CreateSession(gomock.Any()).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/register", api.Credentials{Name: "newuser", Password: "password123"})
+			require.Equal(t, http.StatusCreated, res.StatusCode)
+			var got api.UserResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.EqualValues(t, 5, got.Data.ID)
+			require.Len(t, res.Cookies(), 1)
+		})
+		t.Run("RegisterTaken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().CreateUser(gomock.Any()).Times(1).Return(store.UserID(0), store.ErrUserNameTaken)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/register", api.Credentials{Name: testUser.Name, Password: "password123"})
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+		})
+		t.Run("RegisterShortPassword", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/register", api.Credentials{Name: "newuser", Password: "short"})
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Logout", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().DeleteSession(auth.HashToken("some-token")).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/logout", nil, withSession("some-token"))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.Len(t, res.Cookies(), 1)
+			assert.Empty(t, res.Cookies()[0].Value)
+		})
+		t.Run("Me", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/me", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.UserResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, testUser, got.Data)
+		})
+		t.Run("MeUnauthorized", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/me", nil)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+	})
+	t.Run("api/subscriptions", func(t *testing.T) {
+		t.Parallel()
+		t.Run("List", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			ids := []store.SiteDefID{1, 3}
+			p.Store.EXPECT().GetSubscriptions(testUser.ID).Times(1).Return(ids, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/subscriptions/", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.ListSubscriptionsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, ids, got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("ListErr", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Store.EXPECT().GetSubscriptions(testUser.ID).Times(1).Return(nil, testErr)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/subscriptions/", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			var got api.ListSubscriptionsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data)
+			assert.EqualError(t, testErr, got.Error)
+		})
+		t.Run("Unauthorized", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/subscriptions/", nil)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+		t.Run("Subscribe", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().Subscribe(testUser.ID, testSiteDef.ID).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/subscriptions/1", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("SubscribeNotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(store.SiteDefID(2)).Times(1).Return(store.SiteDef{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodPut, p.Srv.URL+"/api/subscriptions/2", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("Unsubscribe", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().Unsubscribe(testUser.ID, store.SiteDefID(1)).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodDelete, p.Srv.URL+"/api/subscriptions/1", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("UnsubscribeBadID", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodDelete, p.Srv.URL+"/api/subscriptions/abc", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+	t.Run("api/updates/read", func(t *testing.T) {
+		t.Parallel()
+		t.Run("MarkRead", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().MarkRead(testUser.ID, store.SiteUpdateID(5)).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/updates/5/read", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("MarkReadThrough", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().MarkReadThrough(testUser.ID, store.SiteUpdateID(5)).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/updates/5/read-through", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("BadID", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/updates/abc/read", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().MarkRead(testUser.ID, store.SiteUpdateID(5)).Times(1).Return(errors.New("test error"))
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/updates/5/read", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		})
+	})
+	t.Run("api/unread", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			unread := []store.UnreadComic{{SiteDefID: 1, Name: "Test Comic", ID: 5, Title: "Five", URL: "https://example.com/5", Unread: 2}}
+			p.Store.EXPECT().GetUnreadComics(testUser.ID).Times(1).Return(unread, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/unread/", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.ListUnreadComicsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, unread, got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Store.EXPECT().GetUnreadComics(testUser.ID).Times(1).Return(nil, testErr)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/unread/", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			var got api.ListUnreadComicsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data)
+			assert.EqualError(t, testErr, got.Error)
+		})
+	})
+	t.Run("api/updates/images", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			images := []store.UpdateImage{{ID: 1, UpdateID: 5, URL: "https://example.com/5.png", Hash: blob.Key([]byte("png")), MIMEType: "image/png", Width: 10, Height: 20, Size: 3, ArchivedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}}
+			p.Store.EXPECT().GetUpdateImages(store.SiteUpdateID(5)).Times(1).Return(images, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/updates/5/images", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.ListUpdateImagesResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, images, got.Data)
+			assert.Empty(t, got.Error)
+		})
+		t.Run("BadID", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/updates/five/images", nil)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Err", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUpdateImages(store.SiteUpdateID(5)).Times(1).Return(nil, errors.New("test error"))
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/updates/5/images", nil)
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		})
+	})
+	t.Run("images", func(t *testing.T) {
+		t.Parallel()
+		data := []byte("\x89PNG\r\n\x1a\nimage data")
+		hash := blob.Key(data)
+		img := store.UpdateImage{ID: 1, UpdateID: 5, Hash: hash, MIMEType: "image/png", Size: int64(len(data))}
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			require.NoError(t, p.Images.Put(context.Background(), hash, data, img.MIMEType))
+			p.Store.EXPECT().GetUpdateImageByHash(hash).Times(1).Return(img, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/images/"+hash, nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "image/png", res.Header.Get("Content-Type"))
+			assert.Equal(t, `"`+hash+`"`, res.Header.Get("ETag"))
+			assert.Contains(t, res.Header.Get("Cache-Control"), "immutable")
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, data, body)
+
+			res = doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/images/"+hash, nil, func(r *http.Request) {
+				r.Header.Set("If-None-Match", `"`+hash+`"`)
+			})
+			require.Equal(t, http.StatusNotModified, res.StatusCode)
+		})
+		t.Run("InvalidHash", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/images/..%2Fsecret", nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("Unknown", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUpdateImageByHash(hash).Times(1).Return(store.UpdateImage{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/images/"+hash, nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("NotArchived", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUpdateImageByHash(hash).Times(1).Return(img, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/images/"+hash, nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+	})
+	t.Run("api/feeds", func(t *testing.T) {
+		t.Parallel()
+		seenAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		updates := []store.ComicUpdate{{ID: 5, SiteDefID: 1, Name: "Test Comic", Title: "Five", URL: "https://example.com/5", SeenAt: seenAt}}
+		t.Run("AllAtom", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetRecentUpdates(gomock.Any()).Times(1).Return(updates, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/all/atom", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "application/atom+xml; charset=utf-8", res.Header.Get("Content-Type"))
+			assert.NotEmpty(t, res.Header.Get("ETag"))
+			assert.Equal(t, seenAt.Format(http.TimeFormat), res.Header.Get("Last-Modified"))
+			items, err := feed.Parse(res.Body)
+			require.NoError(t, err)
+			require.Len(t, items, 1)
+			assert.Equal(t, "Test Comic: Five", items[0].Title)
+			assert.Equal(t, p.Srv.URL+"/r/5", items[0].Link)
+		})
+		t.Run("AllNotModified", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetRecentUpdates(gomock.Any()).Times(2).Return(updates, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/all/rss", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			etag := res.Header.Get("ETag")
+			res = doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/all/rss", nil, func(r *http.Request) {
+				r.Header.Set("If-None-Match", etag)
+			})
+			require.Equal(t, http.StatusNotModified, res.StatusCode)
+		})
+		t.Run("BadFormat", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetRecentUpdates(gomock.Any()).Times(1).Return(updates, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/all/json", nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("SiteDefRSS", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(testSiteDef.ID).Times(1).Return(testSiteDef, nil)
+			p.Store.EXPECT().GetSiteDefUpdates(testSiteDef.ID, gomock.Any()).Times(1).Return(updates, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/sitedefs/1/rss", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "application/rss+xml; charset=utf-8", res.Header.Get("Content-Type"))
+			items, err := feed.Parse(res.Body)
+			require.NoError(t, err)
+			require.Len(t, items, 1)
+			assert.Equal(t, "Five", items[0].Title)
+		})
+		t.Run("Media", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			publishedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			media := []store.ComicUpdate{{
+				ID: 6, SiteDefID: 1, Name: "Test Comic", Title: "Six", URL: "https://example.com/6", SeenAt: seenAt,
+				ImageURLs: store.StringList{"https://example.com/6.png"}, AltText: `"Six" & more`, PublishedAt: &publishedAt,
+			}}
+			p.Store.EXPECT().GetRecentUpdates(gomock.Any()).Times(1).Return(media, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/all/atom", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			items, err := feed.Parse(res.Body)
+			require.NoError(t, err)
+			require.Len(t, items, 1)
+			assert.True(t, publishedAt.Equal(items[0].Published))
+			assert.Equal(t, `<p><img src="https://example.com/6.png" alt="&#34;Six&#34; &amp; more" title="&#34;Six&#34; &amp; more"></p>`, items[0].Content)
+		})
+		t.Run("SiteDefNotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDef(store.SiteDefID(2)).Times(1).Return(store.SiteDef{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/sitedefs/2/rss", nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		t.Run("User", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUserByFeedToken(auth.HashToken("abc")).Times(1).Return(testUser, nil)
+			p.Store.EXPECT().GetSubscribedUpdates(testUser.ID, gomock.Any()).Times(1).Return(updates, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/users/abc/atom", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			items, err := feed.Parse(res.Body)
+			require.NoError(t, err)
+			assert.Len(t, items, 1)
+		})
+		t.Run("UserBadToken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetUserByFeedToken(auth.HashToken("abc")).Times(1).Return(store.User{}, sql.ErrNoRows)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/feeds/users/abc/atom", nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+		for name, tc := range map[string]struct {
+			tokenHash string
+			expected  bool
+		}{
+			"FeedStatusNoToken":  {"", false},
+			"FeedStatusHasToken": {auth.HashToken("abc"), true},
+		} {
+			tc := tc
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				p := setup(t)
+				p.Store.EXPECT().GetFeedToken(testUser.ID).Times(1).Return(tc.tokenHash, nil)
+				res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/me/feed", nil, loginAs(p, testUser))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				var got api.FeedStatusResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, tc.expected, got.Data.HasToken)
+			})
+		}
+		t.Run("FeedURLsExistingToken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetFeedToken(testUser.ID).Times(1).Return(auth.HashToken("abc"), nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/me/feed", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			var got api.FeedURLsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data.Token)
+			assert.Empty(t, got.Data.Atom)
+			assert.NotEmpty(t, got.Error)
+		})
+		t.Run("FeedURLsCreateToken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			var stored string
+			p.Store.EXPECT().GetFeedToken(testUser.ID).Times(1).Return("", nil)
+			p.Store.EXPECT().SetFeedToken(testUser.ID, gomock.Any()).Times(1).DoAndReturn(func(_ store.UserID, tokenHash string) error {
+				stored = tokenHash
+				return nil
+			})
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/me/feed", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.FeedURLsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			require.NotEmpty(t, got.Data.Token)
+			assert.Equal(t, auth.HashToken(got.Data.Token), stored, "only the hash of the token is stored")
+			assert.Equal(t, p.Srv.URL+"/api/feeds/users/"+got.Data.Token+"/atom", got.Data.Atom)
+			assert.Equal(t, p.Srv.URL+"/api/feeds/users/"+got.Data.Token+"/rss", got.Data.RSS)
+		})
+		t.Run("ResetToken", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().SetFeedToken(testUser.ID, gomock.Any()).Times(1).Return(nil)
+			res := doJSON(t, p.Client, http.MethodPost, p.Srv.URL+"/api/me/feed/reset", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+	})
+	t.Run("redirect", func(t *testing.T) {
+		t.Parallel()
+		noFollow := func(p params) *http.Client {
+			c := *p.Client
+			c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+			return &c
+		}
+		for name, tc := range map[string]struct {
+			forwardedFor []string
+			expected     string
+		}{
+			"Direct":         {nil, "127.0.0.1"},
+			"Proxied":        {[]string{"203.0.113.9"}, "203.0.113.9"},
+			"SpoofedHop":     {[]string{"198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+			"TrustedHops":    {[]string{"203.0.113.9", "127.0.0.1"}, "203.0.113.9"},
+			"InvalidHop":     {[]string{"203.0.113.9, bogus"}, "127.0.0.1"},
+			"AllTrustedHops": {[]string{"127.0.0.1"}, "127.0.0.1"},
+		} {
+			tc := tc
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				p := setup(t)
+				p.Store.EXPECT().Redirect(store.SiteUpdateID(5)).Times(1).Return("https://example.com/5", nil)
+				res := doJSON(t, noFollow(p), http.MethodGet, p.Srv.URL+"/r/5", nil, func(r *http.Request) {
+					for _, v := range tc.forwardedFor {
+						r.Header.Add("X-Forwarded-For", v)
+					}
+				})
+				require.Equal(t, http.StatusFound, res.StatusCode)
+				assert.Equal(t, "https://example.com/5", res.Header.Get("Location"))
+				assert.Equal(t, []store.SiteUpdateID{5}, p.Clicks.ids)
+				assert.Equal(t, []string{tc.expected}, p.Clicks.addrs)
+			})
+		}
+		t.Run("NotFound", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().Redirect(store.SiteUpdateID(5)).Times(1).Return("", sql.ErrNoRows)
+			res := doJSON(t, noFollow(p), http.MethodGet, p.Srv.URL+"/r/5", nil)
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+			assert.Empty(t, p.Clicks.ids)
+		})
+		for name, tc := range map[string]struct {
+			method string
+			header string
+			value  string
+		}{
+			"Head":           {http.MethodHead, "", ""},
+			"SecPurpose":     {http.MethodGet, "Sec-Purpose", "prefetch"},
+			"Purpose":        {http.MethodGet, "Purpose", "prefetch"},
+			"MozPrefetch":    {http.MethodGet, "X-Moz", "prefetch"},
+			"PurposePreview": {http.MethodGet, "X-Purpose", "preview"},
+		} {
+			tc := tc
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				p := setup(t)
+				p.Store.EXPECT().Redirect(store.SiteUpdateID(5)).Times(1).Return("https://example.com/5", nil)
+				res := doJSON(t, noFollow(p), tc.method, p.Srv.URL+"/r/5", nil, func(r *http.Request) {
+					if tc.header != "" {
+						r.Header.Set(tc.header, tc.value)
+					}
+				})
+				require.Equal(t, http.StatusFound, res.StatusCode)
+				assert.Equal(t, "https://example.com/5", res.Header.Get("Location"))
+				assert.Empty(t, p.Clicks.ids, "prefetches should not count as clicks")
+			})
+		}
+	})
+	t.Run("api/comics/popular", func(t *testing.T) {
+		t.Parallel()
+		t.Run("OK", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			comics := []store.Comic{{ID: 1, Name: "Test Comic"}}
+			p.Store.EXPECT().GetPopularComics(gomock.Any()).Times(1).Return(comics, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/comics/?sort=popular&days=30", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var list api.ListComicsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+			assert.Equal(t, comics, list.Data)
+		})
+		t.Run("BadDays", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/comics/?sort=popular&days=0", nil)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("BadSort", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/comics/?sort=random", nil)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+	t.Run("api/admin/stats", func(t *testing.T) {
+		t.Parallel()
+		t.Run("SiteDefs", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			stats := []store.SiteDefClicks{{SiteDefID: 1, Name: "Test Comic", Clicks: 3}}
+			before := time.Now().AddDate(0, 0, -7)
+			p.Store.EXPECT().GetSiteDefClicks(gomock.Any(), 10).Times(1).DoAndReturn(func(since time.Time, _ int) ([]store.SiteDefClicks, error) {
+				assert.WithinDuration(t, before, since, time.Minute)
+				return stats, nil
+			})
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteDefClicksResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, stats, got.Data)
+		})
+		t.Run("SiteDefsErr", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			testErr := errors.New("test error")
+			p.Store.EXPECT().GetSiteDefClicks(gomock.Any(), 5).Times(1).Return(nil, testErr)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs?limit=5", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+			var got api.SiteDefClicksResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Empty(t, got.Data)
+			assert.EqualError(t, testErr, got.Error)
+		})
+		t.Run("BadLimit", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs?limit=1000", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Forbidden", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs", nil, loginAs(p, testUser))
+			require.Equal(t, http.StatusForbidden, res.StatusCode)
+		})
+		t.Run("Updates", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			stats := []store.SiteUpdateClicks{{ID: 5, SiteDefID: 1, Name: "Test Comic", Title: "Five", Clicks: 2}}
+			p.Store.EXPECT().GetSiteUpdateClicks(gomock.Any(), 10).Times(1).Return(stats, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/updates", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.SiteUpdateClicksResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, stats, got.Data)
+		})
+		t.Run("Series", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			series := []store.ClickBucket{{Start: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Clicks: 4}}
+			p.Store.EXPECT().GetSiteDefClickSeries(store.SiteDefID(1), store.ClickBucketHour, gomock.Any()).Times(1).Return(series, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs/1?bucket=hour&days=2", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.ClickSeriesResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, series, got.Data)
+		})
+		t.Run("SeriesDefaultBucket", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			p.Store.EXPECT().GetSiteDefClickSeries(store.SiteDefID(1), store.ClickBucketDay, gomock.Any()).Times(1).Return(nil, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs/1", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		})
+		t.Run("SeriesBadBucket", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/sitedefs/1?bucket=minute", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+		t.Run("Countries", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			stats := []store.LocationClicks{{Country: "IE", Clicks: 5}}
+			p.Store.EXPECT().GetCountryClicks(gomock.Any(), 10).Times(1).Return(stats, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/countries", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.LocationClicksResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, stats, got.Data)
+		})
+		t.Run("Regions", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			stats := []store.LocationClicks{{Country: "IE", Region: "L", Clicks: 5}}
+			p.Store.EXPECT().GetRegionClicks(gomock.Any(), 10).Times(1).Return(stats, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/regions", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.LocationClicksResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, stats, got.Data)
+		})
+		t.Run("Trending", func(t *testing.T) {
+			t.Parallel()
+			p := setup(t)
+			stats := []store.TrendingComic{{SiteDefID: 1, Name: "Test Comic", Clicks: 7, PreviousClicks: 2}}
+			p.Store.EXPECT().GetTrendingComics(gomock.Any(), 3).Times(1).Return(stats, nil)
+			res := doJSON(t, p.Client, http.MethodGet, p.Srv.URL+"/api/admin/stats/trending?days=1&limit=3", nil, loginAs(p, testAdmin))
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var got api.TrendingComicsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, stats, got.Data)
+		})
+	})
 }
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/auth"
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+const (
+	// SessionCookieName is the name of the cookie holding the session token
+	SessionCookieName = "freshcomics_session"
+	// SessionTTL is how long a session remains valid after login
+	SessionTTL = 30 * 24 * time.Hour
+	// maxUserNameLength is the maximum accepted length of a user name
+	maxUserNameLength = 64
+)
+
+type ctxKey int
+
+const userCtxKey ctxKey = iota
+
+type Credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type UserResponse struct {
+	Data  store.User `json:"data"`
+	Error string     `json:"error"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// userFromContext returns the logged in User stored in ctx by requireUser
+func userFromContext(ctx context.Context) (store.User, bool) {
+	u, ok := ctx.Value(userCtxKey).(store.User)
+	return u, ok
+}
+
+// requireUser only calls next if the request carries a valid session cookie.
+// The logged in User is available to next via userFromContext.
+func (h *handler) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := h.sessionUser(r)
+		if err != nil {
+			h.writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "login required"}, "requireUser")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userCtxKey, u)))
+	}
+}
+
+// requireAdmin only calls next if the request carries a valid session cookie for an admin User
+func (h *handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireUser(func(w http.ResponseWriter, r *http.Request) {
+		if u, _ := userFromContext(r.Context()); u.Role != store.RoleAdmin {
+			h.writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "admin role required"}, "requireAdmin")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (h *handler) sessionUser(r *http.Request) (store.User, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return store.User{}, err
+	}
+
+	u, err := h.store.GetSessionUser(auth.HashToken(cookie.Value))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.log.Error("get session user", "err", err)
+		}
+		return store.User{}, err
+	}
+
+	return u, nil
+}
+
+func (h *handler) register(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, UserResponse{Error: "invalid request body"}, "register")
+		return
+	}
+
+	creds.Name = strings.TrimSpace(creds.Name)
+	if creds.Name == "" || len(creds.Name) > maxUserNameLength {
+		h.writeJSON(w, http.StatusBadRequest, UserResponse{Error: "invalid user name"}, "register")
+		return
+	}
+
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, UserResponse{Error: err.Error()}, "register")
+		return
+	}
+
+	u := store.User{
+		Name:         creds.Name,
+		PasswordHash: hash,
+		Role:         store.RoleUser,
+		CreatedAt:    time.Now(),
+	}
+	id, err := h.store.CreateUser(u)
+	if errors.Is(err, store.ErrUserNameTaken) {
+		h.writeJSON(w, http.StatusConflict, UserResponse{Error: err.Error()}, "register")
+		return
+	} else if err != nil {
+		h.log.Error("create user", "err", err, "handler", "register")
+		h.writeJSON(w, http.StatusInternalServerError, UserResponse{Error: err.Error()}, "register")
+		return
+	}
+	u.ID = id
+
+	if err := h.startSession(w, r, u); err != nil {
+		h.writeJSON(w, http.StatusInternalServerError, UserResponse{Error: err.Error()}, "register")
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, UserResponse{Data: u}, "register")
+}
+
+func (h *handler) login(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, UserResponse{Error: "invalid request body"}, "login")
+		return
+	}
+
+	u, err := h.store.GetUserByName(strings.TrimSpace(creds.Name))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.log.Error("get user by name", "err", err, "handler", "login")
+		h.writeJSON(w, http.StatusInternalServerError, UserResponse{Error: err.Error()}, "login")
+		return
+	}
+
+	if err != nil || auth.CheckPassword(u.PasswordHash, creds.Password) != nil {
+		h.writeJSON(w, http.StatusUnauthorized, UserResponse{Error: "invalid name or password"}, "login")
+		return
+	}
+
+	if err := h.startSession(w, r, u); err != nil {
+		h.writeJSON(w, http.StatusInternalServerError, UserResponse{Error: err.Error()}, "login")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, UserResponse{Data: u}, "login")
+}
+
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if err := h.store.DeleteSession(auth.HashToken(cookie.Value)); err != nil {
+			h.log.Error("delete session", "err", err, "handler", "logout")
+			h.writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()}, "logout")
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	h.writeJSON(w, http.StatusOK, ErrorResponse{}, "logout")
+}
+
+func (h *handler) whoami(w http.ResponseWriter, r *http.Request) {
+	u, _ := userFromContext(r.Context())
+	h.writeJSON(w, http.StatusOK, UserResponse{Data: u}, "whoami")
+}
+
+// startSession persists a new Session for the given User and sets the session cookie
+func (h *handler) startSession(w http.ResponseWriter, r *http.Request, u store.User) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		h.log.Error("new session token", "err", err)
+		return err
+	}
+
+	now := time.Now()
+	sess := store.Session{
+		TokenHash: auth.HashToken(token),
+		UserID:    u.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(SessionTTL),
+	}
+	if err := h.store.CreateSession(sess); err != nil {
+		h.log.Error("create session", "err", err, "user_id", u.ID)
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/auth"
+	"github.com/johnstcn/freshcomics/internal/feed"
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+// feedLimit is the maximum number of entries in a published feed
+const feedLimit = 50
+
+// feedFormats maps the format path parameter of the feed endpoints to a writer and content type
+var feedFormats = map[string]struct {
+	write       func(io.Writer, feed.Feed) error
+	contentType string
+}{
+	"atom": {feed.WriteAtom, "application/atom+xml; charset=utf-8"},
+	"rss":  {feed.WriteRSS, "application/rss+xml; charset=utf-8"},
+}
+
+// FeedURLs are the URLs of the personal feeds of a User
+type FeedURLs struct {
+	Token string `json:"token"`
+	Atom  string `json:"atom"`
+	RSS   string `json:"rss"`
+}
+
+type FeedURLsResponse struct {
+	Data  FeedURLs `json:"data"`
+	Error string   `json:"error"`
+}
+
+// FeedStatus tells whether a User has a feed token
+type FeedStatus struct {
+	HasToken bool `json:"has_token"`
+}
+
+type FeedStatusResponse struct {
+	Data  FeedStatus `json:"data"`
+	Error string     `json:"error"`
+}
+
+func (h *handler) allFeed(w http.ResponseWriter, r *http.Request) {
+	updates, err := h.store.GetRecentUpdates(feedLimit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "allFeed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.serveFeed(w, r, "FreshComics", updates, true)
+}
+
+func (h *handler) siteDefFeed(w http.ResponseWriter, r *http.Request) {
+	var def store.SiteDef
+	code, err := h.lookupSiteDef(r, &def)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	updates, err := h.store.GetSiteDefUpdates(def.ID, feedLimit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "siteDefFeed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.serveFeed(w, r, def.Name+" - FreshComics", updates, false)
+}
+
+// userFeed serves the subscribed comics of the User identified by the token path parameter.
+// Feed readers can't log in, so the token in the URL takes the place of the session cookie.
+func (h *handler) userFeed(w http.ResponseWriter, r *http.Request) {
+	u, err := h.store.GetUserByFeedToken(auth.HashToken(r.PathValue("token")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		h.log.Error("get user by feed token", "err", err, "handler", "userFeed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	updates, err := h.store.GetSubscribedUpdates(u.ID, feedLimit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "userFeed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.serveFeed(w, r, u.Name+"'s FreshComics", updates, true)
+}
+
+// serveFeed writes updates as a feed in the format given by the format path parameter.
+// If withName is true, entry titles are prefixed with the name of the SiteDef.
+func (h *handler) serveFeed(w http.ResponseWriter, r *http.Request, title string, updates []store.ComicUpdate, withName bool) {
+	format, ok := feedFormats[r.PathValue("format")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	base := h.baseURL(r)
+	f := feed.Feed{
+		Title:   title,
+		Link:    base + "/",
+		Self:    base + r.URL.Path,
+		ID:      base + r.URL.Path,
+		Author:  "FreshComics",
+		Updated: time.Unix(0, 0).UTC(),
+		Items:   make([]feed.Item, 0, len(updates)),
+	}
+	if len(updates) > 0 {
+		f.Updated = updates[0].SeenAt
+	}
+	for _, u := range updates {
+		itemTitle := u.Title
+		if withName {
+			itemTitle = u.Name + ": " + u.Title
+		}
+		published := u.SeenAt
+		if u.PublishedAt != nil {
+			published = *u.PublishedAt
+		}
+		f.Items = append(f.Items, feed.Item{
+			Title:     itemTitle,
+			Link:      fmt.Sprintf("%s/r/%d", base, u.ID),
+			ID:        fmt.Sprintf("urn:freshcomics:update:%d", u.ID),
+			Published: published,
+			Content:   feedItemContent(u),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := format.write(&buf, f); err != nil {
+		h.log.Error("write feed", "err", err, "handler", "serveFeed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(buf.Bytes()))
+}
+
+// feedItemContent returns the images of the given update as HTML, with its alt text as their alt and title
+// so that feed readers show it on hover, or the alt text alone if there are no images
+func feedItemContent(u store.ComicUpdate) string {
+	alt := html.EscapeString(u.AltText)
+	if len(u.ImageURLs) == 0 {
+		if alt == "" {
+			return ""
+		}
+		return "<p>" + alt + "</p>"
+	}
+
+	var b strings.Builder
+	for _, src := range u.ImageURLs {
+		fmt.Fprintf(&b, `<p><img src="%s" alt="%s" title="%s"></p>`, html.EscapeString(src), alt, alt)
+	}
+	return b.String()
+}
+
+// getFeedStatus reports whether the logged in User has a feed token. Only hashes of feed tokens
+// are persisted, so the feed URLs are only returned when the token is created or reset.
+func (h *handler) getFeedStatus(w http.ResponseWriter, r *http.Request) {
+	u, _ := userFromContext(r.Context())
+	tokenHash, err := h.store.GetFeedToken(u.ID)
+	if err != nil {
+		h.log.Error("get feed token", "err", err, "handler", "getFeedStatus")
+		h.writeJSON(w, http.StatusInternalServerError, FeedStatusResponse{Error: err.Error()}, "getFeedStatus")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, FeedStatusResponse{Data: FeedStatus{HasToken: tokenHash != ""}}, "getFeedStatus")
+}
+
+// createFeedToken creates a feed token for the logged in User and returns its feed URLs.
+// A User who already has one must reset it instead, so existing feed URLs aren't invalidated by accident.
+func (h *handler) createFeedToken(w http.ResponseWriter, r *http.Request) {
+	u, _ := userFromContext(r.Context())
+	tokenHash, err := h.store.GetFeedToken(u.ID)
+	if err != nil {
+		h.log.Error("get feed token", "err", err, "handler", "createFeedToken")
+		h.writeJSON(w, http.StatusInternalServerError, FeedURLsResponse{Error: err.Error()}, "createFeedToken")
+		return
+	}
+	if tokenHash != "" {
+		h.writeJSON(w, http.StatusConflict, FeedURLsResponse{Error: "feed token already created, reset it for new feed urls"}, "createFeedToken")
+		return
+	}
+
+	h.resetFeedToken(w, r)
+}
+
+// resetFeedToken replaces the feed token of the logged in User, invalidating the previous feed URLs
+func (h *handler) resetFeedToken(w http.ResponseWriter, r *http.Request) {
+	u, _ := userFromContext(r.Context())
+	token, err := auth.NewToken()
+	if err != nil {
+		h.log.Error("generate feed token", "err", err, "handler", "resetFeedToken")
+		h.writeJSON(w, http.StatusInternalServerError, FeedURLsResponse{Error: err.Error()}, "resetFeedToken")
+		return
+	}
+	if err := h.store.SetFeedToken(u.ID, auth.HashToken(token)); err != nil {
+		h.log.Error("set feed token", "err", err, "handler", "resetFeedToken")
+		h.writeJSON(w, http.StatusInternalServerError, FeedURLsResponse{Error: err.Error()}, "resetFeedToken")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, FeedURLsResponse{Data: h.feedURLs(r, token)}, "resetFeedToken")
+}
+
+func (h *handler) feedURLs(r *http.Request, token string) FeedURLs {
+	prefix := h.baseURL(r) + "/api/feeds/users/" + token
+	return FeedURLs{
+		Token: token,
+		Atom:  prefix + "/atom",
+		RSS:   prefix + "/rss",
+	}
+}
+
+// baseURL returns the configured public URL of the server, or guesses it from r
+func (h *handler) baseURL(r *http.Request) string {
+	if h.publicURL != "" {
+		return strings.TrimSuffix(h.publicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
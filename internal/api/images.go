@@ -0,0 +1,89 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+type ListUpdateImagesResponse struct {
+	Data  []store.UpdateImage `json:"data"`
+	Error string              `json:"error"`
+}
+
+// listUpdateImages returns the archived images of the SiteUpdate given by the id path parameter.
+// Each is served from /images/{hash}.
+func (h *handler) listUpdateImages(w http.ResponseWriter, r *http.Request) {
+	resp := ListUpdateImagesResponse{Data: []store.UpdateImage{}}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		resp.Error = "invalid update id"
+		h.writeJSON(w, http.StatusBadRequest, resp, "listUpdateImages")
+		return
+	}
+
+	images, err := h.store.GetUpdateImages(store.SiteUpdateID(id))
+	if err != nil {
+		h.log.Error("get update images", "err", err, "handler", "listUpdateImages")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "listUpdateImages")
+		return
+	}
+
+	resp.Data = images
+	h.writeJSON(w, http.StatusOK, resp, "listUpdateImages")
+}
+
+// serveImage serves the archived image whose hash is given by the hash path parameter. Archived
+// images never change, so they may be cached for good.
+func (h *handler) serveImage(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if h.images == nil || !blob.ValidKey(hash) {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"` + hash + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := h.store.GetUpdateImageByHash(hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		h.log.Error("get update image", "err", err, "handler", "serveImage")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rc, err := h.images.Open(r.Context(), hash)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		h.log.Error("open image", "err", err, "handler", "serveImage")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", img.MIMEType)
+	w.Header().Set("Content-Length", strconv.FormatInt(img.Size, 10))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		h.log.Error("write image", "err", err, "handler", "serveImage")
+	}
+}
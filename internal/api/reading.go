@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+type ListSubscriptionsResponse struct {
+	Data  []store.SiteDefID `json:"data"`
+	Error string            `json:"error"`
+}
+
+type ListUnreadComicsResponse struct {
+	Data  []store.UnreadComic `json:"data"`
+	Error string              `json:"error"`
+}
+
+func (h *handler) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	resp := ListSubscriptionsResponse{
+		Data:  []store.SiteDefID{},
+		Error: "",
+	}
+	code := http.StatusOK
+	u, _ := userFromContext(r.Context())
+	data, err := h.store.GetSubscriptions(u.ID)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "listSubscriptions")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "listSubscriptions")
+}
+
+func (h *handler) subscribe(w http.ResponseWriter, r *http.Request) {
+	var def store.SiteDef
+	code, err := h.lookupSiteDef(r, &def)
+	if err != nil {
+		h.writeJSON(w, code, ErrorResponse{Error: err.Error()}, "subscribe")
+		return
+	}
+
+	u, _ := userFromContext(r.Context())
+	if err := h.store.Subscribe(u.ID, def.ID); err != nil {
+		h.log.Error("subscribe", "err", err, "handler", "subscribe")
+		h.writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()}, "subscribe")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, ErrorResponse{}, "subscribe")
+}
+
+func (h *handler) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid site def id"}, "unsubscribe")
+		return
+	}
+
+	u, _ := userFromContext(r.Context())
+	if err := h.store.Unsubscribe(u.ID, store.SiteDefID(id)); err != nil {
+		h.log.Error("unsubscribe", "err", err, "handler", "unsubscribe")
+		h.writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()}, "unsubscribe")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, ErrorResponse{}, "unsubscribe")
+}
+
+// markRead marks the SiteUpdate identified by the id path parameter as read. If through is true,
+// all earlier SiteUpdates of the same SiteDef are marked as read too.
+func (h *handler) markRead(through bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			h.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid site update id"}, "markRead")
+			return
+		}
+
+		u, _ := userFromContext(r.Context())
+		if through {
+			err = h.store.MarkReadThrough(u.ID, store.SiteUpdateID(id))
+		} else {
+			err = h.store.MarkRead(u.ID, store.SiteUpdateID(id))
+		}
+		if err != nil {
+			h.log.Error("mark read", "err", err, "handler", "markRead", "through", through)
+			h.writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()}, "markRead")
+			return
+		}
+
+		h.writeJSON(w, http.StatusOK, ErrorResponse{}, "markRead")
+	}
+}
+
+func (h *handler) listUnreadComics(w http.ResponseWriter, r *http.Request) {
+	resp := ListUnreadComicsResponse{
+		Data:  []store.UnreadComic{},
+		Error: "",
+	}
+	code := http.StatusOK
+	u, _ := userFromContext(r.Context())
+	data, err := h.store.GetUnreadComics(u.ID)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "listUnreadComics")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "listUnreadComics")
+}
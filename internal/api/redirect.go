@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+// ClickRecorder records clicks on SiteUpdates without blocking the caller
+type ClickRecorder interface {
+	Record(id store.SiteUpdateID, addr net.IP) bool
+}
+
+// redirect sends the client to the URL of the SiteUpdate given by the id path parameter,
+// recording the click if a ClickRecorder is configured. HEAD and prefetch requests, as sent by
+// feed readers checking or preloading entry links, are not clicks and aren't recorded.
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	target, err := h.store.Redirect(store.SiteUpdateID(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		h.log.Error("get redirect url", "err", err, "handler", "redirect")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if h.clicks != nil && !isPrefetch(r) {
+		if addr := clientIP(r, h.trustedProxies); addr != nil {
+			h.clicks.Record(store.SiteUpdateID(id), addr)
+		}
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// isPrefetch reports whether r was sent without a user following the link
+func isPrefetch(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+	for _, header := range []string{"Sec-Purpose", "Purpose", "X-Moz", "X-Purpose"} {
+		v := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent r. X-Forwarded-For is only
+// believed when the request came from one of the trusted proxies, in which case the
+// rightmost address not belonging to a trusted proxy is the client.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr := net.ParseIP(host)
+	if addr == nil || !isTrusted(addr, trusted) {
+		return addr
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		addr = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return addr
+}
+
+func isTrusted(addr net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr := net.ParseIP(field)
+			if addr == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", field)
+			}
+			bits := 8 * net.IPv6len
+			if addr.To4() != nil {
+				addr, bits = addr.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: addr, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
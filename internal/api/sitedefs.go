@@ -0,0 +1,366 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/johnstcn/freshcomics/pkg/crawld"
+)
+
+type ListSiteDefsResponse struct {
+	Data  []store.SiteDef `json:"data"`
+	Error string          `json:"error"`
+}
+
+type SiteDefResponse struct {
+	Data  store.SiteDef `json:"data"`
+	Error string        `json:"error"`
+}
+
+type CrawlSiteDefResponse struct {
+	Data  store.CrawlInfoID `json:"data"`
+	Error string            `json:"error"`
+}
+
+type BackfillResponse struct {
+	Data  store.Backfill `json:"data"`
+	Error string         `json:"error"`
+}
+
+type PreviewSiteDefResponse struct {
+	Data  []crawld.PreviewPage `json:"data"`
+	Error string               `json:"error"`
+}
+
+func (h *handler) listSiteDefs(w http.ResponseWriter, r *http.Request) {
+	resp := ListSiteDefsResponse{
+		Data:  []store.SiteDef{},
+		Error: "",
+	}
+	code := http.StatusOK
+	data, err := h.store.GetSiteDefs(true)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "listSiteDefs")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "listSiteDefs")
+}
+
+func (h *handler) getSiteDef(w http.ResponseWriter, r *http.Request) {
+	var resp SiteDefResponse
+	code, err := h.lookupSiteDef(r, &resp.Data)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	h.writeJSON(w, code, resp, "getSiteDef")
+}
+
+func (h *handler) createSiteDef(w http.ResponseWriter, r *http.Request) {
+	var resp SiteDefResponse
+	code := http.StatusCreated
+	def, err := decodeSiteDef(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "createSiteDef")
+		return
+	}
+
+	def.ID = 0
+	def.BrokenReason = ""
+	id, err := h.store.CreateSiteDef(def)
+	if err != nil {
+		h.log.Error("create site def", "err", err, "handler", "createSiteDef")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		def.ID = id
+		resp.Data = def
+	}
+
+	h.writeJSON(w, code, resp, "createSiteDef")
+}
+
+func (h *handler) updateSiteDef(w http.ResponseWriter, r *http.Request) {
+	var resp SiteDefResponse
+	var existing store.SiteDef
+	code, err := h.lookupSiteDef(r, &existing)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, code, resp, "updateSiteDef")
+		return
+	}
+
+	def, err := decodeSiteDef(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "updateSiteDef")
+		return
+	}
+
+	def.ID = existing.ID
+	def.BrokenReason = brokenReason(existing, def.Active)
+	if err := h.store.UpdateSiteDef(def); err != nil {
+		h.log.Error("update site def", "err", err, "handler", "updateSiteDef")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = def
+	}
+
+	h.writeJSON(w, code, resp, "updateSiteDef")
+}
+
+func (h *handler) setSiteDefActive(active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var resp SiteDefResponse
+		code, err := h.lookupSiteDef(r, &resp.Data)
+		if err != nil {
+			resp.Error = err.Error()
+			h.writeJSON(w, code, resp, "setSiteDefActive")
+			return
+		}
+
+		resp.Data.BrokenReason = brokenReason(resp.Data, active)
+		resp.Data.Active = active
+		if err := h.store.UpdateSiteDef(resp.Data); err != nil {
+			h.log.Error("update site def", "err", err, "handler", "setSiteDefActive")
+			code = http.StatusInternalServerError
+			resp.Data = store.SiteDef{}
+			resp.Error = err.Error()
+		}
+
+		h.writeJSON(w, code, resp, "setSiteDefActive")
+	}
+}
+
+// brokenReason returns the BrokenReason the given SiteDef keeps once its active flag is set. Only crawld
+// marks SiteDefs broken, and an admin activating one again is taken to mean it has been fixed.
+func brokenReason(def store.SiteDef, active bool) string {
+	if active {
+		return ""
+	}
+	return def.BrokenReason
+}
+
+// crawlSiteDef enqueues a crawl of the SiteDef right away, whatever its schedule, responding with the
+// id of the new CrawlInfo. Responds with 409 Conflict if the SiteDef already has a crawl pending or running.
+func (h *handler) crawlSiteDef(w http.ResponseWriter, r *http.Request) {
+	var resp CrawlSiteDefResponse
+	var def store.SiteDef
+	code, err := h.lookupSiteDef(r, &def)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, code, resp, "crawlSiteDef")
+		return
+	}
+
+	crawls, err := h.store.GetCrawlInfo(def.ID)
+	if err != nil {
+		h.log.Error("get crawl infos", "err", err, "handler", "crawlSiteDef")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "crawlSiteDef")
+		return
+	}
+	for _, ci := range crawls {
+		if !ci.EndedAt.Valid {
+			resp.Data = ci.ID
+			resp.Error = "crawl already in progress"
+			h.writeJSON(w, http.StatusConflict, resp, "crawlSiteDef")
+			return
+		}
+	}
+
+	crawlURL, err := crawld.CrawlURL(h.store, def)
+	if err != nil {
+		h.log.Error("get crawl url", "err", err, "handler", "crawlSiteDef")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "crawlSiteDef")
+		return
+	}
+
+	code = http.StatusAccepted
+	id, err := h.store.CreateCrawlInfo(def.ID, crawlURL)
+	if err != nil {
+		h.log.Error("create crawl info", "err", err, "handler", "crawlSiteDef")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = id
+	}
+
+	h.writeJSON(w, code, resp, "crawlSiteDef")
+}
+
+// backfillSiteDef enqueues a backfill of the SiteDef, which walks its archive backwards from its BackfillURL.
+// The number of pages to crawl may be given with the max_pages query parameter, otherwise the backfill goes
+// back until it finds a page seen before or runs out of pages. Responds with 409 Conflict if the SiteDef
+// already has a backfill pending or running, and 400 Bad Request if it has no previous page rule.
+func (h *handler) backfillSiteDef(w http.ResponseWriter, r *http.Request) {
+	var resp BackfillResponse
+	var def store.SiteDef
+	code, err := h.lookupSiteDef(r, &def)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, code, resp, "backfillSiteDef")
+		return
+	}
+
+	maxPages, err := intParam(r, "max_pages", 0, math.MaxInt32)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "backfillSiteDef")
+		return
+	}
+
+	existing, err := h.store.GetBackfill(def.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.log.Error("get backfill", "err", err, "handler", "backfillSiteDef")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "backfillSiteDef")
+		return
+	}
+	if err == nil && existing.EndedAt == nil {
+		resp.Data = existing
+		resp.Error = "backfill already in progress"
+		h.writeJSON(w, http.StatusConflict, resp, "backfillSiteDef")
+		return
+	}
+
+	b, err := crawld.NewBackfill(h.store, def, maxPages)
+	if errors.Is(err, crawld.ErrNoPrevPageRule) {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "backfillSiteDef")
+		return
+	}
+	if err != nil {
+		h.log.Error("new backfill", "err", err, "handler", "backfillSiteDef")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "backfillSiteDef")
+		return
+	}
+
+	if err := h.store.CreateBackfill(b); err != nil {
+		h.log.Error("create backfill", "err", err, "handler", "backfillSiteDef")
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusInternalServerError, resp, "backfillSiteDef")
+		return
+	}
+
+	code = http.StatusAccepted
+	resp.Data, err = h.store.GetBackfill(def.ID)
+	if err != nil {
+		h.log.Error("get backfill", "err", err, "handler", "backfillSiteDef")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	}
+
+	h.writeJSON(w, code, resp, "backfillSiteDef")
+}
+
+// getBackfill responds with the latest backfill of the SiteDef and its progress
+func (h *handler) getBackfill(w http.ResponseWriter, r *http.Request) {
+	var resp BackfillResponse
+	var def store.SiteDef
+	code, err := h.lookupSiteDef(r, &def)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, code, resp, "getBackfill")
+		return
+	}
+
+	resp.Data, err = h.store.GetBackfill(def.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		code = http.StatusNotFound
+		resp.Error = "backfill not found"
+	} else if err != nil {
+		h.log.Error("get backfill", "err", err, "handler", "getBackfill")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	}
+
+	h.writeJSON(w, code, resp, "getBackfill")
+}
+
+// previewSiteDef crawls the candidate SiteDef in the request body without persisting anything.
+// The number of pages to crawl may be given with the pages query parameter.
+func (h *handler) previewSiteDef(w http.ResponseWriter, r *http.Request) {
+	resp := PreviewSiteDefResponse{
+		Data:  []crawld.PreviewPage{},
+		Error: "",
+	}
+
+	pages, err := intParam(r, "pages", crawld.DefaultPreviewPages, crawld.MaxPreviewPages)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "previewSiteDef")
+		return
+	}
+
+	def, err := decodeSiteDef(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "previewSiteDef")
+		return
+	}
+
+	code := http.StatusOK
+	data, err := h.previewer.Preview(def, pages)
+	if err != nil {
+		h.log.Error("preview site def", "err", err, "handler", "previewSiteDef")
+		code = http.StatusBadGateway
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "previewSiteDef")
+}
+
+// lookupSiteDef fetches the SiteDef identified by the id path parameter of r into def,
+// returning the HTTP status code to respond with.
+func (h *handler) lookupSiteDef(r *http.Request, def *store.SiteDef) (int, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, errors.New("invalid site def id")
+	}
+
+	found, err := h.store.GetSiteDef(store.SiteDefID(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, errors.New("site def not found")
+	}
+	if err != nil {
+		h.log.Error("get site def", "err", err, "id", id)
+		return http.StatusInternalServerError, err
+	}
+
+	*def = found
+	return http.StatusOK, nil
+}
+
+// decodeSiteDef reads a SiteDef from the request body and validates it
+func decodeSiteDef(r *http.Request) (store.SiteDef, error) {
+	var def store.SiteDef
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		return store.SiteDef{}, errors.New("invalid request body")
+	}
+
+	if def.CrawlStrategy == "" {
+		def.CrawlStrategy = store.CrawlStrategyPage
+	}
+
+	if err := crawld.ValidateSiteDef(def); err != nil {
+		return store.SiteDef{}, err
+	}
+
+	return def, nil
+}
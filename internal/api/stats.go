@@ -0,0 +1,210 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+const (
+	// defaultStatsDays is the time window of click statistics if the days query parameter is not given
+	defaultStatsDays = 7
+	// maxStatsDays is the largest accepted time window of click statistics
+	maxStatsDays = 365
+	// defaultStatsLimit is the number of results returned if the limit query parameter is not given
+	defaultStatsLimit = 10
+	// maxStatsLimit is the largest accepted limit query parameter
+	maxStatsLimit = 100
+)
+
+type SiteDefClicksResponse struct {
+	Data  []store.SiteDefClicks `json:"data"`
+	Error string                `json:"error"`
+}
+
+type SiteUpdateClicksResponse struct {
+	Data  []store.SiteUpdateClicks `json:"data"`
+	Error string                   `json:"error"`
+}
+
+type ClickSeriesResponse struct {
+	Data  []store.ClickBucket `json:"data"`
+	Error string              `json:"error"`
+}
+
+type LocationClicksResponse struct {
+	Data  []store.LocationClicks `json:"data"`
+	Error string                 `json:"error"`
+}
+
+type TrendingComicsResponse struct {
+	Data  []store.TrendingComic `json:"data"`
+	Error string                `json:"error"`
+}
+
+func (h *handler) siteDefClicks(w http.ResponseWriter, r *http.Request) {
+	resp := SiteDefClicksResponse{
+		Data:  []store.SiteDefClicks{},
+		Error: "",
+	}
+	since, limit, err := statsParams(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "siteDefClicks")
+		return
+	}
+
+	code := http.StatusOK
+	data, err := h.store.GetSiteDefClicks(since, limit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "siteDefClicks")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "siteDefClicks")
+}
+
+func (h *handler) siteUpdateClicks(w http.ResponseWriter, r *http.Request) {
+	resp := SiteUpdateClicksResponse{
+		Data:  []store.SiteUpdateClicks{},
+		Error: "",
+	}
+	since, limit, err := statsParams(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "siteUpdateClicks")
+		return
+	}
+
+	code := http.StatusOK
+	data, err := h.store.GetSiteUpdateClicks(since, limit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "siteUpdateClicks")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "siteUpdateClicks")
+}
+
+// siteDefClickSeries returns the clicks on a single SiteDef over time. The bucket query
+// parameter is one of hour, day or week and defaults to day.
+func (h *handler) siteDefClickSeries(w http.ResponseWriter, r *http.Request) {
+	resp := ClickSeriesResponse{
+		Data:  []store.ClickBucket{},
+		Error: "",
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		resp.Error = "invalid site def id"
+		h.writeJSON(w, http.StatusBadRequest, resp, "siteDefClickSeries")
+		return
+	}
+	since, _, err := statsParams(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "siteDefClickSeries")
+		return
+	}
+	bucket := store.ClickBucketSize(r.URL.Query().Get("bucket"))
+	switch bucket {
+	case "":
+		bucket = store.ClickBucketDay
+	case store.ClickBucketHour, store.ClickBucketDay, store.ClickBucketWeek:
+	default:
+		resp.Error = fmt.Sprintf("invalid bucket %q", bucket)
+		h.writeJSON(w, http.StatusBadRequest, resp, "siteDefClickSeries")
+		return
+	}
+
+	code := http.StatusOK
+	data, err := h.store.GetSiteDefClickSeries(store.SiteDefID(id), bucket, since)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "siteDefClickSeries")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "siteDefClickSeries")
+}
+
+// locationClicks returns the countries or, if byRegion is true, the regions with the most clicks
+func (h *handler) locationClicks(byRegion bool) http.HandlerFunc {
+	get := h.store.GetCountryClicks
+	if byRegion {
+		get = h.store.GetRegionClicks
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := LocationClicksResponse{
+			Data:  []store.LocationClicks{},
+			Error: "",
+		}
+		since, limit, err := statsParams(r)
+		if err != nil {
+			resp.Error = err.Error()
+			h.writeJSON(w, http.StatusBadRequest, resp, "locationClicks")
+			return
+		}
+
+		code := http.StatusOK
+		data, err := get(since, limit)
+		if err != nil {
+			h.log.Error("get data from store", "err", err, "handler", "locationClicks", "by_region", byRegion)
+			code = http.StatusInternalServerError
+			resp.Error = err.Error()
+		} else {
+			resp.Data = data
+		}
+
+		h.writeJSON(w, code, resp, "locationClicks")
+	}
+}
+
+func (h *handler) trendingComics(w http.ResponseWriter, r *http.Request) {
+	resp := TrendingComicsResponse{
+		Data:  []store.TrendingComic{},
+		Error: "",
+	}
+	since, limit, err := statsParams(r)
+	if err != nil {
+		resp.Error = err.Error()
+		h.writeJSON(w, http.StatusBadRequest, resp, "trendingComics")
+		return
+	}
+
+	code := http.StatusOK
+	data, err := h.store.GetTrendingComics(since, limit)
+	if err != nil {
+		h.log.Error("get data from store", "err", err, "handler", "trendingComics")
+		code = http.StatusInternalServerError
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	h.writeJSON(w, code, resp, "trendingComics")
+}
+
+// statsParams returns the start of the time window given by the days query parameter
+// and the number of results given by the limit query parameter
+func statsParams(r *http.Request) (time.Time, int, error) {
+	days, err := intParam(r, "days", defaultStatsDays, maxStatsDays)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	limit, err := intParam(r, "limit", defaultStatsLimit, maxStatsLimit)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return time.Now().AddDate(0, 0, -days), limit, nil
+}
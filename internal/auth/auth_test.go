@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HashPassword_OK(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, "correct horse", hash)
+	assert.NoError(t, CheckPassword(hash, "correct horse"))
+	assert.Equal(t, ErrPasswordMismatch, CheckPassword(hash, "battery staple"))
+}
+
+func Test_HashPassword_TooShort(t *testing.T) {
+	_, err := HashPassword("short")
+	require.Equal(t, ErrPasswordTooShort, err)
+}
+
+func Test_CheckPassword_InvalidHash(t *testing.T) {
+	err := CheckPassword("not a hash", "correct horse")
+	require.Error(t, err)
+	require.NotEqual(t, ErrPasswordMismatch, err)
+}
+
+func Test_NewToken(t *testing.T) {
+	a, err := NewToken()
+	require.NoError(t, err)
+	b, err := NewToken()
+	require.NoError(t, err)
+	assert.Len(t, a, 64)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, HashToken(a), HashToken(a))
+	assert.NotEqual(t, a, HashToken(a))
+}
@@ -0,0 +1,65 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps immutable blobs, such as archived comic images, under the hex SHA-256 of their content
+// as returned by Key
+type Store interface {
+	// Put stores data under key, doing nothing if a blob with that key is already stored
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open returns the blob stored under key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists returns whether a blob is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+var keyExpr = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Key returns the key data is stored under: the hex SHA-256 of its content
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidKey returns whether key could have been returned by Key
+func ValidKey(key string) bool {
+	return keyExpr.MatchString(key)
+}
+
+type Args struct {
+	// Dir is the directory blobs are kept in if Endpoint is empty
+	Dir string
+	// Endpoint is the URL of an S3-compatible API, such as https://s3.eu-west-1.amazonaws.com or
+	// http://localhost:9000 for MinIO. Buckets are addressed by path.
+	Endpoint  string
+	Bucket    string
+	Region    string // defaults to us-east-1
+	AccessKey string
+	SecretKey string
+	// Client is used for requests to Endpoint, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// New returns a Store in the S3 bucket given by a, or in its Dir if a has no Endpoint
+func New(a *Args) (Store, error) {
+	if a.Endpoint != "" {
+		return newS3Store(a)
+	}
+	if a.Dir == "" {
+		return nil, errors.New("blob store needs a directory or an endpoint")
+	}
+	return newDirStore(a.Dir)
+}
@@ -0,0 +1,69 @@
+package clicks
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/exp/slog"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+)
+
+// DefaultQueueSize is the number of clicks a Recorder buffers before dropping new ones
+const DefaultQueueSize = 1024
+
+type click struct {
+	id   store.SiteUpdateID
+	addr net.IP
+}
+
+// Recorder persists clicks in the background so that redirects don't wait on the database
+type Recorder struct {
+	store store.ClickLogger
+	log   *slog.Logger
+	queue chan click
+	once  sync.Once
+	done  chan struct{}
+}
+
+// NewRecorder starts a Recorder writing clicks to s. At most queueSize clicks are buffered.
+func NewRecorder(s store.ClickLogger, log *slog.Logger, queueSize int) *Recorder {
+	r := &Recorder{
+		store: s,
+		log:   log,
+		queue: make(chan click, queueSize),
+		done:  make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues a click on the given SiteUpdate from addr. It never blocks; if the queue
+// is full the click is dropped and Record returns false.
+func (r *Recorder) Record(id store.SiteUpdateID, addr net.IP) bool {
+	select {
+	case r.queue <- click{id: id, addr: addr}:
+		return true
+	default:
+		r.log.Warn("click queue full, dropping click", "update_id", id)
+		return false
+	}
+}
+
+// Close stops accepting clicks and waits for queued clicks to be written.
+// Record must not be called after Close.
+func (r *Recorder) Close() {
+	r.once.Do(func() {
+		close(r.queue)
+	})
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for c := range r.queue {
+		if err := r.store.CreateClickLog(c.id, c.addr); err != nil {
+			r.log.Error("record click", "err", err, "update_id", c.id)
+		}
+	}
+}
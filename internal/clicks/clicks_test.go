@@ -0,0 +1,47 @@
+package clicks
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+	mock_store "github.com/johnstcn/freshcomics/internal/store/mocks"
+	"github.com/johnstcn/freshcomics/internal/testutil/slogtest"
+)
+
+func Test_Recorder(t *testing.T) {
+	t.Parallel()
+	addr := net.ParseIP("192.0.2.1")
+
+	t.Run("OK", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		s := mock_store.NewMockStore(ctrl)
+		s.EXPECT().CreateClickLog(store.SiteUpdateID(1), addr).Times(1).Return(nil)
+		s.EXPECT().CreateClickLog(store.SiteUpdateID(2), addr).Times(1).Return(errors.New("some error"))
+		r := NewRecorder(s, slogtest.New(t), DefaultQueueSize)
+		assert.True(t, r.Record(1, addr))
+		assert.True(t, r.Record(2, addr))
+		r.Close()
+		r.Close()
+	})
+
+	t.Run("QueueFull", func(t *testing.T) {
+		t.Parallel()
+		ctrl := gomock.NewController(t)
+		s := mock_store.NewMockStore(ctrl)
+		r := &Recorder{
+			store: s,
+			log:   slogtest.New(t),
+			queue: make(chan click, 1),
+			done:  make(chan struct{}),
+		}
+		assert.True(t, r.Record(1, addr))
+		assert.False(t, r.Record(2, addr))
+		assert.Len(t, r.queue, 1)
+	})
+}
@@ -0,0 +1,191 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownFormat = errors.New("unknown feed format")
+
+// Item is a single entry in an RSS or Atom feed
+type Item struct {
+	Title     string    // Title of the item
+	Link      string    // Link to the item
+	ID        string    // Unique identifier of the item, if present
+	Published time.Time // Publication time of the item, if present
+	Content   string    // HTML content of the item, if present
+}
+
+type rssDoc struct {
+	Items []rssItem `xml:"channel>item"`
+}
+
+type rdfDoc struct {
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+}
+
+type atomDoc struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   string     `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2006-01-02",
+}
+
+// Parse reads an RSS 2.0, RSS 1.0 or Atom feed and returns its items in document order
+func Parse(r io.Reader) ([]Item, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading feed")
+	}
+
+	root, err := rootName(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "rss":
+		var doc rssDoc
+		if err := unmarshal(data, &doc); err != nil {
+			return nil, errors.Wrap(err, "parsing rss")
+		}
+		return rssItems(doc.Items), nil
+	case "RDF":
+		var doc rdfDoc
+		if err := unmarshal(data, &doc); err != nil {
+			return nil, errors.Wrap(err, "parsing rdf")
+		}
+		return rssItems(doc.Items), nil
+	case "feed":
+		var doc atomDoc
+		if err := unmarshal(data, &doc); err != nil {
+			return nil, errors.Wrap(err, "parsing atom")
+		}
+		return atomItems(doc.Entries), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// newDecoder returns a lenient decoder, as feeds in the wild are frequently not well-formed
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return dec
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	return newDecoder(data).Decode(v)
+}
+
+func rootName(data []byte) (string, error) {
+	dec := newDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return "", ErrUnknownFormat
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "parsing feed")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func rssItems(in []rssItem) []Item {
+	items := make([]Item, 0, len(in))
+	for _, it := range in {
+		pub := it.PubDate
+		if pub == "" {
+			pub = it.Date
+		}
+		items = append(items, Item{
+			Title:     strings.TrimSpace(it.Title),
+			Link:      strings.TrimSpace(it.Link),
+			ID:        strings.TrimSpace(it.GUID),
+			Published: parseDate(pub),
+			Content:   strings.TrimSpace(it.Description),
+		})
+	}
+	return items
+}
+
+func atomItems(in []atomEntry) []Item {
+	items := make([]Item, 0, len(in))
+	for _, e := range in {
+		pub := e.Published
+		if pub == "" {
+			pub = e.Updated
+		}
+		items = append(items, Item{
+			Title:     strings.TrimSpace(e.Title),
+			Link:      atomLinkHref(e.Links),
+			ID:        strings.TrimSpace(e.ID),
+			Published: parseDate(pub),
+			Content:   strings.TrimSpace(e.Content),
+		})
+	}
+	return items
+}
+
+// atomLinkHref returns the alternate link of an entry, falling back to the first link
+func atomLinkHref(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+	return ""
+}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,128 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exampleRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>Example Comic</title>
+<item>
+  <title>Page 2</title>
+  <link>http://example.com/comic/2</link>
+  <guid>http://example.com/?p=2</guid>
+  <pubDate>Tue, 03 Jan 2006 15:04:05 +0000</pubDate>
+</item>
+<item>
+  <title> Page 1 </title>
+  <link>http://example.com/comic/1</link>
+</item>
+</channel>
+</rss>
+`
+
+var exampleAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Example Comic</title>
+<entry>
+  <title>Page 2</title>
+  <link rel="self" href="http://example.com/feed/2"/>
+  <link href="http://example.com/comic/2"/>
+  <id>urn:example:2</id>
+  <updated>2006-01-03T15:04:05Z</updated>
+</entry>
+</feed>
+`
+
+var exampleRDF = `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Example Comic</title></channel>
+<item>
+  <title>Page 1</title>
+  <link>http://example.com/comic/1</link>
+  <dc:date>2006-01-02T15:04:05Z</dc:date>
+</item>
+</rdf:RDF>
+`
+
+func Test_Parse_RSS(t *testing.T) {
+	items, err := Parse(strings.NewReader(exampleRSS))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "Page 2", items[0].Title)
+	assert.Equal(t, "http://example.com/comic/2", items[0].Link)
+	assert.Equal(t, "http://example.com/?p=2", items[0].ID)
+	assert.True(t, time.Date(2006, 1, 3, 15, 4, 5, 0, time.UTC).Equal(items[0].Published))
+	assert.Equal(t, "Page 1", items[1].Title)
+	assert.Zero(t, items[1].ID)
+	assert.Zero(t, items[1].Published)
+}
+
+func Test_Parse_Atom(t *testing.T) {
+	items, err := Parse(strings.NewReader(exampleAtom))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Page 2", items[0].Title)
+	assert.Equal(t, "http://example.com/comic/2", items[0].Link)
+	assert.Equal(t, "urn:example:2", items[0].ID)
+	assert.True(t, time.Date(2006, 1, 3, 15, 4, 5, 0, time.UTC).Equal(items[0].Published))
+}
+
+func Test_Parse_RDF(t *testing.T) {
+	items, err := Parse(strings.NewReader(exampleRDF))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "http://example.com/comic/1", items[0].Link)
+	assert.True(t, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Equal(items[0].Published))
+}
+
+func Test_Parse_UnknownFormat(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<html><body></body></html>`))
+	require.Equal(t, ErrUnknownFormat, err)
+}
+
+func Test_Parse_Empty(t *testing.T) {
+	_, err := Parse(strings.NewReader(``))
+	require.Equal(t, ErrUnknownFormat, err)
+}
+
+func Test_Write_RoundTrip(t *testing.T) {
+	published := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	f := Feed{
+		Title:   "Example & Friends",
+		Link:    "http://example.com/",
+		Self:    "http://example.com/feed",
+		ID:      "http://example.com/feed",
+		Author:  "freshcomics",
+		Updated: published,
+		Items: []Item{
+			{Title: "Page <1>", Link: "http://example.com/r/1", ID: "urn:example:1", Published: published,
+				Content: `<img src="http://example.com/1.png" alt="a &amp; b">`},
+			{Title: "Page 2", Link: "http://example.com/r/2", ID: "urn:example:2", Published: published},
+		},
+	}
+	for name, write := range map[string]func(*strings.Builder, Feed) error{
+		"Atom": func(b *strings.Builder, f Feed) error { return WriteAtom(b, f) },
+		"RSS":  func(b *strings.Builder, f Feed) error { return WriteRSS(b, f) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var b strings.Builder
+			require.NoError(t, write(&b, f))
+			items, err := Parse(strings.NewReader(b.String()))
+			require.NoError(t, err)
+			require.Len(t, items, 2)
+			assert.Equal(t, f.Items[0].Title, items[0].Title)
+			assert.Equal(t, f.Items[0].Link, items[0].Link)
+			assert.Equal(t, f.Items[0].ID, items[0].ID)
+			assert.True(t, f.Items[0].Published.Equal(items[0].Published))
+			assert.Equal(t, f.Items[0].Content, items[0].Content)
+			assert.Empty(t, items[1].Content)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+// Feed is a list of Items to be published as RSS or Atom
+type Feed struct {
+	Title   string    // Title of the feed
+	Link    string    // Link to the site the feed describes
+	Self    string    // URL the feed is served from
+	ID      string    // Unique identifier of the feed
+	Author  string    // Name of the feed author
+	Updated time.Time // Time the feed last changed
+	Items   []Item    // Items in the feed, newest first
+}
+
+type atomOutFeed struct {
+	XMLName xml.Name       `xml:"feed"`
+	NS      string         `xml:"xmlns,attr"`
+	Title   string         `xml:"title"`
+	ID      string         `xml:"id"`
+	Updated string         `xml:"updated"`
+	Author  atomOutAuthor  `xml:"author"`
+	Links   []atomOutLink  `xml:"link"`
+	Entries []atomOutEntry `xml:"entry"`
+}
+
+type atomOutAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomOutLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomOutEntry struct {
+	Title     string        `xml:"title"`
+	ID        string        `xml:"id"`
+	Links     []atomOutLink `xml:"link"`
+	Published string        `xml:"published"`
+	Updated   string        `xml:"updated"`
+	Content   *atomContent  `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type rssOutDoc struct {
+	XMLName xml.Name      `xml:"rss"`
+	Version string        `xml:"version,attr"`
+	NS      string        `xml:"xmlns:atom,attr"`
+	Channel rssOutChannel `xml:"channel"`
+}
+
+type rssOutChannel struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	Self          atomOutLink  `xml:"atom:link"`
+	Items         []rssOutItem `xml:"item"`
+}
+
+type rssOutItem struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	GUID        rssOutGUID `xml:"guid"`
+	PubDate     string     `xml:"pubDate"`
+	Description string     `xml:"description,omitempty"`
+}
+
+type rssOutGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// WriteAtom writes f to w as an Atom 1.0 document
+func WriteAtom(w io.Writer, f Feed) error {
+	doc := atomOutFeed{
+		NS:      atomNS,
+		Title:   f.Title,
+		ID:      f.ID,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  atomOutAuthor{Name: f.Author},
+		Links: []atomOutLink{
+			{Href: f.Link, Rel: "alternate"},
+			{Href: f.Self, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]atomOutEntry, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		ts := item.Published.UTC().Format(time.RFC3339)
+		entry := atomOutEntry{
+			Title:     item.Title,
+			ID:        item.ID,
+			Links:     []atomOutLink{{Href: item.Link, Rel: "alternate"}},
+			Published: ts,
+			Updated:   ts,
+		}
+		if item.Content != "" {
+			entry.Content = &atomContent{Type: "html", Value: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return encode(w, doc)
+}
+
+// WriteRSS writes f to w as an RSS 2.0 document
+func WriteRSS(w io.Writer, f Feed) error {
+	doc := rssOutDoc{
+		Version: "2.0",
+		NS:      atomNS,
+		Channel: rssOutChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Title,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomOutLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssOutItem, 0, len(f.Items)),
+		},
+	}
+	for _, item := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssOutItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssOutGUID{Value: item.ID},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Description: item.Content,
+		})
+	}
+	return encode(w, doc)
+}
+
+func encode(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
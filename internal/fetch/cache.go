@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context asking Fetch neither to make a conditional request nor to keep the
+// response for one, for large responses such as images that are only fetched once
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func withoutCache(ctx context.Context) bool {
+	skip, _ := ctx.Value(noCacheKey{}).(bool)
+	return skip
+}
+
+// cachedPage holds the validators and body of a page fetched before
+type cachedPage struct {
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// pageCache keeps the most recently fetched pages that had validators, so that they can be
+// fetched again with a conditional request. A pageCache with size 0 keeps nothing.
+type pageCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of cachedPage, most recently used first
+	entries map[string]*list.Element
+}
+
+func newPageCache(size int) *pageCache {
+	return &pageCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached page for the given URL, if any
+func (c *pageCache) get(url string) (cachedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[url]
+	if !found {
+		return cachedPage{}, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(cachedPage), true
+}
+
+// put caches the given page, evicting the least recently used page if the cache is full
+func (c *pageCache) put(p cachedPage) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.entries[p.url]; found {
+		e.Value = p
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[p.url] = c.lru.PushFront(p)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(cachedPage).url)
+	}
+}
+
+// remove drops the cached page for the given URL, if any
+func (c *pageCache) remove(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.entries[url]; found {
+		c.lru.Remove(e)
+		delete(c.entries, url)
+	}
+}
@@ -2,6 +2,7 @@ package fetch
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,8 +15,25 @@ import (
 type FetchedPage struct {
 	URL          string // URL fetched
 	ResponseCode int    // Response code returned
-	Body         []byte // Response body
+	Body         []byte // Response body, or the cached body if NotModified
 	Retries      int    // Number of retries
+	NotModified  bool   // Server responded 304 Not Modified to a conditional request
+}
+
+// ErrTooLarge is returned when a response body is longer than the limit given with WithMaxBytes
+var ErrTooLarge = errors.New("response too large")
+
+type maxBytesKey struct{}
+
+// WithMaxBytes returns a context asking Fetch to fail with ErrTooLarge rather than read more than n bytes
+// of a response body
+func WithMaxBytes(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, maxBytesKey{}, n)
+}
+
+func maxBytesFrom(ctx context.Context) int64 {
+	n, _ := ctx.Value(maxBytesKey{}).(int64)
+	return n
 }
 
 // Fetcher fetches a given URL
@@ -30,27 +48,74 @@ type pageFetcher struct {
 	client    *http.Client
 	retries   int
 	wait      time.Duration
+	maxWait   time.Duration
+	jitter    func(d time.Duration) time.Duration
 	after     func(d time.Duration) <-chan time.Time
 	userAgent string
 	log       *slog.Logger
+	cache     *pageCache
+	robots    *robotsCache // nil if robots.txt is ignored
+	throttle  *hostThrottle
+	hostDelay time.Duration
+	now       func() time.Time
 }
 
 type Args struct {
 	Client    *http.Client
 	UserAgent string
-	Retries   int
-	Wait      time.Duration
+	// Retries is how many times a request failing with a transport error, a 429 or a 5xx is retried
+	Retries int
+	// Wait is the wait before the first retry, doubling with each one after
+	Wait time.Duration
+	// MaxWait caps the wait between retries, DefaultMaxWait if zero. A request whose Retry-After
+	// is longer is not retried.
+	MaxWait time.Duration
+	// CacheSize is the number of pages whose ETag or Last-Modified validators and bodies are kept
+	// to be fetched again with conditional requests. Zero disables conditional requests.
+	CacheSize int
+	// Logger defaults to slog.Default()
+	Logger *slog.Logger
+	// HostDelay is the least time left between requests to the same host. A longer Crawl-delay in
+	// the host's robots.txt, or one given with WithHostDelay, takes precedence.
+	HostDelay time.Duration
+	// IgnoreRobots skips checking robots.txt before fetching
+	IgnoreRobots bool
+	// RobotsTTL is how long robots.txt files are cached for, DefaultRobotsTTL if zero
+	RobotsTTL time.Duration
 }
 
 // New returns a new PageFetcher
 func New(a *Args) Fetcher {
-	return &pageFetcher{
-		client:    a.Client,
+	log := a.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	maxWait := a.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	f := &pageFetcher{
+		client:    client,
 		retries:   a.Retries,
 		wait:      a.Wait,
+		maxWait:   maxWait,
+		jitter:    halfJitter,
 		userAgent: a.UserAgent,
 		after:     time.After,
+		log:       log,
+		cache:     newPageCache(a.CacheSize),
+		throttle:  newHostThrottle(),
+		hostDelay: a.HostDelay,
+		now:       time.Now,
 	}
+	if !a.IgnoreRobots {
+		f.robots = newRobotsCache(client, a.UserAgent, a.RobotsTTL)
+	}
+	return f
 }
 
 // Fetch fetches the given URL and returns a FetchedPage
@@ -64,41 +129,151 @@ func (f *pageFetcher) Fetch(ctx context.Context, url string) (FetchedPage, error
 	}
 	req.Header.Add("User-Agent", f.userAgent)
 
+	delay := max(f.hostDelay, hostDelayFrom(ctx))
+	if f.robots != nil {
+		rules, err := f.robots.rulesFor(ctx, req.URL, func() error {
+			return f.waitTurn(ctx, req.URL.Host, delay)
+		})
+		if err != nil {
+			return FetchedPage{}, err
+		}
+		if !rules.allowed(req.URL.RequestURI()) {
+			return FetchedPage{URL: url}, fmt.Errorf("%w: %s", ErrDisallowed, url)
+		}
+		delay = max(delay, min(rules.crawlDelay, maxCrawlDelay))
+	}
+
+	useCache := f.cache != nil && !withoutCache(ctx)
+	var cached cachedPage
+	var isCached bool
+	if useCache {
+		cached, isCached = f.cache.get(url)
+	}
+	if isCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
 	for {
-		select {
-		case <-ctx.Done():
-			return FetchedPage{}, ctx.Err()
-		default:
-			f.log.Debug("get", "retry", p.Retries, "max", f.retries, "url", url)
-			code, body, err := fetchOnce(f.client, req)
-			p.ResponseCode = code
-			p.Body = body
-			if err == nil {
-				return p, nil
+		if err := f.waitTurn(ctx, req.URL.Host, delay); err != nil {
+			return FetchedPage{}, err
+		}
+		f.log.Debug("get", "retry", p.Retries, "max", f.retries, "url", url)
+		code, header, body, err := fetchOnce(f.client, req, maxBytesFrom(ctx))
+		p.ResponseCode = code
+		p.Body = body
+		if err == nil && code >= 400 {
+			err = &HTTPError{
+				URL:        url,
+				StatusCode: code,
+				RetryAfter: parseRetryAfter(header.Get("Retry-After"), f.now()),
 			}
-			if p.Retries >= f.retries {
-				f.log.Error("get failed after retry", "retries", f.retries, "url", url, "err", err)
-				return p, err
+		}
+		if err == nil {
+			if code == http.StatusNotModified && isCached {
+				f.log.Debug("not modified", "url", url)
+				p.Body = cached.body
+				p.NotModified = true
+			} else if code == http.StatusOK && useCache {
+				f.remember(url, header, body)
 			}
-			p.Retries++
-			f.log.Debug("retry", "retry", p.Retries, "max", f.retries, "url", url)
-			<-time.After(f.wait)
+			return p, nil
 		}
+		if ctx.Err() != nil {
+			return p, ctx.Err()
+		}
+		if !retryable(err) {
+			f.log.Debug("not retrying", "url", url, "err", err)
+			return p, err
+		}
+		if p.Retries >= f.retries {
+			f.log.Error("get failed after retry", "retries", f.retries, "url", url, "err", err)
+			return p, err
+		}
+		wait := f.backoff(p.Retries, err)
+		if f.maxWait > 0 && wait > f.maxWait {
+			f.log.Error("retry after too long", "wait", wait, "max", f.maxWait, "url", url, "err", err)
+			return p, err
+		}
+		p.Retries++
+		f.log.Debug("retry", "retry", p.Retries, "max", f.retries, "wait", wait, "url", url)
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-f.after(wait):
+		}
+	}
+}
+
+// waitTurn waits until a request to the given host would come at least delay after the previous one
+func (f *pageFetcher) waitTurn(ctx context.Context, host string, delay time.Duration) error {
+	if f.throttle == nil || delay <= 0 {
+		return nil
+	}
+
+	wait := f.throttle.reserve(host, f.now(), delay)
+	if wait <= 0 {
+		return nil
+	}
+	f.log.Debug("wait for host", "host", host, "wait", wait)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.after(wait):
+		return nil
 	}
 }
 
-func fetchOnce(c *http.Client, r *http.Request) (int, []byte, error) {
+// remember caches the validators and body of a page fetched in full, or forgets the page if it
+// no longer has validators
+func (f *pageFetcher) remember(url string, header http.Header, body []byte) {
+	if f.cache == nil {
+		return
+	}
+
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		f.cache.remove(url)
+		return
+	}
+
+	f.cache.put(cachedPage{
+		url:          url,
+		etag:         etag,
+		lastModified: lastModified,
+		body:         body,
+	})
+}
+
+// fetchOnce makes the given request, reading at most maxBytes of the response body if maxBytes is positive
+func fetchOnce(c *http.Client, r *http.Request, maxBytes int64) (int, http.Header, []byte, error) {
 	resp, err := c.Do(r)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, nil, err
 	}
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var body []byte
+	if maxBytes > 0 {
+		if resp.ContentLength > maxBytes {
+			return resp.StatusCode, resp.Header, nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+		}
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err == nil && int64(len(body)) > maxBytes {
+			return resp.StatusCode, resp.Header, nil, fmt.Errorf("%w: over %d bytes", ErrTooLarge, maxBytes)
+		}
+	} else {
+		body, err = io.ReadAll(resp.Body)
+	}
 	if err != nil {
-		return resp.StatusCode, nil, fmt.Errorf("read response body: %w", err)
+		return resp.StatusCode, resp.Header, nil, fmt.Errorf("read response body: %w", err)
 	}
 
-	return resp.StatusCode, body, nil
+	return resp.StatusCode, resp.Header, body, nil
 }
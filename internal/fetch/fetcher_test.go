@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/johnstcn/freshcomics/internal/testutil/slogtest"
 	"github.com/stretchr/testify/assert"
@@ -20,6 +21,142 @@ func TestPageFetcher(t *testing.T) {
 		assert.NotNil(t, p)
 	})
 
+	t.Run("NewDefaultLogger", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		p, err := New(&Args{Client: srv.Client()}).Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "body", string(p.Body))
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		t.Parallel()
+		var full int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			full++
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), CacheSize: 1, Logger: slogtest.New(t)})
+		p, err := pf.Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, p.ResponseCode)
+		assert.False(t, p.NotModified)
+
+		p, err = pf.Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, p.ResponseCode)
+		assert.True(t, p.NotModified)
+		assert.Equal(t, "body", string(p.Body))
+		assert.Equal(t, 1, full)
+	})
+
+	t.Run("LastModified", func(t *testing.T) {
+		t.Parallel()
+		lastModified := "Mon, 04 Mar 2024 05:00:00 GMT"
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), CacheSize: 1, Logger: slogtest.New(t)})
+		_, err := pf.Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		p, err := pf.Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		assert.True(t, p.NotModified)
+		assert.Equal(t, "body", string(p.Body))
+	})
+
+	t.Run("NoCache", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Get("If-None-Match"))
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), Logger: slogtest.New(t)})
+		for i := 0; i < 2; i++ {
+			p, err := pf.Fetch(context.Background(), srv.URL)
+			require.NoError(t, err)
+			assert.False(t, p.NotModified)
+		}
+	})
+
+	t.Run("WithoutCache", func(t *testing.T) {
+		t.Parallel()
+		var full int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			assert.Empty(t, r.Header.Get("If-None-Match"))
+			full++
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("image"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), CacheSize: 1, Logger: slogtest.New(t)})
+		ctx := WithoutCache(context.Background())
+		for i := 0; i < 2; i++ {
+			p, err := pf.Fetch(ctx, srv.URL)
+			require.NoError(t, err)
+			assert.False(t, p.NotModified)
+		}
+		assert.Equal(t, 2, full)
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		t.Parallel()
+		var calls int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			calls++
+			if r.URL.Path == "/chunked" {
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte("0123456789"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), Retries: 2, Logger: slogtest.New(t)})
+		p, err := pf.Fetch(WithMaxBytes(context.Background(), 10), srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "0123456789", string(p.Body))
+
+		for _, path := range []string{"/", "/chunked"} {
+			_, err = pf.Fetch(WithMaxBytes(context.Background(), 9), srv.URL+path)
+			assert.ErrorIs(t, err, ErrTooLarge, path)
+		}
+		assert.Equal(t, 3, calls, "too large is not retried")
+	})
+
 	t.Run("OK", func(t *testing.T) {
 		t.Parallel()
 		var (
@@ -41,6 +178,8 @@ func TestPageFetcher(t *testing.T) {
 			client:    client,
 			retries:   0,
 			wait:      1,
+			jitter:    noJitter,
+			after:     time.After,
 			userAgent: useragent,
 			log:       slogtest.New(t),
 		}
@@ -80,6 +219,8 @@ func TestPageFetcher(t *testing.T) {
 			client:    client,
 			retries:   1,
 			wait:      1,
+			jitter:    noJitter,
+			after:     time.After,
 			userAgent: useragent,
 			log:       slogtest.New(t),
 		}
@@ -112,6 +253,8 @@ func TestPageFetcher(t *testing.T) {
 			client:    client,
 			retries:   1,
 			wait:      1,
+			jitter:    noJitter,
+			after:     time.After,
 			userAgent: useragent,
 			log:       slogtest.New(t),
 		}
@@ -121,3 +264,32 @@ func TestPageFetcher(t *testing.T) {
 		assert.Equal(t, 1, p.Retries)
 	})
 }
+
+func TestPageCache(t *testing.T) {
+	t.Parallel()
+
+	c := newPageCache(2)
+	c.put(cachedPage{url: "a", etag: "1"})
+	c.put(cachedPage{url: "b", etag: "1"})
+	_, found := c.get("a")
+	require.True(t, found)
+
+	// b is the least recently used
+	c.put(cachedPage{url: "c", etag: "1"})
+	_, found = c.get("b")
+	assert.False(t, found)
+
+	c.put(cachedPage{url: "a", etag: "2"})
+	a, found := c.get("a")
+	require.True(t, found)
+	assert.Equal(t, "2", a.etag)
+
+	c.remove("a")
+	_, found = c.get("a")
+	assert.False(t, found)
+
+	empty := newPageCache(0)
+	empty.put(cachedPage{url: "a", etag: "1"})
+	_, found = empty.get("a")
+	assert.False(t, found)
+}
@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxWait is the longest wait between retries if not specified
+const DefaultMaxWait = time.Minute
+
+// HTTPError is returned when a server responds with a 4xx or 5xx status
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is how long the server asked to be left alone for in its Retry-After header, if it did
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Temporary returns whether the request may succeed if tried again later, i.e. the server was
+// overloaded or failing rather than saying the page is gone or may not be fetched
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// retryable returns whether a request that failed with err is worth trying again. Transport errors
+// are, except for a body that is too large; HTTP errors are if they are temporary.
+func retryable(err error) bool {
+	if errors.Is(err, ErrTooLarge) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	return true
+}
+
+// backoff returns how long to wait before the given retry, counting from zero, of a request that failed
+// with err. The wait doubles with each retry, starting from wait, and is jittered so that workers
+// that failed together don't all retry together. A Retry-After from the server is used as is.
+func (f *pageFetcher) backoff(retry int, err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return httpErr.RetryAfter
+	}
+
+	d := f.wait
+	for i := 0; i < retry && (f.maxWait <= 0 || d < f.maxWait); i++ {
+		d *= 2
+	}
+	if f.maxWait > 0 && d > f.maxWait {
+		d = f.maxWait
+	}
+	return f.jitter(d)
+}
+
+// halfJitter returns a random duration between d/2 and d
+func halfJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date,
+// returning zero if it is missing, invalid or already past
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
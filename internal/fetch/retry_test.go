@@ -0,0 +1,150 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/testutil/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noJitter(d time.Duration) time.Duration { return d }
+
+// newRetryFetcher returns a pageFetcher for srv that records its waits between retries instead of waiting
+func newRetryFetcher(t *testing.T, srv *httptest.Server, retries int) (*pageFetcher, *[]time.Duration) {
+	var waits []time.Duration
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	return &pageFetcher{
+		client:  srv.Client(),
+		retries: retries,
+		wait:    time.Second,
+		maxWait: time.Minute,
+		jitter:  noJitter,
+		now:     func() time.Time { return now },
+		after: func(d time.Duration) <-chan time.Time {
+			waits = append(waits, d)
+			ch := make(chan time.Time, 1)
+			ch <- now.Add(d)
+			return ch
+		},
+		log: slogtest.New(t),
+	}, &waits
+}
+
+func TestPageFetcher_Retry(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		status    int
+		header    map[string]string
+		wantCalls int32
+		wantWaits []time.Duration
+		temporary bool
+	}{
+		{"NotFound", http.StatusNotFound, nil, 1, nil, false},
+		{"Forbidden", http.StatusForbidden, nil, 1, nil, false},
+		{"ServerError", http.StatusInternalServerError, nil, 4, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, true},
+		{"TooManyRequests", http.StatusTooManyRequests, nil, 4, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, true},
+		{"RetryAfterSecs", http.StatusServiceUnavailable, map[string]string{"Retry-After": "30"}, 4, []time.Duration{30 * time.Second, 30 * time.Second, 30 * time.Second}, true},
+		{"RetryAfterDate", http.StatusTooManyRequests, map[string]string{"Retry-After": "Mon, 04 Mar 2024 05:00:10 GMT"}, 4, []time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second}, true},
+		{"RetryAfterTooLong", http.StatusServiceUnavailable, map[string]string{"Retry-After": "3600"}, 1, nil, true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte("error page"))
+			}))
+			t.Cleanup(srv.Close)
+
+			pf, waits := newRetryFetcher(t, srv, 3)
+			p, err := pf.Fetch(context.Background(), srv.URL)
+			var httpErr *HTTPError
+			require.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tc.status, httpErr.StatusCode)
+			assert.Equal(t, tc.temporary, httpErr.Temporary())
+			assert.Equal(t, tc.status, p.ResponseCode)
+			assert.Equal(t, "error page", string(p.Body))
+			assert.Equal(t, tc.wantCalls, calls.Load())
+			assert.Equal(t, tc.wantWaits, *waits)
+		})
+	}
+
+	t.Run("RecoversAfterServerError", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf, _ := newRetryFetcher(t, srv, 3)
+		p, err := pf.Fetch(context.Background(), srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "body", string(p.Body))
+		assert.Equal(t, 1, p.Retries)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pf, _ := newRetryFetcher(t, srv, 3)
+		pf.after = func(time.Duration) <-chan time.Time {
+			cancel()
+			return nil
+		}
+		_, err := pf.Fetch(ctx, srv.URL)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	pf := &pageFetcher{wait: time.Second, maxWait: 5 * time.Second, jitter: noJitter}
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, pf.backoff(i, errors.New("connection reset")))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, got)
+
+	for i := 0; i < 100; i++ {
+		d := halfJitter(4 * time.Second)
+		assert.GreaterOrEqual(t, d, 2*time.Second)
+		assert.LessOrEqual(t, d, 4*time.Second)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, time.Minute, parseRetryAfter("Mon, 04 Mar 2024 05:01:00 GMT", now))
+	assert.Zero(t, parseRetryAfter("Mon, 04 Mar 2024 04:59:00 GMT", now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("-5", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
@@ -0,0 +1,288 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is returned when robots.txt forbids fetching a URL
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+const (
+	// maxRobotsSize is the most of a robots.txt file that is read
+	maxRobotsSize = 500 << 10
+	// maxCrawlDelay caps the Crawl-delay a robots.txt may ask for, so that one site can't hold up a worker indefinitely
+	maxCrawlDelay = time.Minute
+	// DefaultRobotsTTL is how long robots.txt files are cached for if not specified
+	DefaultRobotsTTL = 24 * time.Hour
+)
+
+// robotsRule allows or disallows the paths matching its pattern
+type robotsRule struct {
+	allow   bool
+	pattern string
+	expr    *regexp.Regexp
+}
+
+// robotsRules are the rules of a robots.txt file that apply to a single user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowed returns whether the given path, including any query string, may be fetched. The rule with
+// the longest matching pattern wins, with Allow winning ties, as described in RFC 9309.
+func (r robotsRules) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.expr.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsGroup is a group of rules in a robots.txt file along with the user agents it applies to
+type robotsGroup struct {
+	agents []string
+	robotsRules
+}
+
+// names returns whether the given lowercased user agent is one of the group's
+func (g *robotsGroup) names(agent string) bool {
+	for _, a := range g.agents {
+		if a == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRobots returns the rules in the given robots.txt that apply to userAgent. Groups naming the
+// product token of userAgent apply to it; otherwise the groups for * do.
+func parseRobots(r io.Reader, userAgent string) robotsRules {
+	var groups []*robotsGroup
+	var cur *robotsGroup
+	inRules := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if cur == nil || inRules {
+				cur = &robotsGroup{}
+				groups = append(groups, cur)
+				inRules = false
+			}
+			cur.agents = append(cur.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if cur == nil {
+				continue
+			}
+			inRules = true
+			if value == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: value,
+				expr:    compileRobotsPattern(value),
+			})
+		case "crawl-delay":
+			if cur == nil {
+				continue
+			}
+			inRules = true
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				cur.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	token := productToken(userAgent)
+	var specific, wildcard robotsRules
+	var matched bool
+	for _, g := range groups {
+		switch {
+		case g.names(token):
+			matched = true
+			specific = mergeRobotsRules(specific, g.robotsRules)
+		case g.names("*"):
+			wildcard = mergeRobotsRules(wildcard, g.robotsRules)
+		}
+	}
+	if matched {
+		return specific
+	}
+	return wildcard
+}
+
+func mergeRobotsRules(a, b robotsRules) robotsRules {
+	a.rules = append(a.rules, b.rules...)
+	if b.crawlDelay > a.crawlDelay {
+		a.crawlDelay = b.crawlDelay
+	}
+	return a
+}
+
+// productToken returns the name a robots.txt user-agent line would use for the given User-Agent header
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(strings.TrimSpace(token))
+}
+
+// compileRobotsPattern turns a robots.txt path pattern, in which * matches anything and a trailing
+// $ anchors the end of the path, into a regexp matching from the start of the path
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsEntry is a cached robots.txt
+type robotsEntry struct {
+	rules     robotsRules
+	fetchedAt time.Time
+}
+
+// robotsCall is a fetch of a robots.txt that other callers wanting the same one wait for
+type robotsCall struct {
+	done  chan struct{}
+	rules robotsRules
+	err   error
+}
+
+// robotsCache fetches and caches the robots.txt of each origin
+type robotsCache struct {
+	client    *http.Client
+	userAgent string
+	ttl       time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   map[string]robotsEntry
+	inflight  map[string]*robotsCall
+	swept     time.Time
+}
+
+func newRobotsCache(client *http.Client, userAgent string, ttl time.Duration) *robotsCache {
+	if ttl <= 0 {
+		ttl = DefaultRobotsTTL
+	}
+	return &robotsCache{
+		client:    client,
+		userAgent: userAgent,
+		ttl:       ttl,
+		now:       time.Now,
+		entries:   make(map[string]robotsEntry),
+		inflight:  make(map[string]*robotsCall),
+	}
+}
+
+// rulesFor returns the robots.txt rules for the origin of the given URL, fetching them if they
+// aren't cached. Concurrent callers for the same origin share a single fetch. waitTurn is called
+// before fetching, so that robots.txt takes its place among the other requests to the host.
+// A missing robots.txt allows everything. An unreachable one is an error, so that nothing is
+// fetched from a site whose rules are unknown.
+func (c *robotsCache) rulesFor(ctx context.Context, u *url.URL, waitTurn func() error) (robotsRules, error) {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	now := c.now()
+	if now.Sub(c.swept) >= c.ttl {
+		c.sweep(now)
+	}
+	if entry, found := c.entries[origin]; found && now.Sub(entry.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return entry.rules, nil
+	}
+	if call, found := c.inflight[origin]; found {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.rules, call.err
+		case <-ctx.Done():
+			return robotsRules{}, ctx.Err()
+		}
+	}
+	call := &robotsCall{done: make(chan struct{})}
+	c.inflight[origin] = call
+	c.mu.Unlock()
+
+	call.err = waitTurn()
+	if call.err == nil {
+		call.rules, call.err = c.fetch(ctx, origin)
+	}
+
+	c.mu.Lock()
+	if call.err == nil {
+		c.entries[origin] = robotsEntry{rules: call.rules, fetchedAt: c.now()}
+	}
+	delete(c.inflight, origin)
+	c.mu.Unlock()
+	close(call.done)
+	return call.rules, call.err
+}
+
+// sweep forgets the robots.txt files that have expired, so that the cache doesn't grow with every
+// origin ever fetched from. The caller must hold mu.
+func (c *robotsCache) sweep(now time.Time) {
+	for origin, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) >= c.ttl {
+			delete(c.entries, origin)
+		}
+	}
+	c.swept = now
+}
+
+func (c *robotsCache) fetch(ctx context.Context, origin string) (robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("create robots.txt request: %w", err)
+	}
+	req.Header.Add("User-Agent", c.userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return robotsRules{}, fmt.Errorf("fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(resp.Body, c.userAgent), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return robotsRules{}, nil
+	default:
+		return robotsRules{}, fmt.Errorf("fetch robots.txt: unexpected status %d", resp.StatusCode)
+	}
+}
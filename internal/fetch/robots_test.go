@@ -0,0 +1,302 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/testutil/slogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRobots = `
+# comments are ignored
+User-agent: *
+Disallow: /
+
+User-agent: otherbot
+User-agent: freshcomics
+Disallow: /private/
+Allow: /private/public$
+Disallow: /*.php
+Crawl-delay: 2.5
+`
+
+func TestParseRobots(t *testing.T) {
+	t.Parallel()
+
+	rules := parseRobots(strings.NewReader(testRobots), "freshcomics/crawld")
+	assert.Equal(t, 2500*time.Millisecond, rules.crawlDelay)
+	for path, want := range map[string]bool{
+		"/":                     true,
+		"/robots.txt":           true,
+		"/comic/1":              true,
+		"/private/":             false,
+		"/private/page":         false,
+		"/private/public":       true,
+		"/private/public/other": false,
+		"/index.php?page=2":     false,
+	} {
+		assert.Equal(t, want, rules.allowed(path), path)
+	}
+
+	other := parseRobots(strings.NewReader(testRobots), "somebot/1.0")
+	assert.Zero(t, other.crawlDelay)
+	assert.False(t, other.allowed("/comic/1"))
+
+	empty := parseRobots(strings.NewReader(""), "freshcomics/crawld")
+	assert.True(t, empty.allowed("/anything"))
+}
+
+func TestPageFetcher_Robots(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Disallowed", func(t *testing.T) {
+		t.Parallel()
+		var robots, pages atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				robots.Add(1)
+				w.Write([]byte(testRobots))
+				return
+			}
+			pages.Add(1)
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), UserAgent: "freshcomics/crawld", Logger: slogtest.New(t)})
+		_, err := pf.Fetch(context.Background(), srv.URL+"/private/page")
+		assert.True(t, errors.Is(err, ErrDisallowed))
+
+		p, err := pf.Fetch(context.Background(), srv.URL+"/private/public")
+		require.NoError(t, err)
+		assert.Equal(t, "body", string(p.Body))
+		assert.EqualValues(t, 1, robots.Load(), "robots.txt should be cached")
+		assert.EqualValues(t, 1, pages.Load())
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), Logger: slogtest.New(t)})
+		_, err := pf.Fetch(context.Background(), srv.URL+"/private/page")
+		require.NoError(t, err)
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			t.Errorf("unexpected request for %s", r.URL)
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), Logger: slogtest.New(t)})
+		_, err := pf.Fetch(context.Background(), srv.URL+"/page")
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrDisallowed))
+	})
+
+	t.Run("Ignored", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				t.Error("robots.txt should not be fetched")
+			}
+			w.Write([]byte("body"))
+		}))
+		t.Cleanup(srv.Close)
+
+		pf := New(&Args{Client: srv.Client(), IgnoreRobots: true, Logger: slogtest.New(t)})
+		_, err := pf.Fetch(context.Background(), srv.URL+"/private/page")
+		require.NoError(t, err)
+	})
+}
+
+func TestPageFetcher_HostDelay(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	pf := &pageFetcher{
+		client:    srv.Client(),
+		log:       slogtest.New(t),
+		throttle:  newHostThrottle(),
+		hostDelay: time.Second,
+		now:       func() time.Time { return now },
+		after: func(d time.Duration) <-chan time.Time {
+			waits = append(waits, d)
+			ch := make(chan time.Time, 1)
+			ch <- now.Add(d)
+			return ch
+		},
+	}
+
+	ctx := WithHostDelay(context.Background(), 3*time.Second)
+	for i := 0; i < 3; i++ {
+		_, err := pf.Fetch(ctx, srv.URL)
+		require.NoError(t, err)
+	}
+	// The first request goes straight away, the next two queue up behind it
+	assert.Equal(t, []time.Duration{3 * time.Second, 6 * time.Second}, waits)
+}
+
+func TestPageFetcher_RobotsHostDelay(t *testing.T) {
+	t.Parallel()
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("body"))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	pf := &pageFetcher{
+		client:    srv.Client(),
+		log:       slogtest.New(t),
+		robots:    newRobotsCache(srv.Client(), "freshcomics", time.Hour),
+		throttle:  newHostThrottle(),
+		hostDelay: time.Second,
+		now:       func() time.Time { return now },
+		after: func(d time.Duration) <-chan time.Time {
+			waits = append(waits, d)
+			ch := make(chan time.Time, 1)
+			ch <- now.Add(d)
+			return ch
+		},
+	}
+
+	_, err := pf.Fetch(context.Background(), srv.URL+"/comic/1")
+	require.NoError(t, err)
+	// robots.txt takes the first turn, so the page waits behind it
+	assert.Equal(t, []string{"/robots.txt", "/comic/1"}, paths)
+	assert.Equal(t, []time.Duration{time.Second}, waits)
+}
+
+func TestRobotsCache_Expiry(t *testing.T) {
+	t.Parallel()
+
+	var robots atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		robots.Add(1)
+		w.Write([]byte(testRobots))
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	c := newRobotsCache(srv.Client(), "freshcomics", time.Hour)
+	c.now = func() time.Time { return now }
+	noWait := func() error { return nil }
+	a, _ := url.Parse(srv.URL + "/comic/1")
+	b, _ := url.Parse(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/comic/1")
+
+	_, err := c.rulesFor(context.Background(), a, noWait)
+	require.NoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, err = c.rulesFor(context.Background(), a, noWait)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, robots.Load(), "robots.txt should be cached for its ttl")
+
+	// expired robots.txt files are forgotten once another origin is looked up
+	now = now.Add(time.Hour)
+	_, err = c.rulesFor(context.Background(), b, noWait)
+	require.NoError(t, err)
+	assert.Len(t, c.entries, 1)
+	assert.Contains(t, c.entries, b.Scheme+"://"+b.Host)
+
+	_, err = c.rulesFor(context.Background(), a, noWait)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, robots.Load())
+}
+
+func TestRobotsCache_SharedFetch(t *testing.T) {
+	t.Parallel()
+
+	var robots atomic.Int32
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		robots.Add(1)
+		<-release
+		w.Write([]byte(testRobots))
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(unblock)
+
+	c := newRobotsCache(srv.Client(), "freshcomics", time.Hour)
+	u, _ := url.Parse(srv.URL + "/comic/1")
+	var turns atomic.Int32
+	waitTurn := func() error {
+		turns.Add(1)
+		return nil
+	}
+
+	const workers = 5
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			rules, err := c.rulesFor(context.Background(), u, waitTurn)
+			if err == nil && rules.allowed("/private/page") {
+				err = errors.New("rules should come from the shared robots.txt")
+			}
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.inflight) == 1 && robots.Load() == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	unblock()
+	for i := 0; i < workers; i++ {
+		require.NoError(t, <-errs)
+	}
+	assert.EqualValues(t, 1, robots.Load(), "concurrent lookups should share one fetch")
+	assert.EqualValues(t, 1, turns.Load())
+	assert.Empty(t, c.inflight)
+}
+
+func TestHostThrottle(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)
+	th := newHostThrottle()
+	assert.Zero(t, th.reserve("a.example.com", now, time.Second))
+	assert.Equal(t, time.Second, th.reserve("a.example.com", now, time.Second))
+	assert.Zero(t, th.reserve("b.example.com", now, time.Second))
+	assert.Zero(t, th.reserve("a.example.com", now.Add(time.Minute), time.Second))
+
+	// hosts that may be fetched from straight away are forgotten
+	later := now.Add(time.Hour)
+	assert.Zero(t, th.reserve("c.example.com", later, time.Second))
+	assert.Equal(t, map[string]time.Time{"c.example.com": later.Add(time.Second)}, th.next)
+}
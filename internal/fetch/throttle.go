@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type hostDelayKey struct{}
+
+// WithHostDelay returns a context asking Fetch to leave at least d between its requests to the host
+// of the URL fetched, if that is longer than the Fetcher's own HostDelay or the host's Crawl-delay
+func WithHostDelay(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, hostDelayKey{}, d)
+}
+
+func hostDelayFrom(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(hostDelayKey{}).(time.Duration)
+	return d
+}
+
+// throttleSweepInterval is how often hostThrottle forgets hosts that it no longer needs to hold back
+const throttleSweepInterval = time.Minute
+
+// hostThrottle spaces out requests to the same host
+type hostThrottle struct {
+	mu    sync.Mutex
+	next  map[string]time.Time // earliest time of the next request to each host
+	swept time.Time
+}
+
+func newHostThrottle() *hostThrottle {
+	return &hostThrottle{next: make(map[string]time.Time)}
+}
+
+// reserve books the next request to the given host at least delay after the one before it,
+// returning how long to wait from now until it may be made
+func (t *hostThrottle) reserve(host string, now time.Time, delay time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.swept) >= throttleSweepInterval {
+		t.sweep(now)
+	}
+
+	at := t.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.next[host] = at.Add(delay)
+	return at.Sub(now)
+}
+
+// sweep forgets the hosts whose last request was longer ago than its delay, since the next request to
+// them may be made straight away, so that the throttle doesn't grow with every host ever fetched from
+func (t *hostThrottle) sweep(now time.Time) {
+	for host, at := range t.next {
+		if !at.After(now) {
+			delete(t.next, host)
+		}
+	}
+	t.swept = now
+}
@@ -30,6 +30,8 @@ type Lookuper interface {
 
 type urlOpener func(url string, refreshSecs, fetchTimeoutSecs time.Duration) (*freegeoip.DB, error)
 
+type fileOpener func(path string) (*freegeoip.DB, error)
+
 var _ IPInfoer = (*ipInfoer)(nil)
 var _ Lookuper = (*freegeoip.DB)(nil)
 
@@ -37,6 +39,12 @@ func NewIPInfoer(refreshSecs, fetchTimeoutSecs int) (IPInfoer, error) {
 	return newIPInfoer(freegeoip.OpenURL, refreshSecs, fetchTimeoutSecs)
 }
 
+// OpenFile returns an IPInfoer backed by the MaxMind database file at path.
+// The file is reloaded automatically when it changes on disk.
+func OpenFile(path string) (IPInfoer, error) {
+	return openFile(freegeoip.Open, path)
+}
+
 func NewDummyIPInfoer() IPInfoer {
 	return &ipInfoer{
 		geoIP: &DummyLookuper{},
@@ -56,6 +64,17 @@ func newIPInfoer(openURL urlOpener, refreshSecs, fetchTimeoutSecs int) (IPInfoer
 	}, nil
 }
 
+func openFile(open fileOpener, path string) (IPInfoer, error) {
+	ip, err := open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not open geoIP db %s", path)
+	}
+
+	return &ipInfoer{
+		geoIP: ip,
+	}, nil
+}
+
 func (i *ipInfoer) GetIPInfo(addr net.IP) (GeoLoc, error) {
 	var ipInfo freegeoip.DefaultQuery
 	var g GeoLoc
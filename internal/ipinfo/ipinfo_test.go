@@ -62,6 +62,21 @@ func (s *IPInfoTestSuite) TestNewIPInfoer_Err() {
 	s.EqualError(err, "Could not open MaxMind geoIP db: some error")
 }
 
+func (s *IPInfoTestSuite) TestOpenFile_Err() {
+	ip, err := OpenFile("testdata/does-not-exist.mmdb")
+	s.Nil(ip)
+	s.Error(err)
+}
+
+func (s *IPInfoTestSuite) TestOpenFile_ErrOpener() {
+	badOpener := func(_ string) (*freegeoip.DB, error) {
+		return nil, fmt.Errorf("some error")
+	}
+	ip, err := openFile(badOpener, "/path/to/geoip.mmdb")
+	s.Nil(ip)
+	s.EqualError(err, "Could not open geoIP db /path/to/geoip.mmdb: some error")
+}
+
 func (s *IPInfoTestSuite) TestGetIPInfo_OK() {
 	s.ml.On("Lookup", mock.AnythingOfType("net.IP"), mock.Anything).Run(func(args mock.Arguments) {
 		result := args.Get(1).(*freegeoip.DefaultQuery)
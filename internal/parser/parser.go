@@ -1,87 +1,320 @@
 package parser
 
 import (
+	"bytes"
+	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 
 	"io"
 
+	"github.com/andybalholm/cascadia"
 	"github.com/pkg/errors"
+	"golang.org/x/net/html"
 	"gopkg.in/xmlpath.v2"
 )
 
 //go:generate mockery -interface Parser -package parsertest
 
 var (
-	ErrInvalidRegexp = errors.New("invalid regexp")
-	ErrInvalidXPath  = errors.New("invalid xpath")
-	ErrRegexpNoMatch = errors.New("no match for regexp")
-	ErrXPathNoMatch  = errors.New("no match for xpath")
+	ErrInvalidRegexp       = errors.New("invalid regexp")
+	ErrInvalidXPath        = errors.New("invalid xpath")
+	ErrInvalidCSS          = errors.New("invalid css selector")
+	ErrInvalidSelectorType = errors.New("invalid selector type")
+	ErrRegexpNoMatch       = errors.New("no match for regexp")
+	// ErrNoMatch is wrapped by the errors returned when a selector matches nothing
+	ErrNoMatch      = errors.New("no match")
+	ErrXPathNoMatch = fmt.Errorf("%w for xpath", ErrNoMatch)
+	ErrCSSNoMatch   = fmt.Errorf("%w for css selector", ErrNoMatch)
+)
+
+// SelectorType says how the Selector of a Rule is evaluated
+type SelectorType string
+
+const (
+	SelectorXPath SelectorType = "xpath"
+	SelectorCSS   SelectorType = "css"
 )
 
 // Rule represents a targeted element on a Page
 type Rule struct {
-	XPath  string
+	// XPath selects the targeted element, or is a CSS selector if Type is SelectorCSS
+	XPath string
+	// Filter keeps the first capture group of its first match, like a TransformFind before Transforms.
+	// An empty Filter keeps the whole selected value, where it used to match and return "".
 	Filter string
+	// Type of selector in XPath, SelectorXPath if empty
+	Type SelectorType
+	// Attr, if set, takes the value of the named attribute of the selected element instead of its text
+	Attr string
+	// Transforms are applied in order to each selected value after Filter
+	Transforms []Transform
+}
+
+// selectorType returns the type of the Rule's selector, defaulting to XPath
+func (r Rule) selectorType() SelectorType {
+	if r.Type == "" {
+		return SelectorXPath
+	}
+	return r.Type
+}
+
+// Validate checks that the selector, Filter and Transforms of the given Rule compile
+func Validate(r Rule) error {
+	switch r.selectorType() {
+	case SelectorXPath:
+		if _, err := xmlpath.Compile(r.XPath); err != nil {
+			return fmt.Errorf("%w %q: %v", ErrInvalidXPath, r.XPath, err)
+		}
+		if r.Attr != "" {
+			if _, err := xmlpath.Compile(attrPath(r.Attr)); err != nil {
+				return fmt.Errorf("%w %q: %v", ErrInvalidXPath, attrPath(r.Attr), err)
+			}
+		}
+	case SelectorCSS:
+		if _, err := cascadia.Compile(r.XPath); err != nil {
+			return fmt.Errorf("%w %q: %v", ErrInvalidCSS, r.XPath, err)
+		}
+	default:
+		return fmt.Errorf("%w %q", ErrInvalidSelectorType, r.Type)
+	}
+
+	if _, err := regexp.Compile(r.Filter); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidRegexp, r.Filter, err)
+	}
+
+	for _, t := range r.Transforms {
+		if err := validateTransform(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 type xPathCompiler func(path string) (*xmlpath.Path, error)
+type cssCompiler func(sel string) (cascadia.Selector, error)
 type regexpCompiler func(expr string) (*regexp.Regexp, error)
 
 // Parser applies a Rule to its parsed Page
 type Parser interface {
+	// Apply returns the first value selected by the Rule
 	Apply(r Rule) (string, error)
+	// ApplyAll returns every value selected by the Rule, leaving out those its Filter or a
+	// TransformFind doesn't match
+	ApplyAll(r Rule) ([]string, error)
 }
 
-func NewParser(r io.Reader) (Parser, error) {
-	return newXPathParser(r)
+// NewParser reads and parses the page at pageURL from r, so that both XPath and CSS Rules can be
+// applied to it. Relative URLs are resolved against pageURL.
+func NewParser(r io.Reader, pageURL string) (Parser, error) {
+	return newPageParser(r, pageURL)
 }
 
-func newXPathParser(r io.Reader) (Parser, error) {
-	page, err := xmlpath.ParseHTML(r)
+func newPageParser(r io.Reader, pageURL string) (*pageParser, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return &pageParser{}, fmt.Errorf("%w %q: %v", ErrInvalidURL, pageURL, err)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return &pageParser{}, errors.Wrap(err, "parsing Page")
+	}
+	page, err := xmlpath.ParseHTML(bytes.NewReader(body))
 	if err != nil {
-		return &xPathParser{}, errors.Wrap(err, "parsing Page")
+		return &pageParser{}, errors.Wrap(err, "parsing Page")
 	}
-	return &xPathParser{
+	return &pageParser{
+		URL:           base,
+		Body:          body,
 		Page:          page,
 		CompileXPath:  xmlpath.Compile,
+		CompileCSS:    cascadia.Compile,
 		CompileRegexp: regexp.Compile,
 	}, nil
 }
 
-// xPathParser implements Parser
-type xPathParser struct {
+// pageParser implements Parser. The page is parsed for XPath up front, and for CSS selectors the
+// first time a CSS Rule is applied.
+type pageParser struct {
+	URL           *url.URL
+	Body          []byte
 	Page          *xmlpath.Node
+	Doc           *html.Node
 	CompileXPath  xPathCompiler
+	CompileCSS    cssCompiler
 	CompileRegexp regexpCompiler
 }
 
-var _ Parser = (*xPathParser)(nil)
+var _ Parser = (*pageParser)(nil)
 
-func (p *xPathParser) Apply(r Rule) (string, error) {
-	rawValue, err := p.applyXPath(r.XPath)
+func (p *pageParser) Apply(r Rule) (string, error) {
+	rawValues, err := p.selectValues(r, false)
 	if err != nil {
 		return "", err
 	}
 
-	return p.applyFilter(r.Filter, rawValue)
+	return p.applyRule(r, rawValues[0])
+}
+
+func (p *pageParser) ApplyAll(r Rule) ([]string, error) {
+	rawValues, err := p.selectValues(r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, rawValue := range rawValues {
+		value, err := p.applyRule(r, rawValue)
+		if errors.Is(err, ErrRegexpNoMatch) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 0 {
+		return nil, ErrRegexpNoMatch
+	}
+
+	return values, nil
+}
+
+// selectValues returns the first value selected by the Rule, or every value if all is set
+func (p *pageParser) selectValues(r Rule, all bool) ([]string, error) {
+	switch r.selectorType() {
+	case SelectorXPath:
+		return p.applyXPath(r.XPath, r.Attr, all)
+	case SelectorCSS:
+		return p.applyCSS(r.XPath, r.Attr, all)
+	default:
+		return nil, ErrInvalidSelectorType
+	}
+}
+
+// applyRule passes a selected value through the Filter and Transforms of the Rule
+func (p *pageParser) applyRule(r Rule, rawValue string) (string, error) {
+	value := rawValue
+	if r.Filter != "" {
+		var err error
+		if value, err = p.applyFilter(r.Filter, value); err != nil {
+			return value, err
+		}
+	}
+
+	return p.applyTransforms(r.Transforms, value)
 }
 
-func (p *xPathParser) applyXPath(path string) (string, error) {
+// attrPath returns the XPath selecting the named attribute of the context node
+func attrPath(attr string) string {
+	return "@" + attr
+}
+
+func (p *pageParser) applyXPath(path, attr string, all bool) ([]string, error) {
 	xp, err := p.CompileXPath(path)
 	if err != nil {
-		return "", ErrInvalidXPath
+		return nil, ErrInvalidXPath
+	}
+
+	// the attribute is read from each selected node rather than appended to path, which would
+	// only apply it to the last step of a union or parenthesised expression
+	var attrXP *xmlpath.Path
+	if attr != "" {
+		if attrXP, err = p.CompileXPath(attrPath(attr)); err != nil {
+			return nil, ErrInvalidXPath
+		}
+	}
+
+	var vals []string
+	for iter := xp.Iter(p.Page); iter.Next(); {
+		val := iter.Node().String()
+		if attrXP != nil {
+			var ok bool
+			if val, ok = attrXP.String(iter.Node()); !ok {
+				continue
+			}
+		}
+		vals = append(vals, val)
+		if !all {
+			break
+		}
+	}
+
+	if len(vals) == 0 {
+		return nil, ErrXPathNoMatch
+	}
+
+	return vals, nil
+}
+
+func (p *pageParser) applyCSS(selector, attr string, all bool) ([]string, error) {
+	sel, err := p.CompileCSS(selector)
+	if err != nil {
+		return nil, ErrInvalidCSS
+	}
+
+	if p.Doc == nil {
+		doc, err := html.Parse(bytes.NewReader(p.Body))
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing Page")
+		}
+		p.Doc = doc
 	}
 
-	val, ok := xp.String(p.Page)
-	if !ok {
-		return "", ErrXPathNoMatch
+	var vals []string
+	for _, n := range cascadia.QueryAll(p.Doc, sel) {
+		val, ok := nodeValue(n, attr)
+		if !ok {
+			continue
+		}
+		vals = append(vals, val)
+		if !all {
+			break
+		}
 	}
 
-	return val, nil
+	if len(vals) == 0 {
+		return nil, ErrCSSNoMatch
+	}
+
+	return vals, nil
+}
+
+// nodeValue returns the text of the given node, or the value of its attr if set
+func nodeValue(n *html.Node, attr string) (string, bool) {
+	if attr == "" {
+		return textContent(n), true
+	}
+
+	for _, a := range n.Attr {
+		if a.Key == attr {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// textContent returns the text of the given node and its descendants, like the string value of an XPath node
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
 }
 
-func (p *xPathParser) applyFilter(expr, text string) (string, error) {
+func (p *pageParser) applyFilter(expr, text string) (string, error) {
 	r, err := p.CompileRegexp(expr)
 	if err != nil {
 		return "", ErrInvalidRegexp
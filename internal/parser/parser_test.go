@@ -20,18 +20,18 @@ func (r *badReader) Read([]byte) (int, error) {
 	return 0, fmt.Errorf("read error")
 }
 
-func Test_NewXPathParser_OK(t *testing.T) {
-	_, err := newXPathParser(strings.NewReader(exampleHTML))
+func Test_NewPageParser_OK(t *testing.T) {
+	_, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 }
 
-func Test_NewXPathParser_Err(t *testing.T) {
-	_, err := newXPathParser(&badReader{})
+func Test_NewPageParser_Err(t *testing.T) {
+	_, err := newPageParser(&badReader{}, "http://example.com/")
 	require.EqualError(t, err, "parsing Page: read error")
 }
 
 func Test_Apply_OK(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "//a/@href",
@@ -43,7 +43,7 @@ func Test_Apply_OK(t *testing.T) {
 }
 
 func Test_Apply_NoGroup(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "//a/@href",
@@ -55,7 +55,7 @@ func Test_Apply_NoGroup(t *testing.T) {
 }
 
 func Test_Apply_XPathNoMatch(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "//b/@href",
@@ -67,7 +67,7 @@ func Test_Apply_XPathNoMatch(t *testing.T) {
 }
 
 func Test_Apply_RegexNoMatch(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "//a/@href",
@@ -79,7 +79,7 @@ func Test_Apply_RegexNoMatch(t *testing.T) {
 }
 
 func Test_Apply_InvalidXPath(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "",
@@ -91,7 +91,7 @@ func Test_Apply_InvalidXPath(t *testing.T) {
 }
 
 func Test_Apply_InvalidRegexp(t *testing.T) {
-	p, err := newXPathParser(strings.NewReader(exampleHTML))
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/")
 	require.NoError(t, err)
 	r := Rule{
 		XPath:  "//a/@href",
@@ -101,3 +101,176 @@ func Test_Apply_InvalidRegexp(t *testing.T) {
 	require.EqualValues(t, ErrInvalidRegexp, err)
 	require.Zero(t, val)
 }
+
+func Test_Validate_OK(t *testing.T) {
+	err := Validate(Rule{
+		XPath:  "//a/@href",
+		Filter: "foo=([^&]+)",
+	})
+	require.NoError(t, err)
+}
+
+func Test_Validate_InvalidXPath(t *testing.T) {
+	err := Validate(Rule{
+		XPath:  "//a[",
+		Filter: "foo=([^&]+)",
+	})
+	require.ErrorIs(t, err, ErrInvalidXPath)
+}
+
+func Test_Validate_InvalidRegexp(t *testing.T) {
+	err := Validate(Rule{
+		XPath:  "//a/@href",
+		Filter: "(",
+	})
+	require.ErrorIs(t, err, ErrInvalidRegexp)
+}
+
+var exampleNavHTML = `<html>
+<head><title>Page 2</title></head>
+<body>
+<div class="nav">
+<a class="prev" href="/comic/1">Previous</a>
+<a class="next" href="/comic/3">Next <b>page</b></a>
+</div>
+</body>
+</html>
+`
+
+func Test_Apply_CSS(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	val, err := p.Apply(Rule{Type: SelectorCSS, XPath: "div.nav a.next", Attr: "href", Filter: "/comic/(\\d+)"})
+	require.NoError(t, err)
+	require.EqualValues(t, "3", val)
+
+	val, err = p.Apply(Rule{Type: SelectorCSS, XPath: "div.nav a.next", Filter: ".+"})
+	require.NoError(t, err)
+	require.EqualValues(t, "Next page", val)
+
+	val, err = p.Apply(Rule{Type: SelectorCSS, XPath: "a.missing, title", Filter: ".+"})
+	require.NoError(t, err)
+	require.EqualValues(t, "Page 2", val)
+}
+
+func Test_Apply_CSSNoMatch(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	_, err = p.Apply(Rule{Type: SelectorCSS, XPath: "a.first", Attr: "href", Filter: ".+"})
+	require.ErrorIs(t, err, ErrCSSNoMatch)
+	require.ErrorIs(t, err, ErrNoMatch)
+
+	_, err = p.Apply(Rule{Type: SelectorCSS, XPath: "a.next", Attr: "title", Filter: ".+"})
+	require.ErrorIs(t, err, ErrCSSNoMatch)
+}
+
+func Test_Apply_InvalidCSS(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	val, err := p.Apply(Rule{Type: SelectorCSS, XPath: "a[", Filter: ".+"})
+	require.EqualValues(t, ErrInvalidCSS, err)
+	require.Zero(t, val)
+}
+
+func Test_Apply_XPathAttr(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	val, err := p.Apply(Rule{XPath: "//a[@class='prev']", Attr: "href", Filter: "/comic/(\\d+)"})
+	require.NoError(t, err)
+	require.EqualValues(t, "1", val)
+
+	_, err = p.Apply(Rule{XPath: "//a[@class='first']", Filter: ".+"})
+	require.ErrorIs(t, err, ErrNoMatch)
+
+	// the attribute is read from the selected nodes, skipping those without it
+	val, err = p.Apply(Rule{XPath: "//div[@class='nav']/*", Attr: "class", Filter: ".+"})
+	require.NoError(t, err)
+	require.EqualValues(t, "prev", val)
+	val, err = p.Apply(Rule{XPath: "//a[2]", Attr: "href", Filter: ".+"})
+	require.NoError(t, err)
+	require.EqualValues(t, "/comic/3", val)
+	val, err = p.Apply(Rule{XPath: "//*", Attr: "href", Filter: ".+"})
+	require.NoError(t, err)
+	require.EqualValues(t, "/comic/1", val)
+
+	_, err = p.Apply(Rule{XPath: "//a", Attr: "title", Filter: ".+"})
+	require.ErrorIs(t, err, ErrXPathNoMatch)
+	_, err = p.Apply(Rule{XPath: "//a", Attr: "[", Filter: ".+"})
+	require.ErrorIs(t, err, ErrInvalidXPath)
+	require.ErrorIs(t, Validate(Rule{XPath: "//a", Attr: "["}), ErrInvalidXPath)
+}
+
+func Test_Apply_EmptyFilter(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	// before Rules had Transforms, an empty Filter matched "" and so returned it
+	val, err := p.Apply(Rule{XPath: "//title"})
+	require.NoError(t, err)
+	require.EqualValues(t, "Page 2", val)
+}
+
+func Test_Apply_InvalidSelectorType(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleNavHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	_, err = p.Apply(Rule{Type: "jquery", XPath: "a", Filter: ".+"})
+	require.ErrorIs(t, err, ErrInvalidSelectorType)
+}
+
+func Test_Validate_CSS(t *testing.T) {
+	require.NoError(t, Validate(Rule{Type: SelectorCSS, XPath: "a.next", Attr: "href", Filter: ".+"}))
+	require.ErrorIs(t, Validate(Rule{Type: SelectorCSS, XPath: "a[", Filter: ".+"}), ErrInvalidCSS)
+	require.ErrorIs(t, Validate(Rule{Type: "jquery", XPath: "a", Filter: ".+"}), ErrInvalidSelectorType)
+}
+
+var exampleArchiveHTML = `<html>
+<body>
+<ul class="archive">
+<li><a href="/comic/1">  Tom &amp; Jerry  </a></li>
+<li><a href="/comic/2">Second Strip</a></li>
+<li><a href="/about">About</a></li>
+</ul>
+</body>
+</html>
+`
+
+func Test_ApplyAll_XPath(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleArchiveHTML), "http://example.com/archive/")
+	require.NoError(t, err)
+
+	vals, err := p.ApplyAll(Rule{XPath: "//ul/li/a/@href", Filter: "/comic/(\\d+)"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, vals)
+
+	vals, err = p.ApplyAll(Rule{XPath: "//ul/li/a", Attr: "href", Transforms: []Transform{{Kind: TransformResolveURL}}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://example.com/comic/1", "http://example.com/comic/2", "http://example.com/about"}, vals)
+}
+
+func Test_ApplyAll_CSS(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleArchiveHTML), "http://example.com/archive/")
+	require.NoError(t, err)
+
+	vals, err := p.ApplyAll(Rule{Type: SelectorCSS, XPath: "ul.archive a", Transforms: []Transform{
+		{Kind: TransformTrim},
+		{Kind: TransformLower},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"tom & jerry", "second strip", "about"}, vals)
+}
+
+func Test_ApplyAll_NoMatch(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleArchiveHTML), "http://example.com/archive/")
+	require.NoError(t, err)
+
+	_, err = p.ApplyAll(Rule{Type: SelectorCSS, XPath: "ol a"})
+	require.ErrorIs(t, err, ErrCSSNoMatch)
+
+	_, err = p.ApplyAll(Rule{XPath: "//ul/li/a/@href", Filter: "/page/(\\d+)"})
+	require.ErrorIs(t, err, ErrRegexpNoMatch)
+}
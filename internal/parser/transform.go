@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidTransform = errors.New("invalid transform")
+	ErrInvalidURL       = errors.New("invalid url")
+)
+
+// TransformKind says what a Transform does to a value
+type TransformKind string
+
+const (
+	// TransformFind keeps the first capture group of the first match of Pattern, or the whole match if
+	// Pattern has no groups. A value that doesn't match fails with ErrRegexpNoMatch.
+	TransformFind TransformKind = "find"
+	// TransformReplace replaces every match of Pattern with Replacement, which may refer to groups as $1
+	TransformReplace TransformKind = "replace"
+	// TransformTrim removes leading and trailing whitespace
+	TransformTrim TransformKind = "trim"
+	// TransformResolveURL resolves a relative URL against the URL of the page
+	TransformResolveURL TransformKind = "resolve_url"
+	// TransformHTMLUnescape turns HTML entities such as &amp; into the characters they stand for
+	TransformHTMLUnescape TransformKind = "html_unescape"
+	// TransformLower lower cases the value
+	TransformLower TransformKind = "lower"
+	// TransformUpper upper cases the value
+	TransformUpper TransformKind = "upper"
+)
+
+// Transform is one step of the chain a Rule passes its values through
+type Transform struct {
+	Kind        TransformKind `json:"kind"`
+	Pattern     string        `json:"pattern,omitempty"`
+	Replacement string        `json:"replacement,omitempty"`
+}
+
+// validateTransform checks that the given Transform is known and its Pattern compiles
+func validateTransform(t Transform) error {
+	switch t.Kind {
+	case TransformFind, TransformReplace:
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			return fmt.Errorf("%w %q: %v", ErrInvalidRegexp, t.Pattern, err)
+		}
+	case TransformTrim, TransformResolveURL, TransformHTMLUnescape, TransformLower, TransformUpper:
+	default:
+		return fmt.Errorf("%w %q", ErrInvalidTransform, t.Kind)
+	}
+	return nil
+}
+
+// applyTransforms passes text through the given Transforms in order
+func (p *pageParser) applyTransforms(ts []Transform, text string) (string, error) {
+	var err error
+	for _, t := range ts {
+		if text, err = p.applyTransform(t, text); err != nil {
+			return text, err
+		}
+	}
+	return text, nil
+}
+
+func (p *pageParser) applyTransform(t Transform, text string) (string, error) {
+	switch t.Kind {
+	case TransformFind:
+		return p.applyFilter(t.Pattern, text)
+	case TransformReplace:
+		r, err := p.CompileRegexp(t.Pattern)
+		if err != nil {
+			return "", ErrInvalidRegexp
+		}
+		return r.ReplaceAllString(text, t.Replacement), nil
+	case TransformTrim:
+		return strings.TrimSpace(text), nil
+	case TransformResolveURL:
+		ref, err := url.Parse(strings.TrimSpace(text))
+		if err != nil {
+			return text, ErrInvalidURL
+		}
+		if p.URL == nil {
+			return ref.String(), nil
+		}
+		return p.URL.ResolveReference(ref).String(), nil
+	case TransformHTMLUnescape:
+		return html.UnescapeString(text), nil
+	case TransformLower:
+		return strings.ToLower(text), nil
+	case TransformUpper:
+		return strings.ToUpper(text), nil
+	default:
+		return "", ErrInvalidTransform
+	}
+}
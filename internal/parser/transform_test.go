@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ApplyTransforms(t *testing.T) {
+	p, err := newPageParser(strings.NewReader(exampleHTML), "http://example.com/comic/2")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		transforms []Transform
+		in         string
+		want       string
+		err        error
+	}{
+		{"None", nil, " as is ", " as is ", nil},
+		{"Find", []Transform{{Kind: TransformFind, Pattern: `#(\d+)`}}, "Episode #42: Title", "42", nil},
+		{"FindNoGroup", []Transform{{Kind: TransformFind, Pattern: `\d+`}}, "Episode 42", "42", nil},
+		{"FindNoMatch", []Transform{{Kind: TransformFind, Pattern: `#(\d+)`}}, "Episode", "Episode", ErrRegexpNoMatch},
+		{"Replace", []Transform{{Kind: TransformReplace, Pattern: `^Episode (\d+):\s*`, Replacement: "$1 - "}}, "Episode 42: Title", "42 - Title", nil},
+		{"Trim", []Transform{{Kind: TransformTrim}}, "\n  Title \t", "Title", nil},
+		{"ResolveRelative", []Transform{{Kind: TransformResolveURL}}, "3", "http://example.com/comic/3", nil},
+		{"ResolveRooted", []Transform{{Kind: TransformResolveURL}}, " /comic/3 ", "http://example.com/comic/3", nil},
+		{"ResolveAbsolute", []Transform{{Kind: TransformResolveURL}}, "https://cdn.example.com/3.png", "https://cdn.example.com/3.png", nil},
+		{"ResolveInvalid", []Transform{{Kind: TransformResolveURL}}, "http://[::1", "http://[::1", ErrInvalidURL},
+		{"HTMLUnescape", []Transform{{Kind: TransformHTMLUnescape}}, "Tom &amp; Jerry &#39;s", "Tom & Jerry 's", nil},
+		{"Lower", []Transform{{Kind: TransformLower}}, "Title", "title", nil},
+		{"Upper", []Transform{{Kind: TransformUpper}}, "Title", "TITLE", nil},
+		{"Chain", []Transform{
+			{Kind: TransformHTMLUnescape},
+			{Kind: TransformReplace, Pattern: `\s+`, Replacement: " "},
+			{Kind: TransformTrim},
+			{Kind: TransformUpper},
+		}, "  Tom &amp;\n Jerry ", "TOM & JERRY", nil},
+		{"Unknown", []Transform{{Kind: "reverse"}}, "Title", "", ErrInvalidTransform},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.applyTransforms(tc.transforms, tc.in)
+			require.ErrorIs(t, err, tc.err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_Validate_Transforms(t *testing.T) {
+	require.NoError(t, Validate(Rule{XPath: "//title", Transforms: []Transform{
+		{Kind: TransformReplace, Pattern: `\s+`, Replacement: " "},
+		{Kind: TransformTrim},
+	}}))
+	require.ErrorIs(t, Validate(Rule{XPath: "//title", Transforms: []Transform{{Kind: TransformFind, Pattern: "("}}}), ErrInvalidRegexp)
+	require.ErrorIs(t, Validate(Rule{XPath: "//title", Transforms: []Transform{{Kind: "reverse"}}}), ErrInvalidTransform)
+}
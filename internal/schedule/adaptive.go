@@ -0,0 +1,94 @@
+package schedule
+
+import (
+	"time"
+)
+
+const (
+	hoursPerWeek = 7 * 24
+	// minHotCount is the fewest updates seen in an hour of the week for it to be hot
+	minHotCount = 3
+	// minHotPercent is the smallest share of all updates seen in an hour of the week for it to be hot
+	minHotPercent = 10
+)
+
+// Adaptive schedules the crawls of a comic from the times its updates were seen before.
+//
+// Crawls back off exponentially from Base, doubling with each crawl in a row that finds nothing new, up to Max.
+// Hours of the week in which the comic has repeatedly updated are hot: a crawl is scheduled for the start of
+// the next hot hour even if the backoff would wait longer, and crawls repeat every Min until HotWindow after it.
+type Adaptive struct {
+	Base      time.Duration
+	Min       time.Duration
+	Max       time.Duration
+	HotWindow time.Duration
+}
+
+// Next returns when to crawl next, given when the last crawl ended, the times updates were seen in any order,
+// and the number of crawls in a row up to the last one that found no updates.
+func (a Adaptive) Next(lastEnded time.Time, seen []time.Time, emptyCrawls int) time.Time {
+	next := lastEnded.Add(Backoff(a.Base, a.Max, emptyCrawls))
+
+	hot := hotHours(seen)
+	if len(hot) == 0 {
+		return next
+	}
+
+	ended := lastEnded.UTC()
+	hour := ended.Truncate(time.Hour)
+	for start := hour; ended.Before(start.Add(a.HotWindow)); start = start.Add(-time.Hour) {
+		if hot[weekHour(start)] {
+			if soon := ended.Add(a.Min); soon.Before(next) {
+				next = soon
+			}
+			break
+		}
+	}
+
+	for start := hour.Add(time.Hour); start.Before(next); start = start.Add(time.Hour) {
+		if hot[weekHour(start)] {
+			return start
+		}
+	}
+	return next
+}
+
+// Backoff returns base doubled for each of n attempts in a row after the first, capped at max
+func Backoff(base, max time.Duration, n int) time.Duration {
+	d := base
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// hotHours returns the hours of the week in which updates were repeatedly seen. Updates seen within the same
+// hour count once, so that the archive found by a comic's first crawl doesn't make that hour hot.
+func hotHours(seen []time.Time) map[int]bool {
+	distinct := make(map[time.Time]bool)
+	for _, t := range seen {
+		distinct[t.UTC().Truncate(time.Hour)] = true
+	}
+
+	var counts [hoursPerWeek]int
+	for t := range distinct {
+		counts[weekHour(t)]++
+	}
+
+	hot := make(map[int]bool)
+	for h, n := range counts {
+		if n >= minHotCount && n*100 >= len(distinct)*minHotPercent {
+			hot[h] = true
+		}
+	}
+	return hot
+}
+
+// weekHour returns the hour of the week of t in UTC, counting from midnight on Sunday
+func weekHour(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mwf returns the times a comic updating at 05:20 UTC on Mondays, Wednesdays and Fridays was seen over the given number of weeks
+func mwf(weeks int) []time.Time {
+	var seen []time.Time
+	// a Monday
+	start := time.Date(2024, 1, 1, 5, 20, 0, 0, time.UTC)
+	for w := 0; w < weeks; w++ {
+		for _, d := range []int{0, 2, 4} {
+			seen = append(seen, start.AddDate(0, 0, 7*w+d))
+		}
+	}
+	return seen
+}
+
+func TestAdaptive_Next(t *testing.T) {
+	a := Adaptive{Base: time.Hour, Min: 10 * time.Minute, Max: 48 * time.Hour, HotWindow: 2 * time.Hour}
+	// a Sunday
+	sunday := time.Date(2024, 3, 3, 20, 0, 0, 0, time.UTC)
+	monday := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name      string
+		lastEnded time.Time
+		seen      []time.Time
+		empty     int
+		want      time.Time
+	}{
+		{"NoHistory", sunday, nil, 0, sunday.Add(time.Hour)},
+		{"OneEmpty", sunday, nil, 1, sunday.Add(time.Hour)},
+		{"Backoff", sunday, nil, 4, sunday.Add(8 * time.Hour)},
+		{"BackoffMax", sunday, nil, 20, sunday.Add(48 * time.Hour)},
+		{"HotHourSooner", sunday, mwf(6), 5, monday.Add(5 * time.Hour)},
+		{"BackoffSooner", sunday, mwf(6), 1, sunday.Add(time.Hour)},
+		{"InHotWindow", monday.Add(5*time.Hour + 25*time.Minute), mwf(6), 1, monday.Add(5*time.Hour + 35*time.Minute)},
+		{"EndOfHotWindow", monday.Add(6*time.Hour + 55*time.Minute), mwf(6), 1, monday.Add(7*time.Hour + 5*time.Minute)},
+		{"AfterHotWindow", monday.Add(7*time.Hour + 5*time.Minute), mwf(6), 1, monday.Add(8*time.Hour + 5*time.Minute)},
+		{"TooLittleHistory", sunday, mwf(2), 5, sunday.Add(16 * time.Hour)},
+		{"Burst", sunday, burst(monday.Add(-7*24*time.Hour+5*time.Hour), 100), 5, sunday.Add(16 * time.Hour)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, a.Next(tc.lastEnded, tc.seen, tc.empty))
+		})
+	}
+}
+
+// burst returns n times within a minute of t, as seen by the first crawl of a comic's archive
+func burst(t time.Time, n int) []time.Time {
+	seen := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		seen = append(seen, t.Add(time.Duration(i)*time.Second/2))
+	}
+	return seen
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, Backoff(time.Minute, time.Hour, 0))
+	assert.Equal(t, time.Minute, Backoff(time.Minute, time.Hour, 1))
+	assert.Equal(t, 2*time.Minute, Backoff(time.Minute, time.Hour, 2))
+	assert.Equal(t, 32*time.Minute, Backoff(time.Minute, time.Hour, 6))
+	assert.Equal(t, time.Hour, Backoff(time.Minute, time.Hour, 7))
+	assert.Equal(t, time.Hour, Backoff(time.Minute, time.Hour, 1000))
+}
+
+func TestHotHours(t *testing.T) {
+	hot := hotHours(mwf(4))
+	assert.Equal(t, map[int]bool{1*24 + 5: true, 3*24 + 5: true, 5*24 + 5: true}, hot)
+
+	// updates at random hours never make an hour hot
+	var scattered []time.Time
+	for i := 0; i < 50; i++ {
+		scattered = append(scattered, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i*29)*time.Hour))
+	}
+	assert.Empty(t, hotHours(scattered))
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@fortnightly",
+	} {
+		_, err := ParseCron(expr)
+		assert.True(t, errors.Is(err, ErrInvalidCron), "expected %q to be invalid, got %v", expr, err)
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// a Saturday
+	from := time.Date(2024, 3, 2, 10, 30, 15, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 2, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 3, 3, 10, 30, 0, 0, time.UTC)},
+		{"0 5 * * *", time.Date(2024, 3, 3, 5, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 5 * * 1,3,5", time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)},
+		{"0 5 * * 1-5/2", time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week when both are restricted
+		{"0 0 15 * 1", time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 2, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		c, err := ParseCron(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.want, c.Next(from), tc.expr)
+	}
+}
+
+func TestCron_Next_NonUTC(t *testing.T) {
+	c, err := ParseCron("0 5 * * *")
+	require.NoError(t, err)
+	from := time.Date(2024, 3, 2, 6, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	assert.Equal(t, time.Date(2024, 3, 2, 5, 0, 0, 0, time.UTC), c.Next(from))
+}
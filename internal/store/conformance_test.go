@@ -0,0 +1,802 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+	"github.com/johnstcn/freshcomics/internal/ipinfo/ipinfotest"
+)
+
+// postgresTestDSNEnv names the environment variable holding the DSN of a disposable Postgres
+// database to run the conformance suite against. Its schema is dropped and recreated.
+const postgresTestDSNEnv = "FRESHCOMICS_TEST_POSTGRES_DSN"
+
+// ConformanceTestSuite runs the same scenarios against each Store implementation
+type ConformanceTestSuite struct {
+	suite.Suite
+	newStore func(t *testing.T, geoIP ipinfo.IPInfoer) Store
+	store    Store
+	mip      *ipinfotest.IPInfoer
+}
+
+func (s *ConformanceTestSuite) SetupTest() {
+	s.mip = &ipinfotest.IPInfoer{}
+	s.mip.On("GetIPInfo", mock.Anything).Return(ipinfo.GeoLoc{Country: "IE", Region: "L", City: "Dublin"}, nil)
+	s.store = s.newStore(s.T(), s.mip)
+}
+
+// openSQLStore returns a function that opens the database given by dsn with an empty schema
+func openSQLStore(dsn func(t *testing.T) string) func(*testing.T, ipinfo.IPInfoer) Store {
+	return func(t *testing.T, geoIP ipinfo.IPInfoer) Store {
+		conn, err := Open(dsn(t))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		migrator, err := NewMigrator(conn)
+		require.NoError(t, err)
+		require.NoError(t, migrator.To(0))
+		require.NoError(t, migrator.Up())
+		st, err := New(conn, geoIP)
+		require.NoError(t, err)
+		return st
+	}
+}
+
+func (s *ConformanceTestSuite) createSiteDef(name string, active bool) SiteDef {
+	def := SiteDef{
+		Name:          name,
+		Active:        active,
+		StartURL:      "http://" + name + ".example.com/1",
+		URLTemplate:   "http://" + name + ".example.com/%s",
+		NextPageXPath: "//a/@href",
+		RefRegexp:     "(\\d+)$",
+		TitleXPath:    "//title/text()",
+		TitleRegexp:   "(.+)",
+		CrawlStrategy: CrawlStrategyPage,
+	}
+	id, err := s.store.CreateSiteDef(def)
+	s.Require().NoError(err)
+	def.ID = id
+	return def
+}
+
+func (s *ConformanceTestSuite) createSiteUpdate(def SiteDef, ref string, seenAt time.Time) SiteUpdate {
+	su := SiteUpdate{
+		SiteDefID: def.ID,
+		Ref:       ref,
+		URL:       "http://" + def.Name + ".example.com/" + ref,
+		Title:     def.Name + " " + ref,
+		SeenAt:    seenAt,
+	}
+	id, err := s.store.CreateSiteUpdate(su)
+	s.Require().NoError(err)
+	su.ID = id
+	return su
+}
+
+func (s *ConformanceTestSuite) createUser(name string) User {
+	u := User{Name: name, PasswordHash: "hash", Role: RoleUser}
+	id, err := s.store.CreateUser(u)
+	s.Require().NoError(err)
+	u.ID = id
+	return u
+}
+
+func (s *ConformanceTestSuite) TestSiteDefs() {
+	defs, err := s.store.GetSiteDefs(true)
+	s.NoError(err)
+	s.NotNil(defs)
+	s.Empty(defs)
+
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", false)
+
+	active, err := s.store.GetSiteDefs(false)
+	s.NoError(err)
+	s.Equal([]SiteDef{a}, active)
+
+	all, err := s.store.GetSiteDefs(true)
+	s.NoError(err)
+	s.Equal([]SiteDef{a, b}, all)
+
+	b.Active = true
+	b.CrawlStrategy = CrawlStrategyFeed
+	b.FeedURL = "http://b.example.com/feed"
+	b.CrawlCron = "0 5 * * 1,3,5"
+	b.CrawlJitterSecs = 600
+	b.FetchDelaySecs = 5
+	b.SelectorType = "css"
+	b.NextPageAttr = "href"
+	b.TitleAttr = "alt"
+	b.ImageXPath = "img.comic"
+	b.ImageAttr = "src"
+	b.AltTextXPath = "img.comic"
+	b.AltTextAttr = "title"
+	b.PublishedXPath = "time"
+	b.PublishedAttr = "datetime"
+	b.PublishedRegexp = `(\d{4}-\d{2}-\d{2})`
+	b.PublishedFormat = "2006-01-02"
+	b.PrevPageXPath = "a.prev"
+	b.PrevPageAttr = "href"
+	b.BackfillURL = "http://b.example.com/"
+	s.NoError(s.store.UpdateSiteDef(b))
+	got, err := s.store.GetSiteDef(b.ID)
+	s.NoError(err)
+	s.Equal(b, got)
+
+	s.NoError(s.store.MarkSiteDefBroken(b.ID, "too many failures"))
+	got, err = s.store.GetSiteDef(b.ID)
+	s.NoError(err)
+	s.False(got.Active)
+	s.Equal("too many failures", got.BrokenReason)
+	got.Active = true
+	got.BrokenReason = ""
+	s.Equal(b, got)
+
+	_, err = s.store.GetSiteDef(b.ID + 1)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *ConformanceTestSuite) TestFeedSiteDefs() {
+	for _, name := range []string{"a", "b"} {
+		_, err := s.store.CreateSiteDef(SiteDef{
+			Name:          name,
+			StartURL:      "http://" + name + ".example.com",
+			RefRegexp:     "(\\d+)$",
+			CrawlStrategy: CrawlStrategyFeed,
+			FeedURL:       "http://" + name + ".example.com/feed",
+		})
+		s.NoError(err, "feed site defs don't need a URL template of their own")
+	}
+
+	defs, err := s.store.GetSiteDefs(true)
+	s.NoError(err)
+	s.Len(defs, 2)
+}
+
+func (s *ConformanceTestSuite) TestSiteUpdates() {
+	now := time.Now().Truncate(time.Second)
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	a1 := s.createSiteUpdate(a, "1", now.Add(-2*time.Hour))
+	a2 := s.createSiteUpdate(a, "2", now.Add(-time.Hour))
+	b1 := s.createSiteUpdate(b, "1", now.Add(-3*time.Hour))
+
+	updates, err := s.store.GetSiteUpdates(a.ID)
+	s.NoError(err)
+	if s.Len(updates, 2) {
+		s.Equal(a2.ID, updates[0].ID)
+		s.True(a2.SeenAt.Equal(updates[0].SeenAt))
+		s.Equal(a1.ID, updates[1].ID)
+	}
+
+	times, err := s.store.GetSiteUpdateTimes(a.ID, 1)
+	s.NoError(err)
+	if s.Len(times, 1) {
+		s.True(a2.SeenAt.Equal(times[0]))
+	}
+
+	su, found, err := s.store.GetSiteUpdate(a.ID, "1")
+	s.NoError(err)
+	s.True(found)
+	s.Equal(a1.URL, su.URL)
+	_, found, err = s.store.GetSiteUpdate(a.ID, "3")
+	s.NoError(err)
+	s.False(found)
+
+	lastURL, err := s.store.GetLastURL(a.ID)
+	s.NoError(err)
+	s.Equal(a2.URL, lastURL)
+
+	redirect, err := s.store.Redirect(b1.ID)
+	s.NoError(err)
+	s.Equal(b1.URL, redirect)
+
+	comics, err := s.store.GetComics()
+	s.NoError(err)
+	if s.Len(comics, 2) {
+		s.Equal(a2.Title, comics[0].Title)
+		s.Equal(b1.Title, comics[1].Title)
+		s.Equal(StringList{}, comics[0].ImageURLs)
+		s.Nil(comics[0].PublishedAt)
+	}
+}
+
+func (s *ConformanceTestSuite) TestComicsSameSeenAt() {
+	// a feed crawl sees all of its items at once, persisting them oldest first
+	now := time.Now().Truncate(time.Second)
+	a := s.createSiteDef("a", true)
+	s.createSiteUpdate(a, "1", now)
+	s.createSiteUpdate(a, "2", now)
+	a3 := s.createSiteUpdate(a, "3", now)
+
+	comics, err := s.store.GetComics()
+	s.NoError(err)
+	if s.Len(comics, 1) {
+		s.Equal(a3.Title, comics[0].Title)
+	}
+}
+
+func (s *ConformanceTestSuite) TestSiteUpdateMedia() {
+	now := time.Now().Truncate(time.Second)
+	published := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	a := s.createSiteDef("a", true)
+	_, err := s.store.CreateSiteUpdate(SiteUpdate{
+		SiteDefID:   a.ID,
+		Ref:         "1",
+		URL:         "http://a.example.com/1",
+		Title:       "a 1",
+		SeenAt:      now,
+		ImageURLs:   StringList{"http://a.example.com/1a.png", "http://a.example.com/1b.png"},
+		AltText:     "hover text",
+		PublishedAt: pq.NullTime{Time: published, Valid: true},
+	})
+	s.NoError(err)
+
+	su, found, err := s.store.GetSiteUpdate(a.ID, "1")
+	s.NoError(err)
+	s.True(found)
+	s.Equal(StringList{"http://a.example.com/1a.png", "http://a.example.com/1b.png"}, su.ImageURLs)
+	s.Equal("hover text", su.AltText)
+	s.True(su.PublishedAt.Valid)
+	s.True(published.Equal(su.PublishedAt.Time))
+
+	comics, err := s.store.GetComics()
+	s.NoError(err)
+	if s.Len(comics, 1) {
+		s.Equal(su.ImageURLs, comics[0].ImageURLs)
+		s.Equal("hover text", comics[0].AltText)
+		if s.NotNil(comics[0].PublishedAt) {
+			s.True(published.Equal(*comics[0].PublishedAt))
+		}
+	}
+}
+
+func (s *ConformanceTestSuite) TestConstraints() {
+	now := time.Now()
+	a := s.createSiteDef("a", true)
+	a1 := s.createSiteUpdate(a, "1", now)
+
+	dup := a
+	dup.ID = 0
+	_, err := s.store.CreateSiteDef(dup)
+	s.Error(err, "site def names must be unique")
+	dup.Name = "other"
+	_, err = s.store.CreateSiteDef(dup)
+	s.Error(err, "site def start URLs must be unique")
+	dup.StartURL = "http://other.example.com"
+	_, err = s.store.CreateSiteDef(dup)
+	s.Error(err, "page site def URL templates must be unique")
+
+	_, err = s.store.CreateSiteUpdate(SiteUpdate{SiteDefID: a.ID, Ref: "2", URL: a1.URL, Title: "dup", SeenAt: now})
+	s.Error(err, "site update URLs must be unique")
+	_, err = s.store.CreateSiteUpdate(SiteUpdate{SiteDefID: a.ID, Ref: a1.Ref, URL: a1.URL + "/other", Title: "dup", SeenAt: now})
+	s.Error(err, "site update refs must be unique per site def")
+	_, err = s.store.CreateSiteUpdate(SiteUpdate{SiteDefID: a.ID + 1, Ref: "1", URL: "http://missing.example.com/1", Title: "missing", SeenAt: now})
+	s.Error(err, "site updates must belong to a site def")
+
+	s.createUser("alice")
+	_, err = s.store.CreateUser(User{Name: "alice", PasswordHash: "hash", Role: RoleUser})
+	s.ErrorIs(err, ErrUserNameTaken, "user names must be unique")
+
+	updates, err := s.store.GetSiteUpdates(a.ID)
+	s.NoError(err)
+	s.Len(updates, 1)
+}
+
+func (s *ConformanceTestSuite) TestUpdateImages() {
+	now := time.Now().Truncate(time.Second)
+	a := s.createSiteDef("a", true)
+	a1 := s.createSiteUpdate(a, "1", now)
+	a2 := s.createSiteUpdate(a, "2", now)
+
+	images, err := s.store.GetUpdateImages(a1.ID)
+	s.NoError(err)
+	s.NotNil(images)
+	s.Empty(images)
+
+	second := UpdateImage{UpdateID: a1.ID, Position: 1, URL: "http://a.example.com/1b.gif", Hash: "bbbb", MIMEType: "image/gif", Size: 10, ArchivedAt: now}
+	first := UpdateImage{UpdateID: a1.ID, Position: 0, URL: "http://a.example.com/1a.png", Hash: "aaaa", MIMEType: "image/png", Width: 640, Height: 480, Size: 1234, ArchivedAt: now}
+	second.ID, err = s.store.CreateUpdateImage(second)
+	s.NoError(err)
+	first.ID, err = s.store.CreateUpdateImage(first)
+	s.NoError(err)
+	// the same image may appear in several updates
+	reused := UpdateImage{UpdateID: a2.ID, Position: 0, URL: "http://a.example.com/2.png", Hash: "aaaa", MIMEType: "image/png", ArchivedAt: now}
+	_, err = s.store.CreateUpdateImage(reused)
+	s.NoError(err)
+
+	images, err = s.store.GetUpdateImages(a1.ID)
+	s.NoError(err)
+	if s.Len(images, 2) {
+		s.Equal(first.ID, images[0].ID)
+		s.Equal(first.URL, images[0].URL)
+		s.Equal(640, images[0].Width)
+		s.Equal(int64(1234), images[0].Size)
+		s.True(now.Equal(images[0].ArchivedAt))
+		s.Equal(second.ID, images[1].ID)
+	}
+
+	got, err := s.store.GetUpdateImageByHash("aaaa")
+	s.NoError(err)
+	s.Equal(first.URL, got.URL)
+	s.Equal("image/png", got.MIMEType)
+	_, err = s.store.GetUpdateImageByHash("cccc")
+	s.Equal(sql.ErrNoRows, err)
+
+	_, err = s.store.CreateUpdateImage(UpdateImage{UpdateID: a1.ID, Position: 0, URL: "http://a.example.com/dup.png", Hash: "dddd", MIMEType: "image/png", ArchivedAt: now})
+	s.Error(err, "one image per position")
+	_, err = s.store.CreateUpdateImage(UpdateImage{UpdateID: a2.ID + 1, URL: "http://a.example.com/missing.png", Hash: "eeee", MIMEType: "image/png", ArchivedAt: now})
+	s.Error(err, "the update must exist")
+}
+
+func (s *ConformanceTestSuite) TestCrawlInfos() {
+	a := s.createSiteDef("a", true)
+	id, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+
+	pending, err := s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	if s.Len(pending, 1) {
+		s.Equal(id, pending[0].ID)
+		s.False(pending[0].StartedAt.Valid)
+	}
+
+	s.NoError(s.store.StartCrawlInfo(id))
+	pending, err = s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	s.Empty(pending)
+
+	s.NoError(s.store.EndCrawlInfo(id, "", errTest, 3))
+	infos, err := s.store.GetCrawlInfo(a.ID)
+	s.NoError(err)
+	if s.Len(infos, 1) {
+		s.True(infos[0].StartedAt.Valid)
+		s.True(infos[0].EndedAt.Valid)
+		s.Equal("some error", infos[0].Error)
+		s.Equal(3, infos[0].Seen)
+	}
+
+	all, err := s.store.GetCrawlInfos()
+	s.NoError(err)
+	s.Len(all, 1)
+}
+
+func (s *ConformanceTestSuite) TestCrawlInfoOrder() {
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	first, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	second, err := s.store.CreateCrawlInfo(b.ID, b.StartURL)
+	s.NoError(err)
+	third, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+
+	pending, err := s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{first, second, third}, crawlInfoIDs(pending))
+
+	all, err := s.store.GetCrawlInfos()
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{third, second, first}, crawlInfoIDs(all))
+
+	forA, err := s.store.GetCrawlInfo(a.ID)
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{third, first}, crawlInfoIDs(forA))
+}
+
+func (s *ConformanceTestSuite) TestClaimCrawlInfo() {
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	first, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	second, err := s.store.CreateCrawlInfo(b.ID, b.StartURL)
+	s.NoError(err)
+	third, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, nil)
+	s.Require().NoError(err)
+	s.Equal(first, ci.ID)
+	s.Equal(a.StartURL, ci.URL)
+	s.Equal("w1", ci.WorkerID)
+	s.True(ci.StartedAt.Valid)
+	if s.True(ci.LeaseExpiresAt.Valid) {
+		s.WithinDuration(time.Now().Add(time.Minute), ci.LeaseExpiresAt.Time, 10*time.Second)
+	}
+
+	pending, err := s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{second, third}, crawlInfoIDs(pending))
+
+	// crawls on a skipped origin are passed over
+	ci, err = s.store.ClaimNextCrawlInfo("w2", time.Minute, []string{"http://b.example.com"})
+	s.Require().NoError(err)
+	s.Equal(third, ci.ID)
+	_, err = s.store.ClaimNextCrawlInfo("w3", time.Minute, []string{"http://b.example.com", "http://a.example.com"})
+	s.Equal(sql.ErrNoRows, err)
+
+	// only the worker holding the lease can renew it, and only until the crawl ends
+	s.NoError(s.store.RenewCrawlInfoLease(first, "w1", time.Minute))
+	s.Equal(ErrLeaseLost, s.store.RenewCrawlInfoLease(first, "w2", time.Minute))
+	s.NoError(s.store.EndCrawlInfo(first, "w1", nil, 1))
+	s.Equal(ErrLeaseLost, s.store.RenewCrawlInfoLease(first, "w1", time.Minute))
+
+	// an expired lease puts the crawl back to pending for another worker to claim
+	ci, err = s.store.ClaimNextCrawlInfo("w4", time.Millisecond, nil)
+	s.Require().NoError(err)
+	s.Equal(second, ci.ID)
+	time.Sleep(50 * time.Millisecond)
+	pending, err = s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{second}, crawlInfoIDs(pending))
+	ci, err = s.store.ClaimNextCrawlInfo("w5", time.Minute, nil)
+	s.Require().NoError(err)
+	s.Equal(second, ci.ID)
+	s.Equal("w5", ci.WorkerID)
+	s.Equal(ErrLeaseLost, s.store.RenewCrawlInfoLease(second, "w4", time.Minute))
+
+	// the worker whose lease expired can't end the crawl from under the one that claimed it since
+	s.Equal(ErrLeaseLost, s.store.EndCrawlInfo(second, "w4", errTest, 0))
+	infos, err := s.store.GetCrawlInfo(b.ID)
+	s.NoError(err)
+	if s.Len(infos, 1) {
+		s.False(infos[0].EndedAt.Valid)
+		s.Empty(infos[0].Error)
+	}
+	s.NoError(s.store.EndCrawlInfo(second, "w5", nil, 2))
+
+	_, err = s.store.ClaimNextCrawlInfo("w6", time.Minute, nil)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *ConformanceTestSuite) TestClaimCrawlInfoOrigins() {
+	a := s.createSiteDef("a", true)
+	mixedCase, err := s.store.CreateCrawlInfo(a.ID, "http://A.Example.com/1")
+	s.NoError(err)
+	bare, err := s.store.CreateCrawlInfo(a.ID, "http://a.example.com")
+	s.NoError(err)
+	wildcard, err := s.store.CreateCrawlInfo(a.ID, "http://a_example.com/1")
+	s.NoError(err)
+
+	infos, err := s.store.GetCrawlInfo(a.ID)
+	s.NoError(err)
+	if s.Len(infos, 3) {
+		s.Equal("http://a.example.com", infos[1].Origin)
+		s.Equal("http://a.example.com", infos[2].Origin)
+	}
+
+	// crawl URLs and skip origins are both normalised with Origin, so case and paths don't matter,
+	// but origins are then compared exactly rather than as patterns
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, []string{"http://a.example.com"})
+	s.Require().NoError(err)
+	s.Equal(wildcard, ci.ID)
+	s.Equal("http://a_example.com", ci.Origin)
+	_, err = s.store.ClaimNextCrawlInfo("w2", time.Minute, []string{"HTTP://A.EXAMPLE.COM"})
+	s.Equal(sql.ErrNoRows, err)
+
+	ci, err = s.store.ClaimNextCrawlInfo("w3", time.Minute, []string{"http://a_example.com"})
+	s.Require().NoError(err)
+	s.Equal(mixedCase, ci.ID)
+	ci, err = s.store.ClaimNextCrawlInfo("w4", time.Minute, nil)
+	s.Require().NoError(err)
+	s.Equal(bare, ci.ID)
+}
+
+func (s *ConformanceTestSuite) TestAbandonStaleCrawlInfos() {
+	a := s.createSiteDef("a", true)
+	noLease, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	s.NoError(s.store.StartCrawlInfo(noLease))
+	live, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	_, err = s.store.ClaimNextCrawlInfo("w1", time.Minute, nil)
+	s.NoError(err)
+	expired, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	_, err = s.store.ClaimNextCrawlInfo("w2", time.Millisecond, nil)
+	s.NoError(err)
+	ended, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	s.NoError(s.store.StartCrawlInfo(ended))
+	s.NoError(s.store.EndCrawlInfo(ended, "", nil, 1))
+	notStarted, err := s.store.CreateCrawlInfo(a.ID, a.StartURL)
+	s.NoError(err)
+	time.Sleep(50 * time.Millisecond)
+
+	n, err := s.store.AbandonStaleCrawlInfos(time.Now().Add(-time.Hour))
+	s.NoError(err)
+	s.Zero(n)
+
+	n, err = s.store.AbandonStaleCrawlInfos(time.Now().Add(time.Minute))
+	s.NoError(err)
+	s.Equal(2, n)
+
+	infos, err := s.store.GetCrawlInfo(a.ID)
+	s.NoError(err)
+	byID := make(map[CrawlInfoID]CrawlInfo)
+	for _, ci := range infos {
+		byID[ci.ID] = ci
+	}
+	for _, id := range []CrawlInfoID{noLease, expired} {
+		s.True(byID[id].EndedAt.Valid)
+		s.Equal(ErrCrawlAbandoned.Error(), byID[id].Error)
+	}
+	s.False(byID[live].EndedAt.Valid)
+	s.False(byID[notStarted].EndedAt.Valid)
+	s.Empty(byID[ended].Error)
+
+	pending, err := s.store.GetPendingCrawlInfos()
+	s.NoError(err)
+	s.Equal([]CrawlInfoID{notStarted}, crawlInfoIDs(pending))
+}
+
+func crawlInfoIDs(infos []CrawlInfo) []CrawlInfoID {
+	ids := make([]CrawlInfoID, 0, len(infos))
+	for _, ci := range infos {
+		ids = append(ids, ci.ID)
+	}
+	return ids
+}
+
+func (s *ConformanceTestSuite) TestBackfills() {
+	before := time.Now().Add(-time.Hour).Truncate(time.Second)
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+
+	_, err := s.store.GetBackfill(a.ID)
+	s.Equal(sql.ErrNoRows, err)
+	_, err = s.store.ClaimNextBackfill("w1", time.Minute)
+	s.Equal(sql.ErrNoRows, err)
+
+	s.NoError(s.store.CreateBackfill(Backfill{SiteDefID: a.ID, URL: "http://a.example.com/", MaxPages: 10, DatedBefore: before}))
+	s.NoError(s.store.CreateBackfill(Backfill{SiteDefID: b.ID, URL: "http://b.example.com/", DatedBefore: before}))
+	s.Error(s.store.CreateBackfill(Backfill{SiteDefID: b.ID + 1, URL: "http://c.example.com/", DatedBefore: before}), "the site def must exist")
+
+	got, err := s.store.GetBackfill(a.ID)
+	s.Require().NoError(err)
+	s.Equal("http://a.example.com/", got.URL)
+	s.Equal(10, got.MaxPages)
+	s.True(before.Equal(got.DatedBefore))
+	s.Nil(got.EndedAt)
+	s.Nil(got.LeaseExpiresAt)
+
+	claimed, err := s.store.ClaimNextBackfill("w1", time.Minute)
+	s.Require().NoError(err)
+	s.Equal(a.ID, claimed.SiteDefID)
+	s.Equal("w1", claimed.WorkerID)
+	if s.NotNil(claimed.LeaseExpiresAt) {
+		s.WithinDuration(time.Now().Add(time.Minute), *claimed.LeaseExpiresAt, 10*time.Second)
+	}
+
+	// only the worker holding the lease can record progress or renew it
+	claimed.URL = "http://a.example.com/9"
+	claimed.Pages = 2
+	claimed.Seen = 1
+	s.NoError(s.store.SaveBackfillProgress(claimed))
+	s.NoError(s.store.RenewBackfillLease(a.ID, "w1", time.Minute))
+	s.Equal(ErrLeaseLost, s.store.RenewBackfillLease(a.ID, "w2", time.Minute))
+	stolen := claimed
+	stolen.WorkerID = "w2"
+	s.Equal(ErrLeaseLost, s.store.SaveBackfillProgress(stolen))
+	got, err = s.store.GetBackfill(a.ID)
+	s.Require().NoError(err)
+	s.Equal("http://a.example.com/9", got.URL)
+	s.Equal(2, got.Pages)
+	s.Equal(1, got.Seen)
+
+	// an expired lease lets another worker pick the backfill up where it left off
+	claimed, err = s.store.ClaimNextBackfill("w3", time.Millisecond)
+	s.Require().NoError(err)
+	s.Equal(b.ID, claimed.SiteDefID)
+	time.Sleep(50 * time.Millisecond)
+	claimed, err = s.store.ClaimNextBackfill("w4", time.Minute)
+	s.Require().NoError(err)
+	s.Equal(b.ID, claimed.SiteDefID)
+	s.Equal(ErrLeaseLost, s.store.RenewBackfillLease(b.ID, "w3", time.Minute))
+	_, err = s.store.ClaimNextBackfill("w5", time.Minute)
+	s.Equal(sql.ErrNoRows, err)
+
+	s.NoError(s.store.EndBackfill(a.ID, errors.New("fetch failed")))
+	got, err = s.store.GetBackfill(a.ID)
+	s.Require().NoError(err)
+	s.NotNil(got.EndedAt)
+	s.Equal("fetch failed", got.Error)
+	s.Equal(ErrLeaseLost, s.store.SaveBackfillProgress(Backfill{SiteDefID: a.ID, WorkerID: "w1", URL: "http://a.example.com/8"}))
+	s.Equal(ErrLeaseLost, s.store.RenewBackfillLease(a.ID, "w1", time.Minute))
+
+	// requesting another backfill starts over
+	s.NoError(s.store.CreateBackfill(Backfill{SiteDefID: a.ID, URL: "http://a.example.com/latest", DatedBefore: before.Add(-time.Hour)}))
+	got, err = s.store.GetBackfill(a.ID)
+	s.Require().NoError(err)
+	s.Equal("http://a.example.com/latest", got.URL)
+	s.Zero(got.MaxPages)
+	s.Zero(got.Pages)
+	s.Zero(got.Seen)
+	s.Nil(got.EndedAt)
+	s.Empty(got.Error)
+	s.Empty(got.WorkerID)
+	claimed, err = s.store.ClaimNextBackfill("w6", time.Minute)
+	s.Require().NoError(err)
+	s.Equal(a.ID, claimed.SiteDefID)
+}
+
+func (s *ConformanceTestSuite) TestUsersAndSessions() {
+	u := s.createUser("alice")
+
+	got, err := s.store.GetUser(u.ID)
+	s.NoError(err)
+	s.Equal(u.Name, got.Name)
+	s.Equal(RoleUser, got.Role)
+	got, err = s.store.GetUserByName("alice")
+	s.NoError(err)
+	s.Equal(u.ID, got.ID)
+
+	s.NoError(s.store.CreateSession(Session{TokenHash: "live", UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	s.NoError(s.store.CreateSession(Session{TokenHash: "expired", UserID: u.ID, ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	got, err = s.store.GetSessionUser("live")
+	s.NoError(err)
+	s.Equal(u.ID, got.ID)
+	_, err = s.store.GetSessionUser("expired")
+	s.Equal(sql.ErrNoRows, err)
+
+	s.NoError(s.store.DeleteSession("live"))
+	_, err = s.store.GetSessionUser("live")
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *ConformanceTestSuite) TestReadingState() {
+	now := time.Now()
+	u := s.createUser("alice")
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	a1 := s.createSiteUpdate(a, "1", now.Add(-3*time.Hour))
+	a2 := s.createSiteUpdate(a, "2", now.Add(-2*time.Hour))
+	a3 := s.createSiteUpdate(a, "3", now.Add(-time.Hour))
+	s.createSiteUpdate(b, "1", now)
+
+	s.NoError(s.store.Subscribe(u.ID, a.ID))
+	s.NoError(s.store.Subscribe(u.ID, a.ID))
+	s.NoError(s.store.Subscribe(u.ID, b.ID))
+	subs, err := s.store.GetSubscriptions(u.ID)
+	s.NoError(err)
+	s.Equal([]SiteDefID{a.ID, b.ID}, subs)
+
+	s.NoError(s.store.MarkRead(u.ID, a1.ID))
+	s.NoError(s.store.MarkRead(u.ID, a1.ID))
+	s.NoError(s.store.MarkReadThrough(u.ID, a2.ID))
+	s.NoError(s.store.Unsubscribe(u.ID, b.ID))
+
+	unread, err := s.store.GetUnreadComics(u.ID)
+	s.NoError(err)
+	if s.Len(unread, 1) {
+		s.Equal(a.ID, unread[0].SiteDefID)
+		s.Equal(a3.ID, unread[0].ID)
+		s.Equal(1, unread[0].Unread)
+	}
+}
+
+func (s *ConformanceTestSuite) TestFeeds() {
+	now := time.Now()
+	u := s.createUser("alice")
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	a1 := s.createSiteUpdate(a, "1", now.Add(-2*time.Hour))
+	b1 := s.createSiteUpdate(b, "1", now.Add(-time.Hour))
+	s.NoError(s.store.Subscribe(u.ID, a.ID))
+
+	recent, err := s.store.GetRecentUpdates(1)
+	s.NoError(err)
+	if s.Len(recent, 1) {
+		s.Equal(b1.ID, recent[0].ID)
+		s.Equal("b", recent[0].Name)
+	}
+	updates, err := s.store.GetSiteDefUpdates(a.ID, 10)
+	s.NoError(err)
+	if s.Len(updates, 1) {
+		s.Equal(a1.ID, updates[0].ID)
+	}
+	updates, err = s.store.GetSubscribedUpdates(u.ID, 10)
+	s.NoError(err)
+	if s.Len(updates, 1) {
+		s.Equal(a1.ID, updates[0].ID)
+	}
+
+	token, err := s.store.GetFeedToken(u.ID)
+	s.NoError(err)
+	s.Empty(token)
+	s.NoError(s.store.SetFeedToken(u.ID, "token"))
+	token, err = s.store.GetFeedToken(u.ID)
+	s.NoError(err)
+	s.Equal("token", token)
+	got, err := s.store.GetUserByFeedToken("token")
+	s.NoError(err)
+	s.Equal(u.ID, got.ID)
+}
+
+func (s *ConformanceTestSuite) TestClickStats() {
+	now := time.Now()
+	a := s.createSiteDef("a", true)
+	b := s.createSiteDef("b", true)
+	a1 := s.createSiteUpdate(a, "1", now.Add(-2*time.Hour))
+	b1 := s.createSiteUpdate(b, "1", now.Add(-time.Hour))
+	addr := net.ParseIP("192.0.2.1")
+	for i := 0; i < 3; i++ {
+		s.NoError(s.store.CreateClickLog(a1.ID, addr))
+	}
+	s.NoError(s.store.CreateClickLog(b1.ID, addr))
+	since := now.Add(-time.Hour)
+
+	defClicks, err := s.store.GetSiteDefClicks(since, 10)
+	s.NoError(err)
+	s.Equal([]SiteDefClicks{{SiteDefID: a.ID, Name: "a", Clicks: 3}, {SiteDefID: b.ID, Name: "b", Clicks: 1}}, defClicks)
+
+	updateClicks, err := s.store.GetSiteUpdateClicks(since, 1)
+	s.NoError(err)
+	s.Equal([]SiteUpdateClicks{{ID: a1.ID, SiteDefID: a.ID, Name: "a", Title: a1.Title, Clicks: 3}}, updateClicks)
+
+	series, err := s.store.GetSiteDefClickSeries(a.ID, ClickBucketHour, since)
+	s.NoError(err)
+	if s.Len(series, 1) {
+		s.Equal(3, series[0].Clicks)
+		s.WithinDuration(now, series[0].Start, time.Hour)
+	}
+
+	countries, err := s.store.GetCountryClicks(since, 10)
+	s.NoError(err)
+	s.Equal([]LocationClicks{{Country: "IE", Clicks: 4}}, countries)
+	regions, err := s.store.GetRegionClicks(since, 10)
+	s.NoError(err)
+	s.Equal([]LocationClicks{{Country: "IE", Region: "L", Clicks: 4}}, regions)
+
+	trending, err := s.store.GetTrendingComics(since, 10)
+	s.NoError(err)
+	s.Equal([]TrendingComic{{SiteDefID: a.ID, Name: "a", Clicks: 3}, {SiteDefID: b.ID, Name: "b", Clicks: 1}}, trending)
+
+	popular, err := s.store.GetPopularComics(since)
+	s.NoError(err)
+	if s.Len(popular, 2) {
+		s.Equal(a1.Title, popular[0].Title)
+	}
+
+	defClicks, err = s.store.GetSiteDefClicks(now.Add(time.Hour), 10)
+	s.NoError(err)
+	s.Empty(defClicks)
+}
+
+func TestMemConformanceTestSuite(t *testing.T) {
+	suite.Run(t, &ConformanceTestSuite{
+		newStore: func(_ *testing.T, geoIP ipinfo.IPInfoer) Store {
+			return NewMemStore(geoIP)
+		},
+	})
+}
+
+func TestSQLiteConformanceTestSuite(t *testing.T) {
+	suite.Run(t, &ConformanceTestSuite{
+		newStore: openSQLStore(func(t *testing.T) string {
+			return "sqlite:" + filepath.Join(t.TempDir(), "freshcomics.db")
+		}),
+	})
+}
+
+func TestPGConformanceTestSuite(t *testing.T) {
+	dsn, ok := os.LookupEnv(postgresTestDSNEnv)
+	if !ok {
+		t.Skipf("%s not set", postgresTestDSNEnv)
+	}
+	suite.Run(t, &ConformanceTestSuite{
+		newStore: openSQLStore(func(*testing.T) string { return dsn }),
+	})
+}
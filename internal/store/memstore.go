@@ -0,0 +1,1246 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+)
+
+// memStore implements Store in memory. It mirrors the ordering, constraints and errors of
+// the SQL backends so that it can stand in for a database in tests and demos.
+type memStore struct {
+	mu    sync.RWMutex
+	now   func() time.Time
+	geoIP ipinfo.IPInfoer
+
+	siteDefs      []SiteDef
+	siteUpdates   []SiteUpdate
+	crawlInfos    []CrawlInfo
+	users         []User
+	feedTokens    map[UserID]string
+	sessions      map[string]Session
+	subscriptions map[UserID]map[SiteDefID]bool
+	readUpdates   map[UserID]map[SiteUpdateID]bool
+	clicks        []ClickLog
+	updateImages  []UpdateImage
+	backfills     []Backfill
+
+	lastSiteDefID    SiteDefID
+	lastSiteUpdateID SiteUpdateID
+	lastCrawlInfoID  CrawlInfoID
+	lastUserID       UserID
+	lastClickLogID   ClickLogID
+	lastImageID      UpdateImageID
+}
+
+var _ Store = (*memStore)(nil)
+
+// NewMemStore returns an empty Store held in memory. Clicks are located with geoIP; if geoIP
+// is nil, clicks are recorded without a location. It is safe for concurrent use.
+func NewMemStore(geoIP ipinfo.IPInfoer) Store {
+	if geoIP == nil {
+		geoIP = ipinfo.NewDummyIPInfoer()
+	}
+
+	return &memStore{
+		now:           time.Now,
+		geoIP:         geoIP,
+		feedTokens:    make(map[UserID]string),
+		sessions:      make(map[string]Session),
+		subscriptions: make(map[UserID]map[SiteDefID]bool),
+		readUpdates:   make(map[UserID]map[SiteUpdateID]bool),
+	}
+}
+
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", constraint)
+}
+
+func foreignKeyViolation(table string) error {
+	return fmt.Errorf("insert on table %q violates foreign key constraint", table)
+}
+
+// The methods below expect the caller to hold mu.
+
+func (s *memStore) siteDefIndex(id SiteDefID) int {
+	for i := range s.siteDefs {
+		if s.siteDefs[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memStore) siteUpdateIndex(id SiteUpdateID) int {
+	for i := range s.siteUpdates {
+		if s.siteUpdates[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memStore) crawlInfoIndex(id CrawlInfoID) int {
+	for i := range s.crawlInfos {
+		if s.crawlInfos[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memStore) backfillIndex(id SiteDefID) int {
+	for i := range s.backfills {
+		if s.backfills[i].SiteDefID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// heldBackfill returns the index of the Backfill of the given SiteDef if workerID holds its lease, or -1
+func (s *memStore) heldBackfill(id SiteDefID, workerID string) int {
+	i := s.backfillIndex(id)
+	if i < 0 || s.backfills[i].WorkerID != workerID || s.backfills[i].EndedAt != nil {
+		return -1
+	}
+	return i
+}
+
+func (s *memStore) userIndex(id UserID) int {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newerUpdate returns true if a sorts before b in the latest-first order used by the SQL backends
+func newerUpdate(a, b SiteUpdate) bool {
+	if !a.SeenAt.Equal(b.SeenAt) {
+		return a.SeenAt.After(b.SeenAt)
+	}
+	return a.ID > b.ID
+}
+
+// latestUpdates returns the latest SiteUpdate of each SiteDef that has any, newest first
+func (s *memStore) latestUpdates() []SiteUpdate {
+	latest := make(map[SiteDefID]SiteUpdate)
+	for _, su := range s.siteUpdates {
+		if cur, ok := latest[su.SiteDefID]; !ok || newerUpdate(su, cur) {
+			latest[su.SiteDefID] = su
+		}
+	}
+	updates := make([]SiteUpdate, 0, len(latest))
+	for _, su := range latest {
+		updates = append(updates, su)
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return newerUpdate(updates[i], updates[j])
+	})
+	return updates
+}
+
+// sortedUpdates returns the SiteUpdates for which keep returns true, newest first
+func (s *memStore) sortedUpdates(keep func(SiteUpdate) bool) []SiteUpdate {
+	updates := make([]SiteUpdate, 0)
+	for _, su := range s.siteUpdates {
+		if keep(su) {
+			updates = append(updates, su)
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return newerUpdate(updates[i], updates[j])
+	})
+	return updates
+}
+
+func (s *memStore) comic(su SiteUpdate) Comic {
+	def := s.siteDefs[s.siteDefIndex(su.SiteDefID)]
+	return Comic{
+		ID:          ComicID(su.ID),
+		Name:        def.Name,
+		Title:       su.Title,
+		SeenAt:      su.SeenAt,
+		NSFW:        def.NSFW,
+		URL:         su.URL,
+		ImageURLs:   imageURLs(su),
+		AltText:     su.AltText,
+		PublishedAt: publishedAt(su),
+	}
+}
+
+// imageURLs returns the image URLs of the given SiteUpdate, never nil, as the SQL backends scan them
+func imageURLs(su SiteUpdate) StringList {
+	if su.ImageURLs == nil {
+		return StringList{}
+	}
+	return su.ImageURLs
+}
+
+// publishedAt returns the publication time of the given SiteUpdate, or nil if it is unknown
+func publishedAt(su SiteUpdate) *time.Time {
+	if !su.PublishedAt.Valid {
+		return nil
+	}
+	t := su.PublishedAt.Time
+	return &t
+}
+
+func (s *memStore) comicUpdates(updates []SiteUpdate, limit int) []ComicUpdate {
+	result := make([]ComicUpdate, 0)
+	for _, su := range updates {
+		if len(result) == limit {
+			break
+		}
+		result = append(result, ComicUpdate{
+			ID:          su.ID,
+			SiteDefID:   su.SiteDefID,
+			Name:        s.siteDefs[s.siteDefIndex(su.SiteDefID)].Name,
+			Title:       su.Title,
+			URL:         su.URL,
+			SeenAt:      su.SeenAt,
+			ImageURLs:   imageURLs(su),
+			AltText:     su.AltText,
+			PublishedAt: publishedAt(su),
+		})
+	}
+	return result
+}
+
+// clicksSince returns the clicks made at or after since along with the SiteUpdate clicked
+func (s *memStore) clicksSince(since time.Time) ([]ClickLog, []SiteUpdate) {
+	clicks := make([]ClickLog, 0)
+	updates := make([]SiteUpdate, 0)
+	for _, c := range s.clicks {
+		if c.ClickedAt.Before(since) {
+			continue
+		}
+		clicks = append(clicks, c)
+		updates = append(updates, s.siteUpdates[s.siteUpdateIndex(c.UpdateID)])
+	}
+	return clicks, updates
+}
+
+// GetComics implements ComicStore.GetComics
+func (s *memStore) GetComics() ([]Comic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comics := make([]Comic, 0)
+	for _, su := range s.latestUpdates() {
+		comics = append(comics, s.comic(su))
+	}
+	return comics, nil
+}
+
+// GetPopularComics implements ComicStore.GetPopularComics
+func (s *memStore) GetPopularComics(since time.Time) ([]Comic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[SiteDefID]int)
+	_, clicked := s.clicksSince(since)
+	for _, su := range clicked {
+		counts[su.SiteDefID]++
+	}
+
+	latest := s.latestUpdates()
+	sort.SliceStable(latest, func(i, j int) bool {
+		return counts[latest[i].SiteDefID] > counts[latest[j].SiteDefID]
+	})
+	comics := make([]Comic, 0)
+	for _, su := range latest {
+		comics = append(comics, s.comic(su))
+	}
+	return comics, nil
+}
+
+// Redirect implements Redirecter.Redirect
+func (s *memStore) Redirect(id SiteUpdateID) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.siteUpdateIndex(id)
+	if i < 0 {
+		return "", sql.ErrNoRows
+	}
+	return s.siteUpdates[i].URL, nil
+}
+
+// CreateClickLog implements ClickLogger.CreateClickLog
+func (s *memStore) CreateClickLog(id SiteUpdateID, addr net.IP) error {
+	geoLoc, err := s.geoIP.GetIPInfo(addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteUpdateIndex(id) < 0 {
+		return foreignKeyViolation("comic_clicks")
+	}
+	s.lastClickLogID++
+	s.clicks = append(s.clicks, ClickLog{
+		ID:        s.lastClickLogID,
+		UpdateID:  id,
+		ClickedAt: s.now(),
+		Country:   geoLoc.Country,
+		Region:    geoLoc.Region,
+		City:      geoLoc.City,
+	})
+	return nil
+}
+
+// checkSiteDef returns an error if sd conflicts with any SiteDef other than itself
+func (s *memStore) checkSiteDef(sd SiteDef) error {
+	for _, other := range s.siteDefs {
+		if other.ID == sd.ID {
+			continue
+		}
+		switch {
+		case other.Name == sd.Name:
+			return uniqueViolation("site_defs_name_key")
+		case other.StartURL == sd.StartURL:
+			return uniqueViolation("site_defs_start_url_key")
+		case other.URLTemplate == sd.URLTemplate && other.CrawlStrategy == CrawlStrategyPage && sd.CrawlStrategy == CrawlStrategyPage:
+			return uniqueViolation("site_defs_url_template_key")
+		}
+	}
+	return nil
+}
+
+// CreateSiteDef implements SiteDefStore.CreateSiteDef
+func (s *memStore) CreateSiteDef(sd SiteDef) (SiteDefID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sd.ID = 0
+	if err := s.checkSiteDef(sd); err != nil {
+		return 0, err
+	}
+	s.lastSiteDefID++
+	sd.ID = s.lastSiteDefID
+	s.siteDefs = append(s.siteDefs, sd)
+	return sd.ID, nil
+}
+
+// GetSiteDefs implements SiteDefStore.GetSiteDefs
+func (s *memStore) GetSiteDefs(includeInactive bool) ([]SiteDef, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	defs := make([]SiteDef, 0)
+	for _, sd := range s.siteDefs {
+		if sd.Active || includeInactive {
+			defs = append(defs, sd)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs, nil
+}
+
+// GetSiteDef implements SiteDefStore.GetSiteDef
+func (s *memStore) GetSiteDef(id SiteDefID) (SiteDef, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.siteDefIndex(id)
+	if i < 0 {
+		return SiteDef{}, sql.ErrNoRows
+	}
+	return s.siteDefs[i], nil
+}
+
+// UpdateSiteDef implements SiteDefStore.UpdateSiteDef
+func (s *memStore) UpdateSiteDef(sd SiteDef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.siteDefIndex(sd.ID)
+	if i < 0 {
+		return nil
+	}
+	if err := s.checkSiteDef(sd); err != nil {
+		return err
+	}
+	s.siteDefs[i] = sd
+	return nil
+}
+
+// MarkSiteDefBroken implements SiteDefStore.MarkSiteDefBroken
+func (s *memStore) MarkSiteDefBroken(id SiteDefID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.siteDefIndex(id)
+	if i < 0 {
+		return nil
+	}
+	s.siteDefs[i].Active = false
+	s.siteDefs[i].BrokenReason = reason
+	return nil
+}
+
+// GetLastURL implements SiteDefStore.GetLastURL
+func (s *memStore) GetLastURL(id SiteDefID) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	updates := s.sortedUpdates(func(su SiteUpdate) bool { return su.SiteDefID == id })
+	if len(updates) == 0 {
+		return "", sql.ErrNoRows
+	}
+	return updates[0].URL, nil
+}
+
+// CreateSiteUpdate implements SiteUpdateStore.CreateSiteUpdate
+func (s *memStore) CreateSiteUpdate(su SiteUpdate) (SiteUpdateID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteDefIndex(su.SiteDefID) < 0 {
+		return 0, foreignKeyViolation("site_updates")
+	}
+	for _, other := range s.siteUpdates {
+		if other.URL == su.URL {
+			return 0, uniqueViolation("site_updates_url_key")
+		}
+		if other.SiteDefID == su.SiteDefID && other.Ref == su.Ref {
+			return 0, uniqueViolation("site_updates_site_def_id_ref")
+		}
+	}
+	s.lastSiteUpdateID++
+	su.ID = s.lastSiteUpdateID
+	su.ImageURLs = imageURLs(su)
+	s.siteUpdates = append(s.siteUpdates, su)
+	return su.ID, nil
+}
+
+// GetSiteUpdates implements SiteUpdateStore.GetSiteUpdates
+func (s *memStore) GetSiteUpdates(id SiteDefID) ([]SiteUpdate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedUpdates(func(su SiteUpdate) bool { return su.SiteDefID == id }), nil
+}
+
+// GetSiteUpdateTimes implements SiteUpdateStore.GetSiteUpdateTimes
+func (s *memStore) GetSiteUpdateTimes(id SiteDefID, limit int) ([]time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	times := make([]time.Time, 0)
+	for _, su := range s.sortedUpdates(func(su SiteUpdate) bool { return su.SiteDefID == id }) {
+		if len(times) == limit {
+			break
+		}
+		times = append(times, su.SeenAt)
+	}
+	return times, nil
+}
+
+// GetSiteUpdate implements SiteUpdateStore.GetSiteUpdate
+func (s *memStore) GetSiteUpdate(id SiteDefID, ref string) (SiteUpdate, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, su := range s.siteUpdates {
+		if su.SiteDefID == id && su.Ref == ref {
+			return su, true, nil
+		}
+	}
+	return SiteUpdate{}, false, nil
+}
+
+// getCrawlInfos returns the CrawlInfos for which keep returns true, ordered by creation time
+func (s *memStore) getCrawlInfos(keep func(CrawlInfo) bool, newestFirst bool) []CrawlInfo {
+	infos := make([]CrawlInfo, 0)
+	for _, ci := range s.crawlInfos {
+		if keep(ci) {
+			infos = append(infos, ci)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if newestFirst {
+			a, b = b, a
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return infos
+}
+
+// GetCrawlInfos implements CrawlInfoStore.GetCrawlInfos
+func (s *memStore) GetCrawlInfos() ([]CrawlInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getCrawlInfos(func(CrawlInfo) bool { return true }, true), nil
+}
+
+// GetCrawlInfo implements CrawlInfoStore.GetCrawlInfo
+func (s *memStore) GetCrawlInfo(id SiteDefID) ([]CrawlInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.getCrawlInfos(func(ci CrawlInfo) bool { return ci.SiteDefID == id }, true), nil
+}
+
+// GetPendingCrawlInfos implements CrawlInfoStore.GetPendingCrawlInfos
+func (s *memStore) GetPendingCrawlInfos() ([]CrawlInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	return s.getCrawlInfos(func(ci CrawlInfo) bool { return crawlInfoPending(ci, now) }, false), nil
+}
+
+// crawlInfoPending returns true if ci has not ended and either has not started or its lease expired before now
+func crawlInfoPending(ci CrawlInfo, now time.Time) bool {
+	if ci.EndedAt.Valid {
+		return false
+	}
+	return !ci.StartedAt.Valid || (ci.LeaseExpiresAt.Valid && ci.LeaseExpiresAt.Time.Before(now))
+}
+
+// CreateCrawlInfo implements CrawlInfoStore.CreateCrawlInfo
+func (s *memStore) CreateCrawlInfo(id SiteDefID, url string) (CrawlInfoID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteDefIndex(id) < 0 {
+		return 0, foreignKeyViolation("crawl_infos")
+	}
+	s.lastCrawlInfoID++
+	s.crawlInfos = append(s.crawlInfos, CrawlInfo{
+		ID:        s.lastCrawlInfoID,
+		SiteDefID: id,
+		URL:       url,
+		Origin:    Origin(url),
+		CreatedAt: s.now(),
+	})
+	return s.lastCrawlInfoID, nil
+}
+
+// StartCrawlInfo implements CrawlInfoStore.StartCrawlInfo
+func (s *memStore) StartCrawlInfo(id CrawlInfoID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.crawlInfoIndex(id); i >= 0 {
+		s.crawlInfos[i].StartedAt = pq.NullTime{Time: s.now(), Valid: true}
+	}
+	return nil
+}
+
+// EndCrawlInfo implements CrawlInfoStore.EndCrawlInfo
+func (s *memStore) EndCrawlInfo(id CrawlInfoID, workerID string, crawlErr error, seen int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errString string
+	if crawlErr != nil {
+		errString = crawlErr.Error()
+	}
+
+	i := s.crawlInfoIndex(id)
+	if i < 0 || s.crawlInfos[i].WorkerID != workerID {
+		return ErrLeaseLost
+	}
+	s.crawlInfos[i].EndedAt = pq.NullTime{Time: s.now(), Valid: true}
+	s.crawlInfos[i].Error = errString
+	s.crawlInfos[i].Seen = seen
+	return nil
+}
+
+// ClaimNextCrawlInfo implements CrawlInfoStore.ClaimNextCrawlInfo
+func (s *memStore) ClaimNextCrawlInfo(workerID string, lease time.Duration, skipOrigins []string) (CrawlInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	pending := s.getCrawlInfos(func(ci CrawlInfo) bool {
+		if !crawlInfoPending(ci, now) {
+			return false
+		}
+		for _, origin := range skipOrigins {
+			if ci.Origin == Origin(origin) {
+				return false
+			}
+		}
+		return true
+	}, false)
+	if len(pending) == 0 {
+		return CrawlInfo{}, sql.ErrNoRows
+	}
+
+	i := s.crawlInfoIndex(pending[0].ID)
+	s.crawlInfos[i].WorkerID = workerID
+	s.crawlInfos[i].StartedAt = pq.NullTime{Time: now, Valid: true}
+	s.crawlInfos[i].LeaseExpiresAt = pq.NullTime{Time: now.Add(lease), Valid: true}
+	return s.crawlInfos[i], nil
+}
+
+// RenewCrawlInfoLease implements CrawlInfoStore.RenewCrawlInfoLease
+func (s *memStore) RenewCrawlInfoLease(id CrawlInfoID, workerID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.crawlInfoIndex(id)
+	if i < 0 || s.crawlInfos[i].WorkerID != workerID || s.crawlInfos[i].EndedAt.Valid {
+		return ErrLeaseLost
+	}
+	s.crawlInfos[i].LeaseExpiresAt = pq.NullTime{Time: s.now().Add(lease), Valid: true}
+	return nil
+}
+
+// AbandonStaleCrawlInfos implements CrawlInfoStore.AbandonStaleCrawlInfos
+func (s *memStore) AbandonStaleCrawlInfos(startedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var n int
+	for i, ci := range s.crawlInfos {
+		if ci.EndedAt.Valid || !ci.StartedAt.Valid || !ci.StartedAt.Time.Before(startedBefore) {
+			continue
+		}
+		if ci.LeaseExpiresAt.Valid && !ci.LeaseExpiresAt.Time.Before(now) {
+			continue
+		}
+		s.crawlInfos[i].EndedAt = pq.NullTime{Time: now, Valid: true}
+		s.crawlInfos[i].Error = ErrCrawlAbandoned.Error()
+		n++
+	}
+	return n, nil
+}
+
+// CreateUser implements UserStore.CreateUser
+func (s *memStore) CreateUser(u User) (UserID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.users {
+		if other.Name == u.Name {
+			return 0, ErrUserNameTaken
+		}
+	}
+	s.lastUserID++
+	u.ID = s.lastUserID
+	u.CreatedAt = s.now()
+	s.users = append(s.users, u)
+	return u.ID, nil
+}
+
+// GetUser implements UserStore.GetUser
+func (s *memStore) GetUser(id UserID) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.userIndex(id)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	return s.users[i], nil
+}
+
+// GetUserByName implements UserStore.GetUserByName
+func (s *memStore) GetUserByName(name string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+// CreateSession implements SessionStore.CreateSession
+func (s *memStore) CreateSession(sess Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[sess.TokenHash]; ok {
+		return uniqueViolation("sessions_pkey")
+	}
+	if s.userIndex(sess.UserID) < 0 {
+		return foreignKeyViolation("sessions")
+	}
+	sess.CreatedAt = s.now()
+	s.sessions[sess.TokenHash] = sess
+	return nil
+}
+
+// GetSessionUser implements SessionStore.GetSessionUser
+func (s *memStore) GetSessionUser(tokenHash string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sess, ok := s.sessions[tokenHash]
+	if !ok || !sess.ExpiresAt.After(s.now()) {
+		return User{}, sql.ErrNoRows
+	}
+	i := s.userIndex(sess.UserID)
+	if i < 0 {
+		return User{}, sql.ErrNoRows
+	}
+	return s.users[i], nil
+}
+
+// DeleteSession implements SessionStore.DeleteSession
+func (s *memStore) DeleteSession(tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+// Subscribe implements SubscriptionStore.Subscribe
+func (s *memStore) Subscribe(userID UserID, id SiteDefID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userIndex(userID) < 0 || s.siteDefIndex(id) < 0 {
+		return foreignKeyViolation("subscriptions")
+	}
+	if s.subscriptions[userID] == nil {
+		s.subscriptions[userID] = make(map[SiteDefID]bool)
+	}
+	s.subscriptions[userID][id] = true
+	return nil
+}
+
+// Unsubscribe implements SubscriptionStore.Unsubscribe
+func (s *memStore) Unsubscribe(userID UserID, id SiteDefID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscriptions[userID], id)
+	return nil
+}
+
+// GetSubscriptions implements SubscriptionStore.GetSubscriptions
+func (s *memStore) GetSubscriptions(userID UserID) ([]SiteDefID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]SiteDefID, 0)
+	for id := range s.subscriptions[userID] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// markRead marks the given SiteUpdates as read by the given User
+func (s *memStore) markRead(userID UserID, ids ...SiteUpdateID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if s.userIndex(userID) < 0 {
+		return foreignKeyViolation("read_updates")
+	}
+	if s.readUpdates[userID] == nil {
+		s.readUpdates[userID] = make(map[SiteUpdateID]bool)
+	}
+	for _, id := range ids {
+		s.readUpdates[userID][id] = true
+	}
+	return nil
+}
+
+// MarkRead implements ReadingStateStore.MarkRead
+func (s *memStore) MarkRead(userID UserID, id SiteUpdateID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteUpdateIndex(id) < 0 {
+		return nil
+	}
+	return s.markRead(userID, id)
+}
+
+// MarkReadThrough implements ReadingStateStore.MarkReadThrough
+func (s *memStore) MarkReadThrough(userID UserID, id SiteUpdateID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.siteUpdateIndex(id)
+	if i < 0 {
+		return nil
+	}
+	target := s.siteUpdates[i]
+
+	ids := make([]SiteUpdateID, 0)
+	for _, su := range s.siteUpdates {
+		if su.SiteDefID == target.SiteDefID && !newerUpdate(su, target) {
+			ids = append(ids, su.ID)
+		}
+	}
+	return s.markRead(userID, ids...)
+}
+
+// GetUnreadComics implements ReadingStateStore.GetUnreadComics
+func (s *memStore) GetUnreadComics(userID UserID) ([]UnreadComic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unread := make(map[SiteDefID]int)
+	for _, su := range s.siteUpdates {
+		if !s.readUpdates[userID][su.ID] {
+			unread[su.SiteDefID]++
+		}
+	}
+
+	comics := make([]UnreadComic, 0)
+	for _, su := range s.latestUpdates() {
+		if !s.subscriptions[userID][su.SiteDefID] {
+			continue
+		}
+		def := s.siteDefs[s.siteDefIndex(su.SiteDefID)]
+		comics = append(comics, UnreadComic{
+			SiteDefID: def.ID,
+			Name:      def.Name,
+			NSFW:      def.NSFW,
+			ID:        su.ID,
+			Title:     su.Title,
+			URL:       su.URL,
+			SeenAt:    su.SeenAt,
+			Unread:    unread[def.ID],
+		})
+	}
+	return comics, nil
+}
+
+// GetRecentUpdates implements FeedStore.GetRecentUpdates
+func (s *memStore) GetRecentUpdates(limit int) ([]ComicUpdate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	updates := s.sortedUpdates(func(SiteUpdate) bool { return true })
+	return s.comicUpdates(updates, limit), nil
+}
+
+// GetSiteDefUpdates implements FeedStore.GetSiteDefUpdates
+func (s *memStore) GetSiteDefUpdates(id SiteDefID, limit int) ([]ComicUpdate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	updates := s.sortedUpdates(func(su SiteUpdate) bool { return su.SiteDefID == id })
+	return s.comicUpdates(updates, limit), nil
+}
+
+// GetSubscribedUpdates implements FeedStore.GetSubscribedUpdates
+func (s *memStore) GetSubscribedUpdates(userID UserID, limit int) ([]ComicUpdate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	updates := s.sortedUpdates(func(su SiteUpdate) bool { return s.subscriptions[userID][su.SiteDefID] })
+	return s.comicUpdates(updates, limit), nil
+}
+
+// GetFeedToken implements FeedStore.GetFeedToken
+func (s *memStore) GetFeedToken(userID UserID) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.userIndex(userID) < 0 {
+		return "", sql.ErrNoRows
+	}
+	return s.feedTokens[userID], nil
+}
+
+// SetFeedToken implements FeedStore.SetFeedToken
+func (s *memStore) SetFeedToken(userID UserID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userIndex(userID) < 0 {
+		return nil
+	}
+	for other, t := range s.feedTokens {
+		if other != userID && t == token {
+			return uniqueViolation("users_feed_token_key")
+		}
+	}
+	s.feedTokens[userID] = token
+	return nil
+}
+
+// GetUserByFeedToken implements FeedStore.GetUserByFeedToken
+func (s *memStore) GetUserByFeedToken(token string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for userID, t := range s.feedTokens {
+		if t == token {
+			return s.users[s.userIndex(userID)], nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+// GetSiteDefClicks implements ClickStatsStore.GetSiteDefClicks
+func (s *memStore) GetSiteDefClicks(since time.Time, limit int) ([]SiteDefClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[SiteDefID]int)
+	_, clicked := s.clicksSince(since)
+	for _, su := range clicked {
+		counts[su.SiteDefID]++
+	}
+
+	stats := make([]SiteDefClicks, 0, len(counts))
+	for id, n := range counts {
+		stats = append(stats, SiteDefClicks{SiteDefID: id, Name: s.siteDefs[s.siteDefIndex(id)].Name, Clicks: n})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// GetSiteUpdateClicks implements ClickStatsStore.GetSiteUpdateClicks
+func (s *memStore) GetSiteUpdateClicks(since time.Time, limit int) ([]SiteUpdateClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[SiteUpdateID]int)
+	clicks, _ := s.clicksSince(since)
+	for _, c := range clicks {
+		counts[c.UpdateID]++
+	}
+
+	stats := make([]SiteUpdateClicks, 0, len(counts))
+	for id, n := range counts {
+		su := s.siteUpdates[s.siteUpdateIndex(id)]
+		stats = append(stats, SiteUpdateClicks{
+			ID:        su.ID,
+			SiteDefID: su.SiteDefID,
+			Name:      s.siteDefs[s.siteDefIndex(su.SiteDefID)].Name,
+			Title:     su.Title,
+			Clicks:    n,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Clicks != stats[j].Clicks {
+			return stats[i].Clicks > stats[j].Clicks
+		}
+		return stats[i].ID > stats[j].ID
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// bucketStart truncates t to the start of its hour, day or week in UTC. Weeks start on Monday.
+func bucketStart(t time.Time, bucket ClickBucketSize) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case ClickBucketHour:
+		return t.Truncate(time.Hour)
+	case ClickBucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// GetSiteDefClickSeries implements ClickStatsStore.GetSiteDefClickSeries
+func (s *memStore) GetSiteDefClickSeries(id SiteDefID, bucket ClickBucketSize, since time.Time) ([]ClickBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[time.Time]int)
+	clicks, clicked := s.clicksSince(since)
+	for i, c := range clicks {
+		if clicked[i].SiteDefID == id {
+			counts[bucketStart(c.ClickedAt, bucket)]++
+		}
+	}
+
+	series := make([]ClickBucket, 0, len(counts))
+	for start, n := range counts {
+		series = append(series, ClickBucket{Start: start, Clicks: n})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Start.Before(series[j].Start)
+	})
+	return series, nil
+}
+
+// locationClicks counts the clicks since the given time by country and, if byRegion is true, region
+func (s *memStore) locationClicks(since time.Time, limit int, byRegion bool) []LocationClicks {
+	counts := make(map[LocationClicks]int)
+	clicks, _ := s.clicksSince(since)
+	for _, c := range clicks {
+		key := LocationClicks{Country: c.Country}
+		if byRegion {
+			key.Region = c.Region
+		}
+		counts[key]++
+	}
+
+	stats := make([]LocationClicks, 0, len(counts))
+	for key, n := range counts {
+		key.Clicks = n
+		stats = append(stats, key)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		return a.Region < b.Region
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// GetCountryClicks implements ClickStatsStore.GetCountryClicks
+func (s *memStore) GetCountryClicks(since time.Time, limit int) ([]LocationClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.locationClicks(since, limit, false), nil
+}
+
+// GetRegionClicks implements ClickStatsStore.GetRegionClicks
+func (s *memStore) GetRegionClicks(since time.Time, limit int) ([]LocationClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.locationClicks(since, limit, true), nil
+}
+
+// GetTrendingComics implements ClickStatsStore.GetTrendingComics
+func (s *memStore) GetTrendingComics(since time.Time, limit int) ([]TrendingComic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	previousSince := since.Add(-s.now().Sub(since))
+	current := make(map[SiteDefID]int)
+	previous := make(map[SiteDefID]int)
+	clicks, clicked := s.clicksSince(previousSince)
+	for i, c := range clicks {
+		if c.ClickedAt.Before(since) {
+			previous[clicked[i].SiteDefID]++
+		} else {
+			current[clicked[i].SiteDefID]++
+		}
+	}
+
+	stats := make([]TrendingComic, 0, len(current))
+	for id, n := range current {
+		stats = append(stats, TrendingComic{
+			SiteDefID:      id,
+			Name:           s.siteDefs[s.siteDefIndex(id)].Name,
+			Clicks:         n,
+			PreviousClicks: previous[id],
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if growthA, growthB := a.Clicks-a.PreviousClicks, b.Clicks-b.PreviousClicks; growthA != growthB {
+			return growthA > growthB
+		}
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.Name < b.Name
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// CreateUpdateImage implements UpdateImageStore.CreateUpdateImage
+func (s *memStore) CreateUpdateImage(img UpdateImage) (UpdateImageID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteUpdateIndex(img.UpdateID) < 0 {
+		return 0, foreignKeyViolation("update_images")
+	}
+	for _, other := range s.updateImages {
+		if other.UpdateID == img.UpdateID && other.Position == img.Position {
+			return 0, uniqueViolation("update_images_update_id_position_key")
+		}
+	}
+	s.lastImageID++
+	img.ID = s.lastImageID
+	s.updateImages = append(s.updateImages, img)
+	return img.ID, nil
+}
+
+// GetUpdateImages implements UpdateImageStore.GetUpdateImages
+func (s *memStore) GetUpdateImages(id SiteUpdateID) ([]UpdateImage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	images := make([]UpdateImage, 0)
+	for _, img := range s.updateImages {
+		if img.UpdateID == id {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images, nil
+}
+
+// GetUpdateImageByHash implements UpdateImageStore.GetUpdateImageByHash
+func (s *memStore) GetUpdateImageByHash(hash string) (UpdateImage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, img := range s.updateImages {
+		if img.Hash == hash {
+			return img, nil
+		}
+	}
+	return UpdateImage{}, sql.ErrNoRows
+}
+
+// CreateBackfill implements BackfillStore.CreateBackfill
+func (s *memStore) CreateBackfill(b Backfill) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.siteDefIndex(b.SiteDefID) < 0 {
+		return foreignKeyViolation("backfills")
+	}
+	created := Backfill{
+		SiteDefID:   b.SiteDefID,
+		URL:         b.URL,
+		MaxPages:    b.MaxPages,
+		DatedBefore: b.DatedBefore,
+		CreatedAt:   s.now(),
+	}
+	if i := s.backfillIndex(b.SiteDefID); i >= 0 {
+		s.backfills[i] = created
+		return nil
+	}
+	s.backfills = append(s.backfills, created)
+	return nil
+}
+
+// GetBackfill implements BackfillStore.GetBackfill
+func (s *memStore) GetBackfill(id SiteDefID) (Backfill, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.backfillIndex(id)
+	if i < 0 {
+		return Backfill{}, sql.ErrNoRows
+	}
+	return s.backfills[i], nil
+}
+
+// ClaimNextBackfill implements BackfillStore.ClaimNextBackfill
+func (s *memStore) ClaimNextBackfill(workerID string, lease time.Duration) (Backfill, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	next := -1
+	for i, b := range s.backfills {
+		if b.EndedAt != nil || (b.LeaseExpiresAt != nil && !b.LeaseExpiresAt.Before(now)) {
+			continue
+		}
+		if next < 0 || b.CreatedAt.Before(s.backfills[next].CreatedAt) ||
+			(b.CreatedAt.Equal(s.backfills[next].CreatedAt) && b.SiteDefID < s.backfills[next].SiteDefID) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return Backfill{}, sql.ErrNoRows
+	}
+
+	expires := now.Add(lease)
+	s.backfills[next].WorkerID = workerID
+	s.backfills[next].LeaseExpiresAt = &expires
+	return s.backfills[next], nil
+}
+
+// RenewBackfillLease implements BackfillStore.RenewBackfillLease
+func (s *memStore) RenewBackfillLease(id SiteDefID, workerID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.heldBackfill(id, workerID)
+	if i < 0 {
+		return ErrLeaseLost
+	}
+	expires := s.now().Add(lease)
+	s.backfills[i].LeaseExpiresAt = &expires
+	return nil
+}
+
+// SaveBackfillProgress implements BackfillStore.SaveBackfillProgress
+func (s *memStore) SaveBackfillProgress(b Backfill) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.heldBackfill(b.SiteDefID, b.WorkerID)
+	if i < 0 {
+		return ErrLeaseLost
+	}
+	s.backfills[i].URL = b.URL
+	s.backfills[i].Pages = b.Pages
+	s.backfills[i].Seen = b.Seen
+	return nil
+}
+
+// EndBackfill implements BackfillStore.EndBackfill
+func (s *memStore) EndBackfill(id SiteDefID, backfillErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errString string
+	if backfillErr != nil {
+		errString = backfillErr.Error()
+	}
+
+	if i := s.backfillIndex(id); i >= 0 {
+		now := s.now()
+		s.backfills[i].EndedAt = &now
+		s.backfills[i].Error = errString
+		s.backfills[i].LeaseExpiresAt = nil
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStore_Concurrent(t *testing.T) {
+	s := NewMemStore(nil)
+	id, err := s.CreateSiteDef(SiteDef{Name: "a", StartURL: "http://a.example.com/1", URLTemplate: "http://a.example.com/%s"})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				ref := fmt.Sprintf("%d-%d", i, j)
+				suID, err := s.CreateSiteUpdate(SiteUpdate{SiteDefID: id, Ref: ref, URL: "http://a.example.com/" + ref, Title: ref, SeenAt: time.Now()})
+				assert.NoError(t, err)
+				assert.NoError(t, s.CreateClickLog(suID, net.ParseIP("192.0.2.1")))
+				_, err = s.GetComics()
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	updates, err := s.GetSiteUpdates(id)
+	require.NoError(t, err)
+	assert.Len(t, updates, 200)
+	clicks, err := s.GetSiteDefClicks(time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []SiteDefClicks{{SiteDefID: id, Name: "a", Clicks: 200}}, clicks)
+}
+
+func TestBucketStart(t *testing.T) {
+	// Saturday 17 October 2026, 15:04:05 UTC
+	ts := time.Date(2026, time.October, 17, 16, 4, 5, 0, time.FixedZone("CET", 3600))
+	assert.Equal(t, time.Date(2026, time.October, 17, 15, 0, 0, 0, time.UTC), bucketStart(ts, ClickBucketHour))
+	assert.Equal(t, time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC), bucketStart(ts, ClickBucketDay))
+	assert.Equal(t, time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC), bucketStart(ts, ClickBucketWeek))
+	monday := time.Date(2026, time.October, 12, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC), bucketStart(monday, ClickBucketWeek))
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const (
+	sqlCreateMigrationsTable string = `CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, applied_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP);`
+	sqlGetSchemaVersion      string = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`
+	sqlInsertSchemaVersion   string = `INSERT INTO schema_migrations (version) VALUES (?);`
+	sqlDeleteSchemaVersion   string = `DELETE FROM schema_migrations WHERE version = ?;`
+	sqlLockMigrationsPG      string = `LOCK TABLE schema_migrations IN EXCLUSIVE MODE;`
+	sqliteForeignKeysOff     string = `PRAGMA foreign_keys = OFF;`
+	sqliteForeignKeysOn      string = `PRAGMA foreign_keys = ON;`
+	sqliteForeignKeyCheck    string = `PRAGMA foreign_key_check;`
+)
+
+// Migration is a numbered schema change along with the statements to revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// LoadMigrations reads migrations named NNNN_name.up.sql and NNNN_name.down.sql from dir in fsys.
+// Every migration must have both an up and a down file. The result is sorted by version.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(contents)
+		} else {
+			mig.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies Migrations to a database, recording the applied versions in the schema_migrations table
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	lockSQL    string
+	// sqlite migrations rebuild tables that other tables refer to, which SQLite only allows
+	// with foreign keys turned off outside the transaction, so they are checked before committing
+	sqlite bool
+}
+
+// NewPGMigrator returns a Migrator applying the embedded Postgres migrations to db
+func NewPGMigrator(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, lockSQL: sqlLockMigrationsPG}, nil
+}
+
+// NewSQLiteMigrator returns a Migrator applying the embedded SQLite migrations to db.
+// SQLite transactions already exclude concurrent writers, so no extra lock is taken.
+func NewSQLiteMigrator(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, sqlite: true}, nil
+}
+
+// NewMigrator returns the Migrator matching the driver of db, which should be opened with Open
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	if db.DriverName() == sqliteDriver {
+		return NewSQLiteMigrator(db)
+	}
+	return NewPGMigrator(db)
+}
+
+// Latest returns the version of the newest known Migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version of the newest applied Migration, or 0 if none have been applied
+func (m *Migrator) Version() (int, error) {
+	if _, err := m.db.Exec(sqlCreateMigrationsTable); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := m.db.Get(&version, sqlGetSchemaVersion); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Up applies all pending Migrations
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// To applies or reverts Migrations until the schema is at the given version. Version 0
+// reverts all Migrations. All changes are made in a single transaction.
+func (m *Migrator) To(target int) error {
+	if target != 0 && !m.known(target) {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+	if _, err := m.db.Exec(sqlCreateMigrationsTable); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.sqlite {
+		if _, err := conn.ExecContext(ctx, sqliteForeignKeysOff); err != nil {
+			return err
+		}
+		defer func() { _, _ = conn.ExecContext(ctx, sqliteForeignKeysOn) }()
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if m.lockSQL != "" {
+		if _, err := tx.Exec(m.lockSQL); err != nil {
+			return err
+		}
+	}
+	var current int
+	if err := tx.Get(&current, sqlGetSchemaVersion); err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", current, m.Latest())
+	}
+
+	if target >= current {
+		for _, mig := range m.migrations {
+			if mig.Version <= current || mig.Version > target {
+				continue
+			}
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := tx.Exec(tx.Rebind(sqlInsertSchemaVersion), mig.Version); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if mig.Version > current || mig.Version <= target {
+				continue
+			}
+			if _, err := tx.Exec(mig.Down); err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if _, err := tx.Exec(tx.Rebind(sqlDeleteSchemaVersion), mig.Version); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.sqlite {
+		rows, err := tx.Query(sqliteForeignKeyCheck)
+		if err != nil {
+			return err
+		}
+		violated := rows.Next()
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if violated {
+			return fmt.Errorf("migrating to schema version %d violates foreign key constraints", target)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateCommand runs the migrate subcommand given by args against m, writing output to out.
+//
+//	migrate [up]        apply all pending migrations
+//	migrate down        revert the newest applied migration
+//	migrate to VERSION  apply or revert migrations until the schema is at VERSION
+//	migrate version     print the current and latest schema versions
+func MigrateCommand(m *Migrator, args []string, out io.Writer) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		if err := m.Up(); err != nil {
+			return err
+		}
+	case "down":
+		current, err := m.Version()
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return fmt.Errorf("no migrations to revert")
+		}
+		previous := 0
+		for _, mig := range m.migrations {
+			if mig.Version < current {
+				previous = mig.Version
+			}
+		}
+		if err := m.To(previous); err != nil {
+			return err
+		}
+	case "to":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate to VERSION")
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if err := m.To(target); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate command %q", cmd)
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "schema version %d (latest %d)\n", current, m.Latest())
+	return err
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var testMigrations = fstest.MapFS{
+	"m/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id integer);")},
+	"m/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	"m/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id integer);")},
+	"m/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+}
+
+type MigratorTestSuite struct {
+	suite.Suite
+	migrator *Migrator
+	mdb      sqlmock.Sqlmock
+}
+
+func (s *MigratorTestSuite) SetupTest() {
+	conn, mdb, err := sqlmock.New()
+	s.Require().NoError(err)
+	migrations, err := LoadMigrations(testMigrations, "m")
+	s.Require().NoError(err)
+	s.mdb = mdb
+	s.migrator = &Migrator{
+		db:         sqlx.NewDb(conn, "postgres"),
+		migrations: migrations,
+		lockSQL:    sqlLockMigrationsPG,
+	}
+}
+
+func (s *MigratorTestSuite) TearDownTest() {
+	s.NoError(s.mdb.ExpectationsWereMet())
+}
+
+func (s *MigratorTestSuite) expectVersion(version int) {
+	s.mdb.ExpectExec(regexp.QuoteMeta(sqlCreateMigrationsTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(sqlLockMigrationsPG)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaVersion)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func (s *MigratorTestSuite) TestLoadMigrations_Embedded() {
+	migrations, err := LoadMigrations(postgresMigrations, "migrations/postgres")
+	s.NoError(err)
+	s.NotEmpty(migrations)
+	for i, mig := range migrations {
+		s.Equal(i+1, mig.Version, "migration versions must be contiguous")
+	}
+
+	sqlite, err := LoadMigrations(sqliteMigrations, "migrations/sqlite")
+	s.NoError(err)
+	if s.Len(sqlite, len(migrations), "every postgres migration must have a sqlite counterpart") {
+		for i := range sqlite {
+			s.Equal(migrations[i].Version, sqlite[i].Version)
+			s.Equal(migrations[i].Name, sqlite[i].Name)
+		}
+	}
+}
+
+func (s *MigratorTestSuite) TestLoadMigrations_MissingDown() {
+	fsys := fstest.MapFS{"m/0001_first.up.sql": {Data: []byte("SELECT 1;")}}
+	_, err := LoadMigrations(fsys, "m")
+	s.EqualError(err, "migration 1_first must have both up and down files")
+}
+
+func (s *MigratorTestSuite) TestLoadMigrations_BadName() {
+	fsys := fstest.MapFS{"m/first.sql": {Data: []byte("SELECT 1;")}}
+	_, err := LoadMigrations(fsys, "m")
+	s.EqualError(err, `invalid migration file name "first.sql"`)
+}
+
+func (s *MigratorTestSuite) TestLoadMigrations_ConflictingNames() {
+	fsys := fstest.MapFS{
+		"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+	}
+	_, err := LoadMigrations(fsys, "m")
+	s.EqualError(err, `migration 1 has conflicting names "first" and "other"`)
+}
+
+func (s *MigratorTestSuite) TestUp_OK() {
+	s.expectVersion(0)
+	s.mdb.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id integer);")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version) VALUES ($1);")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id integer);")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version) VALUES ($1);")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.migrator.Up())
+}
+
+func (s *MigratorTestSuite) TestUp_UpToDate() {
+	s.expectVersion(2)
+	s.mdb.ExpectCommit()
+	s.NoError(s.migrator.Up())
+}
+
+func (s *MigratorTestSuite) TestUp_ErrMigration() {
+	s.expectVersion(1)
+	s.mdb.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id integer);")).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	s.EqualError(s.migrator.Up(), "apply migration 2_second: some error")
+}
+
+func (s *MigratorTestSuite) TestUp_NewerSchema() {
+	s.expectVersion(3)
+	s.mdb.ExpectRollback()
+	s.EqualError(s.migrator.Up(), "schema version 3 is newer than the latest known version 2")
+}
+
+func (s *MigratorTestSuite) TestTo_Down() {
+	s.expectVersion(2)
+	s.mdb.ExpectExec(regexp.QuoteMeta("DROP TABLE b;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1;")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectExec(regexp.QuoteMeta("DROP TABLE a;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1;")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.migrator.To(0))
+}
+
+func (s *MigratorTestSuite) TestTo_Unknown() {
+	s.EqualError(s.migrator.To(5), "unknown schema version 5")
+}
+
+func (s *MigratorTestSuite) TestTo_ErrBegin() {
+	s.mdb.ExpectExec(regexp.QuoteMeta(sqlCreateMigrationsTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	s.EqualError(s.migrator.To(1), "some error")
+}
+
+func (s *MigratorTestSuite) TestMigrateCommand_Down() {
+	s.mdb.ExpectExec(regexp.QuoteMeta(sqlCreateMigrationsTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaVersion)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	s.expectVersion(2)
+	s.mdb.ExpectExec(regexp.QuoteMeta("DROP TABLE b;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1;")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.mdb.ExpectExec(regexp.QuoteMeta(sqlCreateMigrationsTable)).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectQuery(regexp.QuoteMeta(sqlGetSchemaVersion)).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	var out bytes.Buffer
+	s.NoError(MigrateCommand(s.migrator, []string{"down"}, &out))
+	s.Equal("schema version 1 (latest 2)\n", out.String())
+}
+
+func (s *MigratorTestSuite) TestMigrateCommand_Unknown() {
+	var out bytes.Buffer
+	s.EqualError(MigrateCommand(s.migrator, []string{"sideways"}, &out), `unknown migrate command "sideways"`)
+}
+
+func TestMigratorTestSuite(t *testing.T) {
+	suite.Run(t, new(MigratorTestSuite))
+}
+
+func TestSQLiteMigrator_HashFeedTokens(t *testing.T) {
+	conn, err := openSQLite("sqlite:" + filepath.Join(t.TempDir(), "freshcomics.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+	m, err := NewSQLiteMigrator(conn)
+	require.NoError(t, err)
+	require.NoError(t, m.To(16))
+	_, err = conn.Exec(`INSERT INTO users (name, password_hash, feed_token) VALUES ('a', 'x', 'token'), ('b', 'x', NULL);`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up())
+	var tokens []sql.NullString
+	require.NoError(t, conn.Select(&tokens, `SELECT feed_token FROM users ORDER BY name;`))
+	sum := sha256.Sum256([]byte("token"))
+	assert.Equal(t, []sql.NullString{{String: hex.EncodeToString(sum[:]), Valid: true}, {}}, tokens)
+}
+
+func TestSQLiteMigrator_PageURLTemplate(t *testing.T) {
+	conn, err := openSQLite("sqlite:" + filepath.Join(t.TempDir(), "freshcomics.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+	m, err := NewSQLiteMigrator(conn)
+	require.NoError(t, err)
+	require.NoError(t, m.To(17))
+	_, err = conn.Exec(`INSERT INTO site_defs (name, start_url) VALUES ('a', 'http://a.example.com');`)
+	require.NoError(t, err)
+	_, err = conn.Exec(`INSERT INTO site_updates (site_def_id, ref, url, title) VALUES (1, '1', 'http://a.example.com/1', 'a 1');`)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Up())
+	var count int
+	require.NoError(t, conn.Get(&count, `SELECT COUNT(*) FROM site_updates;`))
+	assert.Equal(t, 1, count, "rebuilding site_defs must not cascade to its site updates")
+	_, err = conn.Exec(`INSERT INTO site_updates (site_def_id, ref, url, title) VALUES (2, '1', 'http://b.example.com/1', 'b 1');`)
+	assert.Error(t, err, "foreign keys must be enforced again after migrating")
+
+	require.NoError(t, m.To(17))
+	require.NoError(t, conn.Get(&count, `SELECT COUNT(*) FROM site_updates;`))
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,2 @@
+ALTER TABLE site_defs DROP COLUMN IF EXISTS feed_url;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS crawl_strategy;
@@ -0,0 +1,2 @@
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS crawl_strategy text NOT NULL DEFAULT 'page';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS feed_url text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS feed_token text DEFAULT NULL UNIQUE;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS comic_clicks (
+    id          serial      PRIMARY KEY,
+    update_id   integer     NOT NULL REFERENCES site_updates (id) ON DELETE CASCADE,
+    clicked_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    country     text        NOT NULL DEFAULT '',
+    region      text        NOT NULL DEFAULT '',
+    city        text        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS comic_clicks_clicked_at ON comic_clicks (clicked_at);
+CREATE INDEX IF NOT EXISTS comic_clicks_update_id ON comic_clicks (update_id);
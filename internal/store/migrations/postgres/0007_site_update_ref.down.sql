@@ -0,0 +1 @@
+DROP INDEX IF EXISTS site_updates_site_def_id_ref;
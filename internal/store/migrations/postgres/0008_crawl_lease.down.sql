@@ -0,0 +1,2 @@
+ALTER TABLE crawl_infos DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE crawl_infos DROP COLUMN IF EXISTS worker_id;
@@ -0,0 +1,2 @@
+ALTER TABLE crawl_infos ADD COLUMN IF NOT EXISTS worker_id text NOT NULL DEFAULT '';
+ALTER TABLE crawl_infos ADD COLUMN IF NOT EXISTS lease_expires_at timestamptz DEFAULT NULL;
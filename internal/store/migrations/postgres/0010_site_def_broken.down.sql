@@ -0,0 +1 @@
+ALTER TABLE site_defs DROP COLUMN IF EXISTS broken_reason;
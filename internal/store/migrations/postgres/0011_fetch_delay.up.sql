@@ -0,0 +1 @@
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS fetch_delay_secs integer NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE site_defs DROP COLUMN IF EXISTS title_attr;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS next_page_attr;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS selector_type;
@@ -0,0 +1,3 @@
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS selector_type text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS next_page_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS title_attr text NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+ALTER TABLE site_updates DROP COLUMN IF EXISTS published_at;
+ALTER TABLE site_updates DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE site_updates DROP COLUMN IF EXISTS image_urls;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS published_format;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS published_regexp;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS published_attr;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS published_xpath;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS alt_text_attr;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS alt_text_xpath;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS image_attr;
+ALTER TABLE site_defs DROP COLUMN IF EXISTS image_xpath;
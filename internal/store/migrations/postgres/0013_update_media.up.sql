@@ -0,0 +1,11 @@
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS image_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS image_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS alt_text_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS alt_text_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS published_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS published_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS published_regexp text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS published_format text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN IF NOT EXISTS image_urls text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN IF NOT EXISTS alt_text text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN IF NOT EXISTS published_at timestamptz DEFAULT NULL;
@@ -0,0 +1,17 @@
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS prev_page_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS prev_page_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN IF NOT EXISTS backfill_url text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS backfills (
+    site_def_id      integer     PRIMARY KEY REFERENCES site_defs (id) ON DELETE CASCADE,
+    url              text        NOT NULL,
+    max_pages        integer     NOT NULL DEFAULT 0,
+    pages            integer     NOT NULL DEFAULT 0,
+    seen             integer     NOT NULL DEFAULT 0,
+    dated_before     timestamptz NOT NULL,
+    created_at       timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at         timestamptz DEFAULT NULL,
+    error            text        NOT NULL DEFAULT '',
+    worker_id        text        NOT NULL DEFAULT '',
+    lease_expires_at timestamptz DEFAULT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE crawl_infos DROP COLUMN IF EXISTS origin;
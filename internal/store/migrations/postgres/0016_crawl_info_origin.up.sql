@@ -0,0 +1,2 @@
+ALTER TABLE crawl_infos ADD COLUMN IF NOT EXISTS origin text NOT NULL DEFAULT '';
+UPDATE crawl_infos SET origin = lower(substring(url from '^[^:/?#]+://[^/?#]*')) WHERE url ~ '^[^:/?#]+://';
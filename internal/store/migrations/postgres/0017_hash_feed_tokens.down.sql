@@ -0,0 +1 @@
+UPDATE users SET feed_token = NULL;
@@ -0,0 +1 @@
+UPDATE users SET feed_token = encode(sha256(convert_to(feed_token, 'UTF8')), 'hex') WHERE feed_token IS NOT NULL;
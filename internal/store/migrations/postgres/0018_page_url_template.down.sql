@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS site_defs_url_template_key;
+ALTER TABLE site_defs ADD CONSTRAINT site_defs_url_template_key UNIQUE (url_template);
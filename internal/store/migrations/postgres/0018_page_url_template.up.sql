@@ -0,0 +1,3 @@
+-- only page SiteDefs use url_template, so feed SiteDefs can share an empty one
+ALTER TABLE site_defs DROP CONSTRAINT IF EXISTS site_defs_url_template_key;
+CREATE UNIQUE INDEX IF NOT EXISTS site_defs_url_template_key ON site_defs (url_template) WHERE crawl_strategy = 'page';
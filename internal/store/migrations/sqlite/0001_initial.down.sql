@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS crawl_infos;
+DROP TABLE IF EXISTS site_updates;
+DROP TABLE IF EXISTS site_defs;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS site_defs (
+    id              integer  PRIMARY KEY AUTOINCREMENT,
+    name            text     NOT NULL DEFAULT 'New SiteDef' UNIQUE,
+    active          boolean  NOT NULL DEFAULT FALSE,
+    nsfw            boolean  NOT NULL DEFAULT FALSE,
+    start_url       text     NOT NULL DEFAULT 'http://example.com' UNIQUE,
+    url_template    text     NOT NULL DEFAULT 'http://example.com/%s' UNIQUE,
+    next_page_xpath text     NOT NULL DEFAULT '//a[@rel="next"]/@href',
+    ref_regexp      text     NOT NULL DEFAULT '([^/]+)/?$',
+    title_xpath     text     NOT NULL DEFAULT '//title/text()',
+    title_regexp    text     NOT NULL DEFAULT '(.+)'
+);
+
+CREATE TABLE IF NOT EXISTS site_updates (
+    id          integer  PRIMARY KEY AUTOINCREMENT,
+    site_def_id integer  REFERENCES site_defs (id) ON DELETE CASCADE,
+    ref         text     NOT NULL,
+    url         text     NOT NULL UNIQUE,
+    title       text     NOT NULL,
+    seen_at     datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS crawl_infos (
+    id          integer  PRIMARY KEY AUTOINCREMENT,
+    site_def_id integer  REFERENCES site_defs (id) ON DELETE CASCADE,
+    url         text     NOT NULL,
+    created_at  datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at  datetime DEFAULT NULL,
+    ended_at    datetime DEFAULT NULL,
+    error       text     NOT NULL DEFAULT '',
+    seen        integer  NOT NULL DEFAULT 0
+);
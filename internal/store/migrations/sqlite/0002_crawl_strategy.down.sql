@@ -0,0 +1,2 @@
+ALTER TABLE site_defs DROP COLUMN feed_url;
+ALTER TABLE site_defs DROP COLUMN crawl_strategy;
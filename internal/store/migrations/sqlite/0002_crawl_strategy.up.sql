@@ -0,0 +1,2 @@
+ALTER TABLE site_defs ADD COLUMN crawl_strategy text NOT NULL DEFAULT 'page';
+ALTER TABLE site_defs ADD COLUMN feed_url text NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS users (
+    id            integer  PRIMARY KEY AUTOINCREMENT,
+    name          text     NOT NULL UNIQUE,
+    password_hash text     NOT NULL,
+    role          text     NOT NULL DEFAULT 'user',
+    created_at    datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash  text     PRIMARY KEY,
+    user_id     integer  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at  datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at  datetime NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS read_updates;
+DROP TABLE IF EXISTS subscriptions;
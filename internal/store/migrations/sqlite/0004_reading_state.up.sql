@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    user_id     integer  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    site_def_id integer  NOT NULL REFERENCES site_defs (id) ON DELETE CASCADE,
+    created_at  datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, site_def_id)
+);
+
+CREATE TABLE IF NOT EXISTS read_updates (
+    user_id        integer  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    site_update_id integer  NOT NULL REFERENCES site_updates (id) ON DELETE CASCADE,
+    read_at        datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, site_update_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN feed_token text DEFAULT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_feed_token ON users (feed_token);
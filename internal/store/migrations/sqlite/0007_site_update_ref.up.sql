@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS site_updates_site_def_id_ref ON site_updates (site_def_id, ref);
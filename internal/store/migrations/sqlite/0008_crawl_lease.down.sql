@@ -0,0 +1,2 @@
+ALTER TABLE crawl_infos DROP COLUMN lease_expires_at;
+ALTER TABLE crawl_infos DROP COLUMN worker_id;
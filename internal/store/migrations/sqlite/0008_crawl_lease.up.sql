@@ -0,0 +1,2 @@
+ALTER TABLE crawl_infos ADD COLUMN worker_id text NOT NULL DEFAULT '';
+ALTER TABLE crawl_infos ADD COLUMN lease_expires_at datetime DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE site_defs DROP COLUMN crawl_jitter_secs;
+ALTER TABLE site_defs DROP COLUMN crawl_cron;
+ALTER TABLE site_defs DROP COLUMN crawl_interval_secs;
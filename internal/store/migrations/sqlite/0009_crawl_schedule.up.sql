@@ -0,0 +1,3 @@
+ALTER TABLE site_defs ADD COLUMN crawl_interval_secs integer NOT NULL DEFAULT 0;
+ALTER TABLE site_defs ADD COLUMN crawl_cron text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN crawl_jitter_secs integer NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE site_defs DROP COLUMN broken_reason;
@@ -0,0 +1 @@
+ALTER TABLE site_defs ADD COLUMN broken_reason text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE site_defs DROP COLUMN fetch_delay_secs;
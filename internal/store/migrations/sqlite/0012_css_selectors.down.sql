@@ -0,0 +1,3 @@
+ALTER TABLE site_defs DROP COLUMN title_attr;
+ALTER TABLE site_defs DROP COLUMN next_page_attr;
+ALTER TABLE site_defs DROP COLUMN selector_type;
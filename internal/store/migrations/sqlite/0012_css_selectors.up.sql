@@ -0,0 +1,3 @@
+ALTER TABLE site_defs ADD COLUMN selector_type text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN next_page_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN title_attr text NOT NULL DEFAULT '';
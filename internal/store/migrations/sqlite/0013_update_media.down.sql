@@ -0,0 +1,11 @@
+ALTER TABLE site_updates DROP COLUMN published_at;
+ALTER TABLE site_updates DROP COLUMN alt_text;
+ALTER TABLE site_updates DROP COLUMN image_urls;
+ALTER TABLE site_defs DROP COLUMN published_format;
+ALTER TABLE site_defs DROP COLUMN published_regexp;
+ALTER TABLE site_defs DROP COLUMN published_attr;
+ALTER TABLE site_defs DROP COLUMN published_xpath;
+ALTER TABLE site_defs DROP COLUMN alt_text_attr;
+ALTER TABLE site_defs DROP COLUMN alt_text_xpath;
+ALTER TABLE site_defs DROP COLUMN image_attr;
+ALTER TABLE site_defs DROP COLUMN image_xpath;
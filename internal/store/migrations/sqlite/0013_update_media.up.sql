@@ -0,0 +1,11 @@
+ALTER TABLE site_defs ADD COLUMN image_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN image_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN alt_text_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN alt_text_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN published_xpath text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN published_attr text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN published_regexp text NOT NULL DEFAULT '';
+ALTER TABLE site_defs ADD COLUMN published_format text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN image_urls text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN alt_text text NOT NULL DEFAULT '';
+ALTER TABLE site_updates ADD COLUMN published_at datetime DEFAULT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS update_images (
+    id          integer  PRIMARY KEY AUTOINCREMENT,
+    update_id   integer  NOT NULL REFERENCES site_updates (id) ON DELETE CASCADE,
+    position    integer  NOT NULL,
+    url         text     NOT NULL,
+    hash        text     NOT NULL,
+    mime_type   text     NOT NULL,
+    width       integer  NOT NULL DEFAULT 0,
+    height      integer  NOT NULL DEFAULT 0,
+    size        integer  NOT NULL DEFAULT 0,
+    archived_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (update_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS update_images_hash ON update_images (hash);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS backfills;
+ALTER TABLE site_defs DROP COLUMN backfill_url;
+ALTER TABLE site_defs DROP COLUMN prev_page_attr;
+ALTER TABLE site_defs DROP COLUMN prev_page_xpath;
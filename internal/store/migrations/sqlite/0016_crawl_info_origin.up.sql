@@ -0,0 +1,5 @@
+ALTER TABLE crawl_infos ADD COLUMN origin text NOT NULL DEFAULT '';
+UPDATE crawl_infos SET origin = lower(CASE
+    WHEN instr(substr(url, instr(url, '://') + 3), '/') = 0 THEN url
+    ELSE substr(url, 1, instr(url, '://') + 1 + instr(substr(url, instr(url, '://') + 3), '/'))
+END) WHERE instr(url, '://') > 0;
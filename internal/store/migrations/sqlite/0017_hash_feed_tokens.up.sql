@@ -0,0 +1 @@
+UPDATE users SET feed_token = sha256_hex(feed_token) WHERE feed_token IS NOT NULL;
@@ -0,0 +1,40 @@
+-- restores the unique url_template constraint, which fails if feed SiteDefs share a url_template
+CREATE TABLE site_defs_new (
+    id                  integer  PRIMARY KEY AUTOINCREMENT,
+    name                text     NOT NULL DEFAULT 'New SiteDef' UNIQUE,
+    active              boolean  NOT NULL DEFAULT FALSE,
+    nsfw                boolean  NOT NULL DEFAULT FALSE,
+    start_url           text     NOT NULL DEFAULT 'http://example.com' UNIQUE,
+    url_template        text     NOT NULL DEFAULT 'http://example.com/%s' UNIQUE,
+    next_page_xpath     text     NOT NULL DEFAULT '//a[@rel="next"]/@href',
+    ref_regexp          text     NOT NULL DEFAULT '([^/]+)/?$',
+    title_xpath         text     NOT NULL DEFAULT '//title/text()',
+    title_regexp        text     NOT NULL DEFAULT '(.+)',
+    crawl_strategy      text     NOT NULL DEFAULT 'page',
+    feed_url            text     NOT NULL DEFAULT '',
+    crawl_interval_secs integer  NOT NULL DEFAULT 0,
+    crawl_cron          text     NOT NULL DEFAULT '',
+    crawl_jitter_secs   integer  NOT NULL DEFAULT 0,
+    broken_reason       text     NOT NULL DEFAULT '',
+    fetch_delay_secs    integer  NOT NULL DEFAULT 0,
+    selector_type       text     NOT NULL DEFAULT '',
+    next_page_attr      text     NOT NULL DEFAULT '',
+    title_attr          text     NOT NULL DEFAULT '',
+    image_xpath         text     NOT NULL DEFAULT '',
+    image_attr          text     NOT NULL DEFAULT '',
+    alt_text_xpath      text     NOT NULL DEFAULT '',
+    alt_text_attr       text     NOT NULL DEFAULT '',
+    published_xpath     text     NOT NULL DEFAULT '',
+    published_attr      text     NOT NULL DEFAULT '',
+    published_regexp    text     NOT NULL DEFAULT '',
+    published_format    text     NOT NULL DEFAULT '',
+    prev_page_xpath     text     NOT NULL DEFAULT '',
+    prev_page_attr      text     NOT NULL DEFAULT '',
+    backfill_url        text     NOT NULL DEFAULT ''
+);
+
+INSERT INTO site_defs_new (id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url)
+SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url FROM site_defs;
+
+DROP TABLE site_defs;
+ALTER TABLE site_defs_new RENAME TO site_defs;
@@ -5,7 +5,9 @@
 package mock_store
 
 import (
+	net "net"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	store "github.com/johnstcn/freshcomics/internal/store"
@@ -34,6 +36,79 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// AbandonStaleCrawlInfos mocks base method.
+func (m *MockStore) AbandonStaleCrawlInfos(arg0 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AbandonStaleCrawlInfos", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AbandonStaleCrawlInfos indicates an expected call of AbandonStaleCrawlInfos.
+func (mr *MockStoreMockRecorder) AbandonStaleCrawlInfos(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AbandonStaleCrawlInfos", reflect.TypeOf((*MockStore)(nil).AbandonStaleCrawlInfos), arg0)
+}
+
+// ClaimNextBackfill mocks base method.
+func (m *MockStore) ClaimNextBackfill(arg0 string, arg1 time.Duration) (store.Backfill, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimNextBackfill", arg0, arg1)
+	ret0, _ := ret[0].(store.Backfill)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimNextBackfill indicates an expected call of ClaimNextBackfill.
+func (mr *MockStoreMockRecorder) ClaimNextBackfill(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimNextBackfill", reflect.TypeOf((*MockStore)(nil).ClaimNextBackfill), arg0, arg1)
+}
+
+// ClaimNextCrawlInfo mocks base method.
+func (m *MockStore) ClaimNextCrawlInfo(arg0 string, arg1 time.Duration, arg2 []string) (store.CrawlInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimNextCrawlInfo", arg0, arg1, arg2)
+	ret0, _ := ret[0].(store.CrawlInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimNextCrawlInfo indicates an expected call of ClaimNextCrawlInfo.
+func (mr *MockStoreMockRecorder) ClaimNextCrawlInfo(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimNextCrawlInfo", reflect.TypeOf((*MockStore)(nil).ClaimNextCrawlInfo), arg0, arg1, arg2)
+}
+
+// CreateBackfill mocks base method.
+func (m *MockStore) CreateBackfill(arg0 store.Backfill) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBackfill", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateBackfill indicates an expected call of CreateBackfill.
+func (mr *MockStoreMockRecorder) CreateBackfill(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBackfill", reflect.TypeOf((*MockStore)(nil).CreateBackfill), arg0)
+}
+
+// CreateClickLog mocks base method.
+func (m *MockStore) CreateClickLog(arg0 store.SiteUpdateID, arg1 net.IP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClickLog", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateClickLog indicates an expected call of CreateClickLog.
+func (mr *MockStoreMockRecorder) CreateClickLog(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClickLog", reflect.TypeOf((*MockStore)(nil).CreateClickLog), arg0, arg1)
+}
+
 // CreateCrawlInfo mocks base method.
 func (m *MockStore) CreateCrawlInfo(arg0 store.SiteDefID, arg1 string) (store.CrawlInfoID, error) {
 	m.ctrl.T.Helper()
@@ -49,6 +124,20 @@ func (mr *MockStoreMockRecorder) CreateCrawlInfo(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCrawlInfo", reflect.TypeOf((*MockStore)(nil).CreateCrawlInfo), arg0, arg1)
 }
 
+// CreateSession mocks base method.
+func (m *MockStore) CreateSession(arg0 store.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockStoreMockRecorder) CreateSession(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockStore)(nil).CreateSession), arg0)
+}
+
 // CreateSiteDef mocks base method.
 func (m *MockStore) CreateSiteDef(arg0 store.SiteDef) (store.SiteDefID, error) {
 	m.ctrl.T.Helper()
@@ -79,18 +168,91 @@ func (mr *MockStoreMockRecorder) CreateSiteUpdate(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSiteUpdate", reflect.TypeOf((*MockStore)(nil).CreateSiteUpdate), arg0)
 }
 
+// CreateUpdateImage mocks base method.
+func (m *MockStore) CreateUpdateImage(arg0 store.UpdateImage) (store.UpdateImageID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUpdateImage", arg0)
+	ret0, _ := ret[0].(store.UpdateImageID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUpdateImage indicates an expected call of CreateUpdateImage.
+func (mr *MockStoreMockRecorder) CreateUpdateImage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUpdateImage", reflect.TypeOf((*MockStore)(nil).CreateUpdateImage), arg0)
+}
+
+// CreateUser mocks base method.
+func (m *MockStore) CreateUser(arg0 store.User) (store.UserID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", arg0)
+	ret0, _ := ret[0].(store.UserID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockStoreMockRecorder) CreateUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStore)(nil).CreateUser), arg0)
+}
+
+// DeleteSession mocks base method.
+func (m *MockStore) DeleteSession(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSession", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSession indicates an expected call of DeleteSession.
+func (mr *MockStoreMockRecorder) DeleteSession(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockStore)(nil).DeleteSession), arg0)
+}
+
+// EndBackfill mocks base method.
+func (m *MockStore) EndBackfill(arg0 store.SiteDefID, arg1 error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EndBackfill", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EndBackfill indicates an expected call of EndBackfill.
+func (mr *MockStoreMockRecorder) EndBackfill(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndBackfill", reflect.TypeOf((*MockStore)(nil).EndBackfill), arg0, arg1)
+}
+
 // EndCrawlInfo mocks base method.
-func (m *MockStore) EndCrawlInfo(arg0 store.CrawlInfoID, arg1 error, arg2 int) error {
+func (m *MockStore) EndCrawlInfo(arg0 store.CrawlInfoID, arg1 string, arg2 error, arg3 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "EndCrawlInfo", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "EndCrawlInfo", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // EndCrawlInfo indicates an expected call of EndCrawlInfo.
-func (mr *MockStoreMockRecorder) EndCrawlInfo(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) EndCrawlInfo(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndCrawlInfo", reflect.TypeOf((*MockStore)(nil).EndCrawlInfo), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndCrawlInfo", reflect.TypeOf((*MockStore)(nil).EndCrawlInfo), arg0, arg1, arg2, arg3)
+}
+
+// GetBackfill mocks base method.
+func (m *MockStore) GetBackfill(arg0 store.SiteDefID) (store.Backfill, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBackfill", arg0)
+	ret0, _ := ret[0].(store.Backfill)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBackfill indicates an expected call of GetBackfill.
+func (mr *MockStoreMockRecorder) GetBackfill(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBackfill", reflect.TypeOf((*MockStore)(nil).GetBackfill), arg0)
 }
 
 // GetComics mocks base method.
@@ -108,6 +270,21 @@ func (mr *MockStoreMockRecorder) GetComics() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComics", reflect.TypeOf((*MockStore)(nil).GetComics))
 }
 
+// GetCountryClicks mocks base method.
+func (m *MockStore) GetCountryClicks(arg0 time.Time, arg1 int) ([]store.LocationClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCountryClicks", arg0, arg1)
+	ret0, _ := ret[0].([]store.LocationClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCountryClicks indicates an expected call of GetCountryClicks.
+func (mr *MockStoreMockRecorder) GetCountryClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCountryClicks", reflect.TypeOf((*MockStore)(nil).GetCountryClicks), arg0, arg1)
+}
+
 // GetCrawlInfo mocks base method.
 func (m *MockStore) GetCrawlInfo(arg0 store.SiteDefID) ([]store.CrawlInfo, error) {
 	m.ctrl.T.Helper()
@@ -138,6 +315,21 @@ func (mr *MockStoreMockRecorder) GetCrawlInfos() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCrawlInfos", reflect.TypeOf((*MockStore)(nil).GetCrawlInfos))
 }
 
+// GetFeedToken mocks base method.
+func (m *MockStore) GetFeedToken(arg0 store.UserID) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFeedToken", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFeedToken indicates an expected call of GetFeedToken.
+func (mr *MockStoreMockRecorder) GetFeedToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFeedToken", reflect.TypeOf((*MockStore)(nil).GetFeedToken), arg0)
+}
+
 // GetLastURL mocks base method.
 func (m *MockStore) GetLastURL(arg0 store.SiteDefID) (string, error) {
 	m.ctrl.T.Helper()
@@ -168,6 +360,66 @@ func (mr *MockStoreMockRecorder) GetPendingCrawlInfos() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingCrawlInfos", reflect.TypeOf((*MockStore)(nil).GetPendingCrawlInfos))
 }
 
+// GetPopularComics mocks base method.
+func (m *MockStore) GetPopularComics(arg0 time.Time) ([]store.Comic, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPopularComics", arg0)
+	ret0, _ := ret[0].([]store.Comic)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPopularComics indicates an expected call of GetPopularComics.
+func (mr *MockStoreMockRecorder) GetPopularComics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPopularComics", reflect.TypeOf((*MockStore)(nil).GetPopularComics), arg0)
+}
+
+// GetRecentUpdates mocks base method.
+func (m *MockStore) GetRecentUpdates(arg0 int) ([]store.ComicUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecentUpdates", arg0)
+	ret0, _ := ret[0].([]store.ComicUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecentUpdates indicates an expected call of GetRecentUpdates.
+func (mr *MockStoreMockRecorder) GetRecentUpdates(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecentUpdates", reflect.TypeOf((*MockStore)(nil).GetRecentUpdates), arg0)
+}
+
+// GetRegionClicks mocks base method.
+func (m *MockStore) GetRegionClicks(arg0 time.Time, arg1 int) ([]store.LocationClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRegionClicks", arg0, arg1)
+	ret0, _ := ret[0].([]store.LocationClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRegionClicks indicates an expected call of GetRegionClicks.
+func (mr *MockStoreMockRecorder) GetRegionClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRegionClicks", reflect.TypeOf((*MockStore)(nil).GetRegionClicks), arg0, arg1)
+}
+
+// GetSessionUser mocks base method.
+func (m *MockStore) GetSessionUser(arg0 string) (store.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessionUser", arg0)
+	ret0, _ := ret[0].(store.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessionUser indicates an expected call of GetSessionUser.
+func (mr *MockStoreMockRecorder) GetSessionUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessionUser", reflect.TypeOf((*MockStore)(nil).GetSessionUser), arg0)
+}
+
 // GetSiteDef mocks base method.
 func (m *MockStore) GetSiteDef(arg0 store.SiteDefID) (store.SiteDef, error) {
 	m.ctrl.T.Helper()
@@ -183,6 +435,51 @@ func (mr *MockStoreMockRecorder) GetSiteDef(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteDef", reflect.TypeOf((*MockStore)(nil).GetSiteDef), arg0)
 }
 
+// GetSiteDefClickSeries mocks base method.
+func (m *MockStore) GetSiteDefClickSeries(arg0 store.SiteDefID, arg1 store.ClickBucketSize, arg2 time.Time) ([]store.ClickBucket, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSiteDefClickSeries", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]store.ClickBucket)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSiteDefClickSeries indicates an expected call of GetSiteDefClickSeries.
+func (mr *MockStoreMockRecorder) GetSiteDefClickSeries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteDefClickSeries", reflect.TypeOf((*MockStore)(nil).GetSiteDefClickSeries), arg0, arg1, arg2)
+}
+
+// GetSiteDefClicks mocks base method.
+func (m *MockStore) GetSiteDefClicks(arg0 time.Time, arg1 int) ([]store.SiteDefClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSiteDefClicks", arg0, arg1)
+	ret0, _ := ret[0].([]store.SiteDefClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSiteDefClicks indicates an expected call of GetSiteDefClicks.
+func (mr *MockStoreMockRecorder) GetSiteDefClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteDefClicks", reflect.TypeOf((*MockStore)(nil).GetSiteDefClicks), arg0, arg1)
+}
+
+// GetSiteDefUpdates mocks base method.
+func (m *MockStore) GetSiteDefUpdates(arg0 store.SiteDefID, arg1 int) ([]store.ComicUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSiteDefUpdates", arg0, arg1)
+	ret0, _ := ret[0].([]store.ComicUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSiteDefUpdates indicates an expected call of GetSiteDefUpdates.
+func (mr *MockStoreMockRecorder) GetSiteDefUpdates(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteDefUpdates", reflect.TypeOf((*MockStore)(nil).GetSiteDefUpdates), arg0, arg1)
+}
+
 // GetSiteDefs mocks base method.
 func (m *MockStore) GetSiteDefs(arg0 bool) ([]store.SiteDef, error) {
 	m.ctrl.T.Helper()
@@ -214,6 +511,36 @@ func (mr *MockStoreMockRecorder) GetSiteUpdate(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteUpdate", reflect.TypeOf((*MockStore)(nil).GetSiteUpdate), arg0, arg1)
 }
 
+// GetSiteUpdateClicks mocks base method.
+func (m *MockStore) GetSiteUpdateClicks(arg0 time.Time, arg1 int) ([]store.SiteUpdateClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSiteUpdateClicks", arg0, arg1)
+	ret0, _ := ret[0].([]store.SiteUpdateClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSiteUpdateClicks indicates an expected call of GetSiteUpdateClicks.
+func (mr *MockStoreMockRecorder) GetSiteUpdateClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteUpdateClicks", reflect.TypeOf((*MockStore)(nil).GetSiteUpdateClicks), arg0, arg1)
+}
+
+// GetSiteUpdateTimes mocks base method.
+func (m *MockStore) GetSiteUpdateTimes(arg0 store.SiteDefID, arg1 int) ([]time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSiteUpdateTimes", arg0, arg1)
+	ret0, _ := ret[0].([]time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSiteUpdateTimes indicates an expected call of GetSiteUpdateTimes.
+func (mr *MockStoreMockRecorder) GetSiteUpdateTimes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteUpdateTimes", reflect.TypeOf((*MockStore)(nil).GetSiteUpdateTimes), arg0, arg1)
+}
+
 // GetSiteUpdates mocks base method.
 func (m *MockStore) GetSiteUpdates(arg0 store.SiteDefID) ([]store.SiteUpdate, error) {
 	m.ctrl.T.Helper()
@@ -229,6 +556,183 @@ func (mr *MockStoreMockRecorder) GetSiteUpdates(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSiteUpdates", reflect.TypeOf((*MockStore)(nil).GetSiteUpdates), arg0)
 }
 
+// GetSubscribedUpdates mocks base method.
+func (m *MockStore) GetSubscribedUpdates(arg0 store.UserID, arg1 int) ([]store.ComicUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscribedUpdates", arg0, arg1)
+	ret0, _ := ret[0].([]store.ComicUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscribedUpdates indicates an expected call of GetSubscribedUpdates.
+func (mr *MockStoreMockRecorder) GetSubscribedUpdates(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscribedUpdates", reflect.TypeOf((*MockStore)(nil).GetSubscribedUpdates), arg0, arg1)
+}
+
+// GetSubscriptions mocks base method.
+func (m *MockStore) GetSubscriptions(arg0 store.UserID) ([]store.SiteDefID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptions", arg0)
+	ret0, _ := ret[0].([]store.SiteDefID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptions indicates an expected call of GetSubscriptions.
+func (mr *MockStoreMockRecorder) GetSubscriptions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptions", reflect.TypeOf((*MockStore)(nil).GetSubscriptions), arg0)
+}
+
+// GetTrendingComics mocks base method.
+func (m *MockStore) GetTrendingComics(arg0 time.Time, arg1 int) ([]store.TrendingComic, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrendingComics", arg0, arg1)
+	ret0, _ := ret[0].([]store.TrendingComic)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrendingComics indicates an expected call of GetTrendingComics.
+func (mr *MockStoreMockRecorder) GetTrendingComics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrendingComics", reflect.TypeOf((*MockStore)(nil).GetTrendingComics), arg0, arg1)
+}
+
+// GetUnreadComics mocks base method.
+func (m *MockStore) GetUnreadComics(arg0 store.UserID) ([]store.UnreadComic, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnreadComics", arg0)
+	ret0, _ := ret[0].([]store.UnreadComic)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnreadComics indicates an expected call of GetUnreadComics.
+func (mr *MockStoreMockRecorder) GetUnreadComics(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnreadComics", reflect.TypeOf((*MockStore)(nil).GetUnreadComics), arg0)
+}
+
+// GetUpdateImageByHash mocks base method.
+func (m *MockStore) GetUpdateImageByHash(arg0 string) (store.UpdateImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUpdateImageByHash", arg0)
+	ret0, _ := ret[0].(store.UpdateImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUpdateImageByHash indicates an expected call of GetUpdateImageByHash.
+func (mr *MockStoreMockRecorder) GetUpdateImageByHash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpdateImageByHash", reflect.TypeOf((*MockStore)(nil).GetUpdateImageByHash), arg0)
+}
+
+// GetUpdateImages mocks base method.
+func (m *MockStore) GetUpdateImages(arg0 store.SiteUpdateID) ([]store.UpdateImage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUpdateImages", arg0)
+	ret0, _ := ret[0].([]store.UpdateImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUpdateImages indicates an expected call of GetUpdateImages.
+func (mr *MockStoreMockRecorder) GetUpdateImages(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpdateImages", reflect.TypeOf((*MockStore)(nil).GetUpdateImages), arg0)
+}
+
+// GetUser mocks base method.
+func (m *MockStore) GetUser(arg0 store.UserID) (store.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", arg0)
+	ret0, _ := ret[0].(store.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockStoreMockRecorder) GetUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), arg0)
+}
+
+// GetUserByFeedToken mocks base method.
+func (m *MockStore) GetUserByFeedToken(arg0 string) (store.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByFeedToken", arg0)
+	ret0, _ := ret[0].(store.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByFeedToken indicates an expected call of GetUserByFeedToken.
+func (mr *MockStoreMockRecorder) GetUserByFeedToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByFeedToken", reflect.TypeOf((*MockStore)(nil).GetUserByFeedToken), arg0)
+}
+
+// GetUserByName mocks base method.
+func (m *MockStore) GetUserByName(arg0 string) (store.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByName", arg0)
+	ret0, _ := ret[0].(store.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByName indicates an expected call of GetUserByName.
+func (mr *MockStoreMockRecorder) GetUserByName(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByName", reflect.TypeOf((*MockStore)(nil).GetUserByName), arg0)
+}
+
+// MarkRead mocks base method.
+func (m *MockStore) MarkRead(arg0 store.UserID, arg1 store.SiteUpdateID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRead", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRead indicates an expected call of MarkRead.
+func (mr *MockStoreMockRecorder) MarkRead(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRead", reflect.TypeOf((*MockStore)(nil).MarkRead), arg0, arg1)
+}
+
+// MarkReadThrough mocks base method.
+func (m *MockStore) MarkReadThrough(arg0 store.UserID, arg1 store.SiteUpdateID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkReadThrough", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkReadThrough indicates an expected call of MarkReadThrough.
+func (mr *MockStoreMockRecorder) MarkReadThrough(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkReadThrough", reflect.TypeOf((*MockStore)(nil).MarkReadThrough), arg0, arg1)
+}
+
+// MarkSiteDefBroken mocks base method.
+func (m *MockStore) MarkSiteDefBroken(arg0 store.SiteDefID, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkSiteDefBroken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkSiteDefBroken indicates an expected call of MarkSiteDefBroken.
+func (mr *MockStoreMockRecorder) MarkSiteDefBroken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkSiteDefBroken", reflect.TypeOf((*MockStore)(nil).MarkSiteDefBroken), arg0, arg1)
+}
+
 // Redirect mocks base method.
 func (m *MockStore) Redirect(arg0 store.SiteUpdateID) (string, error) {
 	m.ctrl.T.Helper()
@@ -244,6 +748,62 @@ func (mr *MockStoreMockRecorder) Redirect(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Redirect", reflect.TypeOf((*MockStore)(nil).Redirect), arg0)
 }
 
+// RenewBackfillLease mocks base method.
+func (m *MockStore) RenewBackfillLease(arg0 store.SiteDefID, arg1 string, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewBackfillLease", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewBackfillLease indicates an expected call of RenewBackfillLease.
+func (mr *MockStoreMockRecorder) RenewBackfillLease(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewBackfillLease", reflect.TypeOf((*MockStore)(nil).RenewBackfillLease), arg0, arg1, arg2)
+}
+
+// RenewCrawlInfoLease mocks base method.
+func (m *MockStore) RenewCrawlInfoLease(arg0 store.CrawlInfoID, arg1 string, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewCrawlInfoLease", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewCrawlInfoLease indicates an expected call of RenewCrawlInfoLease.
+func (mr *MockStoreMockRecorder) RenewCrawlInfoLease(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewCrawlInfoLease", reflect.TypeOf((*MockStore)(nil).RenewCrawlInfoLease), arg0, arg1, arg2)
+}
+
+// SaveBackfillProgress mocks base method.
+func (m *MockStore) SaveBackfillProgress(arg0 store.Backfill) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveBackfillProgress", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveBackfillProgress indicates an expected call of SaveBackfillProgress.
+func (mr *MockStoreMockRecorder) SaveBackfillProgress(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBackfillProgress", reflect.TypeOf((*MockStore)(nil).SaveBackfillProgress), arg0)
+}
+
+// SetFeedToken mocks base method.
+func (m *MockStore) SetFeedToken(arg0 store.UserID, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFeedToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFeedToken indicates an expected call of SetFeedToken.
+func (mr *MockStoreMockRecorder) SetFeedToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFeedToken", reflect.TypeOf((*MockStore)(nil).SetFeedToken), arg0, arg1)
+}
+
 // StartCrawlInfo mocks base method.
 func (m *MockStore) StartCrawlInfo(arg0 store.CrawlInfoID) error {
 	m.ctrl.T.Helper()
@@ -258,6 +818,34 @@ func (mr *MockStoreMockRecorder) StartCrawlInfo(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartCrawlInfo", reflect.TypeOf((*MockStore)(nil).StartCrawlInfo), arg0)
 }
 
+// Subscribe mocks base method.
+func (m *MockStore) Subscribe(arg0 store.UserID, arg1 store.SiteDefID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockStoreMockRecorder) Subscribe(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockStore)(nil).Subscribe), arg0, arg1)
+}
+
+// Unsubscribe mocks base method.
+func (m *MockStore) Unsubscribe(arg0 store.UserID, arg1 store.SiteDefID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsubscribe", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockStoreMockRecorder) Unsubscribe(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockStore)(nil).Unsubscribe), arg0, arg1)
+}
+
 // UpdateSiteDef mocks base method.
 func (m *MockStore) UpdateSiteDef(arg0 store.SiteDef) error {
 	m.ctrl.T.Helper()
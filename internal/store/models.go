@@ -1,6 +1,11 @@
 package store
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -11,14 +16,73 @@ type ClickLogID int64
 type SiteDefID int64
 type SiteUpdateID int64
 type CrawlInfoID int64
+type UserID int64
+type UpdateImageID int64
+
+// StringList is a list of strings stored as a JSON array in a text column. An empty column scans as an empty list.
+type StringList []string
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	if len(raw) == 0 {
+		*l = StringList{}
+		return nil
+	}
+	return json.Unmarshal(raw, (*[]string)(l))
+}
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Role determines what a User is permitted to do
+type Role string
+
+const (
+	// RoleUser may read comics and manage their own reading state
+	RoleUser Role = "user"
+	// RoleAdmin may additionally manage SiteDefs
+	RoleAdmin Role = "admin"
+)
+
+// CrawlStrategy determines how a SiteDef is crawled
+type CrawlStrategy string
+
+const (
+	// CrawlStrategyPage walks pages using NextPageXPath and RefRegexp
+	CrawlStrategyPage CrawlStrategy = "page"
+	// CrawlStrategyFeed reads updates from the RSS or Atom feed at FeedURL
+	CrawlStrategyFeed CrawlStrategy = "feed"
+)
 
 type Comic struct {
-	ID     ComicID   `db:"id" json:"id"`
-	Name   string    `db:"name" json:"name"`
-	Title  string    `db:"title" json:"title"`
-	SeenAt time.Time `db:"seen_at" json:"seen_at"`
-	NSFW   bool      `db:"nsfw" json:"nsfw"`
-	URL    string    `db:"url" json:"url"`
+	ID          ComicID    `db:"id" json:"id"`
+	Name        string     `db:"name" json:"name"`
+	Title       string     `db:"title" json:"title"`
+	SeenAt      time.Time  `db:"seen_at" json:"seen_at"`
+	NSFW        bool       `db:"nsfw" json:"nsfw"`
+	URL         string     `db:"url" json:"url"`
+	ImageURLs   StringList `db:"image_urls" json:"image_urls"`
+	AltText     string     `db:"alt_text" json:"alt_text"`
+	PublishedAt *time.Time `db:"published_at" json:"published_at,omitempty"`
 }
 
 type ClickLog struct {
@@ -31,25 +95,76 @@ type ClickLog struct {
 }
 
 type SiteDef struct {
-	ID            SiteDefID `db:"id"`
-	Name          string    `db:"name"`
-	Active        bool      `db:"active"`
-	NSFW          bool      `db:"nsfw"`
-	StartURL      string    `db:"start_url"`
-	URLTemplate   string    `db:"url_template"`
-	NextPageXPath string    `db:"next_page_xpath"`
-	RefRegexp     string    `db:"ref_regexp"`
-	TitleXPath    string    `db:"title_xpath"`
-	TitleRegexp   string    `db:"title_regexp"`
+	ID                SiteDefID     `db:"id" json:"id"`
+	Name              string        `db:"name" json:"name"`
+	Active            bool          `db:"active" json:"active"`
+	NSFW              bool          `db:"nsfw" json:"nsfw"`
+	StartURL          string        `db:"start_url" json:"start_url"`
+	URLTemplate       string        `db:"url_template" json:"url_template"`
+	NextPageXPath     string        `db:"next_page_xpath" json:"next_page_xpath"`
+	RefRegexp         string        `db:"ref_regexp" json:"ref_regexp"`
+	TitleXPath        string        `db:"title_xpath" json:"title_xpath"`
+	TitleRegexp       string        `db:"title_regexp" json:"title_regexp"`
+	CrawlStrategy     CrawlStrategy `db:"crawl_strategy" json:"crawl_strategy"`
+	FeedURL           string        `db:"feed_url" json:"feed_url"`
+	CrawlIntervalSecs int           `db:"crawl_interval_secs" json:"crawl_interval_secs"`
+	CrawlCron         string        `db:"crawl_cron" json:"crawl_cron"`
+	CrawlJitterSecs   int           `db:"crawl_jitter_secs" json:"crawl_jitter_secs"`
+	// BrokenReason says why crawld deactivated the SiteDef after its crawls kept failing, if it did
+	BrokenReason string `db:"broken_reason" json:"broken_reason"`
+	// FetchDelaySecs is the least time left between requests while crawling, if longer than crawld's HostDelaySecs
+	FetchDelaySecs int `db:"fetch_delay_secs" json:"fetch_delay_secs"`
+	// SelectorType says whether NextPageXPath and TitleXPath hold XPaths (xpath, the default) or CSS selectors (css)
+	SelectorType string `db:"selector_type" json:"selector_type"`
+	// NextPageAttr and TitleAttr, if set, take the value of the named attribute of the selected element
+	NextPageAttr string `db:"next_page_attr" json:"next_page_attr"`
+	TitleAttr    string `db:"title_attr" json:"title_attr"`
+	// ImageXPath optionally selects the comic image URLs of each page, from the attribute named by ImageAttr
+	ImageXPath string `db:"image_xpath" json:"image_xpath"`
+	ImageAttr  string `db:"image_attr" json:"image_attr"`
+	// AltTextXPath optionally selects the hover or alt text of each page, from the attribute named by AltTextAttr
+	AltTextXPath string `db:"alt_text_xpath" json:"alt_text_xpath"`
+	AltTextAttr  string `db:"alt_text_attr" json:"alt_text_attr"`
+	// PublishedXPath optionally selects the publication date of each page, which PublishedRegexp narrows
+	// down and PublishedFormat, a Go time layout, parses
+	PublishedXPath  string `db:"published_xpath" json:"published_xpath"`
+	PublishedAttr   string `db:"published_attr" json:"published_attr"`
+	PublishedRegexp string `db:"published_regexp" json:"published_regexp"`
+	PublishedFormat string `db:"published_format" json:"published_format"`
+	// PrevPageXPath optionally selects the ref of the previous page, from the attribute named by PrevPageAttr,
+	// so that a backfill can walk the archive backwards
+	PrevPageXPath string `db:"prev_page_xpath" json:"prev_page_xpath"`
+	PrevPageAttr  string `db:"prev_page_attr" json:"prev_page_attr"`
+	// BackfillURL is the page backfills start from, usually the homepage showing the latest comic. StartURL if empty.
+	BackfillURL string `db:"backfill_url" json:"backfill_url"`
 }
 
 type SiteUpdate struct {
-	ID        SiteUpdateID `db:"id"`
-	SiteDefID SiteDefID    `db:"site_def_id"`
-	Ref       string       `db:"ref"`
-	URL       string       `db:"url"`
-	Title     string       `db:"title"`
-	SeenAt    time.Time    `db:"seen_at"`
+	ID          SiteUpdateID `db:"id"`
+	SiteDefID   SiteDefID    `db:"site_def_id"`
+	Ref         string       `db:"ref"`
+	URL         string       `db:"url"`
+	Title       string       `db:"title"`
+	SeenAt      time.Time    `db:"seen_at"`
+	ImageURLs   StringList   `db:"image_urls"`
+	AltText     string       `db:"alt_text"`
+	PublishedAt pq.NullTime  `db:"published_at"`
+}
+
+// UpdateImage is an image of a SiteUpdate downloaded into the image archive
+type UpdateImage struct {
+	ID       UpdateImageID `db:"id" json:"id"`
+	UpdateID SiteUpdateID  `db:"update_id" json:"update_id"`
+	// Position is the index of the image in the SiteUpdate's ImageURLs
+	Position int    `db:"position" json:"position"`
+	URL      string `db:"url" json:"url"`
+	// Hash is the hex SHA-256 of the image, which it is stored under in the archive
+	Hash       string    `db:"hash" json:"hash"`
+	MIMEType   string    `db:"mime_type" json:"mime_type"`
+	Width      int       `db:"width" json:"width"`   // zero if the format isn't understood
+	Height     int       `db:"height" json:"height"` // zero if the format isn't understood
+	Size       int64     `db:"size" json:"size"`
+	ArchivedAt time.Time `db:"archived_at" json:"archived_at"`
 }
 
 type CrawlInfo struct {
@@ -61,4 +176,128 @@ type CrawlInfo struct {
 	EndedAt   pq.NullTime `db:"ended_at"`
 	Error     string      `db:"error"`
 	Seen      int         `db:"seen"`
+	// Origin is the lowercased scheme and host of URL, which crawld limits concurrent crawls by
+	Origin string `db:"origin"`
+	// WorkerID identifies the crawld worker holding the lease on a started CrawlInfo
+	WorkerID string `db:"worker_id"`
+	// LeaseExpiresAt is when a started CrawlInfo goes back to pending unless its lease is renewed
+	LeaseExpiresAt pq.NullTime `db:"lease_expires_at"`
+}
+
+// Origin returns the lowercased scheme and host of rawURL, or rawURL lowercased if it can't be parsed
+func Origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return strings.ToLower(rawURL)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// Backfill walks the archive of a SiteDef backwards from its latest page, recording the pages not seen before.
+// A SiteDef has at most one Backfill; requesting another replaces it.
+type Backfill struct {
+	SiteDefID SiteDefID `db:"site_def_id" json:"site_def_id"`
+	// URL is the page the Backfill crawls next, so that it picks up where it left off
+	URL      string `db:"url" json:"url"`
+	MaxPages int    `db:"max_pages" json:"max_pages"` // zero walks back to the first page
+	Pages    int    `db:"pages" json:"pages"`         // pages crawled so far
+	Seen     int    `db:"seen" json:"seen"`           // new SiteUpdates recorded so far
+	// DatedBefore is when the oldest SiteUpdate of the SiteDef was seen when the Backfill was requested.
+	// The SiteUpdates it records are dated before it, so that they sort before those crawled normally.
+	DatedBefore time.Time  `db:"dated_before" json:"dated_before"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	EndedAt     *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	Error       string     `db:"error" json:"error"`
+	// WorkerID identifies the crawld worker holding the lease on a running Backfill
+	WorkerID string `db:"worker_id" json:"worker_id"`
+	// LeaseExpiresAt is when a running Backfill may be picked up by another worker unless its lease is renewed
+	LeaseExpiresAt *time.Time `db:"lease_expires_at" json:"lease_expires_at,omitempty"`
+}
+
+type User struct {
+	ID           UserID    `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	PasswordHash string    `db:"password_hash" json:"-"`
+	Role         Role      `db:"role" json:"role"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type Session struct {
+	TokenHash string    `db:"token_hash"`
+	UserID    UserID    `db:"user_id"`
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// UnreadComic is the latest SiteUpdate of a subscribed SiteDef with the number of SiteUpdates not yet read
+type UnreadComic struct {
+	SiteDefID SiteDefID    `db:"site_def_id" json:"site_def_id"`
+	Name      string       `db:"name" json:"name"`
+	NSFW      bool         `db:"nsfw" json:"nsfw"`
+	ID        SiteUpdateID `db:"id" json:"id"`
+	Title     string       `db:"title" json:"title"`
+	URL       string       `db:"url" json:"url"`
+	SeenAt    time.Time    `db:"seen_at" json:"seen_at"`
+	Unread    int          `db:"unread" json:"unread"`
+}
+
+// ComicUpdate is a SiteUpdate along with the name of its SiteDef
+type ComicUpdate struct {
+	ID        SiteUpdateID `db:"id" json:"id"`
+	SiteDefID SiteDefID    `db:"site_def_id" json:"site_def_id"`
+	Name      string       `db:"name" json:"name"`
+	Title     string       `db:"title" json:"title"`
+	URL       string       `db:"url" json:"url"`
+	SeenAt    time.Time    `db:"seen_at" json:"seen_at"`
+	ImageURLs StringList   `db:"image_urls" json:"image_urls"`
+	AltText   string       `db:"alt_text" json:"alt_text"`
+	// PublishedAt is when the comic says the update was published, if its SiteDef extracts that
+	PublishedAt *time.Time `db:"published_at" json:"published_at,omitempty"`
+}
+
+// ClickBucketSize is the width of the time buckets of a click series
+type ClickBucketSize string
+
+const (
+	ClickBucketHour ClickBucketSize = "hour"
+	ClickBucketDay  ClickBucketSize = "day"
+	ClickBucketWeek ClickBucketSize = "week"
+)
+
+// SiteDefClicks is the number of clicks on the SiteUpdates of a SiteDef
+type SiteDefClicks struct {
+	SiteDefID SiteDefID `db:"site_def_id" json:"site_def_id"`
+	Name      string    `db:"name" json:"name"`
+	Clicks    int       `db:"clicks" json:"clicks"`
+}
+
+// SiteUpdateClicks is the number of clicks on a single SiteUpdate
+type SiteUpdateClicks struct {
+	ID        SiteUpdateID `db:"id" json:"id"`
+	SiteDefID SiteDefID    `db:"site_def_id" json:"site_def_id"`
+	Name      string       `db:"name" json:"name"`
+	Title     string       `db:"title" json:"title"`
+	Clicks    int          `db:"clicks" json:"clicks"`
+}
+
+// LocationClicks is the number of clicks from a country or region. Region is empty when
+// clicks are counted per country.
+type LocationClicks struct {
+	Country string `db:"country" json:"country"`
+	Region  string `db:"region" json:"region"`
+	Clicks  int    `db:"clicks" json:"clicks"`
+}
+
+// ClickBucket is the number of clicks in the time bucket beginning at Start
+type ClickBucket struct {
+	Start  time.Time `db:"start" json:"start"`
+	Clicks int       `db:"clicks" json:"clicks"`
+}
+
+// TrendingComic compares the clicks on a SiteDef in a time window with the window of the same length before it
+type TrendingComic struct {
+	SiteDefID      SiteDefID `db:"site_def_id" json:"site_def_id"`
+	Name           string    `db:"name" json:"name"`
+	Clicks         int       `db:"clicks" json:"clicks"`
+	PreviousClicks int       `db:"previous_clicks" json:"previous_clicks"`
 }
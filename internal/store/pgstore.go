@@ -1,319 +1,26 @@
 package store
 
 import (
-	"database/sql"
-	"fmt"
-	"net"
-
-	"github.com/johnstcn/freshcomics/internal/ipinfo"
+	"errors"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-)
+	"github.com/lib/pq"
 
-const (
-	sqlGetComics            string = `SELECT site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.seen_at site_updates.url FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE site_updates.id IN (SELECT DISTINCT ON (site_def_id) id FROM site_updates ORDER BY site_def_id, seen_at DESC) ORDER BY seen_at desc;`
-	sqlCreateSiteDef        string = `INSERT INTO site_defs (name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;`
-	sqlRedirect             string = `SELECT site_updates.url FROM site_updates WHERE id = $1`
-	sqlSaveClick            string = `INSERT INTO "comic_clicks" (update_id, country, region, city) VALUES ($1, $2, $3, $4);`
-	sqlGetSiteDefs          string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp FROM site_defs ORDER BY name ASC;`
-	sqlGetActiveSiteDefs    string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp FROM site_defs WHERE active = TRUE ORDER BY NAME ASC;`
-	sqlGetSiteDef           string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp FROM site_defs WHERE id = $1;`
-	sqlUpdateSiteDef        string = `UPDATE site_defs SET (name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp) = ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) WHERE id = $11;`
-	sqlCreateSiteUpdate     string = `INSERT INTO site_updates (site_def_id, ref, url, title, seen_at) VALUES ($1, $2, $3, $4, $5) RETURNING id;`
-	sqlGetSiteUpdates       string = `SELECT id, site_def_id, ref, url, title, seen_at FROM site_updates WHERE site_def_id = $1 ORDER BY seen_at DESC;`
-	sqlGetSiteUpdate        string = `SELECT id, site_def_id, ref, url, title, seen_at FROM site_updates WHERE site_def_id = $1 AND ref = $2;`
-	sqlGetLastURL           string = `SELECT url FROM site_updates WHERE site_def_id = $1 ORDER BY seen_at DESC LIMIT 1;`
-	sqlGetCrawlInfos        string = `SELECT id, site_def_id, url, created_at, started_at, ended_at, error, seen FROM crawl_infos ORDER BY created_at DESC;`
-	sqlGetCrawlInfo         string = `SELECT id, site_def_id, url, created_at, started_at, ended_at, error, seen FROM crawl_infos WHERE site_def_id = $1 ORDER BY created_at DESC;`
-	sqlGetPendingCrawlInfos string = `SELECT id, site_def_id, url, created_at, started_at, ended_at, error, seen FROM crawl_infos WHERE started_at IS NULL AND ended_at IS NULL ORDER BY created_at ASC;`
-	sqlCreateCrawlInfo      string = `INSERT INTO crawl_infos (site_def_id, url) VALUES ($1, $2) RETURNING ID;`
-	sqlStartCrawlInfo       string = `UPDATE crawl_infos SET started_at = CURRENT_TIMESTAMP WHERE id = $1;`
-	sqlEndCrawlInfo         string = `UPDATE crawl_infos SET (ended_at, error, seen) = (CURRENT_TIMESTAMP, $2, $3) WHERE id = $1;`
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
 )
 
-type pgStore struct {
-	db    Conn
-	geoIP ipinfo.IPInfoer
-}
-
-var _ ComicStore = (*pgStore)(nil)
-var _ Redirecter = (*pgStore)(nil)
-var _ SiteDefStore = (*pgStore)(nil)
-var _ SiteUpdateStore = (*pgStore)(nil)
-var _ CrawlInfoStore = (*pgStore)(nil)
-
-func NewPGStore(conn *sqlx.DB) (Store, error) {
-	ip := ipinfo.NewDummyIPInfoer()
-
-	return &pgStore{db: conn, geoIP: ip}, nil
-}
-
-// GetComics implements ComicStore.GetComics
-func (s *pgStore) GetComics() ([]Comic, error) {
-	comics := make([]Comic, 0)
-	err := s.db.Select(&comics, sqlGetComics)
-	if err != nil {
-		fmt.Println("error fetching latest comic list:", err)
-		return nil, err
-	}
-	return comics, nil
-}
-
-// Redirect implements Redirecter.Redirect
-func (s *pgStore) Redirect(id SiteUpdateID) (string, error) {
-	var result string
-	err := s.db.Get(&result, sqlRedirect, id)
-	if err != nil {
-		return "", err
-	}
-	return result, nil
-}
-
-// CreateClickLog implements ClickLogger.CreateClickLog
-func (s *pgStore) CreateClickLog(id SiteUpdateID, addr net.IP) error {
-	geoLoc, err := s.geoIP.GetIPInfo(addr)
-	if err != nil {
-		return err
+// NewPGStore returns a Store backed by conn. Clicks are located with geoIP; if geoIP is nil,
+// clicks are recorded without a location.
+func NewPGStore(conn *sqlx.DB, geoIP ipinfo.IPInfoer) (Store, error) {
+	if geoIP == nil {
+		geoIP = ipinfo.NewDummyIPInfoer()
 	}
 
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(sqlSaveClick, id, geoLoc.Country, geoLoc.Region, geoLoc.City)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	return nil
+	return &sqlStore{db: conn, geoIP: geoIP}, nil
 }
 
-// CreateSiteDef implements SiteDefStore.CreateSiteDef
-func (s *pgStore) CreateSiteDef(sd SiteDef) (SiteDefID, error) {
-	var newid int
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return 0, err
-	}
-	rows, err := tx.Query(sqlCreateSiteDef, sd.Name, sd.Active, sd.NSFW, sd.StartURL, sd.URLTemplate, sd.NextPageXPath, sd.RefRegexp, sd.TitleXPath, sd.TitleRegexp)
-	if err != nil {
-		return 0, err
-	}
-	if rows.Next() {
-		if err := rows.Scan(&newid); err != nil {
-			return 0, err
-		}
-	}
-	err = tx.Commit()
-	if err != nil {
-		return 0, err
-	}
-	return SiteDefID(newid), nil
-}
-
-// GetSiteDefs implements SiteDefStore.GetSiteDefs
-func (s *pgStore) GetSiteDefs(includeInactive bool) ([]SiteDef, error) {
-	var err error
-	defs := make([]SiteDef, 0)
-	if includeInactive {
-		err = s.db.Select(&defs, sqlGetSiteDefs)
-	} else {
-		err = s.db.Select(&defs, sqlGetActiveSiteDefs)
-	}
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-	return defs, nil
-}
-
-// GetSiteDef implements SiteDefStore.GetSiteDef
-func (s *pgStore) GetSiteDef(id SiteDefID) (SiteDef, error) {
-	def := SiteDef{}
-	err := s.db.Get(&def, sqlGetSiteDef, id)
-	if err != nil {
-		return SiteDef{}, err
-	}
-	return def, nil
-}
-
-// UpdateSiteDef implements SiteDefStore.UpdateSiteDef
-func (s *pgStore) UpdateSiteDef(sd SiteDef) error {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return err
-	}
-	_, err = tx.Exec(sqlUpdateSiteDef, sd.Name, sd.Active, sd.NSFW, sd.StartURL, sd.URLTemplate, sd.NextPageXPath, sd.RefRegexp, sd.TitleXPath, sd.TitleRegexp, sd.ID)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// GetLastURL implements SiteDefStore.GetLastURL
-func (s *pgStore) GetLastURL(id SiteDefID) (string, error) {
-	var nextUrl string
-	err := s.db.Get(&nextUrl, sqlGetLastURL, id)
-
-	if err != nil {
-		return "", err
-	}
-
-	return nextUrl, nil
-}
-
-// SiteUpdateStore methods
-
-// CreateSiteUpdate implements SiteUpdateStore.CreateSiteUpdate
-func (s *pgStore) CreateSiteUpdate(su SiteUpdate) (SiteUpdateID, error) {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return 0, err
-	}
-	var newID int64
-	rows, err := tx.Query(sqlCreateSiteUpdate, su.SiteDefID, su.Ref, su.URL, su.Title, su.SeenAt)
-	if err != nil {
-		return 0, err
-	}
-	if rows.Next() {
-		if err := rows.Scan(&newID); err != nil {
-			return 0, err
-		}
-	}
-	if err := rows.Close(); err != nil {
-		return 0, err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return 0, err
-	}
-	return SiteUpdateID(newID), nil
-}
-
-// GetSiteUpdates implements SiteUpdateStore.GetSiteUpdates
-func (s *pgStore) GetSiteUpdates(id SiteDefID) ([]SiteUpdate, error) {
-	var err error
-	updates := make([]SiteUpdate, 0)
-	err = s.db.Select(&updates, sqlGetSiteUpdates, id)
-	if err != nil {
-		return nil, err
-	}
-	return updates, nil
-}
-
-// GetSiteUpdate implements SiteUpdateStore.GetSiteUpdate
-func (s *pgStore) GetSiteUpdate(id SiteDefID, ref string) (SiteUpdate, bool, error) {
-	update := SiteUpdate{}
-	err := s.db.Get(&update, sqlGetSiteUpdate, id, ref)
-	if err == sql.ErrNoRows {
-		return SiteUpdate{}, false, nil
-	} else if err != nil {
-		return SiteUpdate{}, false, err
-	}
-	return update, true, nil
-}
-
-// CrawlInfoStore methods
-
-// TODO(cian): limit
-// GetCrawlInfos implements CrawlInfoStore.GetCrawlInfos
-func (s *pgStore) GetCrawlInfos() ([]CrawlInfo, error) {
-	infos := make([]CrawlInfo, 0)
-	err := s.db.Select(&infos, sqlGetCrawlInfos)
-	if err != nil {
-		return nil, err
-	}
-	return infos, nil
-}
-
-// GetCrawlInfo implements CrawlInfoStore.GetCrawlInfo
-func (s *pgStore) GetCrawlInfo(id SiteDefID) ([]CrawlInfo, error) {
-	infos := make([]CrawlInfo, 0)
-	err := s.db.Select(&infos, sqlGetCrawlInfo, id)
-	if err != nil {
-		return nil, err
-	}
-	return infos, nil
-}
-
-// GetPendingCrawlInfos implements CrawlinfoStore.GetPendingCrawlInfos
-func (s *pgStore) GetPendingCrawlInfos() ([]CrawlInfo, error) {
-	infos := make([]CrawlInfo, 0)
-	err := s.db.Select(&infos, sqlGetPendingCrawlInfos)
-	if err != nil {
-		return nil, err
-	}
-	return infos, nil
-}
-
-// CreateCrawlInfo implements CrawlInfoStore.CreateCrawlInfo
-func (s *pgStore) CreateCrawlInfo(id SiteDefID, url string) (CrawlInfoID, error) {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return 0, err
-	}
-
-	var newID int64
-	rows, err := tx.Query(sqlCreateCrawlInfo, id, url)
-	if err != nil {
-		return 0, err
-	}
-	if rows.Next() {
-		if err := rows.Scan(&newID); err != nil {
-			return 0, err
-		}
-	}
-	err = tx.Commit()
-	if err != nil {
-		return 0, err
-	}
-	return CrawlInfoID(newID), nil
-}
-
-// StartCrawlInfo implements CrawlInfoStore.StartCrawlInfo
-func (s *pgStore) StartCrawlInfo(id CrawlInfoID) error {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec(sqlStartCrawlInfo, id)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// EndCrawlInfo implements CrawlInfoStore.EndCrawlInfo
-func (s *pgStore) EndCrawlInfo(id CrawlInfoID, crawlErr error, seen int) error {
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return err
-	}
-
-	var errString string
-	if crawlErr != nil {
-		errString = crawlErr.Error()
-	}
-
-	_, err = tx.Exec(sqlEndCrawlInfo, id, errString, seen)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	return nil
+// isPGUniqueViolation returns true if err is a Postgres unique_violation
+func isPGUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+)
+
+// sqliteDriver is the database/sql driver name of SQLite
+const sqliteDriver = "sqlite"
+
+// SQLite has no sha256(), so migrations hashing existing values call sha256_hex instead
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("sha256_hex", 1, sqliteSHA256Hex)
+}
+
+// sqliteSHA256Hex returns the hex encoded SHA-256 of its text argument, or NULL if it is NULL
+func sqliteSHA256Hex(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	var b []byte
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return nil, fmt.Errorf("sha256_hex: unsupported argument type %T", v)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SQLite has no DISTINCT ON, date_trunc, timestamptz casts, intervals or row locks, and stores
+// timestamps as text, so these queries replace their Postgres counterparts. Writers are serialised,
+// so claiming a CrawlInfo needs no FOR UPDATE SKIP LOCKED. Timestamps are compared with julianday()
+// so that values written with different UTC offsets compare correctly.
+const (
+	sqliteGetComics             string = `SELECT site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.seen_at, site_updates.url, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE site_updates.id = (SELECT latest.id FROM site_updates latest WHERE latest.site_def_id = site_updates.site_def_id ORDER BY latest.seen_at DESC, latest.id DESC LIMIT 1) ORDER BY site_updates.seen_at DESC;`
+	sqliteGetPopularComics      string = `SELECT site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.seen_at, site_updates.url, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) LEFT JOIN (SELECT site_updates.site_def_id, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) WHERE julianday(comic_clicks.clicked_at) >= julianday($1) GROUP BY site_updates.site_def_id) AS popularity ON (popularity.site_def_id = site_defs.id) WHERE site_updates.id = (SELECT latest.id FROM site_updates latest WHERE latest.site_def_id = site_updates.site_def_id ORDER BY latest.seen_at DESC, latest.id DESC LIMIT 1) ORDER BY COALESCE(popularity.clicks, 0) DESC, site_updates.seen_at DESC;`
+	sqliteGetSessionUser        string = `SELECT users.id, users.name, users.password_hash, users.role, users.created_at FROM sessions JOIN users ON (sessions.user_id = users.id) WHERE sessions.token_hash = $1 AND julianday(sessions.expires_at) > julianday('now');`
+	sqliteMarkReadThrough       string = `INSERT INTO read_updates (user_id, site_update_id) SELECT $1, su.id FROM site_updates su JOIN site_updates target ON (su.site_def_id = target.site_def_id) WHERE target.id = $2 AND (julianday(su.seen_at) < julianday(target.seen_at) OR (julianday(su.seen_at) = julianday(target.seen_at) AND su.id <= target.id)) ON CONFLICT DO NOTHING;`
+	sqliteGetUnreadComics       string = `SELECT site_defs.id AS site_def_id, site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.url, site_updates.seen_at, (SELECT COUNT(*) FROM site_updates su WHERE su.site_def_id = site_defs.id AND NOT EXISTS (SELECT 1 FROM read_updates ru WHERE ru.user_id = $1 AND ru.site_update_id = su.id)) AS unread FROM subscriptions JOIN site_defs ON (subscriptions.site_def_id = site_defs.id) JOIN site_updates ON (site_updates.site_def_id = site_defs.id) WHERE subscriptions.user_id = $1 AND site_updates.id = (SELECT latest.id FROM site_updates latest WHERE latest.site_def_id = site_defs.id ORDER BY latest.seen_at DESC, latest.id DESC LIMIT 1) ORDER BY site_updates.seen_at DESC;`
+	sqliteGetSiteDefClicks      string = `SELECT site_defs.id AS site_def_id, site_defs.name, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE julianday(comic_clicks.clicked_at) >= julianday($1) GROUP BY site_defs.id, site_defs.name ORDER BY clicks DESC, site_defs.name ASC LIMIT $2;`
+	sqliteGetSiteUpdateClicks   string = `SELECT site_updates.id, site_updates.site_def_id, site_defs.name, site_updates.title, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE julianday(comic_clicks.clicked_at) >= julianday($1) GROUP BY site_updates.id, site_defs.id ORDER BY clicks DESC, site_updates.id DESC LIMIT $2;`
+	sqliteGetSiteDefClickSeries string = `SELECT CASE $2 WHEN 'hour' THEN strftime('%Y-%m-%d %H:00:00', comic_clicks.clicked_at) WHEN 'week' THEN date(comic_clicks.clicked_at, '-6 days', 'weekday 1') || ' 00:00:00' ELSE date(comic_clicks.clicked_at) || ' 00:00:00' END AS start, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) WHERE site_updates.site_def_id = $1 AND julianday(comic_clicks.clicked_at) >= julianday($3) GROUP BY start ORDER BY start ASC;`
+	sqliteGetCountryClicks      string = `SELECT country, '' AS region, COUNT(*) AS clicks FROM comic_clicks WHERE julianday(clicked_at) >= julianday($1) GROUP BY country ORDER BY clicks DESC, country ASC LIMIT $2;`
+	sqliteGetRegionClicks       string = `SELECT country, region, COUNT(*) AS clicks FROM comic_clicks WHERE julianday(clicked_at) >= julianday($1) GROUP BY country, region ORDER BY clicks DESC, country ASC, region ASC LIMIT $2;`
+	sqliteGetPendingCrawlInfos  string = `SELECT id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at FROM crawl_infos WHERE ended_at IS NULL AND (started_at IS NULL OR julianday(lease_expires_at) < julianday('now')) ORDER BY created_at ASC, id ASC;`
+	sqliteClaimNextCrawlInfo    string = `UPDATE crawl_infos SET (worker_id, started_at, lease_expires_at) = ($1, CURRENT_TIMESTAMP, strftime('%Y-%m-%d %H:%M:%f', 'now', '+' || $2 || ' seconds')) WHERE id = (SELECT id FROM crawl_infos WHERE ended_at IS NULL AND (started_at IS NULL OR julianday(lease_expires_at) < julianday('now')) AND NOT EXISTS (SELECT 1 FROM json_each($3) AS skip WHERE skip.value = crawl_infos.origin) ORDER BY created_at ASC, id ASC LIMIT 1) RETURNING id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at;`
+	sqliteAbandonCrawlInfos     string = `UPDATE crawl_infos SET (ended_at, error) = (CURRENT_TIMESTAMP, $2) WHERE ended_at IS NULL AND julianday(started_at) < julianday($1) AND (lease_expires_at IS NULL OR julianday(lease_expires_at) < julianday('now'));`
+	sqliteRenewCrawlInfoLease   string = `UPDATE crawl_infos SET lease_expires_at = strftime('%Y-%m-%d %H:%M:%f', 'now', '+' || $3 || ' seconds') WHERE id = $1 AND worker_id = $2 AND ended_at IS NULL;`
+	sqliteClaimNextBackfill     string = `UPDATE backfills SET (worker_id, lease_expires_at) = ($1, strftime('%Y-%m-%d %H:%M:%f', 'now', '+' || $2 || ' seconds')) WHERE site_def_id = (SELECT site_def_id FROM backfills WHERE ended_at IS NULL AND (lease_expires_at IS NULL OR julianday(lease_expires_at) < julianday('now')) ORDER BY created_at ASC, site_def_id ASC LIMIT 1) RETURNING site_def_id, url, max_pages, pages, seen, dated_before, created_at, ended_at, error, worker_id, lease_expires_at;`
+	sqliteRenewBackfillLease    string = `UPDATE backfills SET lease_expires_at = strftime('%Y-%m-%d %H:%M:%f', 'now', '+' || $3 || ' seconds') WHERE site_def_id = $1 AND worker_id = $2 AND ended_at IS NULL;`
+	sqliteGetTrendingComics     string = `SELECT site_defs.id AS site_def_id, site_defs.name, COUNT(*) FILTER (WHERE julianday(comic_clicks.clicked_at) >= julianday($1)) AS clicks, COUNT(*) FILTER (WHERE julianday(comic_clicks.clicked_at) < julianday($1)) AS previous_clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE julianday(comic_clicks.clicked_at) >= 2 * julianday($1) - julianday('now') GROUP BY site_defs.id, site_defs.name HAVING clicks > 0 ORDER BY clicks - previous_clicks DESC, clicks DESC, site_defs.name ASC LIMIT $2;`
+)
+
+// sqliteQueries maps the Postgres queries that SQLite can't run to their replacements
+var sqliteQueries = map[string]string{
+	sqlGetComics:             sqliteGetComics,
+	sqlGetPopularComics:      sqliteGetPopularComics,
+	sqlGetSessionUser:        sqliteGetSessionUser,
+	sqlMarkReadThrough:       sqliteMarkReadThrough,
+	sqlGetUnreadComics:       sqliteGetUnreadComics,
+	sqlGetSiteDefClicks:      sqliteGetSiteDefClicks,
+	sqlGetSiteUpdateClicks:   sqliteGetSiteUpdateClicks,
+	sqlGetSiteDefClickSeries: sqliteGetSiteDefClickSeries,
+	sqlGetCountryClicks:      sqliteGetCountryClicks,
+	sqlGetRegionClicks:       sqliteGetRegionClicks,
+	sqlGetTrendingComics:     sqliteGetTrendingComics,
+	sqlGetPendingCrawlInfos:  sqliteGetPendingCrawlInfos,
+	sqlClaimNextCrawlInfo:    sqliteClaimNextCrawlInfo,
+	sqlRenewCrawlInfoLease:   sqliteRenewCrawlInfoLease,
+	sqlAbandonCrawlInfos:     sqliteAbandonCrawlInfos,
+	sqlClaimNextBackfill:     sqliteClaimNextBackfill,
+	sqlRenewBackfillLease:    sqliteRenewBackfillLease,
+}
+
+// NewSQLiteStore returns a Store backed by the SQLite database conn, which should be opened
+// with Open. Clicks are located with geoIP; if geoIP is nil, clicks are recorded without a location.
+func NewSQLiteStore(conn *sqlx.DB, geoIP ipinfo.IPInfoer) (Store, error) {
+	if geoIP == nil {
+		geoIP = ipinfo.NewDummyIPInfoer()
+	}
+
+	return &sqlStore{db: conn, geoIP: geoIP, queries: sqliteQueries}, nil
+}
+
+// isSQLiteUniqueViolation returns true if err is a SQLite UNIQUE constraint failure
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isSQLiteDSN returns true if dsn names a SQLite database rather than a Postgres one
+func isSQLiteDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "sqlite:") || strings.HasPrefix(dsn, "file:")
+}
+
+// openSQLite opens the SQLite database named by dsn, which is either sqlite:PATH or a file: URI.
+// Foreign keys are enforced and timestamps are written in a format SQLite's date functions understand.
+func openSQLite(dsn string) (*sqlx.DB, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite://"), "sqlite:")
+	path, rawQuery, _ := strings.Cut(name, "?")
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_format", "sqlite")
+
+	conn, err := sqlx.Connect(sqliteDriver, path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, and every connection to :memory: is a separate database.
+	conn.SetMaxOpenConns(1)
+	return conn, nil
+}
@@ -0,0 +1,994 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+)
+
+const (
+	sqlGetComics             string = `SELECT site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.seen_at, site_updates.url, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE site_updates.id IN (SELECT DISTINCT ON (site_def_id) id FROM site_updates ORDER BY site_def_id, seen_at DESC, id DESC) ORDER BY seen_at desc;`
+	sqlGetPopularComics      string = `SELECT site_defs.name, site_defs.nsfw, site_updates.id, site_updates.title, site_updates.seen_at, site_updates.url, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) LEFT JOIN (SELECT site_updates.site_def_id, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) WHERE comic_clicks.clicked_at >= $1 GROUP BY site_updates.site_def_id) AS popularity ON (popularity.site_def_id = site_defs.id) WHERE site_updates.id IN (SELECT DISTINCT ON (site_def_id) id FROM site_updates ORDER BY site_def_id, seen_at DESC, id DESC) ORDER BY COALESCE(popularity.clicks, 0) DESC, site_updates.seen_at DESC;`
+	sqlCreateSiteDef         string = `INSERT INTO site_defs (name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30) RETURNING id;`
+	sqlRedirect              string = `SELECT site_updates.url FROM site_updates WHERE id = $1`
+	sqlSaveClick             string = `INSERT INTO "comic_clicks" (update_id, country, region, city) VALUES ($1, $2, $3, $4);`
+	sqlGetSiteDefs           string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url FROM site_defs ORDER BY name ASC;`
+	sqlGetActiveSiteDefs     string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url FROM site_defs WHERE active = TRUE ORDER BY NAME ASC;`
+	sqlGetSiteDef            string = `SELECT id, name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url FROM site_defs WHERE id = $1;`
+	sqlUpdateSiteDef         string = `UPDATE site_defs SET (name, active, nsfw, start_url, url_template, next_page_xpath, ref_regexp, title_xpath, title_regexp, crawl_strategy, feed_url, crawl_interval_secs, crawl_cron, crawl_jitter_secs, broken_reason, fetch_delay_secs, selector_type, next_page_attr, title_attr, image_xpath, image_attr, alt_text_xpath, alt_text_attr, published_xpath, published_attr, published_regexp, published_format, prev_page_xpath, prev_page_attr, backfill_url) = ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30) WHERE id = $31;`
+	sqlMarkSiteDefBroken     string = `UPDATE site_defs SET active = FALSE, broken_reason = $2 WHERE id = $1;`
+	sqlCreateSiteUpdate      string = `INSERT INTO site_updates (site_def_id, ref, url, title, seen_at, image_urls, alt_text, published_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;`
+	sqlGetSiteUpdates        string = `SELECT id, site_def_id, ref, url, title, seen_at, image_urls, alt_text, published_at FROM site_updates WHERE site_def_id = $1 ORDER BY seen_at DESC, id DESC;`
+	sqlGetSiteUpdateTimes    string = `SELECT seen_at FROM site_updates WHERE site_def_id = $1 ORDER BY seen_at DESC, id DESC LIMIT $2;`
+	sqlGetSiteUpdate         string = `SELECT id, site_def_id, ref, url, title, seen_at, image_urls, alt_text, published_at FROM site_updates WHERE site_def_id = $1 AND ref = $2;`
+	sqlGetLastURL            string = `SELECT url FROM site_updates WHERE site_def_id = $1 ORDER BY seen_at DESC, id DESC LIMIT 1;`
+	sqlGetCrawlInfos         string = `SELECT id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at FROM crawl_infos ORDER BY created_at DESC, id DESC;`
+	sqlGetCrawlInfo          string = `SELECT id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at FROM crawl_infos WHERE site_def_id = $1 ORDER BY created_at DESC, id DESC;`
+	sqlGetPendingCrawlInfos  string = `SELECT id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at FROM crawl_infos WHERE ended_at IS NULL AND (started_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP) ORDER BY created_at ASC, id ASC;`
+	sqlCreateCrawlInfo       string = `INSERT INTO crawl_infos (site_def_id, url, origin) VALUES ($1, $2, $3) RETURNING ID;`
+	sqlStartCrawlInfo        string = `UPDATE crawl_infos SET started_at = CURRENT_TIMESTAMP WHERE id = $1;`
+	sqlEndCrawlInfo          string = `UPDATE crawl_infos SET (ended_at, error, seen) = (CURRENT_TIMESTAMP, $2, $3) WHERE id = $1 AND worker_id = $4;`
+	sqlClaimNextCrawlInfo    string = `UPDATE crawl_infos SET (worker_id, started_at, lease_expires_at) = ($1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(secs => $2)) WHERE id = (SELECT id FROM crawl_infos WHERE ended_at IS NULL AND (started_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP) AND NOT EXISTS (SELECT 1 FROM json_array_elements_text($3::json) AS skip WHERE skip = crawl_infos.origin) ORDER BY created_at ASC, id ASC LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING id, site_def_id, url, origin, created_at, started_at, ended_at, error, seen, worker_id, lease_expires_at;`
+	sqlAbandonCrawlInfos     string = `UPDATE crawl_infos SET (ended_at, error) = (CURRENT_TIMESTAMP, $2) WHERE ended_at IS NULL AND started_at < $1 AND (lease_expires_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP);`
+	sqlRenewCrawlInfoLease   string = `UPDATE crawl_infos SET lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3) WHERE id = $1 AND worker_id = $2 AND ended_at IS NULL;`
+	sqlCreateUser            string = `INSERT INTO users (name, password_hash, role) VALUES ($1, $2, $3) RETURNING id;`
+	sqlGetUser               string = `SELECT id, name, password_hash, role, created_at FROM users WHERE id = $1;`
+	sqlGetUserByName         string = `SELECT id, name, password_hash, role, created_at FROM users WHERE name = $1;`
+	sqlCreateSession         string = `INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3);`
+	sqlGetSessionUser        string = `SELECT users.id, users.name, users.password_hash, users.role, users.created_at FROM sessions JOIN users ON (sessions.user_id = users.id) WHERE sessions.token_hash = $1 AND sessions.expires_at > CURRENT_TIMESTAMP;`
+	sqlDeleteSession         string = `DELETE FROM sessions WHERE token_hash = $1;`
+	sqlSubscribe             string = `INSERT INTO subscriptions (user_id, site_def_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+	sqlUnsubscribe           string = `DELETE FROM subscriptions WHERE user_id = $1 AND site_def_id = $2;`
+	sqlGetSubscriptions      string = `SELECT site_def_id FROM subscriptions WHERE user_id = $1 ORDER BY site_def_id ASC;`
+	sqlMarkRead              string = `INSERT INTO read_updates (user_id, site_update_id) SELECT $1, id FROM site_updates WHERE id = $2 ON CONFLICT DO NOTHING;`
+	sqlMarkReadThrough       string = `INSERT INTO read_updates (user_id, site_update_id) SELECT $1, su.id FROM site_updates su JOIN site_updates target ON (su.site_def_id = target.site_def_id) WHERE target.id = $2 AND (su.seen_at < target.seen_at OR (su.seen_at = target.seen_at AND su.id <= target.id)) ON CONFLICT DO NOTHING;`
+	sqlGetUnreadComics       string = `SELECT site_defs.id AS site_def_id, site_defs.name, site_defs.nsfw, latest.id, latest.title, latest.url, latest.seen_at, (SELECT COUNT(*) FROM site_updates su WHERE su.site_def_id = site_defs.id AND NOT EXISTS (SELECT 1 FROM read_updates ru WHERE ru.user_id = $1 AND ru.site_update_id = su.id)) AS unread FROM subscriptions JOIN site_defs ON (subscriptions.site_def_id = site_defs.id) JOIN (SELECT DISTINCT ON (site_def_id) id, site_def_id, title, url, seen_at FROM site_updates ORDER BY site_def_id, seen_at DESC, id DESC) AS latest ON (latest.site_def_id = site_defs.id) WHERE subscriptions.user_id = $1 ORDER BY latest.seen_at DESC;`
+	sqlGetRecentUpdates      string = `SELECT site_updates.id, site_updates.site_def_id, site_defs.name, site_updates.title, site_updates.url, site_updates.seen_at, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) ORDER BY site_updates.seen_at DESC, site_updates.id DESC LIMIT $1;`
+	sqlGetSiteDefUpdates     string = `SELECT site_updates.id, site_updates.site_def_id, site_defs.name, site_updates.title, site_updates.url, site_updates.seen_at, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE site_updates.site_def_id = $1 ORDER BY site_updates.seen_at DESC, site_updates.id DESC LIMIT $2;`
+	sqlGetSubscribedUpdates  string = `SELECT site_updates.id, site_updates.site_def_id, site_defs.name, site_updates.title, site_updates.url, site_updates.seen_at, site_updates.image_urls, site_updates.alt_text, site_updates.published_at FROM site_updates JOIN site_defs ON (site_updates.site_def_id = site_defs.id) JOIN subscriptions ON (subscriptions.site_def_id = site_defs.id) WHERE subscriptions.user_id = $1 ORDER BY site_updates.seen_at DESC, site_updates.id DESC LIMIT $2;`
+	sqlGetFeedToken          string = `SELECT COALESCE(feed_token, '') FROM users WHERE id = $1;`
+	sqlSetFeedToken          string = `UPDATE users SET feed_token = $2 WHERE id = $1;`
+	sqlGetUserByFeedToken    string = `SELECT id, name, password_hash, role, created_at FROM users WHERE feed_token = $1;`
+	sqlGetSiteDefClicks      string = `SELECT site_defs.id AS site_def_id, site_defs.name, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE comic_clicks.clicked_at >= $1 GROUP BY site_defs.id, site_defs.name ORDER BY clicks DESC, site_defs.name ASC LIMIT $2;`
+	sqlGetSiteUpdateClicks   string = `SELECT site_updates.id, site_updates.site_def_id, site_defs.name, site_updates.title, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE comic_clicks.clicked_at >= $1 GROUP BY site_updates.id, site_defs.id ORDER BY clicks DESC, site_updates.id DESC LIMIT $2;`
+	sqlGetSiteDefClickSeries string = `SELECT date_trunc($2, comic_clicks.clicked_at) AS start, COUNT(*) AS clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) WHERE site_updates.site_def_id = $1 AND comic_clicks.clicked_at >= $3 GROUP BY start ORDER BY start ASC;`
+	sqlGetCountryClicks      string = `SELECT country, '' AS region, COUNT(*) AS clicks FROM comic_clicks WHERE clicked_at >= $1 GROUP BY country ORDER BY clicks DESC, country ASC LIMIT $2;`
+	sqlGetRegionClicks       string = `SELECT country, region, COUNT(*) AS clicks FROM comic_clicks WHERE clicked_at >= $1 GROUP BY country, region ORDER BY clicks DESC, country ASC, region ASC LIMIT $2;`
+	sqlGetTrendingComics     string = `SELECT site_defs.id AS site_def_id, site_defs.name, COUNT(*) FILTER (WHERE comic_clicks.clicked_at >= $1::timestamptz) AS clicks, COUNT(*) FILTER (WHERE comic_clicks.clicked_at < $1::timestamptz) AS previous_clicks FROM comic_clicks JOIN site_updates ON (comic_clicks.update_id = site_updates.id) JOIN site_defs ON (site_updates.site_def_id = site_defs.id) WHERE comic_clicks.clicked_at >= $1::timestamptz - (CURRENT_TIMESTAMP - $1::timestamptz) GROUP BY site_defs.id, site_defs.name HAVING COUNT(*) FILTER (WHERE comic_clicks.clicked_at >= $1::timestamptz) > 0 ORDER BY COUNT(*) FILTER (WHERE comic_clicks.clicked_at >= $1::timestamptz) - COUNT(*) FILTER (WHERE comic_clicks.clicked_at < $1::timestamptz) DESC, clicks DESC, site_defs.name ASC LIMIT $2;`
+	sqlCreateUpdateImage     string = `INSERT INTO update_images (update_id, position, url, hash, mime_type, width, height, size, archived_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	sqlGetUpdateImages       string = `SELECT id, update_id, position, url, hash, mime_type, width, height, size, archived_at FROM update_images WHERE update_id = $1 ORDER BY position ASC;`
+	sqlGetUpdateImageByHash  string = `SELECT id, update_id, position, url, hash, mime_type, width, height, size, archived_at FROM update_images WHERE hash = $1 ORDER BY id ASC LIMIT 1;`
+	sqlCreateBackfill        string = `INSERT INTO backfills (site_def_id, url, max_pages, dated_before) VALUES ($1, $2, $3, $4) ON CONFLICT (site_def_id) DO UPDATE SET (url, max_pages, pages, seen, dated_before, created_at, ended_at, error, worker_id, lease_expires_at) = (excluded.url, excluded.max_pages, 0, 0, excluded.dated_before, CURRENT_TIMESTAMP, NULL, '', '', NULL);`
+	sqlGetBackfill           string = `SELECT site_def_id, url, max_pages, pages, seen, dated_before, created_at, ended_at, error, worker_id, lease_expires_at FROM backfills WHERE site_def_id = $1;`
+	sqlClaimNextBackfill     string = `UPDATE backfills SET (worker_id, lease_expires_at) = ($1, CURRENT_TIMESTAMP + make_interval(secs => $2)) WHERE site_def_id = (SELECT site_def_id FROM backfills WHERE ended_at IS NULL AND (lease_expires_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP) ORDER BY created_at ASC, site_def_id ASC LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING site_def_id, url, max_pages, pages, seen, dated_before, created_at, ended_at, error, worker_id, lease_expires_at;`
+	sqlRenewBackfillLease    string = `UPDATE backfills SET lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3) WHERE site_def_id = $1 AND worker_id = $2 AND ended_at IS NULL;`
+	sqlSaveBackfillProgress  string = `UPDATE backfills SET (url, pages, seen) = ($3, $4, $5) WHERE site_def_id = $1 AND worker_id = $2 AND ended_at IS NULL;`
+	sqlEndBackfill           string = `UPDATE backfills SET (ended_at, error, lease_expires_at) = (CURRENT_TIMESTAMP, $2, NULL) WHERE site_def_id = $1;`
+)
+
+// sqlStore implements Store on top of a database/sql connection. The queries above are
+// written for Postgres; other backends replace those that aren't portable via queries.
+type sqlStore struct {
+	db      Conn
+	geoIP   ipinfo.IPInfoer
+	queries map[string]string
+}
+
+var _ ComicStore = (*sqlStore)(nil)
+var _ Redirecter = (*sqlStore)(nil)
+var _ ClickLogger = (*sqlStore)(nil)
+var _ SiteDefStore = (*sqlStore)(nil)
+var _ SiteUpdateStore = (*sqlStore)(nil)
+var _ CrawlInfoStore = (*sqlStore)(nil)
+var _ UserStore = (*sqlStore)(nil)
+var _ SessionStore = (*sqlStore)(nil)
+var _ SubscriptionStore = (*sqlStore)(nil)
+var _ ReadingStateStore = (*sqlStore)(nil)
+var _ FeedStore = (*sqlStore)(nil)
+var _ ClickStatsStore = (*sqlStore)(nil)
+var _ UpdateImageStore = (*sqlStore)(nil)
+var _ BackfillStore = (*sqlStore)(nil)
+
+// textTimeLayout is the format of timestamps computed by SQLite's date functions, which are always UTC
+const textTimeLayout = "2006-01-02 15:04:05"
+
+// textTime scans a timestamp that the driver returns either as a time.Time or, for computed
+// SQLite columns that carry no declared type, as text in textTimeLayout
+type textTime time.Time
+
+// Scan implements sql.Scanner
+func (t *textTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*t = textTime(v)
+		return nil
+	case string:
+		return t.parse(v)
+	case []byte:
+		return t.parse(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+}
+
+func (t *textTime) parse(s string) error {
+	parsed, err := time.ParseInLocation(textTimeLayout, s, time.UTC)
+	if err != nil {
+		return err
+	}
+	*t = textTime(parsed)
+	return nil
+}
+
+// query returns the backend-specific replacement of q, or q itself if there is none
+func (s *sqlStore) query(q string) string {
+	if override, ok := s.queries[q]; ok {
+		return override
+	}
+	return q
+}
+
+// GetComics implements ComicStore.GetComics
+func (s *sqlStore) GetComics() ([]Comic, error) {
+	comics := make([]Comic, 0)
+	err := s.db.Select(&comics, s.query(sqlGetComics))
+	if err != nil {
+		fmt.Println("error fetching latest comic list:", err)
+		return nil, err
+	}
+	return comics, nil
+}
+
+// GetPopularComics implements ComicStore.GetPopularComics
+func (s *sqlStore) GetPopularComics(since time.Time) ([]Comic, error) {
+	comics := make([]Comic, 0)
+	err := s.db.Select(&comics, s.query(sqlGetPopularComics), since)
+	if err != nil {
+		return nil, err
+	}
+	return comics, nil
+}
+
+// Redirect implements Redirecter.Redirect
+func (s *sqlStore) Redirect(id SiteUpdateID) (string, error) {
+	var result string
+	err := s.db.Get(&result, s.query(sqlRedirect), id)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// CreateClickLog implements ClickLogger.CreateClickLog
+func (s *sqlStore) CreateClickLog(id SiteUpdateID, addr net.IP) error {
+	geoLoc, err := s.geoIP.GetIPInfo(addr)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(s.query(sqlSaveClick), id, geoLoc.Country, geoLoc.Region, geoLoc.City)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateSiteDef implements SiteDefStore.CreateSiteDef
+func (s *sqlStore) CreateSiteDef(sd SiteDef) (SiteDefID, error) {
+	var newid int
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	rows, err := tx.Query(s.query(sqlCreateSiteDef), sd.Name, sd.Active, sd.NSFW, sd.StartURL, sd.URLTemplate, sd.NextPageXPath, sd.RefRegexp, sd.TitleXPath, sd.TitleRegexp, sd.CrawlStrategy, sd.FeedURL, sd.CrawlIntervalSecs, sd.CrawlCron, sd.CrawlJitterSecs, sd.BrokenReason, sd.FetchDelaySecs, sd.SelectorType, sd.NextPageAttr, sd.TitleAttr, sd.ImageXPath, sd.ImageAttr, sd.AltTextXPath, sd.AltTextAttr, sd.PublishedXPath, sd.PublishedAttr, sd.PublishedRegexp, sd.PublishedFormat, sd.PrevPageXPath, sd.PrevPageAttr, sd.BackfillURL)
+	if err != nil {
+		return 0, err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&newid); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return SiteDefID(newid), nil
+}
+
+// GetSiteDefs implements SiteDefStore.GetSiteDefs
+func (s *sqlStore) GetSiteDefs(includeInactive bool) ([]SiteDef, error) {
+	var err error
+	defs := make([]SiteDef, 0)
+	if includeInactive {
+		err = s.db.Select(&defs, s.query(sqlGetSiteDefs))
+	} else {
+		err = s.db.Select(&defs, s.query(sqlGetActiveSiteDefs))
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// GetSiteDef implements SiteDefStore.GetSiteDef
+func (s *sqlStore) GetSiteDef(id SiteDefID) (SiteDef, error) {
+	def := SiteDef{}
+	err := s.db.Get(&def, s.query(sqlGetSiteDef), id)
+	if err != nil {
+		return SiteDef{}, err
+	}
+	return def, nil
+}
+
+// UpdateSiteDef implements SiteDefStore.UpdateSiteDef
+func (s *sqlStore) UpdateSiteDef(sd SiteDef) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(s.query(sqlUpdateSiteDef), sd.Name, sd.Active, sd.NSFW, sd.StartURL, sd.URLTemplate, sd.NextPageXPath, sd.RefRegexp, sd.TitleXPath, sd.TitleRegexp, sd.CrawlStrategy, sd.FeedURL, sd.CrawlIntervalSecs, sd.CrawlCron, sd.CrawlJitterSecs, sd.BrokenReason, sd.FetchDelaySecs, sd.SelectorType, sd.NextPageAttr, sd.TitleAttr, sd.ImageXPath, sd.ImageAttr, sd.AltTextXPath, sd.AltTextAttr, sd.PublishedXPath, sd.PublishedAttr, sd.PublishedRegexp, sd.PublishedFormat, sd.PrevPageXPath, sd.PrevPageAttr, sd.BackfillURL, sd.ID)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkSiteDefBroken implements SiteDefStore.MarkSiteDefBroken
+func (s *sqlStore) MarkSiteDefBroken(id SiteDefID, reason string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(s.query(sqlMarkSiteDefBroken), id, reason)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetLastURL implements SiteDefStore.GetLastURL
+func (s *sqlStore) GetLastURL(id SiteDefID) (string, error) {
+	var nextUrl string
+	err := s.db.Get(&nextUrl, s.query(sqlGetLastURL), id)
+
+	if err != nil {
+		return "", err
+	}
+
+	return nextUrl, nil
+}
+
+// SiteUpdateStore methods
+
+// CreateSiteUpdate implements SiteUpdateStore.CreateSiteUpdate. SeenAt is stored in UTC
+// so that backends storing timestamps as text order them correctly.
+func (s *sqlStore) CreateSiteUpdate(su SiteUpdate) (SiteUpdateID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var newID int64
+	rows, err := tx.Query(s.query(sqlCreateSiteUpdate), su.SiteDefID, su.Ref, su.URL, su.Title, su.SeenAt.UTC(), su.ImageURLs, su.AltText, su.PublishedAt)
+	if err != nil {
+		return 0, err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&newID); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return SiteUpdateID(newID), nil
+}
+
+// GetSiteUpdates implements SiteUpdateStore.GetSiteUpdates
+func (s *sqlStore) GetSiteUpdates(id SiteDefID) ([]SiteUpdate, error) {
+	var err error
+	updates := make([]SiteUpdate, 0)
+	err = s.db.Select(&updates, s.query(sqlGetSiteUpdates), id)
+	if err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// GetSiteUpdateTimes implements SiteUpdateStore.GetSiteUpdateTimes
+func (s *sqlStore) GetSiteUpdateTimes(id SiteDefID, limit int) ([]time.Time, error) {
+	times := make([]time.Time, 0)
+	err := s.db.Select(&times, s.query(sqlGetSiteUpdateTimes), id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// GetSiteUpdate implements SiteUpdateStore.GetSiteUpdate
+func (s *sqlStore) GetSiteUpdate(id SiteDefID, ref string) (SiteUpdate, bool, error) {
+	update := SiteUpdate{}
+	err := s.db.Get(&update, s.query(sqlGetSiteUpdate), id, ref)
+	if err == sql.ErrNoRows {
+		return SiteUpdate{}, false, nil
+	} else if err != nil {
+		return SiteUpdate{}, false, err
+	}
+	return update, true, nil
+}
+
+// CrawlInfoStore methods
+
+// TODO(cian): limit
+// GetCrawlInfos implements CrawlInfoStore.GetCrawlInfos
+func (s *sqlStore) GetCrawlInfos() ([]CrawlInfo, error) {
+	infos := make([]CrawlInfo, 0)
+	err := s.db.Select(&infos, s.query(sqlGetCrawlInfos))
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// GetCrawlInfo implements CrawlInfoStore.GetCrawlInfo
+func (s *sqlStore) GetCrawlInfo(id SiteDefID) ([]CrawlInfo, error) {
+	infos := make([]CrawlInfo, 0)
+	err := s.db.Select(&infos, s.query(sqlGetCrawlInfo), id)
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// GetPendingCrawlInfos implements CrawlinfoStore.GetPendingCrawlInfos
+func (s *sqlStore) GetPendingCrawlInfos() ([]CrawlInfo, error) {
+	infos := make([]CrawlInfo, 0)
+	err := s.db.Select(&infos, s.query(sqlGetPendingCrawlInfos))
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// CreateCrawlInfo implements CrawlInfoStore.CreateCrawlInfo
+func (s *sqlStore) CreateCrawlInfo(id SiteDefID, url string) (CrawlInfoID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var newID int64
+	rows, err := tx.Query(s.query(sqlCreateCrawlInfo), id, url, Origin(url))
+	if err != nil {
+		return 0, err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&newID); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return CrawlInfoID(newID), nil
+}
+
+// StartCrawlInfo implements CrawlInfoStore.StartCrawlInfo
+func (s *sqlStore) StartCrawlInfo(id CrawlInfoID) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlStartCrawlInfo), id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// EndCrawlInfo implements CrawlInfoStore.EndCrawlInfo
+func (s *sqlStore) EndCrawlInfo(id CrawlInfoID, workerID string, crawlErr error, seen int) error {
+	var errString string
+	if crawlErr != nil {
+		errString = crawlErr.Error()
+	}
+
+	return s.execHoldingLease(sqlEndCrawlInfo, id, errString, seen, workerID)
+}
+
+// ClaimNextCrawlInfo implements CrawlInfoStore.ClaimNextCrawlInfo
+func (s *sqlStore) ClaimNextCrawlInfo(workerID string, lease time.Duration, skipOrigins []string) (CrawlInfo, error) {
+	origins := make([]string, 0, len(skipOrigins))
+	for _, origin := range skipOrigins {
+		origins = append(origins, Origin(origin))
+	}
+	skip, err := json.Marshal(origins)
+	if err != nil {
+		return CrawlInfo{}, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return CrawlInfo{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var ci CrawlInfo
+	err = tx.QueryRowx(s.query(sqlClaimNextCrawlInfo), workerID, lease.Seconds(), string(skip)).StructScan(&ci)
+	if err != nil {
+		return CrawlInfo{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return CrawlInfo{}, err
+	}
+	return ci, nil
+}
+
+// RenewCrawlInfoLease implements CrawlInfoStore.RenewCrawlInfoLease
+func (s *sqlStore) RenewCrawlInfoLease(id CrawlInfoID, workerID string, lease time.Duration) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(s.query(sqlRenewCrawlInfoLease), id, workerID, lease.Seconds())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AbandonStaleCrawlInfos implements CrawlInfoStore.AbandonStaleCrawlInfos
+func (s *sqlStore) AbandonStaleCrawlInfos(startedBefore time.Time) (int, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(s.query(sqlAbandonCrawlInfos), startedBefore, ErrCrawlAbandoned.Error())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// UserStore methods
+
+// CreateUser implements UserStore.CreateUser
+func (s *sqlStore) CreateUser(u User) (UserID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var newID int64
+	err = tx.QueryRowx(s.query(sqlCreateUser), u.Name, u.PasswordHash, u.Role).Scan(&newID)
+	if isPGUniqueViolation(err) || isSQLiteUniqueViolation(err) {
+		return 0, ErrUserNameTaken
+	} else if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return UserID(newID), nil
+}
+
+// GetUser implements UserStore.GetUser
+func (s *sqlStore) GetUser(id UserID) (User, error) {
+	u := User{}
+	err := s.db.Get(&u, s.query(sqlGetUser), id)
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// GetUserByName implements UserStore.GetUserByName
+func (s *sqlStore) GetUserByName(name string) (User, error) {
+	u := User{}
+	err := s.db.Get(&u, s.query(sqlGetUserByName), name)
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// SessionStore methods
+
+// CreateSession implements SessionStore.CreateSession
+func (s *sqlStore) CreateSession(sess Session) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlCreateSession), sess.TokenHash, sess.UserID, sess.ExpiresAt.UTC())
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSessionUser implements SessionStore.GetSessionUser
+func (s *sqlStore) GetSessionUser(tokenHash string) (User, error) {
+	u := User{}
+	err := s.db.Get(&u, s.query(sqlGetSessionUser), tokenHash)
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// DeleteSession implements SessionStore.DeleteSession
+func (s *sqlStore) DeleteSession(tokenHash string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlDeleteSession), tokenHash)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubscriptionStore methods
+
+// Subscribe implements SubscriptionStore.Subscribe
+func (s *sqlStore) Subscribe(userID UserID, id SiteDefID) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlSubscribe), userID, id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe implements SubscriptionStore.Unsubscribe
+func (s *sqlStore) Unsubscribe(userID UserID, id SiteDefID) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlUnsubscribe), userID, id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSubscriptions implements SubscriptionStore.GetSubscriptions
+func (s *sqlStore) GetSubscriptions(userID UserID) ([]SiteDefID, error) {
+	ids := make([]SiteDefID, 0)
+	err := s.db.Select(&ids, s.query(sqlGetSubscriptions), userID)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ReadingStateStore methods
+
+// MarkRead implements ReadingStateStore.MarkRead
+func (s *sqlStore) MarkRead(userID UserID, id SiteUpdateID) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlMarkRead), userID, id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkReadThrough implements ReadingStateStore.MarkReadThrough
+func (s *sqlStore) MarkReadThrough(userID UserID, id SiteUpdateID) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlMarkReadThrough), userID, id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUnreadComics implements ReadingStateStore.GetUnreadComics
+func (s *sqlStore) GetUnreadComics(userID UserID) ([]UnreadComic, error) {
+	comics := make([]UnreadComic, 0)
+	err := s.db.Select(&comics, s.query(sqlGetUnreadComics), userID)
+	if err != nil {
+		return nil, err
+	}
+	return comics, nil
+}
+
+// FeedStore methods
+
+// GetRecentUpdates implements FeedStore.GetRecentUpdates
+func (s *sqlStore) GetRecentUpdates(limit int) ([]ComicUpdate, error) {
+	updates := make([]ComicUpdate, 0)
+	err := s.db.Select(&updates, s.query(sqlGetRecentUpdates), limit)
+	if err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// GetSiteDefUpdates implements FeedStore.GetSiteDefUpdates
+func (s *sqlStore) GetSiteDefUpdates(id SiteDefID, limit int) ([]ComicUpdate, error) {
+	updates := make([]ComicUpdate, 0)
+	err := s.db.Select(&updates, s.query(sqlGetSiteDefUpdates), id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// GetSubscribedUpdates implements FeedStore.GetSubscribedUpdates
+func (s *sqlStore) GetSubscribedUpdates(userID UserID, limit int) ([]ComicUpdate, error) {
+	updates := make([]ComicUpdate, 0)
+	err := s.db.Select(&updates, s.query(sqlGetSubscribedUpdates), userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// GetFeedToken implements FeedStore.GetFeedToken
+func (s *sqlStore) GetFeedToken(userID UserID) (string, error) {
+	var token string
+	err := s.db.Get(&token, s.query(sqlGetFeedToken), userID)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SetFeedToken implements FeedStore.SetFeedToken
+func (s *sqlStore) SetFeedToken(userID UserID, token string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(s.query(sqlSetFeedToken), userID, token)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUserByFeedToken implements FeedStore.GetUserByFeedToken
+func (s *sqlStore) GetUserByFeedToken(token string) (User, error) {
+	u := User{}
+	err := s.db.Get(&u, s.query(sqlGetUserByFeedToken), token)
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+// ClickStatsStore methods
+
+// GetSiteDefClicks implements ClickStatsStore.GetSiteDefClicks
+func (s *sqlStore) GetSiteDefClicks(since time.Time, limit int) ([]SiteDefClicks, error) {
+	stats := make([]SiteDefClicks, 0)
+	err := s.db.Select(&stats, s.query(sqlGetSiteDefClicks), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetSiteUpdateClicks implements ClickStatsStore.GetSiteUpdateClicks
+func (s *sqlStore) GetSiteUpdateClicks(since time.Time, limit int) ([]SiteUpdateClicks, error) {
+	stats := make([]SiteUpdateClicks, 0)
+	err := s.db.Select(&stats, s.query(sqlGetSiteUpdateClicks), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetSiteDefClickSeries implements ClickStatsStore.GetSiteDefClickSeries
+func (s *sqlStore) GetSiteDefClickSeries(id SiteDefID, bucket ClickBucketSize, since time.Time) ([]ClickBucket, error) {
+	buckets := make([]struct {
+		Start  textTime `db:"start"`
+		Clicks int      `db:"clicks"`
+	}, 0)
+	err := s.db.Select(&buckets, s.query(sqlGetSiteDefClickSeries), id, bucket, since)
+	if err != nil {
+		return nil, err
+	}
+	series := make([]ClickBucket, 0, len(buckets))
+	for _, b := range buckets {
+		series = append(series, ClickBucket{Start: time.Time(b.Start), Clicks: b.Clicks})
+	}
+	return series, nil
+}
+
+// GetCountryClicks implements ClickStatsStore.GetCountryClicks
+func (s *sqlStore) GetCountryClicks(since time.Time, limit int) ([]LocationClicks, error) {
+	stats := make([]LocationClicks, 0)
+	err := s.db.Select(&stats, s.query(sqlGetCountryClicks), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetRegionClicks implements ClickStatsStore.GetRegionClicks
+func (s *sqlStore) GetRegionClicks(since time.Time, limit int) ([]LocationClicks, error) {
+	stats := make([]LocationClicks, 0)
+	err := s.db.Select(&stats, s.query(sqlGetRegionClicks), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetTrendingComics implements ClickStatsStore.GetTrendingComics
+func (s *sqlStore) GetTrendingComics(since time.Time, limit int) ([]TrendingComic, error) {
+	stats := make([]TrendingComic, 0)
+	err := s.db.Select(&stats, s.query(sqlGetTrendingComics), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// UpdateImageStore methods
+
+// CreateUpdateImage implements UpdateImageStore.CreateUpdateImage
+func (s *sqlStore) CreateUpdateImage(img UpdateImage) (UpdateImageID, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var newID int64
+	rows, err := tx.Query(s.query(sqlCreateUpdateImage), img.UpdateID, img.Position, img.URL, img.Hash, img.MIMEType, img.Width, img.Height, img.Size, img.ArchivedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if rows.Next() {
+		if err := rows.Scan(&newID); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return UpdateImageID(newID), nil
+}
+
+// GetUpdateImages implements UpdateImageStore.GetUpdateImages
+func (s *sqlStore) GetUpdateImages(id SiteUpdateID) ([]UpdateImage, error) {
+	images := make([]UpdateImage, 0)
+	if err := s.db.Select(&images, s.query(sqlGetUpdateImages), id); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// GetUpdateImageByHash implements UpdateImageStore.GetUpdateImageByHash
+func (s *sqlStore) GetUpdateImageByHash(hash string) (UpdateImage, error) {
+	var img UpdateImage
+	if err := s.db.Get(&img, s.query(sqlGetUpdateImageByHash), hash); err != nil {
+		return UpdateImage{}, err
+	}
+	return img, nil
+}
+
+// BackfillStore methods
+
+// CreateBackfill implements BackfillStore.CreateBackfill
+func (s *sqlStore) CreateBackfill(b Backfill) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(s.query(sqlCreateBackfill), b.SiteDefID, b.URL, b.MaxPages, b.DatedBefore.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBackfill implements BackfillStore.GetBackfill
+func (s *sqlStore) GetBackfill(id SiteDefID) (Backfill, error) {
+	var b Backfill
+	if err := s.db.Get(&b, s.query(sqlGetBackfill), id); err != nil {
+		return Backfill{}, err
+	}
+	return b, nil
+}
+
+// ClaimNextBackfill implements BackfillStore.ClaimNextBackfill
+func (s *sqlStore) ClaimNextBackfill(workerID string, lease time.Duration) (Backfill, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return Backfill{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var b Backfill
+	if err := tx.QueryRowx(s.query(sqlClaimNextBackfill), workerID, lease.Seconds()).StructScan(&b); err != nil {
+		return Backfill{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Backfill{}, err
+	}
+	return b, nil
+}
+
+// RenewBackfillLease implements BackfillStore.RenewBackfillLease
+func (s *sqlStore) RenewBackfillLease(id SiteDefID, workerID string, lease time.Duration) error {
+	return s.execHoldingLease(sqlRenewBackfillLease, id, workerID, lease.Seconds())
+}
+
+// SaveBackfillProgress implements BackfillStore.SaveBackfillProgress
+func (s *sqlStore) SaveBackfillProgress(b Backfill) error {
+	return s.execHoldingLease(sqlSaveBackfillProgress, b.SiteDefID, b.WorkerID, b.URL, b.Pages, b.Seen)
+}
+
+// execHoldingLease runs an update of a CrawlInfo or Backfill that only applies while the worker holds
+// its lease, returning ErrLeaseLost if no row was updated
+func (s *sqlStore) execHoldingLease(query string, args ...interface{}) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec(s.query(query), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return tx.Commit()
+}
+
+// EndBackfill implements BackfillStore.EndBackfill
+func (s *sqlStore) EndBackfill(id SiteDefID, backfillErr error) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var errString string
+	if backfillErr != nil {
+		errString = backfillErr.Error()
+	}
+
+	if _, err := tx.Exec(s.query(sqlEndBackfill), id, errString); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
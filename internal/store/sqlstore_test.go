@@ -0,0 +1,1456 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+	"github.com/johnstcn/freshcomics/internal/ipinfo/ipinfotest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var testSiteDefA = SiteDef{
+	ID:                SiteDefID(1),
+	Name:              "Test Name",
+	Active:            true,
+	NSFW:              true,
+	StartURL:          "Test Start URL",
+	URLTemplate:       "Test Template",
+	NextPageXPath:     "Test Ref XPath",
+	RefRegexp:         "Test Ref Regexp",
+	TitleXPath:        "Test Title XPath",
+	TitleRegexp:       "Test Title Regexp",
+	CrawlStrategy:     CrawlStrategyPage,
+	FeedURL:           "",
+	CrawlIntervalSecs: 86400,
+}
+
+var testSiteDefB = SiteDef{
+	ID:              SiteDefID(2),
+	Name:            "Test Name Other",
+	Active:          false,
+	NSFW:            false,
+	StartURL:        "Test Start URL Other",
+	URLTemplate:     "Test Template Other",
+	NextPageXPath:   "Test Ref XPath Other",
+	RefRegexp:       "Test Ref Regexp Other",
+	TitleXPath:      "Test Title XPath Other",
+	TitleRegexp:     "Test Title Regexp Other",
+	CrawlStrategy:   CrawlStrategyFeed,
+	FeedURL:         "Test Feed URL Other",
+	CrawlCron:       "0 5 * * 1,3,5",
+	CrawlJitterSecs: 600,
+	BrokenReason:    "Test Broken Reason Other",
+	FetchDelaySecs:  5,
+	SelectorType:    "css",
+	NextPageAttr:    "href",
+	TitleAttr:       "alt",
+	ImageXPath:      "img.comic",
+	ImageAttr:       "src",
+	AltTextXPath:    "img.comic",
+	AltTextAttr:     "title",
+	PublishedXPath:  "time",
+	PublishedAttr:   "datetime",
+	PublishedRegexp: "(.+)",
+	PublishedFormat: "2006-01-02",
+	PrevPageXPath:   "a.prev",
+	PrevPageAttr:    "href",
+	BackfillURL:     "Test Backfill URL Other",
+}
+
+var testSiteUpdateA = SiteUpdate{
+	ID:        SiteUpdateID(1),
+	SiteDefID: SiteDefID(1),
+	Ref:       "Test Ref",
+	URL:       "Test URL",
+	Title:     "Test Title",
+	SeenAt:    time.Unix(0, 0),
+	ImageURLs: StringList{"Test Image URL"},
+	AltText:   "Test Alt Text",
+
+	PublishedAt: pq.NullTime{Time: time.Unix(-3600, 0), Valid: true},
+}
+
+var testBackfillA = Backfill{
+	SiteDefID:   SiteDefID(1),
+	URL:         "Test Backfill URL",
+	MaxPages:    100,
+	Pages:       3,
+	Seen:        2,
+	DatedBefore: time.Unix(0, 0).UTC(),
+	CreatedAt:   time.Unix(60, 0).UTC(),
+	WorkerID:    "w1",
+}
+
+var testUpdateImageA = UpdateImage{
+	ID:         UpdateImageID(1),
+	UpdateID:   SiteUpdateID(1),
+	Position:   0,
+	URL:        "Test Image URL",
+	Hash:       "Test Hash",
+	MIMEType:   "image/png",
+	Width:      640,
+	Height:     480,
+	Size:       1234,
+	ArchivedAt: time.Unix(0, 0).UTC(),
+}
+
+var testCrawlInfoA = CrawlInfo{
+	ID:        CrawlInfoID(1),
+	SiteDefID: SiteDefID(1),
+	URL:       "http://example.com",
+	Origin:    "http://example.com",
+	StartedAt: pq.NullTime{
+		Time:  time.Unix(0, 0).UTC(),
+		Valid: true,
+	},
+	EndedAt: pq.NullTime{
+		Time:  time.Unix(1, 0).UTC(),
+		Valid: true,
+	},
+	Seen:  1,
+	Error: "",
+}
+
+var testUserA = User{
+	ID:           UserID(1),
+	Name:         "Test User",
+	PasswordHash: "Test Password Hash",
+	Role:         RoleAdmin,
+	CreatedAt:    time.Unix(0, 0),
+}
+
+var testSessionA = Session{
+	TokenHash: "Test Token Hash",
+	UserID:    UserID(1),
+	ExpiresAt: time.Unix(1, 0),
+}
+
+var errTest = fmt.Errorf("some error")
+
+// SQLStoreTestSuite runs against each backend's queries, which are given by queries
+type SQLStoreTestSuite struct {
+	suite.Suite
+	queries map[string]string
+	store   *sqlStore
+	mip     *ipinfotest.IPInfoer
+	mdb     sqlmock.Sqlmock
+	now     func() time.Time
+}
+
+func (s *SQLStoreTestSuite) SetupSuite() {
+	conn, mdb, err := sqlmock.New()
+	if err != nil {
+		s.Fail(err.Error())
+	}
+	s.mdb = mdb
+	s.mip = &ipinfotest.IPInfoer{}
+	s.store = &sqlStore{
+		db:      sqlx.NewDb(conn, "sqlmock"),
+		geoIP:   s.mip,
+		queries: s.queries,
+	}
+	s.now = func() time.Time {
+		return time.Unix(1234, 0)
+	}
+}
+
+func (s *SQLStoreTestSuite) TearDownTest() {
+	s.NoError(s.mdb.ExpectationsWereMet())
+	s.mip.AssertExpectations(s.T())
+}
+
+func (s *SQLStoreTestSuite) TestGetComics_OK() {
+	rows := sqlmock.NewRows([]string{"name", "nsfw", "id", "title", "seen_at"}).AddRow("Test Comic", false, 1, "Test Title", s.now())
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetComics))).WillReturnRows(rows)
+	comics, err := s.store.GetComics()
+	s.NotNil(comics)
+	s.Len(comics, 1)
+	s.EqualValues("Test Comic", comics[0].Name)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestGetComics_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetComics))).WillReturnError(errTest)
+	comics, err := s.store.GetComics()
+	s.Nil(comics)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetRedirectURL_OK() {
+	rows := sqlmock.NewRows([]string{"url"}).AddRow("http://example.com")
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlRedirect))).WithArgs(testSiteUpdateA.ID).WillReturnRows(rows)
+	url, err := s.store.Redirect(testSiteUpdateA.ID)
+	s.NoError(err)
+	s.EqualValues("http://example.com", url)
+}
+
+func (s *SQLStoreTestSuite) TestGetRedirectURL_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlRedirect))).WithArgs(testSiteUpdateA.ID).WillReturnError(errTest)
+	url, err := s.store.Redirect(testSiteUpdateA.ID)
+	s.Zero(url)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestRecordClick_OK() {
+	ip := net.ParseIP("169.254.169.254")
+	s.mip.On("GetIPInfo", ip).Return(ipinfo.GeoLoc{
+		Country: "IE",
+		Region:  "L",
+		City:    "Dublin",
+	}, nil).Once()
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSaveClick))).WithArgs(12345, "IE", "L", "Dublin").WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.CreateClickLog(12345, ip)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestRecordClick_InvalidIP() {
+	ip := net.ParseIP("169.254.169.254")
+	s.mip.On("GetIPInfo", ip).Return(ipinfo.GeoLoc{}, errTest).Once()
+	err := s.store.CreateClickLog(12345, ip)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestRecordClick_ErrBeginTx() {
+	ip := net.ParseIP("169.254.169.254")
+	s.mip.On("GetIPInfo", ip).Return(ipinfo.GeoLoc{
+		Country: "IE",
+		Region:  "L",
+		City:    "Dublin",
+	}, nil).Once()
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.CreateClickLog(12345, ip)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestRecordClick_ErrExec() {
+	ip := net.ParseIP("169.254.169.254")
+	s.mip.On("GetIPInfo", ip).Return(ipinfo.GeoLoc{
+		Country: "IE",
+		Region:  "L",
+		City:    "Dublin",
+	}, nil).Once()
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSaveClick))).WithArgs(12345, "IE", "L", "Dublin").WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.CreateClickLog(12345, ip)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestRecordClick_ErrCommitTx() {
+	ip := net.ParseIP("169.254.169.254")
+	s.mip.On("GetIPInfo", ip).Return(ipinfo.GeoLoc{
+		Country: "IE",
+		Region:  "L",
+		City:    "Dublin",
+	}, nil).Once()
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSaveClick))).WithArgs(12345, "IE", "L", "Dublin").WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.CreateClickLog(12345, ip)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteDef_OK() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	newID, err := s.store.CreateSiteDef(testSiteDefA)
+	s.EqualValues(1, newID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteDef_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	newID, err := s.store.CreateSiteDef(testSiteDefA)
+	s.Zero(newID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteDef_ErrQuery() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	newID, err := s.store.CreateSiteDef(testSiteDefA)
+	s.Zero(newID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteDef_ErrCommit() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL).WillReturnRows(rows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	newID, err := s.store.CreateSiteDef(testSiteDefA)
+	s.Zero(newID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetAllSiteDefs_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "active", "nsfw", "start_url", "url_template", "next_page_xpath", "ref_regexp", "title_xpath", "title_regexp", "crawl_strategy", "feed_url", "crawl_interval_secs", "crawl_cron", "crawl_jitter_secs", "broken_reason", "fetch_delay_secs", "selector_type", "next_page_attr", "title_attr", "image_xpath", "image_attr", "alt_text_xpath", "alt_text_attr", "published_xpath", "published_attr", "published_regexp", "published_format", "prev_page_xpath", "prev_page_attr", "backfill_url"})
+	rows.AddRow(testSiteDefA.ID, testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetActiveSiteDefs))).WillReturnRows(rows)
+	defs, err := s.store.GetSiteDefs(false)
+	s.NoError(err)
+	s.Len(defs, 1)
+	s.EqualValues(testSiteDefA, defs[0])
+}
+
+func (s *SQLStoreTestSuite) TestGetAllSiteDefsInActive_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "active", "nsfw", "start_url", "url_template", "next_page_xpath", "ref_regexp", "title_xpath", "title_regexp", "crawl_strategy", "feed_url", "crawl_interval_secs", "crawl_cron", "crawl_jitter_secs", "broken_reason", "fetch_delay_secs", "selector_type", "next_page_attr", "title_attr", "image_xpath", "image_attr", "alt_text_xpath", "alt_text_attr", "published_xpath", "published_attr", "published_regexp", "published_format", "prev_page_xpath", "prev_page_attr", "backfill_url"})
+	rows.AddRow(testSiteDefA.ID, testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL)
+	rows.AddRow(testSiteDefB.ID, testSiteDefB.Name, testSiteDefB.Active, testSiteDefB.NSFW, testSiteDefB.StartURL, testSiteDefB.URLTemplate, testSiteDefB.NextPageXPath, testSiteDefB.RefRegexp, testSiteDefB.TitleXPath, testSiteDefB.TitleRegexp, testSiteDefB.CrawlStrategy, testSiteDefB.FeedURL, testSiteDefB.CrawlIntervalSecs, testSiteDefB.CrawlCron, testSiteDefB.CrawlJitterSecs, testSiteDefB.BrokenReason, testSiteDefB.FetchDelaySecs, testSiteDefB.SelectorType, testSiteDefB.NextPageAttr, testSiteDefB.TitleAttr, testSiteDefB.ImageXPath, testSiteDefB.ImageAttr, testSiteDefB.AltTextXPath, testSiteDefB.AltTextAttr, testSiteDefB.PublishedXPath, testSiteDefB.PublishedAttr, testSiteDefB.PublishedRegexp, testSiteDefB.PublishedFormat, testSiteDefB.PrevPageXPath, testSiteDefB.PrevPageAttr, testSiteDefB.BackfillURL)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefs))).WillReturnRows(rows)
+	defs, err := s.store.GetSiteDefs(true)
+	s.NoError(err)
+	s.Len(defs, 2)
+	s.EqualValues(testSiteDefA, defs[0])
+	s.EqualValues(testSiteDefB, defs[1])
+}
+
+func (s *SQLStoreTestSuite) TestGetAllSiteDefsNoRows_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "active", "nsfw", "start_url", "url_template", "next_page_xpath", "ref_regexp", "title_xpath", "title_regexp", "crawl_strategy", "feed_url", "crawl_interval_secs", "crawl_cron", "crawl_jitter_secs", "broken_reason", "fetch_delay_secs", "selector_type", "next_page_attr", "title_attr", "image_xpath", "image_attr", "alt_text_xpath", "alt_text_attr", "published_xpath", "published_attr", "published_regexp", "published_format", "prev_page_xpath", "prev_page_attr", "backfill_url"})
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefs))).WillReturnRows(rows)
+	defs, err := s.store.GetSiteDefs(true)
+	s.NoError(err)
+	s.Len(defs, 0)
+}
+
+func (s *SQLStoreTestSuite) TestGetAllSiteDefs_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefs))).WillReturnError(errTest)
+	defs, err := s.store.GetSiteDefs(true)
+	s.EqualError(err, "some error")
+	s.Nil(defs)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefByID_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "active", "nsfw", "start_url", "url_template", "next_page_xpath", "ref_regexp", "title_xpath", "title_regexp", "crawl_strategy", "feed_url", "crawl_interval_secs", "crawl_cron", "crawl_jitter_secs", "broken_reason", "fetch_delay_secs", "selector_type", "next_page_attr", "title_attr", "image_xpath", "image_attr", "alt_text_xpath", "alt_text_attr", "published_xpath", "published_attr", "published_regexp", "published_format", "prev_page_xpath", "prev_page_attr", "backfill_url"})
+	rows.AddRow(testSiteDefA.ID, testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDef))).WithArgs(1).WillReturnRows(rows)
+	def, err := s.store.GetSiteDef(1)
+	s.NoError(err)
+	s.EqualValues(testSiteDefA, def)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefByID_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDef))).WillReturnError(errTest)
+	def, err := s.store.GetSiteDef(1)
+	s.EqualError(err, "some error")
+	s.Zero(def)
+}
+
+func (s *SQLStoreTestSuite) TestSaveSiteDef_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUpdateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.UpdateSiteDef(testSiteDefA)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestSaveSiteDef_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.UpdateSiteDef(testSiteDefA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSaveSiteDef_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUpdateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL, testSiteDefA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.UpdateSiteDef(testSiteDefA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSaveSiteDef_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUpdateSiteDef))).WithArgs(testSiteDefA.Name, testSiteDefA.Active, testSiteDefA.NSFW, testSiteDefA.StartURL, testSiteDefA.URLTemplate, testSiteDefA.NextPageXPath, testSiteDefA.RefRegexp, testSiteDefA.TitleXPath, testSiteDefA.TitleRegexp, testSiteDefA.CrawlStrategy, testSiteDefA.FeedURL, testSiteDefA.CrawlIntervalSecs, testSiteDefA.CrawlCron, testSiteDefA.CrawlJitterSecs, testSiteDefA.BrokenReason, testSiteDefA.FetchDelaySecs, testSiteDefA.SelectorType, testSiteDefA.NextPageAttr, testSiteDefA.TitleAttr, testSiteDefA.ImageXPath, testSiteDefA.ImageAttr, testSiteDefA.AltTextXPath, testSiteDefA.AltTextAttr, testSiteDefA.PublishedXPath, testSiteDefA.PublishedAttr, testSiteDefA.PublishedRegexp, testSiteDefA.PublishedFormat, testSiteDefA.PrevPageXPath, testSiteDefA.PrevPageAttr, testSiteDefA.BackfillURL, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.UpdateSiteDef(testSiteDefA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkSiteDefBroken_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkSiteDefBroken))).WithArgs(testSiteDefA.ID, "some reason").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	err := s.store.MarkSiteDefBroken(testSiteDefA.ID, "some reason")
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestMarkSiteDefBroken_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkSiteDefBroken))).WithArgs(testSiteDefA.ID, "some reason").WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.MarkSiteDefBroken(testSiteDefA.ID, "some reason")
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteUpdate_OK() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteUpdate))).WithArgs(testSiteUpdateA.SiteDefID, testSiteUpdateA.Ref, testSiteUpdateA.URL, testSiteUpdateA.Title, testSiteUpdateA.SeenAt.UTC(), testSiteUpdateA.ImageURLs, testSiteUpdateA.AltText, testSiteUpdateA.PublishedAt).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	newID, err := s.store.CreateSiteUpdate(testSiteUpdateA)
+	s.NoError(err)
+	s.EqualValues(1, newID)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteUpdate_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	newID, err := s.store.CreateSiteUpdate(testSiteUpdateA)
+	s.EqualError(err, "some error")
+	s.Zero(newID)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteUpdate_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteUpdate))).WithArgs(testSiteUpdateA.SiteDefID, testSiteUpdateA.Ref, testSiteUpdateA.URL, testSiteUpdateA.Title, testSiteUpdateA.SeenAt.UTC(), testSiteUpdateA.ImageURLs, testSiteUpdateA.AltText, testSiteUpdateA.PublishedAt).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	newID, err := s.store.CreateSiteUpdate(testSiteUpdateA)
+	s.EqualError(err, "some error")
+	s.Zero(newID)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSiteUpdate_ErrCommit() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateSiteUpdate))).WithArgs(testSiteUpdateA.SiteDefID, testSiteUpdateA.Ref, testSiteUpdateA.URL, testSiteUpdateA.Title, testSiteUpdateA.SeenAt.UTC(), testSiteUpdateA.ImageURLs, testSiteUpdateA.AltText, testSiteUpdateA.PublishedAt).WillReturnRows(rows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	newID, err := s.store.CreateSiteUpdate(testSiteUpdateA)
+	s.EqualError(err, "some error")
+	s.Zero(newID)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdates_OK() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "ref", "url", "title", "seen_at", "image_urls", "alt_text", "published_at"})
+	rows.AddRow(testSiteUpdateA.ID, testSiteUpdateA.SiteDefID, testSiteUpdateA.Ref, testSiteUpdateA.URL, testSiteUpdateA.Title, testSiteUpdateA.SeenAt, `["Test Image URL"]`, testSiteUpdateA.AltText, testSiteUpdateA.PublishedAt.Time)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdates))).WithArgs(testSiteUpdateA.SiteDefID).WillReturnRows(rows)
+	updates, err := s.store.GetSiteUpdates(testSiteUpdateA.SiteDefID)
+	s.NoError(err)
+	s.Len(updates, 1)
+	s.EqualValues(updates[0], testSiteUpdateA)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdates_OKNoRows() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "ref", "url", "title", "seen_at", "image_urls", "alt_text", "published_at"})
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdates))).WithArgs(testSiteUpdateA.SiteDefID).WillReturnRows(rows)
+	updates, err := s.store.GetSiteUpdates(testSiteDefA.ID)
+	s.NoError(err)
+	s.Len(updates, 0)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdates_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdates))).WithArgs(testSiteUpdateA.SiteDefID).WillReturnError(errTest)
+	updates, err := s.store.GetSiteUpdates(testSiteUpdateA.SiteDefID)
+	s.EqualError(err, "some error")
+	s.Len(updates, 0)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdateTimes_OK() {
+	rows := sqlmock.NewRows([]string{"seen_at"}).AddRow(testSiteUpdateA.SeenAt)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdateTimes))).WithArgs(testSiteUpdateA.SiteDefID, 10).WillReturnRows(rows)
+	times, err := s.store.GetSiteUpdateTimes(testSiteUpdateA.SiteDefID, 10)
+	s.NoError(err)
+	s.Equal([]time.Time{testSiteUpdateA.SeenAt}, times)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdateTimes_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdateTimes))).WithArgs(testSiteUpdateA.SiteDefID, 10).WillReturnError(errTest)
+	times, err := s.store.GetSiteUpdateTimes(testSiteUpdateA.SiteDefID, 10)
+	s.EqualError(err, "some error")
+	s.Nil(times)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdate_OK() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "ref", "url", "title", "seen_at", "image_urls", "alt_text", "published_at"})
+	rows.AddRow(testSiteUpdateA.ID, testSiteUpdateA.SiteDefID, testSiteUpdateA.Ref, testSiteUpdateA.URL, testSiteUpdateA.Title, testSiteUpdateA.SeenAt, `["Test Image URL"]`, testSiteUpdateA.AltText, testSiteUpdateA.PublishedAt.Time)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdate))).WillReturnRows(rows)
+	su, found, err := s.store.GetSiteUpdate(testSiteDefA.ID, testSiteUpdateA.Ref)
+	s.True(found)
+	s.NoError(err)
+	s.EqualValues(testSiteUpdateA, su)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdate_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdate))).WillReturnError(errTest)
+	su, found, err := s.store.GetSiteUpdate(testSiteDefA.ID, testSiteUpdateA.Ref)
+	s.False(found)
+	s.EqualError(err, "some error")
+	s.Zero(su)
+}
+
+func (s *SQLStoreTestSuite) TestGetLastURL_OK() {
+	rows := sqlmock.NewRows([]string{"url"})
+	rows.AddRow(testSiteUpdateA.URL)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetLastURL))).WithArgs(testSiteDefA.ID).WillReturnRows(rows)
+	url, err := s.store.GetLastURL(testSiteDefA.ID)
+	s.NoError(err)
+	s.EqualValues(testSiteUpdateA.URL, url)
+}
+
+func (s *SQLStoreTestSuite) TestGetLastURL_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetLastURL))).WithArgs(testSiteDefA.ID).WillReturnError(errTest)
+	url, err := s.store.GetLastURL(testSiteDefA.ID)
+	s.Zero(url)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetCrawlInfos_OK() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "url", "origin", "started_at", "ended_at", "error", "seen"})
+	rows.AddRow(testCrawlInfoA.ID, testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.Origin, testCrawlInfoA.StartedAt.Time, testCrawlInfoA.EndedAt.Time, testCrawlInfoA.Error, testCrawlInfoA.Seen)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCrawlInfos))).WillReturnRows(rows)
+	ci, err := s.store.GetCrawlInfos()
+	s.NoError(err)
+	s.Len(ci, 1)
+	s.EqualValues(ci[0], testCrawlInfoA)
+}
+
+func (s *SQLStoreTestSuite) TestGetCrawlInfos_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCrawlInfos))).WillReturnError(errTest)
+	ci, err := s.store.GetCrawlInfos()
+	s.Len(ci, 0)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetCrawlInfo_OK() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "url", "origin", "started_at", "ended_at", "error", "seen"})
+	rows.AddRow(testCrawlInfoA.ID, testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.Origin, testCrawlInfoA.StartedAt.Time, testCrawlInfoA.EndedAt.Time, testCrawlInfoA.Error, testCrawlInfoA.Seen)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCrawlInfo))).WillReturnRows(rows)
+	ci, err := s.store.GetCrawlInfo(1)
+	s.NoError(err)
+	s.Len(ci, 1)
+	s.EqualValues(ci[0], testCrawlInfoA)
+}
+
+func (s *SQLStoreTestSuite) TestGetCrawlInfo_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCrawlInfo))).WillReturnError(errTest)
+	ci, err := s.store.GetCrawlInfo(1)
+	s.Len(ci, 0)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateCrawlInfo_OK() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateCrawlInfo))).WithArgs(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.Origin).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	id, err := s.store.CreateCrawlInfo(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL)
+	s.NoError(err)
+	s.EqualValues(1, id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateCrawlInfo_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	id, err := s.store.CreateCrawlInfo(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateCrawlInfo_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateCrawlInfo))).WithArgs(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.Origin).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	id, err := s.store.CreateCrawlInfo(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateCrawlInfo_ErrCommit() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateCrawlInfo))).WithArgs(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.Origin).WillReturnRows(rows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	id, err := s.store.CreateCrawlInfo(testCrawlInfoA.SiteDefID, testCrawlInfoA.URL)
+	s.EqualError(err, "some error")
+	s.EqualValues(0, id)
+}
+
+func (s *SQLStoreTestSuite) TestStartCrawlInfo_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlStartCrawlInfo))).WithArgs(testCrawlInfoA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.StartCrawlInfo(testCrawlInfoA.ID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestStartCrawlInfo_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.StartCrawlInfo(testCrawlInfoA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestStartCrawlInfo_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlStartCrawlInfo))).WithArgs(testCrawlInfoA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.StartCrawlInfo(testCrawlInfoA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestStartCrawlInfo_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlStartCrawlInfo))).WithArgs(testCrawlInfoA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.StartCrawlInfo(testCrawlInfoA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestEndCrawlInfo_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlEndCrawlInfo))).WithArgs(testCrawlInfoA.ID, errTest.Error(), 1, "w1").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	err := s.store.EndCrawlInfo(testCrawlInfoA.ID, "w1", errTest, 1)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestEndCrawlInfo_LeaseLost() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlEndCrawlInfo))).WithArgs(testCrawlInfoA.ID, errTest.Error(), 1, "w1").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectRollback()
+	err := s.store.EndCrawlInfo(testCrawlInfoA.ID, "w1", errTest, 1)
+	s.Equal(ErrLeaseLost, err)
+}
+
+func (s *SQLStoreTestSuite) TestEndCrawlInfo_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.EndCrawlInfo(testCrawlInfoA.ID, "w1", errTest, 1)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestEndCrawlInfo_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlEndCrawlInfo))).WithArgs(testCrawlInfoA.ID, errTest.Error(), 1, "w1").WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.EndCrawlInfo(testCrawlInfoA.ID, "w1", errTest, 1)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestEndCrawlInfo_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlEndCrawlInfo))).WithArgs(testCrawlInfoA.ID, errTest.Error(), 1, "w1").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.EndCrawlInfo(testCrawlInfoA.ID, "w1", errTest, 1)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextCrawlInfo_OK() {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "url", "started_at", "worker_id", "lease_expires_at"})
+	rows.AddRow(testCrawlInfoA.ID, testCrawlInfoA.SiteDefID, testCrawlInfoA.URL, testCrawlInfoA.StartedAt.Time, "w1", testCrawlInfoA.EndedAt.Time)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlClaimNextCrawlInfo))).WithArgs("w1", 60.0, `["http://example.com"]`).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, []string{"http://Example.com"})
+	s.NoError(err)
+	s.Equal(testCrawlInfoA.ID, ci.ID)
+	s.Equal("w1", ci.WorkerID)
+	s.Equal(testCrawlInfoA.EndedAt, ci.LeaseExpiresAt)
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextCrawlInfo_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, nil)
+	s.Zero(ci)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextCrawlInfo_ErrNoRows() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlClaimNextCrawlInfo))).WithArgs("w1", 60.0, `[]`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	s.mdb.ExpectRollback()
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, nil)
+	s.Zero(ci)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextCrawlInfo_ErrCommit() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(testCrawlInfoA.ID)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlClaimNextCrawlInfo))).WithArgs("w1", 60.0, `[]`).WillReturnRows(rows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	ci, err := s.store.ClaimNextCrawlInfo("w1", time.Minute, nil)
+	s.Zero(ci)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestAbandonStaleCrawlInfos_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlAbandonCrawlInfos))).WithArgs(testCrawlInfoA.StartedAt.Time, "abandoned").WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mdb.ExpectCommit()
+	n, err := s.store.AbandonStaleCrawlInfos(testCrawlInfoA.StartedAt.Time)
+	s.NoError(err)
+	s.Equal(2, n)
+}
+
+func (s *SQLStoreTestSuite) TestAbandonStaleCrawlInfos_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	n, err := s.store.AbandonStaleCrawlInfos(testCrawlInfoA.StartedAt.Time)
+	s.Zero(n)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestAbandonStaleCrawlInfos_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlAbandonCrawlInfos))).WithArgs(testCrawlInfoA.StartedAt.Time, "abandoned").WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	n, err := s.store.AbandonStaleCrawlInfos(testCrawlInfoA.StartedAt.Time)
+	s.Zero(n)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestAbandonStaleCrawlInfos_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlAbandonCrawlInfos))).WithArgs(testCrawlInfoA.StartedAt.Time, "abandoned").WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	n, err := s.store.AbandonStaleCrawlInfos(testCrawlInfoA.StartedAt.Time)
+	s.Zero(n)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestRenewCrawlInfoLease_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlRenewCrawlInfoLease))).WithArgs(testCrawlInfoA.ID, "w1", 60.0).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	err := s.store.RenewCrawlInfoLease(testCrawlInfoA.ID, "w1", time.Minute)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestRenewCrawlInfoLease_ErrLeaseLost() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlRenewCrawlInfoLease))).WithArgs(testCrawlInfoA.ID, "w1", 60.0).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectRollback()
+	err := s.store.RenewCrawlInfoLease(testCrawlInfoA.ID, "w1", time.Minute)
+	s.Equal(ErrLeaseLost, err)
+}
+
+func (s *SQLStoreTestSuite) TestRenewCrawlInfoLease_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlRenewCrawlInfoLease))).WithArgs(testCrawlInfoA.ID, "w1", 60.0).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.RenewCrawlInfoLease(testCrawlInfoA.ID, "w1", time.Minute)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateUser_OK() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUser))).WithArgs(testUserA.Name, testUserA.PasswordHash, testUserA.Role).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	id, err := s.store.CreateUser(testUserA)
+	s.NoError(err)
+	s.EqualValues(1, id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUser_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	id, err := s.store.CreateUser(testUserA)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUser_ErrQuery() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUser))).WithArgs(testUserA.Name, testUserA.PasswordHash, testUserA.Role).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	id, err := s.store.CreateUser(testUserA)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUser_NameTaken() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUser))).WithArgs(testUserA.Name, testUserA.PasswordHash, testUserA.Role).WillReturnError(&pq.Error{Code: "23505"})
+	s.mdb.ExpectRollback()
+	id, err := s.store.CreateUser(testUserA)
+	s.ErrorIs(err, ErrUserNameTaken)
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUser_ErrCommit() {
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUser))).WithArgs(testUserA.Name, testUserA.PasswordHash, testUserA.Role).WillReturnRows(rows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	id, err := s.store.CreateUser(testUserA)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func (s *SQLStoreTestSuite) TestGetUser_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "password_hash", "role", "created_at"})
+	rows.AddRow(testUserA.ID, testUserA.Name, testUserA.PasswordHash, testUserA.Role, testUserA.CreatedAt)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUser))).WithArgs(testUserA.ID).WillReturnRows(rows)
+	u, err := s.store.GetUser(testUserA.ID)
+	s.NoError(err)
+	s.EqualValues(testUserA, u)
+}
+
+func (s *SQLStoreTestSuite) TestGetUser_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUser))).WithArgs(testUserA.ID).WillReturnError(errTest)
+	u, err := s.store.GetUser(testUserA.ID)
+	s.EqualError(err, "some error")
+	s.Zero(u)
+}
+
+func (s *SQLStoreTestSuite) TestGetUserByName_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "password_hash", "role", "created_at"})
+	rows.AddRow(testUserA.ID, testUserA.Name, testUserA.PasswordHash, testUserA.Role, testUserA.CreatedAt)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUserByName))).WithArgs(testUserA.Name).WillReturnRows(rows)
+	u, err := s.store.GetUserByName(testUserA.Name)
+	s.NoError(err)
+	s.EqualValues(testUserA, u)
+}
+
+func (s *SQLStoreTestSuite) TestGetUserByName_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUserByName))).WithArgs(testUserA.Name).WillReturnError(errTest)
+	u, err := s.store.GetUserByName(testUserA.Name)
+	s.EqualError(err, "some error")
+	s.Zero(u)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSession_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlCreateSession))).WithArgs(testSessionA.TokenHash, testSessionA.UserID, testSessionA.ExpiresAt.UTC()).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.CreateSession(testSessionA)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestCreateSession_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.CreateSession(testSessionA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSession_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlCreateSession))).WithArgs(testSessionA.TokenHash, testSessionA.UserID, testSessionA.ExpiresAt.UTC()).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.CreateSession(testSessionA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestCreateSession_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlCreateSession))).WithArgs(testSessionA.TokenHash, testSessionA.UserID, testSessionA.ExpiresAt.UTC()).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.CreateSession(testSessionA)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetSessionUser_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "password_hash", "role", "created_at"})
+	rows.AddRow(testUserA.ID, testUserA.Name, testUserA.PasswordHash, testUserA.Role, testUserA.CreatedAt)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSessionUser))).WithArgs(testSessionA.TokenHash).WillReturnRows(rows)
+	u, err := s.store.GetSessionUser(testSessionA.TokenHash)
+	s.NoError(err)
+	s.EqualValues(testUserA, u)
+}
+
+func (s *SQLStoreTestSuite) TestGetSessionUser_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSessionUser))).WithArgs(testSessionA.TokenHash).WillReturnError(errTest)
+	u, err := s.store.GetSessionUser(testSessionA.TokenHash)
+	s.EqualError(err, "some error")
+	s.Zero(u)
+}
+
+func (s *SQLStoreTestSuite) TestDeleteSession_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlDeleteSession))).WithArgs(testSessionA.TokenHash).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.DeleteSession(testSessionA.TokenHash)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestDeleteSession_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlDeleteSession))).WithArgs(testSessionA.TokenHash).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.DeleteSession(testSessionA.TokenHash)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSubscribe_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.Subscribe(testUserA.ID, testSiteDefA.ID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestSubscribe_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.Subscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSubscribe_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.Subscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSubscribe_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.Subscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestUnsubscribe_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUnsubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.Unsubscribe(testUserA.ID, testSiteDefA.ID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestUnsubscribe_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.Unsubscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestUnsubscribe_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUnsubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.Unsubscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestUnsubscribe_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlUnsubscribe))).WithArgs(testUserA.ID, testSiteDefA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.Unsubscribe(testUserA.ID, testSiteDefA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetSubscriptions_OK() {
+	rows := sqlmock.NewRows([]string{"site_def_id"}).AddRow(testSiteDefA.ID).AddRow(testSiteDefB.ID)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSubscriptions))).WithArgs(testUserA.ID).WillReturnRows(rows)
+	ids, err := s.store.GetSubscriptions(testUserA.ID)
+	s.NoError(err)
+	s.EqualValues([]SiteDefID{testSiteDefA.ID, testSiteDefB.ID}, ids)
+}
+
+func (s *SQLStoreTestSuite) TestGetSubscriptions_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSubscriptions))).WithArgs(testUserA.ID).WillReturnError(errTest)
+	ids, err := s.store.GetSubscriptions(testUserA.ID)
+	s.EqualError(err, "some error")
+	s.Nil(ids)
+}
+
+func (s *SQLStoreTestSuite) TestMarkRead_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkRead))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.MarkRead(testUserA.ID, testSiteUpdateA.ID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestMarkRead_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.MarkRead(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkRead_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkRead))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.MarkRead(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkRead_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkRead))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.MarkRead(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkReadThrough_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkReadThrough))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.MarkReadThrough(testUserA.ID, testSiteUpdateA.ID)
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestMarkReadThrough_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.MarkReadThrough(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkReadThrough_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkReadThrough))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.MarkReadThrough(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestMarkReadThrough_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlMarkReadThrough))).WithArgs(testUserA.ID, testSiteUpdateA.ID).WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.MarkReadThrough(testUserA.ID, testSiteUpdateA.ID)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetUnreadComics_OK() {
+	rows := sqlmock.NewRows([]string{"site_def_id", "name", "nsfw", "id", "title", "url", "seen_at", "unread"})
+	rows.AddRow(testSiteDefA.ID, testSiteDefA.Name, testSiteDefA.NSFW, testSiteUpdateA.ID, testSiteUpdateA.Title, testSiteUpdateA.URL, testSiteUpdateA.SeenAt, 3)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUnreadComics))).WithArgs(testUserA.ID).WillReturnRows(rows)
+	comics, err := s.store.GetUnreadComics(testUserA.ID)
+	s.NoError(err)
+	s.Len(comics, 1)
+	s.EqualValues(UnreadComic{
+		SiteDefID: testSiteDefA.ID,
+		Name:      testSiteDefA.Name,
+		NSFW:      testSiteDefA.NSFW,
+		ID:        testSiteUpdateA.ID,
+		Title:     testSiteUpdateA.Title,
+		URL:       testSiteUpdateA.URL,
+		SeenAt:    testSiteUpdateA.SeenAt,
+		Unread:    3,
+	}, comics[0])
+}
+
+func (s *SQLStoreTestSuite) TestGetUnreadComics_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUnreadComics))).WithArgs(testUserA.ID).WillReturnError(errTest)
+	comics, err := s.store.GetUnreadComics(testUserA.ID)
+	s.EqualError(err, "some error")
+	s.Nil(comics)
+}
+
+func (s *SQLStoreTestSuite) comicUpdateRows() (*sqlmock.Rows, ComicUpdate) {
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "name", "title", "url", "seen_at"})
+	rows.AddRow(testSiteUpdateA.ID, testSiteDefA.ID, testSiteDefA.Name, testSiteUpdateA.Title, testSiteUpdateA.URL, testSiteUpdateA.SeenAt)
+	return rows, ComicUpdate{
+		ID:        testSiteUpdateA.ID,
+		SiteDefID: testSiteDefA.ID,
+		Name:      testSiteDefA.Name,
+		Title:     testSiteUpdateA.Title,
+		URL:       testSiteUpdateA.URL,
+		SeenAt:    testSiteUpdateA.SeenAt,
+	}
+}
+
+func (s *SQLStoreTestSuite) TestGetRecentUpdates_OK() {
+	rows, expected := s.comicUpdateRows()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetRecentUpdates))).WithArgs(10).WillReturnRows(rows)
+	updates, err := s.store.GetRecentUpdates(10)
+	s.NoError(err)
+	s.EqualValues([]ComicUpdate{expected}, updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetRecentUpdates_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetRecentUpdates))).WithArgs(10).WillReturnError(errTest)
+	updates, err := s.store.GetRecentUpdates(10)
+	s.EqualError(err, "some error")
+	s.Nil(updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefUpdates_OK() {
+	rows, expected := s.comicUpdateRows()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefUpdates))).WithArgs(testSiteDefA.ID, 10).WillReturnRows(rows)
+	updates, err := s.store.GetSiteDefUpdates(testSiteDefA.ID, 10)
+	s.NoError(err)
+	s.EqualValues([]ComicUpdate{expected}, updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefUpdates_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefUpdates))).WithArgs(testSiteDefA.ID, 10).WillReturnError(errTest)
+	updates, err := s.store.GetSiteDefUpdates(testSiteDefA.ID, 10)
+	s.EqualError(err, "some error")
+	s.Nil(updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetSubscribedUpdates_OK() {
+	rows, expected := s.comicUpdateRows()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSubscribedUpdates))).WithArgs(testUserA.ID, 10).WillReturnRows(rows)
+	updates, err := s.store.GetSubscribedUpdates(testUserA.ID, 10)
+	s.NoError(err)
+	s.EqualValues([]ComicUpdate{expected}, updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetSubscribedUpdates_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSubscribedUpdates))).WithArgs(testUserA.ID, 10).WillReturnError(errTest)
+	updates, err := s.store.GetSubscribedUpdates(testUserA.ID, 10)
+	s.EqualError(err, "some error")
+	s.Nil(updates)
+}
+
+func (s *SQLStoreTestSuite) TestGetFeedToken_OK() {
+	rows := sqlmock.NewRows([]string{"feed_token"}).AddRow("abc")
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetFeedToken))).WithArgs(testUserA.ID).WillReturnRows(rows)
+	token, err := s.store.GetFeedToken(testUserA.ID)
+	s.NoError(err)
+	s.Equal("abc", token)
+}
+
+func (s *SQLStoreTestSuite) TestGetFeedToken_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetFeedToken))).WithArgs(testUserA.ID).WillReturnError(errTest)
+	token, err := s.store.GetFeedToken(testUserA.ID)
+	s.EqualError(err, "some error")
+	s.Empty(token)
+}
+
+func (s *SQLStoreTestSuite) TestSetFeedToken_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSetFeedToken))).WithArgs(testUserA.ID, "abc").WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit()
+	err := s.store.SetFeedToken(testUserA.ID, "abc")
+	s.NoError(err)
+}
+
+func (s *SQLStoreTestSuite) TestSetFeedToken_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	err := s.store.SetFeedToken(testUserA.ID, "abc")
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSetFeedToken_ErrExec() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSetFeedToken))).WithArgs(testUserA.ID, "abc").WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	err := s.store.SetFeedToken(testUserA.ID, "abc")
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestSetFeedToken_ErrCommit() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSetFeedToken))).WithArgs(testUserA.ID, "abc").WillReturnResult(driver.ResultNoRows)
+	s.mdb.ExpectCommit().WillReturnError(errTest)
+	err := s.store.SetFeedToken(testUserA.ID, "abc")
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetUserByFeedToken_OK() {
+	rows := sqlmock.NewRows([]string{"id", "name", "password_hash", "role", "created_at"})
+	rows.AddRow(testUserA.ID, testUserA.Name, testUserA.PasswordHash, testUserA.Role, testUserA.CreatedAt)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUserByFeedToken))).WithArgs("abc").WillReturnRows(rows)
+	u, err := s.store.GetUserByFeedToken("abc")
+	s.NoError(err)
+	s.EqualValues(testUserA, u)
+}
+
+func (s *SQLStoreTestSuite) TestGetUserByFeedToken_Err() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUserByFeedToken))).WithArgs("abc").WillReturnError(errTest)
+	u, err := s.store.GetUserByFeedToken("abc")
+	s.EqualError(err, "some error")
+	s.Empty(u)
+}
+
+func (s *SQLStoreTestSuite) TestGetPopularComics_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"name", "nsfw", "id", "title", "seen_at", "url"}).AddRow("Test Comic", false, 1, "Test Title", s.now(), "http://example.com/1")
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetPopularComics))).WithArgs(since).WillReturnRows(rows)
+	comics, err := s.store.GetPopularComics(since)
+	s.NoError(err)
+	s.Len(comics, 1)
+	s.EqualValues("http://example.com/1", comics[0].URL)
+}
+
+func (s *SQLStoreTestSuite) TestGetPopularComics_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetPopularComics))).WithArgs(since).WillReturnError(errTest)
+	comics, err := s.store.GetPopularComics(since)
+	s.Nil(comics)
+	s.EqualError(err, "some error")
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefClicks_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"site_def_id", "name", "clicks"}).AddRow(testSiteDefA.ID, testSiteDefA.Name, 3)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefClicks))).WithArgs(since, 10).WillReturnRows(rows)
+	stats, err := s.store.GetSiteDefClicks(since, 10)
+	s.NoError(err)
+	s.EqualValues([]SiteDefClicks{{SiteDefID: testSiteDefA.ID, Name: testSiteDefA.Name, Clicks: 3}}, stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefClicks_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefClicks))).WithArgs(since, 10).WillReturnError(errTest)
+	stats, err := s.store.GetSiteDefClicks(since, 10)
+	s.EqualError(err, "some error")
+	s.Nil(stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdateClicks_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"id", "site_def_id", "name", "title", "clicks"}).AddRow(testSiteUpdateA.ID, testSiteDefA.ID, testSiteDefA.Name, testSiteUpdateA.Title, 2)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdateClicks))).WithArgs(since, 10).WillReturnRows(rows)
+	stats, err := s.store.GetSiteUpdateClicks(since, 10)
+	s.NoError(err)
+	s.EqualValues([]SiteUpdateClicks{{ID: testSiteUpdateA.ID, SiteDefID: testSiteDefA.ID, Name: testSiteDefA.Name, Title: testSiteUpdateA.Title, Clicks: 2}}, stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteUpdateClicks_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteUpdateClicks))).WithArgs(since, 10).WillReturnError(errTest)
+	stats, err := s.store.GetSiteUpdateClicks(since, 10)
+	s.EqualError(err, "some error")
+	s.Nil(stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefClickSeries_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"start", "clicks"}).AddRow(since, 4)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefClickSeries))).WithArgs(testSiteDefA.ID, ClickBucketHour, since).WillReturnRows(rows)
+	series, err := s.store.GetSiteDefClickSeries(testSiteDefA.ID, ClickBucketHour, since)
+	s.NoError(err)
+	s.EqualValues([]ClickBucket{{Start: since, Clicks: 4}}, series)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefClickSeries_TextStart() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"start", "clicks"}).AddRow("1970-01-01 00:00:00", 4)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefClickSeries))).WithArgs(testSiteDefA.ID, ClickBucketHour, since).WillReturnRows(rows)
+	series, err := s.store.GetSiteDefClickSeries(testSiteDefA.ID, ClickBucketHour, since)
+	s.NoError(err)
+	s.EqualValues([]ClickBucket{{Start: time.Unix(0, 0).UTC(), Clicks: 4}}, series)
+}
+
+func (s *SQLStoreTestSuite) TestGetSiteDefClickSeries_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetSiteDefClickSeries))).WithArgs(testSiteDefA.ID, ClickBucketHour, since).WillReturnError(errTest)
+	series, err := s.store.GetSiteDefClickSeries(testSiteDefA.ID, ClickBucketHour, since)
+	s.EqualError(err, "some error")
+	s.Nil(series)
+}
+
+func (s *SQLStoreTestSuite) TestGetCountryClicks_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"country", "region", "clicks"}).AddRow("IE", "", 5)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCountryClicks))).WithArgs(since, 10).WillReturnRows(rows)
+	stats, err := s.store.GetCountryClicks(since, 10)
+	s.NoError(err)
+	s.EqualValues([]LocationClicks{{Country: "IE", Clicks: 5}}, stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetCountryClicks_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetCountryClicks))).WithArgs(since, 10).WillReturnError(errTest)
+	stats, err := s.store.GetCountryClicks(since, 10)
+	s.EqualError(err, "some error")
+	s.Nil(stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetRegionClicks_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"country", "region", "clicks"}).AddRow("IE", "L", 5)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetRegionClicks))).WithArgs(since, 10).WillReturnRows(rows)
+	stats, err := s.store.GetRegionClicks(since, 10)
+	s.NoError(err)
+	s.EqualValues([]LocationClicks{{Country: "IE", Region: "L", Clicks: 5}}, stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetRegionClicks_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetRegionClicks))).WithArgs(since, 10).WillReturnError(errTest)
+	stats, err := s.store.GetRegionClicks(since, 10)
+	s.EqualError(err, "some error")
+	s.Nil(stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetTrendingComics_OK() {
+	since := s.now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"site_def_id", "name", "clicks", "previous_clicks"}).AddRow(testSiteDefA.ID, testSiteDefA.Name, 7, 2)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetTrendingComics))).WithArgs(since, 10).WillReturnRows(rows)
+	stats, err := s.store.GetTrendingComics(since, 10)
+	s.NoError(err)
+	s.EqualValues([]TrendingComic{{SiteDefID: testSiteDefA.ID, Name: testSiteDefA.Name, Clicks: 7, PreviousClicks: 2}}, stats)
+}
+
+func (s *SQLStoreTestSuite) TestGetTrendingComics_Err() {
+	since := s.now().Add(-time.Hour)
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetTrendingComics))).WithArgs(since, 10).WillReturnError(errTest)
+	stats, err := s.store.GetTrendingComics(since, 10)
+	s.EqualError(err, "some error")
+	s.Nil(stats)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUpdateImage_OK() {
+	img := testUpdateImageA
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUpdateImage))).WithArgs(img.UpdateID, img.Position, img.URL, img.Hash, img.MIMEType, img.Width, img.Height, img.Size, img.ArchivedAt).WillReturnRows(rows)
+	s.mdb.ExpectCommit()
+	id, err := s.store.CreateUpdateImage(img)
+	s.NoError(err)
+	s.EqualValues(1, id)
+}
+
+func (s *SQLStoreTestSuite) TestCreateUpdateImage_ErrQuery() {
+	img := testUpdateImageA
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlCreateUpdateImage))).WithArgs(img.UpdateID, img.Position, img.URL, img.Hash, img.MIMEType, img.Width, img.Height, img.Size, img.ArchivedAt).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	id, err := s.store.CreateUpdateImage(img)
+	s.EqualError(err, "some error")
+	s.Zero(id)
+}
+
+func updateImageRows(images ...UpdateImage) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "update_id", "position", "url", "hash", "mime_type", "width", "height", "size", "archived_at"})
+	for _, img := range images {
+		rows.AddRow(img.ID, img.UpdateID, img.Position, img.URL, img.Hash, img.MIMEType, img.Width, img.Height, img.Size, img.ArchivedAt)
+	}
+	return rows
+}
+
+func (s *SQLStoreTestSuite) TestGetUpdateImages_OK() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUpdateImages))).WithArgs(testUpdateImageA.UpdateID).WillReturnRows(updateImageRows(testUpdateImageA))
+	images, err := s.store.GetUpdateImages(testUpdateImageA.UpdateID)
+	s.NoError(err)
+	s.EqualValues([]UpdateImage{testUpdateImageA}, images)
+}
+
+func (s *SQLStoreTestSuite) TestGetUpdateImages_ErrQuery() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUpdateImages))).WithArgs(testUpdateImageA.UpdateID).WillReturnError(errTest)
+	images, err := s.store.GetUpdateImages(testUpdateImageA.UpdateID)
+	s.EqualError(err, "some error")
+	s.Nil(images)
+}
+
+func (s *SQLStoreTestSuite) TestGetUpdateImageByHash_OK() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUpdateImageByHash))).WithArgs(testUpdateImageA.Hash).WillReturnRows(updateImageRows(testUpdateImageA))
+	img, err := s.store.GetUpdateImageByHash(testUpdateImageA.Hash)
+	s.NoError(err)
+	s.Equal(testUpdateImageA, img)
+}
+
+func (s *SQLStoreTestSuite) TestGetUpdateImageByHash_ErrNoRows() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetUpdateImageByHash))).WithArgs(testUpdateImageA.Hash).WillReturnRows(updateImageRows())
+	_, err := s.store.GetUpdateImageByHash(testUpdateImageA.Hash)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *SQLStoreTestSuite) TestCreateBackfill_OK() {
+	b := testBackfillA
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlCreateBackfill))).WithArgs(b.SiteDefID, b.URL, b.MaxPages, b.DatedBefore).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.store.CreateBackfill(b))
+}
+
+func (s *SQLStoreTestSuite) TestCreateBackfill_ErrExec() {
+	b := testBackfillA
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlCreateBackfill))).WithArgs(b.SiteDefID, b.URL, b.MaxPages, b.DatedBefore).WillReturnError(errTest)
+	s.mdb.ExpectRollback()
+	s.EqualError(s.store.CreateBackfill(b), "some error")
+}
+
+func backfillRows(backfills ...Backfill) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"site_def_id", "url", "max_pages", "pages", "seen", "dated_before", "created_at", "ended_at", "error", "worker_id", "lease_expires_at"})
+	for _, b := range backfills {
+		rows.AddRow(b.SiteDefID, b.URL, b.MaxPages, b.Pages, b.Seen, b.DatedBefore, b.CreatedAt, b.EndedAt, b.Error, b.WorkerID, b.LeaseExpiresAt)
+	}
+	return rows
+}
+
+func (s *SQLStoreTestSuite) TestGetBackfill_OK() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetBackfill))).WithArgs(testBackfillA.SiteDefID).WillReturnRows(backfillRows(testBackfillA))
+	b, err := s.store.GetBackfill(testBackfillA.SiteDefID)
+	s.NoError(err)
+	s.Equal(testBackfillA, b)
+}
+
+func (s *SQLStoreTestSuite) TestGetBackfill_ErrNoRows() {
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlGetBackfill))).WithArgs(testBackfillA.SiteDefID).WillReturnRows(backfillRows())
+	_, err := s.store.GetBackfill(testBackfillA.SiteDefID)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextBackfill_OK() {
+	claimed := testBackfillA
+	expires := time.Unix(120, 0).UTC()
+	claimed.LeaseExpiresAt = &expires
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlClaimNextBackfill))).WithArgs("w1", 60.0).WillReturnRows(backfillRows(claimed))
+	s.mdb.ExpectCommit()
+	b, err := s.store.ClaimNextBackfill("w1", time.Minute)
+	s.NoError(err)
+	s.Equal(claimed, b)
+}
+
+func (s *SQLStoreTestSuite) TestClaimNextBackfill_ErrNoRows() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectQuery(regexp.QuoteMeta(s.store.query(sqlClaimNextBackfill))).WithArgs("w1", 60.0).WillReturnRows(backfillRows())
+	s.mdb.ExpectRollback()
+	b, err := s.store.ClaimNextBackfill("w1", time.Minute)
+	s.Zero(b)
+	s.Equal(sql.ErrNoRows, err)
+}
+
+func (s *SQLStoreTestSuite) TestRenewBackfillLease_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlRenewBackfillLease))).WithArgs(testBackfillA.SiteDefID, "w1", 60.0).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.store.RenewBackfillLease(testBackfillA.SiteDefID, "w1", time.Minute))
+}
+
+func (s *SQLStoreTestSuite) TestRenewBackfillLease_ErrLeaseLost() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlRenewBackfillLease))).WithArgs(testBackfillA.SiteDefID, "w1", 60.0).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectRollback()
+	s.Equal(ErrLeaseLost, s.store.RenewBackfillLease(testBackfillA.SiteDefID, "w1", time.Minute))
+}
+
+func (s *SQLStoreTestSuite) TestSaveBackfillProgress_OK() {
+	b := testBackfillA
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSaveBackfillProgress))).WithArgs(b.SiteDefID, b.WorkerID, b.URL, b.Pages, b.Seen).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.store.SaveBackfillProgress(b))
+}
+
+func (s *SQLStoreTestSuite) TestSaveBackfillProgress_ErrLeaseLost() {
+	b := testBackfillA
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlSaveBackfillProgress))).WithArgs(b.SiteDefID, b.WorkerID, b.URL, b.Pages, b.Seen).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mdb.ExpectRollback()
+	s.Equal(ErrLeaseLost, s.store.SaveBackfillProgress(b))
+}
+
+func (s *SQLStoreTestSuite) TestEndBackfill_OK() {
+	s.mdb.ExpectBegin()
+	s.mdb.ExpectExec(regexp.QuoteMeta(s.store.query(sqlEndBackfill))).WithArgs(testBackfillA.SiteDefID, errTest.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mdb.ExpectCommit()
+	s.NoError(s.store.EndBackfill(testBackfillA.SiteDefID, errTest))
+}
+
+func (s *SQLStoreTestSuite) TestEndBackfill_ErrBegin() {
+	s.mdb.ExpectBegin().WillReturnError(errTest)
+	s.EqualError(s.store.EndBackfill(testBackfillA.SiteDefID, nil), "some error")
+}
+
+func TestPGStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(SQLStoreTestSuite))
+}
+
+func TestSQLiteStoreTestSuite(t *testing.T) {
+	suite.Run(t, &SQLStoreTestSuite{queries: sqliteQueries})
+}
@@ -1,24 +1,50 @@
 package store
 
 import (
+	"errors"
+	"net"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 
+	"github.com/johnstcn/freshcomics/internal/ipinfo"
+
 	_ "github.com/golang/mock/mockgen/model"
 )
 
+// ErrLeaseLost is returned when renewing the lease on, or updating, a CrawlInfo or Backfill that is no longer held by the worker
+var ErrLeaseLost = errors.New("crawl info lease lost")
+
+// ErrUserNameTaken is returned by CreateUser when another User already has the name
+var ErrUserNameTaken = errors.New("user name taken")
+
+// ErrCrawlAbandoned is recorded as the error of CrawlInfos ended by AbandonStaleCrawlInfos
+var ErrCrawlAbandoned = errors.New("abandoned")
+
 //go:generate mockgen -destination mocks/store.go . Store
 
 type Store interface {
 	ComicStore
 	Redirecter
+	ClickLogger
 	SiteDefStore
 	SiteUpdateStore
 	CrawlInfoStore
+	UserStore
+	SessionStore
+	SubscriptionStore
+	ReadingStateStore
+	FeedStore
+	ClickStatsStore
+	UpdateImageStore
+	BackfillStore
 }
 
 type ComicStore interface {
 	// GetComics returns the latest comics
 	GetComics() ([]Comic, error)
+	// GetPopularComics returns the latest comics ordered by the number of clicks since the given time
+	GetPopularComics(since time.Time) ([]Comic, error)
 }
 
 type Redirecter interface {
@@ -26,6 +52,11 @@ type Redirecter interface {
 	Redirect(id SiteUpdateID) (string, error)
 }
 
+type ClickLogger interface {
+	// CreateClickLog records a click on the given SiteUpdateID from the given address
+	CreateClickLog(id SiteUpdateID, addr net.IP) error
+}
+
 type SiteDefStore interface {
 	// GetSiteDefs returns all active SiteDefs. If includeInactive is true, returns all SiteDefs.
 	GetSiteDefs(includeInactive bool) ([]SiteDef, error)
@@ -35,6 +66,8 @@ type SiteDefStore interface {
 	CreateSiteDef(sd SiteDef) (SiteDefID, error)
 	// UpdateSiteDef updates the given SiteDef
 	UpdateSiteDef(sd SiteDef) error
+	// MarkSiteDefBroken deactivates the given SiteDef, recording why
+	MarkSiteDefBroken(id SiteDefID, reason string) error
 	// GetLastURL returns the last URL seen for the given SiteDef.
 	GetLastURL(id SiteDefID) (string, error)
 }
@@ -44,6 +77,8 @@ type SiteUpdateStore interface {
 	CreateSiteUpdate(su SiteUpdate) (SiteUpdateID, error)
 	// GetSiteUpdates returns all SiteUpdates for the given SiteDefID
 	GetSiteUpdates(id SiteDefID) ([]SiteUpdate, error)
+	// GetSiteUpdateTimes returns when the latest limit SiteUpdates for the given SiteDefID were seen, newest first
+	GetSiteUpdateTimes(id SiteDefID, limit int) ([]time.Time, error)
 	// GetSiteUpdate gets a single SiteUpdate from the SiteDefID and the ref
 	GetSiteUpdate(id SiteDefID, ref string) (SiteUpdate, bool, error)
 }
@@ -53,14 +88,119 @@ type CrawlInfoStore interface {
 	GetCrawlInfos() ([]CrawlInfo, error)
 	// GetCrawlInfo returns all CrawlInfos for the given SiteDefID
 	GetCrawlInfo(id SiteDefID) ([]CrawlInfo, error)
-	// GetPendingCrawlInfos returns all CrawlInfos where started_at and ended_at is null
+	// GetPendingCrawlInfos returns all CrawlInfos that have not ended and either have not started or whose lease has expired
 	GetPendingCrawlInfos() ([]CrawlInfo, error)
 	// CreateCrawlInfo creates a new CrawlInfo for the given SiteDefID and url with default fields returning the id
 	CreateCrawlInfo(id SiteDefID, url string) (CrawlInfoID, error)
 	// StartCrawlInfo sets started_at to the current time for the given CrawlInfoID
 	StartCrawlInfo(id CrawlInfoID) error
-	// EndCrawlInfo sets ended_at to the current timestamp for the given CrawlInfoID and sets error and seen to the given values
-	EndCrawlInfo(id CrawlInfoID, crawlErr error, seen int) error
+	// EndCrawlInfo sets ended_at to the current timestamp for the given CrawlInfoID and sets error and seen to the given values.
+	// Returns ErrLeaseLost if the CrawlInfo is leased to another worker.
+	EndCrawlInfo(id CrawlInfoID, workerID string, crawlErr error, seen int) error
+	// ClaimNextCrawlInfo atomically leases the oldest pending CrawlInfo to workerID for the given duration and marks it started.
+	// CrawlInfos whose URL is on one of skipOrigins (scheme://host, normalised with Origin) are passed over. Returns sql.ErrNoRows if there is nothing to claim.
+	ClaimNextCrawlInfo(workerID string, lease time.Duration, skipOrigins []string) (CrawlInfo, error)
+	// RenewCrawlInfoLease extends the lease workerID holds on the given CrawlInfoID to the given duration from now.
+	// Returns ErrLeaseLost if the CrawlInfo has ended or is leased to another worker.
+	RenewCrawlInfoLease(id CrawlInfoID, workerID string, lease time.Duration) error
+	// AbandonStaleCrawlInfos ends CrawlInfos that started before startedBefore, have not ended and hold no live lease,
+	// recording ErrCrawlAbandoned as their error. Returns the number of CrawlInfos abandoned.
+	AbandonStaleCrawlInfos(startedBefore time.Time) (int, error)
+}
+
+type UserStore interface {
+	// CreateUser persists the given User returning the id, or ErrUserNameTaken if the name is in use
+	CreateUser(u User) (UserID, error)
+	// GetUser returns the User with the given UserID
+	GetUser(id UserID) (User, error)
+	// GetUserByName returns the User with the given name
+	GetUserByName(name string) (User, error)
+}
+
+type SessionStore interface {
+	// CreateSession persists the given Session
+	CreateSession(sess Session) error
+	// GetSessionUser returns the User owning the unexpired Session with the given token hash
+	GetSessionUser(tokenHash string) (User, error)
+	// DeleteSession deletes the Session with the given token hash
+	DeleteSession(tokenHash string) error
+}
+
+type SubscriptionStore interface {
+	// Subscribe subscribes the given User to the given SiteDef
+	Subscribe(userID UserID, id SiteDefID) error
+	// Unsubscribe unsubscribes the given User from the given SiteDef
+	Unsubscribe(userID UserID, id SiteDefID) error
+	// GetSubscriptions returns the SiteDefIDs the given User is subscribed to
+	GetSubscriptions(userID UserID) ([]SiteDefID, error)
+}
+
+type ReadingStateStore interface {
+	// MarkRead marks the given SiteUpdate as read by the given User
+	MarkRead(userID UserID, id SiteUpdateID) error
+	// MarkReadThrough marks the given SiteUpdate and all earlier SiteUpdates of the same SiteDef as read by the given User
+	MarkReadThrough(userID UserID, id SiteUpdateID) error
+	// GetUnreadComics returns the latest SiteUpdate of each SiteDef the given User is subscribed to with the number of unread SiteUpdates
+	GetUnreadComics(userID UserID) ([]UnreadComic, error)
+}
+
+type FeedStore interface {
+	// GetRecentUpdates returns up to limit of the most recent SiteUpdates across all SiteDefs
+	GetRecentUpdates(limit int) ([]ComicUpdate, error)
+	// GetSiteDefUpdates returns up to limit of the most recent SiteUpdates for the given SiteDef
+	GetSiteDefUpdates(id SiteDefID, limit int) ([]ComicUpdate, error)
+	// GetSubscribedUpdates returns up to limit of the most recent SiteUpdates of the SiteDefs the given User is subscribed to
+	GetSubscribedUpdates(userID UserID, limit int) ([]ComicUpdate, error)
+	// GetFeedToken returns the feed token hash of the given User, or an empty string if none is set
+	GetFeedToken(userID UserID) (string, error)
+	// SetFeedToken sets the feed token hash of the given User
+	SetFeedToken(userID UserID, tokenHash string) error
+	// GetUserByFeedToken returns the User with the given feed token hash
+	GetUserByFeedToken(tokenHash string) (User, error)
+}
+
+type ClickStatsStore interface {
+	// GetSiteDefClicks returns up to limit SiteDefs with the most clicks since the given time
+	GetSiteDefClicks(since time.Time, limit int) ([]SiteDefClicks, error)
+	// GetSiteUpdateClicks returns up to limit SiteUpdates with the most clicks since the given time
+	GetSiteUpdateClicks(since time.Time, limit int) ([]SiteUpdateClicks, error)
+	// GetSiteDefClickSeries returns the clicks on the given SiteDef since the given time in buckets of the given size
+	GetSiteDefClickSeries(id SiteDefID, bucket ClickBucketSize, since time.Time) ([]ClickBucket, error)
+	// GetCountryClicks returns up to limit countries with the most clicks since the given time
+	GetCountryClicks(since time.Time, limit int) ([]LocationClicks, error)
+	// GetRegionClicks returns up to limit regions with the most clicks since the given time
+	GetRegionClicks(since time.Time, limit int) ([]LocationClicks, error)
+	// GetTrendingComics returns up to limit SiteDefs whose clicks since the given time grew the most
+	// compared to the window of the same length before it
+	GetTrendingComics(since time.Time, limit int) ([]TrendingComic, error)
+}
+
+type UpdateImageStore interface {
+	// CreateUpdateImage records the given archived UpdateImage returning the id
+	CreateUpdateImage(img UpdateImage) (UpdateImageID, error)
+	// GetUpdateImages returns the archived UpdateImages of the given SiteUpdate in page order
+	GetUpdateImages(id SiteUpdateID) ([]UpdateImage, error)
+	// GetUpdateImageByHash returns the first UpdateImage archived with the given hash, or sql.ErrNoRows
+	GetUpdateImageByHash(hash string) (UpdateImage, error)
+}
+
+type BackfillStore interface {
+	// CreateBackfill creates a Backfill for the given SiteDef from the URL, MaxPages and DatedBefore of b,
+	// replacing any earlier Backfill of the SiteDef
+	CreateBackfill(b Backfill) error
+	// GetBackfill returns the Backfill of the given SiteDef, or sql.ErrNoRows
+	GetBackfill(id SiteDefID) (Backfill, error)
+	// ClaimNextBackfill atomically leases the oldest Backfill that has not ended and holds no live lease to
+	// workerID for the given duration. Returns sql.ErrNoRows if there is nothing to claim.
+	ClaimNextBackfill(workerID string, lease time.Duration) (Backfill, error)
+	// RenewBackfillLease extends the lease workerID holds on the Backfill of the given SiteDef to the given
+	// duration from now. Returns ErrLeaseLost if the Backfill has ended or is leased to another worker.
+	RenewBackfillLease(id SiteDefID, workerID string, lease time.Duration) error
+	// SaveBackfillProgress records the URL, Pages and Seen of b. Returns ErrLeaseLost if the Backfill
+	// has ended or is leased to a worker other than b.WorkerID.
+	SaveBackfillProgress(b Backfill) error
+	// EndBackfill sets ended_at to the current time for the Backfill of the given SiteDef and records backfillErr
+	EndBackfill(id SiteDefID, backfillErr error) error
 }
 
 type Conn interface {
@@ -70,3 +210,20 @@ type Conn interface {
 }
 
 var _ Conn = (*sqlx.DB)(nil)
+
+// Open connects to the database given by dsn. DSNs beginning with sqlite: or file: open a
+// SQLite database, e.g. sqlite:freshcomics.db; anything else is passed to the Postgres driver.
+func Open(dsn string) (*sqlx.DB, error) {
+	if isSQLiteDSN(dsn) {
+		return openSQLite(dsn)
+	}
+	return sqlx.Connect("postgres", dsn)
+}
+
+// New returns the Store implementation matching the driver of conn, which should be opened with Open
+func New(conn *sqlx.DB, geoIP ipinfo.IPInfoer) (Store, error) {
+	if conn.DriverName() == sqliteDriver {
+		return NewSQLiteStore(conn, geoIP)
+	}
+	return NewPGStore(conn, geoIP)
+}
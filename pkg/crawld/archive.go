@@ -0,0 +1,81 @@
+package crawld
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// archiveImages downloads the images of the given newly persisted SiteUpdate into the image archive
+// and records them. Failures are logged rather than failing the crawl, since the update was found.
+func (d *CrawlDaemon) archiveImages(def store.SiteDef, su store.SiteUpdate) {
+	if d.archive == nil {
+		return
+	}
+
+	logWithID := log.WithField("site_update_id", su.ID)
+	for i, imageURL := range su.ImageURLs {
+		img, err := d.archiveImage(def, imageURL)
+		if err != nil {
+			logWithID.WithError(err).WithField("image_url", imageURL).Warn("archiving image")
+			continue
+		}
+
+		img.UpdateID = su.ID
+		img.Position = i
+		if _, err := d.images.CreateUpdateImage(img); err != nil {
+			logWithID.WithError(err).WithField("image_url", imageURL).Error("recording archived image")
+			continue
+		}
+		logWithID.WithField("hash", img.Hash).Debug("archived image")
+	}
+}
+
+// archiveImage fetches the image at imageURL and stores it in the image archive
+func (d *CrawlDaemon) archiveImage(def store.SiteDef, imageURL string) (store.UpdateImage, error) {
+	data, err := d.fetchImage(def, imageURL)
+	if err != nil {
+		return store.UpdateImage{}, errors.Wrap(err, "fetching image")
+	}
+
+	img, err := inspectImage(data)
+	if err != nil {
+		return store.UpdateImage{}, err
+	}
+	img.URL = imageURL
+	img.ArchivedAt = d.now()
+
+	if err := d.archive.Put(context.Background(), img.Hash, data, img.MIMEType); err != nil {
+		return store.UpdateImage{}, errors.Wrap(err, "storing image")
+	}
+	return img, nil
+}
+
+// inspectImage returns the hash, MIME type, size and, for GIF, JPEG and PNG, dimensions of the given image
+func inspectImage(data []byte) (store.UpdateImage, error) {
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return store.UpdateImage{}, errors.Errorf("not an image: %s", mimeType)
+	}
+
+	img := store.UpdateImage{
+		Hash:     blob.Key(data),
+		MIMEType: mimeType,
+		Size:     int64(len(data)),
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img.Width = cfg.Width
+		img.Height = cfg.Height
+	}
+	return img, nil
+}
@@ -0,0 +1,254 @@
+package crawld
+
+import (
+	"database/sql"
+	"regexp"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/parser"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoPrevPageRule is returned by NewBackfill for a SiteDef that can't be walked backwards
+var ErrNoPrevPageRule = errors.New("site def has no previous page rule")
+
+// NewBackfill returns a Backfill of the given SiteDef that crawls at most maxPages pages, or back to the
+// first page if maxPages is zero. It starts from the SiteDef's BackfillURL, or its StartURL if that is empty,
+// and dates the updates it finds before the oldest update seen so far.
+func NewBackfill(updates store.SiteUpdateStore, def store.SiteDef, maxPages int) (store.Backfill, error) {
+	if def.PrevPageXPath == "" {
+		return store.Backfill{}, ErrNoPrevPageRule
+	}
+
+	b := store.Backfill{
+		SiteDefID:   def.ID,
+		URL:         def.BackfillURL,
+		MaxPages:    maxPages,
+		DatedBefore: time.Now(),
+	}
+	if b.URL == "" {
+		b.URL = def.StartURL
+	}
+
+	seen, err := updates.GetSiteUpdates(def.ID)
+	if err != nil {
+		return store.Backfill{}, errors.Wrap(err, "fetching site updates")
+	}
+	for _, su := range seen {
+		if su.SeenAt.Before(b.DatedBefore) {
+			b.DatedBefore = su.SeenAt
+		}
+	}
+
+	return b, nil
+}
+
+func (d *CrawlDaemon) doBackfillsForever() {
+	defer d.wg.Done()
+	if d.config.BackfillWorkers <= 0 {
+		log.Info("not running backfills")
+		return
+	}
+
+	for {
+		select {
+		case <-d.stop:
+			log.Info("stopping backfills")
+			return
+		case <-time.After(time.Duration(d.config.WorkPollIntervalSecs) * time.Second):
+		}
+
+		if err := d.dispatchBackfillsOnce(); err != nil {
+			log.WithError(err).Error("fetching pending backfills")
+		}
+	}
+}
+
+// dispatchBackfillsOnce claims pending Backfills and hands them to new workers until BackfillWorkers
+// backfills are in flight. Backfills don't count towards Workers or MaxCrawlsPerHost, so a long backfill
+// doesn't hold up update checks; the fetcher still spaces out requests to the same host.
+func (d *CrawlDaemon) dispatchBackfillsOnce() error {
+	for {
+		d.mu.Lock()
+		free := d.backfilling < d.config.BackfillWorkers
+		d.mu.Unlock()
+		if !free {
+			return nil
+		}
+
+		b, err := d.backfills.ClaimNextBackfill(d.config.WorkerID, d.lease)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		d.backfilling++
+		d.mu.Unlock()
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer func() {
+				d.mu.Lock()
+				d.backfilling--
+				d.mu.Unlock()
+			}()
+
+			done := make(chan struct{})
+			defer close(done)
+			go d.keepLease(log.WithField("site_def_id", b.SiteDefID), "backfill", done, func() error {
+				return d.backfills.RenewBackfillLease(b.SiteDefID, d.config.WorkerID, d.lease)
+			})
+
+			d.doBackfill(b)
+		}()
+	}
+}
+
+// doBackfill walks the given Backfill and ends it once it is finished or fails. A Backfill that is
+// interrupted because crawld is stopping is left for a worker to pick up once its lease runs out.
+func (d *CrawlDaemon) doBackfill(b store.Backfill) {
+	logWithID := log.WithField("site_def_id", b.SiteDefID)
+	logWithID.WithField("current_page", b.URL).Info("starting backfill")
+
+	finished, backfillErr := d.walkBackfill(&b)
+	if !finished {
+		logWithID.WithField("current_page", b.URL).Info("pausing backfill")
+		return
+	}
+
+	if backfillErr != nil {
+		logWithID.WithError(backfillErr).Info("backfill error")
+	}
+	if err := d.backfills.EndBackfill(b.SiteDefID, backfillErr); err != nil {
+		logWithID.WithError(err).Error("marking backfill completed")
+		return
+	}
+	logWithID.WithFields(log.Fields{"pages": b.Pages, "seen": b.Seen}).Info("finished backfill")
+}
+
+// walkBackfill crawls pages of the given Backfill one at a time, following the previous page rule of its
+// SiteDef and saving its progress after each page. Returns false if the Backfill was interrupted rather
+// than finished, either because crawld is stopping or because another worker took over its lease.
+func (d *CrawlDaemon) walkBackfill(b *store.Backfill) (bool, error) {
+	logWithID := log.WithField("site_def_id", b.SiteDefID)
+
+	def, err := d.siteDefs.GetSiteDef(b.SiteDefID)
+	if err != nil {
+		return true, errors.Wrap(err, "fetching site def")
+	}
+
+	refExpr, err := regexp.Compile(def.RefRegexp)
+	if err != nil {
+		return true, errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
+	}
+
+	// backfills are rate limited separately from update checks, which should not wait on them
+	if def.FetchDelaySecs < d.config.BackfillDelaySecs {
+		def.FetchDelaySecs = d.config.BackfillDelaySecs
+	}
+
+	for {
+		if b.MaxPages > 0 && b.Pages >= b.MaxPages {
+			logWithID.WithField("pages", b.Pages).Info("backfill reached max pages")
+			return true, nil
+		}
+
+		select {
+		case <-d.stop:
+			return false, nil
+		default:
+		}
+
+		finished, pageErr := d.backfillPage(def, refExpr, b)
+		if err := d.backfills.SaveBackfillProgress(*b); err == store.ErrLeaseLost {
+			logWithID.Warn("lost lease on backfill")
+			return false, nil
+		} else if err != nil {
+			logWithID.WithError(err).Error("saving backfill progress")
+		}
+
+		if finished || pageErr != nil {
+			return true, pageErr
+		}
+	}
+}
+
+// backfillPage crawls the current page of the given Backfill, persisting a SiteUpdate if it was not seen
+// before, and moves the Backfill on to the previous page. Returns true once there are no more pages to crawl:
+// there is no previous page, or the page was seen before and the Backfill has already found new ones,
+// meaning that it has caught up with an earlier crawl. Pages seen before any new one are passed over, as
+// the latest pages have usually been crawled already.
+func (d *CrawlDaemon) backfillPage(def store.SiteDef, refExpr *regexp.Regexp, b *store.Backfill) (bool, error) {
+	logWithID := log.WithField("site_def_id", b.SiteDefID)
+
+	var page crawledPage
+	var err error
+	if b.Pages == 0 && len(refExpr.FindStringSubmatch(b.URL)) < 2 {
+		// the homepage shows the latest comic without its ref, so it only leads to the previous page
+		page, err = d.extractPage(def, b.URL)
+	} else {
+		page, err = d.crawlPage(def, refExpr, b.URL)
+	}
+	if err != nil {
+		return true, err
+	}
+	b.Pages++
+
+	if page.Ref != "" {
+		if page.TitleErr != nil {
+			return true, page.TitleErr
+		}
+
+		if page.MediaErr != nil {
+			logWithID.WithError(page.MediaErr).WithField("current_page", b.URL).Warn("extracting media")
+		}
+
+		newUpdate := store.SiteUpdate{
+			SiteDefID: b.SiteDefID,
+			URL:       page.URL,
+			Ref:       page.Ref,
+			Title:     page.Title,
+			SeenAt:    b.DatedBefore.Add(-time.Duration(b.Seen+1) * time.Second),
+			ImageURLs: page.ImageURLs,
+			AltText:   page.AltText,
+		}
+		if page.PublishedAt != nil {
+			newUpdate.PublishedAt = pq.NullTime{Time: *page.PublishedAt, Valid: true}
+		}
+
+		created, err := d.persistUpdate(def, newUpdate)
+		if err != nil {
+			logWithID.WithError(err).Error("persisting site update")
+			return true, err
+		}
+		if created {
+			b.Seen++
+		} else if b.Seen > 0 {
+			logWithID.WithField("current_page", b.URL).Info("backfill reached a page seen before")
+			return true, nil
+		}
+	}
+
+	if errors.Is(page.PrevErr, parser.ErrNoMatch) {
+		logWithID.WithField("current_page", b.URL).Info("no previous page")
+		return true, nil
+	}
+
+	if page.PrevErr != nil {
+		return true, page.PrevErr
+	}
+
+	if page.PrevURL == b.URL {
+		logWithID.WithField("current_page", b.URL).Info("previous page links to current page")
+		return true, nil
+	}
+
+	b.URL = page.PrevURL
+	return false, nil
+}
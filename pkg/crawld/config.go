@@ -8,10 +8,33 @@ type Config struct {
 	DSN                  string `default:"host=localhost user=freshcomics password=freshcomics_password dbname=freshcomicsdb sslmode=disable"`
 	UserAgent            string `default:"freshcomics/crawld"`
 	FetchTimeoutSecs     int    `default:"3"`
+	FetchCacheSize       int    `default:"1000"` // pages kept for conditional requests
+	FetchRetries         int    `default:"2"`    // retries of a fetch failing with a transport error, 429 or 5xx
+	FetchRetryWaitSecs   int    `default:"1"`    // wait before the first retry, doubling with each one after
+	HostDelaySecs        int    `default:"1"`    // least time between requests to the same host
+	IgnoreRobots         bool   `default:"false"`
 	CheckIntervalSecs    int    `default:"3600"`
+	MinCheckIntervalSecs int    `default:"600"`
+	MaxCheckIntervalSecs int    `default:"172800"`
 	WorkPollIntervalSecs int    `default:"10"`
 	ScheduleIntervalSecs int    `default:"60"`
+	Workers              int    `default:"4"`
+	MaxCrawlsPerHost     int    `default:"1"`
+	WorkerID             string // defaults to hostname-pid
+	LeaseSecs            int    `default:"300"`
+	CrawlTimeoutSecs     int    `default:"3600"`
+	MaxFailures          int    `default:"8"` // 0 never deactivates failing SiteDefs
 	LogCallerTrace       bool   `default:"false"`
+	ArchiveImages        bool   `default:"false"`  // download the images of new updates into the image archive
+	ImageDir             string `default:"images"` // image archive directory, unless ImageS3Endpoint is set
+	ImageS3Endpoint      string // S3-compatible API keeping the image archive, e.g. http://localhost:9000
+	ImageS3Bucket        string // bucket of the image archive on ImageS3Endpoint
+	ImageS3Region        string `default:"us-east-1"`
+	ImageS3AccessKey     string
+	ImageS3SecretKey     string
+	MaxImageBytes        int64 `default:"20971520"` // larger images are not archived
+	BackfillWorkers      int   `default:"1"`        // backfills run at once by this instance, 0 runs none
+	BackfillDelaySecs    int   `default:"10"`       // least time between requests to the same host while backfilling
 }
 
 func NewConfig() (Config, error) {
@@ -0,0 +1,260 @@
+package crawld
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/feed"
+	"github.com/johnstcn/freshcomics/internal/fetch"
+	"github.com/johnstcn/freshcomics/internal/parser"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/pkg/errors"
+)
+
+// siteCrawler fetches and extracts pages and feeds for SiteDefs without persisting anything
+type siteCrawler struct {
+	fetcher       fetch.Fetcher
+	maxImageBytes int64
+}
+
+func newSiteCrawler(cfg Config) *siteCrawler {
+	timeout := time.Duration(cfg.FetchTimeoutSecs) * time.Second
+	return &siteCrawler{
+		fetcher: fetch.New(&fetch.Args{
+			Client:       &http.Client{Timeout: timeout},
+			UserAgent:    cfg.UserAgent,
+			CacheSize:    cfg.FetchCacheSize,
+			Retries:      cfg.FetchRetries,
+			Wait:         time.Duration(cfg.FetchRetryWaitSecs) * time.Second,
+			HostDelay:    time.Duration(cfg.HostDelaySecs) * time.Second,
+			IgnoreRobots: cfg.IgnoreRobots,
+		}),
+		maxImageBytes: cfg.MaxImageBytes,
+	}
+}
+
+// crawledPage holds the values extracted from a single page of a SiteDef
+type crawledPage struct {
+	URL      string
+	Ref      string
+	Title    string
+	TitleErr error  // Error applying the title rule, if any
+	NextURL  string // URL of the next page, if found
+	NextErr  error  // Error applying the next page rule, if any
+	PrevURL  string // URL of the previous page, if the SiteDef has a previous page rule and it was found
+	PrevErr  error  // Error applying the previous page rule, if any
+
+	ImageURLs   []string   // Absolute URLs of the comic images, if the SiteDef has an image rule
+	AltText     string     // Hover or alt text of the comic, if the SiteDef has an alt text rule
+	PublishedAt *time.Time // Publication time of the page, if the SiteDef has a published rule
+	MediaErr    error      // Error applying the image, alt text or published rules, if any
+}
+
+// crawlPage fetches the page at pageURL and applies the rules of the given SiteDef.
+// Errors applying individual rules are returned as part of the crawledPage.
+func (c *siteCrawler) crawlPage(def store.SiteDef, refExpr *regexp.Regexp, pageURL string) (crawledPage, error) {
+	refResults := refExpr.FindStringSubmatch(pageURL)
+	if len(refResults) < 2 {
+		return crawledPage{URL: pageURL}, errors.Errorf("no match for ref regexp on page %q", pageURL)
+	}
+
+	page, err := c.extractPage(def, pageURL)
+	page.Ref = refResults[1]
+	return page, err
+}
+
+// extractPage fetches the page at pageURL and applies the rules of the given SiteDef, leaving the ref empty
+func (c *siteCrawler) extractPage(def store.SiteDef, pageURL string) (crawledPage, error) {
+	page := crawledPage{URL: pageURL}
+
+	body, err := c.fetch(def, pageURL)
+	if err != nil {
+		return page, errors.Wrapf(err, "fetching page %q", pageURL)
+	}
+
+	p, err := parser.NewParser(bytes.NewReader(body), pageURL)
+	if err != nil {
+		return page, errors.Wrapf(err, "parsing page %q", pageURL)
+	}
+
+	page.Title, page.TitleErr = applyRule(p, "title", titleRule(def))
+	nextRef, nextErr := applyRule(p, "next_page", nextPageRule(def))
+	if nextErr != nil {
+		page.NextErr = nextErr
+	} else {
+		page.NextURL = fmt.Sprintf(def.URLTemplate, nextRef)
+	}
+
+	if def.PrevPageXPath != "" {
+		prevRef, prevErr := applyRule(p, "prev_page", prevPageRule(def))
+		if prevErr != nil {
+			page.PrevErr = prevErr
+		} else {
+			page.PrevURL = fmt.Sprintf(def.URLTemplate, prevRef)
+		}
+	}
+
+	page.MediaErr = applyMediaRules(p, def, &page)
+
+	return page, nil
+}
+
+// applyMediaRules applies the optional image, alt text and published rules of the given SiteDef,
+// returning the first error. A page missing its media is still an update, so these don't fail the page.
+func applyMediaRules(p parser.Parser, def store.SiteDef, page *crawledPage) error {
+	var firstErr error
+	keep := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if def.ImageXPath != "" {
+		urls, err := p.ApplyAll(imageRule(def))
+		if err != nil {
+			keep(errors.Wrap(err, "image rule"))
+		}
+		page.ImageURLs = urls
+	}
+
+	if def.AltTextXPath != "" {
+		altText, err := applyRule(p, "alt_text", altTextRule(def))
+		if err != nil {
+			keep(err)
+		}
+		page.AltText = altText
+	}
+
+	if def.PublishedXPath != "" {
+		published, err := applyRule(p, "published", publishedRule(def))
+		if err != nil {
+			keep(err)
+		} else if at, err := time.ParseInLocation(def.PublishedFormat, published, time.UTC); err != nil {
+			keep(errors.Wrapf(err, "published rule: parsing %q", published))
+		} else {
+			page.PublishedAt = &at
+		}
+	}
+
+	return firstErr
+}
+
+// titleRule returns the rule extracting the title from a page of the given SiteDef
+func titleRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:   parser.SelectorType(def.SelectorType),
+		XPath:  def.TitleXPath,
+		Attr:   def.TitleAttr,
+		Filter: def.TitleRegexp,
+	}
+}
+
+// nextPageRule returns the rule extracting the ref of the next page from a page of the given SiteDef
+func nextPageRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:   parser.SelectorType(def.SelectorType),
+		XPath:  def.NextPageXPath,
+		Attr:   def.NextPageAttr,
+		Filter: def.RefRegexp,
+	}
+}
+
+// prevPageRule returns the rule extracting the ref of the previous page from a page of the given SiteDef
+func prevPageRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:   parser.SelectorType(def.SelectorType),
+		XPath:  def.PrevPageXPath,
+		Attr:   def.PrevPageAttr,
+		Filter: def.RefRegexp,
+	}
+}
+
+// imageRule returns the rule extracting the absolute URLs of the comic images from a page of the given SiteDef
+func imageRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:       parser.SelectorType(def.SelectorType),
+		XPath:      def.ImageXPath,
+		Attr:       def.ImageAttr,
+		Transforms: []parser.Transform{{Kind: parser.TransformResolveURL}},
+	}
+}
+
+// altTextRule returns the rule extracting the hover or alt text from a page of the given SiteDef
+func altTextRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:       parser.SelectorType(def.SelectorType),
+		XPath:      def.AltTextXPath,
+		Attr:       def.AltTextAttr,
+		Transforms: []parser.Transform{{Kind: parser.TransformTrim}},
+	}
+}
+
+// publishedRule returns the rule extracting the publication date from a page of the given SiteDef
+func publishedRule(def store.SiteDef) parser.Rule {
+	return parser.Rule{
+		Type:       parser.SelectorType(def.SelectorType),
+		XPath:      def.PublishedXPath,
+		Attr:       def.PublishedAttr,
+		Filter:     def.PublishedRegexp,
+		Transforms: []parser.Transform{{Kind: parser.TransformTrim}},
+	}
+}
+
+// applyRule applies the given rule to a parsed page, naming the rule in any error
+func applyRule(p parser.Parser, name string, r parser.Rule) (string, error) {
+	value, err := p.Apply(r)
+	if err != nil {
+		return "", errors.Wrapf(err, "%s rule", name)
+	}
+	return value, nil
+}
+
+// fetch returns the body of the page of the given SiteDef at the given URL, leaving at least the SiteDef's
+// FetchDelaySecs since the last request to the same host. Unchanged pages are answered from the fetcher's
+// cache after a conditional request.
+func (c *siteCrawler) fetch(def store.SiteDef, url string) ([]byte, error) {
+	return c.fetchWith(context.Background(), def, url)
+}
+
+// fetchImage returns the image of the given SiteDef at the given URL. Images are fetched once, so they
+// skip the cache, and fail if larger than maxImageBytes.
+func (c *siteCrawler) fetchImage(def store.SiteDef, url string) ([]byte, error) {
+	ctx := fetch.WithoutCache(context.Background())
+	if c.maxImageBytes > 0 {
+		ctx = fetch.WithMaxBytes(ctx, c.maxImageBytes)
+	}
+	return c.fetchWith(ctx, def, url)
+}
+
+func (c *siteCrawler) fetchWith(ctx context.Context, def store.SiteDef, url string) ([]byte, error) {
+	ctx = fetch.WithHostDelay(ctx, time.Duration(def.FetchDelaySecs)*time.Second)
+	p, err := c.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.ResponseCode != http.StatusOK && !p.NotModified {
+		return nil, errors.Errorf("unexpected status %d", p.ResponseCode)
+	}
+
+	return p.Body, nil
+}
+
+// fetchFeed fetches and parses the feed of the given SiteDef at the given URL
+func (c *siteCrawler) fetchFeed(def store.SiteDef, url string) ([]feed.Item, error) {
+	body, err := c.fetch(def, url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching feed %q", url)
+	}
+
+	items, err := feed.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing feed %q", url)
+	}
+
+	return items, nil
+}
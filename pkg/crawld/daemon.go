@@ -3,83 +3,149 @@ package crawld
 import (
 	"database/sql"
 	"fmt"
-	"net/http"
+	"hash/fnv"
 	"os"
 	"os/signal"
 	"regexp"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/parser"
+	"github.com/johnstcn/freshcomics/internal/schedule"
 	"github.com/johnstcn/freshcomics/internal/store"
-	"github.com/johnstcn/gocrawl/pkg/crawl"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-var errNoPendingWork = errors.New("no pending work")
+const (
+	// updateHistoryLimit is how many of a SiteDef's latest updates are used to predict its next one
+	updateHistoryLimit = 200
+	// hotWindow is how long after the start of an hour in which a comic usually updates it is polled more often
+	hotWindow = 2 * time.Hour
+)
 
-func New(cfg Config, store store.Store) (*CrawlDaemon, error) {
-	opts := crawl.CrawlerOpts{
-		Timeout: time.Duration(cfg.FetchTimeoutSecs) * time.Second,
+func New(cfg Config, s store.Store) (*CrawlDaemon, error) {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxCrawlsPerHost < 1 {
+		cfg.MaxCrawlsPerHost = 1
+	}
+	if cfg.LeaseSecs < 1 {
+		cfg.LeaseSecs = 1
+	}
+	if cfg.MinCheckIntervalSecs < 1 || cfg.MinCheckIntervalSecs > cfg.CheckIntervalSecs {
+		cfg.MinCheckIntervalSecs = cfg.CheckIntervalSecs
+	}
+	if cfg.MaxCheckIntervalSecs < cfg.CheckIntervalSecs {
+		cfg.MaxCheckIntervalSecs = cfg.CheckIntervalSecs
+	}
+	if cfg.WorkerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting hostname for worker id")
+		}
+		cfg.WorkerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	var archive blob.Store
+	if cfg.ArchiveImages {
+		var err error
+		archive, err = blob.New(&blob.Args{
+			Dir:       cfg.ImageDir,
+			Endpoint:  cfg.ImageS3Endpoint,
+			Bucket:    cfg.ImageS3Bucket,
+			Region:    cfg.ImageS3Region,
+			AccessKey: cfg.ImageS3AccessKey,
+			SecretKey: cfg.ImageS3SecretKey,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "opening image archive")
+		}
 	}
-
-	stopScheduler := make(chan bool)
-	stopWorker := make(chan bool)
 	return &CrawlDaemon{
-		stopScheduler: stopScheduler,
-		stopWorker:    stopWorker,
-		now:           time.Now,
-		exit:          os.Exit,
-		crawler:       crawl.New(opts),
-		config:        cfg,
-		siteDefs:      store,
-		siteUpdates:   store,
-		crawlInfos:    store,
+		siteCrawler: newSiteCrawler(cfg),
+		stop:        make(chan struct{}),
+		wake:        make(chan struct{}, 1),
+		inFlight:    make(map[store.CrawlInfoID]bool),
+		hosts:       make(map[string]int),
+		lease:       time.Duration(cfg.LeaseSecs) * time.Second,
+		now:         time.Now,
+		config:      cfg,
+		siteDefs:    s,
+		siteUpdates: s,
+		crawlInfos:  s,
+		images:      s,
+		backfills:   s,
+		archive:     archive,
 	}, nil
 }
 
 type CrawlDaemon struct {
-	stopScheduler chan bool
-	stopWorker    chan bool
-	now           func() time.Time
-	exit          func(status int)
-	crawler       crawl.Crawler
-	config        Config
-	siteDefs      store.SiteDefStore
-	siteUpdates   store.SiteUpdateStore
-	crawlInfos    store.CrawlInfoStore
+	*siteCrawler
+	stop        chan struct{}
+	wake        chan struct{} // signalled when a worker finishes so that its slot is refilled immediately
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	inFlight    map[store.CrawlInfoID]bool
+	hosts       map[string]int // number of in-flight crawls per origin
+	backfilling int            // number of in-flight backfills
+	lease       time.Duration
+	now         func() time.Time
+	config      Config
+	siteDefs    store.SiteDefStore
+	siteUpdates store.SiteUpdateStore
+	crawlInfos  store.CrawlInfoStore
+	images      store.UpdateImageStore
+	backfills   store.BackfillStore
+	archive     blob.Store // nil unless images are archived
 }
 
+// Run starts the daemon and blocks until SIGINT or SIGTERM is received, then waits for
+// in-flight crawls to finish before returning.
 func (d *CrawlDaemon) Run() error {
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch)
-	go d.handleSignals(ch)
-	go d.scheduleWorkForever()
-	go d.doWorkForever()
-	select {}
-	return nil
-}
-
-func (d *CrawlDaemon) handleSignals(ch <-chan os.Signal) {
+	d.Start()
 	for s := range ch {
 		if s == syscall.SIGINT || s == syscall.SIGTERM {
-			log.WithField("signal", s).Error("exiting on signal")
-			d.stopWorker <- true
-			d.stopScheduler <- true
-			d.exit(1)
-		} else {
-			log.WithField("signal", s).Info("ignoring signal")
+			log.WithField("signal", s).Info("shutting down, waiting for in-flight crawls")
+			d.Stop()
+			return nil
 		}
+		log.WithField("signal", s).Info("ignoring signal")
 	}
+	return nil
+}
+
+// Start abandons crawls left over from a previous run, then runs the scheduler, the worker pool and
+// the backfill workers in the background.
+func (d *CrawlDaemon) Start() {
+	d.abandonStaleCrawls()
+	d.wg.Add(3)
+	go d.scheduleWorkForever()
+	go d.doWorkForever()
+	go d.doBackfillsForever()
+}
+
+// Stop stops scheduling and picking up new work, and waits for in-flight crawls to finish. In-flight
+// backfills stop after their current page.
+func (d *CrawlDaemon) Stop() {
+	close(d.stop)
+	d.wg.Wait()
 }
 
 func (d *CrawlDaemon) scheduleWorkForever() {
+	defer d.wg.Done()
 	for {
 		select {
-		case <-d.stopScheduler:
-			log.Error("stopping scheduler")
+		case <-d.stop:
+			log.Info("stopping scheduler")
 			return
 		case <-time.After(time.Duration(d.config.ScheduleIntervalSecs) * time.Second):
+			d.abandonStaleCrawls()
 			if err := d.scheduleWorkOnce(); err != nil {
 				log.Println(err)
 			}
@@ -87,6 +153,20 @@ func (d *CrawlDaemon) scheduleWorkForever() {
 	}
 }
 
+// abandonStaleCrawls ends crawls that started more than CrawlTimeoutSecs ago and are not leased to a
+// running worker, such as those left behind by a crawld instance that died, so that their sites get scheduled again.
+func (d *CrawlDaemon) abandonStaleCrawls() {
+	startedBefore := d.now().Add(-time.Duration(d.config.CrawlTimeoutSecs) * time.Second)
+	n, err := d.crawlInfos.AbandonStaleCrawlInfos(startedBefore)
+	if err != nil {
+		log.WithError(err).Error("abandoning stale crawls")
+		return
+	}
+	if n > 0 {
+		log.WithField("count", n).Warn("abandoned stale crawls")
+	}
+}
+
 // TODO(cian): make this not terrible
 func (d *CrawlDaemon) scheduleWorkOnce() error {
 	pending, err := d.crawlInfos.GetPendingCrawlInfos()
@@ -121,10 +201,11 @@ func (d *CrawlDaemon) scheduleWorkOnce() error {
 			continue
 		}
 
-		lastURL, err := d.getLastURL(def)
+		lastURL, err := CrawlURL(d.siteDefs, def)
 		if err != nil {
 			logWithID.Debug("skipping scheduling")
 			logWithID.WithError(err).Error("fetch last URL")
+			continue
 		}
 
 		if _, err := d.crawlInfos.CreateCrawlInfo(def.ID, lastURL); err != nil {
@@ -135,8 +216,14 @@ func (d *CrawlDaemon) scheduleWorkOnce() error {
 	return nil
 }
 
-func (d *CrawlDaemon) getLastURL(def store.SiteDef) (string, error) {
-	lastURL, err := d.siteDefs.GetLastURL(def.ID)
+// CrawlURL returns the URL a new crawl of the given SiteDef starts from: its feed, or else the
+// last page seen, or its start URL if nothing has been seen yet.
+func CrawlURL(defs store.SiteDefStore, def store.SiteDef) (string, error) {
+	if def.CrawlStrategy == store.CrawlStrategyFeed {
+		return def.FeedURL, nil
+	}
+
+	lastURL, err := defs.GetLastURL(def.ID)
 	if err == sql.ErrNoRows {
 		return def.StartURL, nil
 	}
@@ -148,6 +235,7 @@ func (d *CrawlDaemon) getLastURL(def store.SiteDef) (string, error) {
 	return lastURL, nil
 }
 
+// shouldSchedule returns true if the given SiteDef is due a crawl, given its previous crawls newest first
 func (d *CrawlDaemon) shouldSchedule(def store.SiteDef, crawls []store.CrawlInfo) bool {
 	if len(crawls) == 0 {
 		return true
@@ -158,110 +246,253 @@ func (d *CrawlDaemon) shouldSchedule(def store.SiteDef, crawls []store.CrawlInfo
 		return false
 	}
 
-	lastCrawlTime := lastCrawl.EndedAt.Time
-	nextScheduleTime := lastCrawlTime.Add(time.Duration(d.config.CheckIntervalSecs) * time.Second)
-	return nextScheduleTime.After(d.now())
+	next, err := d.nextCrawlTime(def, crawls)
+	if err != nil {
+		log.WithField("site_def_id", def.ID).WithError(err).Error("computing next crawl time")
+		return false
+	}
+	return !d.now().Before(next)
+}
+
+// nextCrawlTime returns when the given SiteDef is next due a crawl after the last of the given crawls,
+// following its cron expression or crawl interval. If it has neither, the time is predicted from when
+// its updates were seen before and how many crawls in a row found nothing new.
+func (d *CrawlDaemon) nextCrawlTime(def store.SiteDef, crawls []store.CrawlInfo) (time.Time, error) {
+	lastCrawl := crawls[0]
+	var next time.Time
+	switch {
+	case def.CrawlCron != "":
+		c, err := schedule.ParseCron(def.CrawlCron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next = c.Next(lastCrawl.EndedAt.Time)
+		if next.IsZero() {
+			return time.Time{}, errors.Errorf("cron expression %q never matches", def.CrawlCron)
+		}
+	case def.CrawlIntervalSecs > 0:
+		next = lastCrawl.EndedAt.Time.Add(time.Duration(def.CrawlIntervalSecs) * time.Second)
+	default:
+		seen, err := d.siteUpdates.GetSiteUpdateTimes(def.ID, updateHistoryLimit)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "fetching update history")
+		}
+		a := schedule.Adaptive{
+			Base:      time.Duration(d.config.CheckIntervalSecs) * time.Second,
+			Min:       time.Duration(d.config.MinCheckIntervalSecs) * time.Second,
+			Max:       time.Duration(d.config.MaxCheckIntervalSecs) * time.Second,
+			HotWindow: hotWindow,
+		}
+		next = a.Next(lastCrawl.EndedAt.Time, seen, emptyCrawls(crawls))
+	}
+
+	// back off from a site that keeps failing, but never crawl it sooner than its schedule says
+	if n := failedCrawls(crawls); n > 0 {
+		base := time.Duration(d.config.CheckIntervalSecs) * time.Second
+		max := time.Duration(d.config.MaxCheckIntervalSecs) * time.Second
+		if retry := lastCrawl.EndedAt.Time.Add(schedule.Backoff(base, max, n)); retry.After(next) {
+			next = retry
+		}
+	}
+
+	return next.Add(crawlJitter(def, lastCrawl)), nil
+}
+
+// emptyCrawls returns the number of crawls in a row, newest first, that ended without seeing any updates.
+// Failed crawls are skipped: they say nothing about whether the comic has updated.
+func emptyCrawls(crawls []store.CrawlInfo) int {
+	n := 0
+	for _, ci := range crawls {
+		if !ci.EndedAt.Valid || ci.Error != "" {
+			continue
+		}
+		if ci.Seen > 0 {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// failedCrawls returns the number of crawls in a row, newest first, that ended with an error.
+// Abandoned crawls are skipped: they failed because of crawld rather than the site.
+func failedCrawls(crawls []store.CrawlInfo) int {
+	n := 0
+	for _, ci := range crawls {
+		if !ci.EndedAt.Valid || ci.Error == store.ErrCrawlAbandoned.Error() {
+			continue
+		}
+		if ci.Error == "" {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// crawlJitter returns a delay of up to CrawlJitterSecs for the crawl after lastCrawl. It is derived
+// from the ids rather than drawn at random so that it stays the same between scheduling passes.
+func crawlJitter(def store.SiteDef, lastCrawl store.CrawlInfo) time.Duration {
+	if def.CrawlJitterSecs <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d", def.ID, lastCrawl.ID)
+	return time.Duration(h.Sum64()%uint64(def.CrawlJitterSecs+1)) * time.Second
 }
 
 func (d *CrawlDaemon) doWorkForever() {
+	defer d.wg.Done()
 	for {
 		select {
-		case <-d.stopWorker:
-			log.Error("stopping worker")
+		case <-d.stop:
+			log.Info("stopping workers")
 			return
+		case <-d.wake:
 		case <-time.After(time.Duration(d.config.WorkPollIntervalSecs) * time.Second):
-			item, err := d.getWorkOnce()
-			if err == errNoPendingWork {
-				log.Debug(err)
-				continue
-			}
-			if err != nil {
-				log.WithError(err).Error("fetching pending work")
-				continue
-			}
+		}
+
+		if err := d.dispatchWorkOnce(); err != nil {
+			log.WithError(err).Error("fetching pending work")
+		}
+	}
+}
+
+// dispatchWorkOnce claims pending CrawlInfos and hands them to new workers until either all Workers
+// are busy or every remaining CrawlInfo is for an origin that already has MaxCrawlsPerHost crawls in flight.
+func (d *CrawlDaemon) dispatchWorkOnce() error {
+	for {
+		skip, ok := d.busyOrigins()
+		if !ok {
+			return nil
+		}
+
+		ci, err := d.crawlInfos.ClaimNextCrawlInfo(d.config.WorkerID, d.lease, skip)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		host := crawlHost(ci)
+		d.acquire(ci.ID, host)
+		log.WithField("work", ci).Debug("got work")
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer d.release(ci.ID, host)
+
+			done := make(chan struct{})
+			defer close(done)
+			go d.renewLeaseUntil(ci.ID, done)
 
-			log.WithField("work", item).Debug("got work")
-			if err := d.doWorkOnce(item); err != nil {
-				log.WithError(err).WithField("work", item).Error("doing work")
+			if err := d.doWorkOnce(&ci); err != nil {
+				log.WithError(err).WithField("work", ci).Error("doing work")
 			}
+		}()
+	}
+}
+
+// busyOrigins returns the origins that have MaxCrawlsPerHost crawls in flight, or false if no worker is free
+func (d *CrawlDaemon) busyOrigins() ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.inFlight) >= d.config.Workers {
+		return nil, false
+	}
+	busy := make([]string, 0)
+	for host, n := range d.hosts {
+		if n >= d.config.MaxCrawlsPerHost {
+			busy = append(busy, host)
 		}
 	}
+	return busy, true
 }
 
-func (d *CrawlDaemon) getWorkOnce() (*store.CrawlInfo, error) {
-	pending, err := d.crawlInfos.GetPendingCrawlInfos()
-	if err != nil {
-		return nil, err
+func (d *CrawlDaemon) acquire(id store.CrawlInfoID, host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inFlight[id] = true
+	d.hosts[host]++
+}
+
+func (d *CrawlDaemon) release(id store.CrawlInfoID, host string) {
+	d.mu.Lock()
+	delete(d.inFlight, id)
+	d.hosts[host]--
+	if d.hosts[host] == 0 {
+		delete(d.hosts, host)
 	}
+	d.mu.Unlock()
 
-	if len(pending) == 0 {
-		return nil, errNoPendingWork
+	select {
+	case d.wake <- struct{}{}:
+	default:
 	}
+}
 
-	return &pending[0], nil
+// renewLeaseUntil keeps renewing the lease on the given CrawlInfo until done is closed, so that
+// other crawld instances only pick it up again once this one has stopped working on it.
+func (d *CrawlDaemon) renewLeaseUntil(id store.CrawlInfoID, done <-chan struct{}) {
+	d.keepLease(log.WithField("crawl_id", id), "crawl", done, func() error {
+		return d.crawlInfos.RenewCrawlInfoLease(id, d.config.WorkerID, d.lease)
+	})
 }
 
-func (d *CrawlDaemon) makeCrawlJob(def store.SiteDef, url string) crawl.Job {
-	return crawl.Job{
-		Request: crawl.Request{
-			URL:     url,
-			Method:  http.MethodGet,
-			Headers: map[string]string{"User-Agent": d.config.UserAgent},
-			Body:    "",
-		},
-		Rules: []crawl.Rule{
-			{
-				Name:  "next_page",
-				XPath: def.NextPageXPath,
-				Filters: []crawl.Filter{
-					{
-						Find:    def.RefRegexp,
-						Replace: "$1",
-					},
-				},
-			},
-			{
-				Name:  "title",
-				XPath: def.TitleXPath,
-				Filters: []crawl.Filter{
-					{
-						Find:    def.TitleRegexp,
-						Replace: "$1",
-					},
-				},
-			},
-		},
+// keepLease calls renew every third of the lease until done is closed or the lease is lost
+func (d *CrawlDaemon) keepLease(logWithID *log.Entry, what string, done <-chan struct{}, renew func() error) {
+	ticker := time.NewTicker(d.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := renew()
+			if err == store.ErrLeaseLost {
+				logWithID.Warn("lost lease on " + what)
+				return
+			}
+			if err != nil {
+				logWithID.WithError(err).Error("renewing lease on " + what)
+			}
+		}
 	}
 }
 
+// crawlHost returns the origin the given CrawlInfo is going to be fetched from
+func crawlHost(ci store.CrawlInfo) string {
+	return store.Origin(ci.URL)
+}
+
 func (d *CrawlDaemon) doWorkOnce(ci *store.CrawlInfo) error {
-	// fetch last URL
-	// loop
-	// 	 parse page
-	// 	 check if persisted
-	// 	 persist
-	// 	 check for next page result
-	//   break if no result
 	var seen int
 	var crawlErr error
-	var currentURL = ci.URL
 
 	logWithID := log.WithField("crawl_id", ci.ID)
 
-	if err := d.crawlInfos.StartCrawlInfo(ci.ID); err != nil {
-		logWithID.WithError(err).Error("marking crawl started")
-	} else {
-		logWithID.WithField("current_page", currentURL).Info("starting crawl")
-	}
+	logWithID.WithField("current_page", ci.URL).Info("starting crawl")
 
 	defer func() {
 		if crawlErr != nil {
-			logWithID.WithField("current_page", currentURL).WithError(crawlErr).Info("crawl error")
+			logWithID.WithError(crawlErr).Info("crawl error")
 		}
 
-		if err := d.crawlInfos.EndCrawlInfo(ci.ID, crawlErr, seen); err != nil {
+		if err := d.crawlInfos.EndCrawlInfo(ci.ID, d.config.WorkerID, crawlErr, seen); err == store.ErrLeaseLost {
+			// another worker has claimed the crawl since, and will end it itself
+			logWithID.Warn("lost lease on crawl")
+			return
+		} else if err != nil {
 			logWithID.WithError(err).Error("marking crawl completed)")
 		}
+
+		if crawlErr != nil {
+			d.markBrokenIfFailing(ci.SiteDefID, crawlErr)
+		}
 	}()
 
 	def, err := d.siteDefs.GetSiteDef(ci.SiteDefID)
@@ -269,81 +500,136 @@ func (d *CrawlDaemon) doWorkOnce(ci *store.CrawlInfo) error {
 		return errors.Wrap(err, "fetching site def")
 	}
 
-	refExpr, err := regexp.Compile(def.RefRegexp)
+	switch def.CrawlStrategy {
+	case store.CrawlStrategyFeed:
+		seen, crawlErr = d.crawlFeed(ci, def)
+	default:
+		seen, crawlErr = d.crawlPages(ci, def)
+	}
+
+	return nil
+}
+
+// markBrokenIfFailing deactivates the given SiteDef once MaxFailures of its crawls in a row have failed,
+// recording the latest error so that an admin can see what needs fixing.
+func (d *CrawlDaemon) markBrokenIfFailing(id store.SiteDefID, crawlErr error) {
+	if d.config.MaxFailures <= 0 {
+		return
+	}
+
+	logWithID := log.WithField("site_def_id", id)
+	crawls, err := d.crawlInfos.GetCrawlInfo(id)
 	if err != nil {
-		crawlErr = errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
-		return nil
+		logWithID.WithError(err).Error("fetching previous crawls")
+		return
 	}
 
-	for {
-		refResults := refExpr.FindStringSubmatch(currentURL)
-		if len(refResults) == 0 {
-			crawlErr = fmt.Errorf("no match for ref regexp")
-			return nil
-		}
-		newRef := refResults[1]
+	n := failedCrawls(crawls)
+	if n < d.config.MaxFailures {
+		return
+	}
 
-		crawlJob := d.makeCrawlJob(def, currentURL)
-		result, crawlErr := d.crawler.Crawl(crawlJob)
-		if crawlErr != nil {
-			return errors.Wrapf(crawlErr, "fetching page %q", crawlJob.Request.URL)
-		}
+	reason := fmt.Sprintf("%d crawls in a row failed, the last with: %v", n, crawlErr)
+	if err := d.siteDefs.MarkSiteDefBroken(id, reason); err != nil {
+		logWithID.WithError(err).Error("marking site def broken")
+		return
+	}
+	logWithID.WithField("failures", n).Warn("deactivated broken site def")
+}
 
-		titleResult, found := result["title"]
-		if !found {
-			crawlErr = errors.New("no output for title rule")
-			return nil
-		}
+// crawlPages walks pages of the given SiteDef starting from the CrawlInfo URL,
+// persisting a SiteUpdate for each page not seen before.
+func (d *CrawlDaemon) crawlPages(ci *store.CrawlInfo, def store.SiteDef) (int, error) {
+	// loop
+	// 	 parse page
+	// 	 check if persisted
+	// 	 persist
+	// 	 check for next page result
+	//   break if no result
+	var seen int
+	var currentURL = ci.URL
 
-		if titleResult.Error != "" {
-			crawlErr = errors.New(titleResult.Error)
-			return nil
+	logWithID := log.WithField("crawl_id", ci.ID)
+
+	refExpr, err := regexp.Compile(def.RefRegexp)
+	if err != nil {
+		return seen, errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
+	}
+
+	for {
+		page, err := d.crawlPage(def, refExpr, currentURL)
+		if err != nil {
+			return seen, err
 		}
 
-		if len(titleResult.Values) == 0 {
-			crawlErr = errors.New("no matches for title Xpath")
-			return nil
+		if page.TitleErr != nil {
+			return seen, page.TitleErr
 		}
 
-		newTitle := titleResult.Values[0]
+		if page.MediaErr != nil {
+			logWithID.WithError(page.MediaErr).WithField("current_page", currentURL).Warn("extracting media")
+		}
 
 		newUpdate := store.SiteUpdate{
 			SiteDefID: ci.SiteDefID,
-			URL:       currentURL,
-			Ref:       newRef,
-			Title:     newTitle,
+			URL:       page.URL,
+			Ref:       page.Ref,
+			Title:     page.Title,
 			SeenAt:    d.now(),
+			ImageURLs: page.ImageURLs,
+			AltText:   page.AltText,
+		}
+		if page.PublishedAt != nil {
+			newUpdate.PublishedAt = pq.NullTime{Time: *page.PublishedAt, Valid: true}
 		}
 
-		if _, found, err := d.siteUpdates.GetSiteUpdate(ci.SiteDefID, newRef); found {
-			logWithID.WithField("ref", newRef).Info("already persisted")
-		} else if err != nil {
-			logWithID.WithError(err).Error("checking if site update already persisted")
-		} else if _, err := d.siteUpdates.CreateSiteUpdate(newUpdate); err != nil {
+		created, err := d.persistUpdate(def, newUpdate)
+		if err != nil {
 			logWithID.WithError(err).Error("persisting site update")
-			return err
-		} else {
-			logWithID.WithField("update", newUpdate).Info("persisted new update")
-			seen += 1
+			return seen, err
+		}
+		if created {
+			seen++
 		}
 
-		nextpageResult, found := result["next_page"]
-		if !found {
-			crawlErr = errors.New("no output for next page rule")
-			return nil
+		if errors.Is(page.NextErr, parser.ErrNoMatch) {
+			logWithID.WithField("current_page", currentURL).Info("no next page")
+			return seen, nil
 		}
 
-		if nextpageResult.Error != "" {
-			crawlErr = errors.New(nextpageResult.Error)
-			return nil
+		if page.NextErr != nil {
+			return seen, page.NextErr
 		}
 
-		if len(nextpageResult.Values) == 0 {
-			crawlErr = errors.New("no matches for ref Xpath")
-			return nil
+		if page.NextURL == currentURL {
+			logWithID.WithField("current_page", currentURL).Info("next page links to current page")
+			return seen, nil
 		}
 
-		newRef = nextpageResult.Values[0]
-		currentURL = fmt.Sprintf(def.URLTemplate, newRef)
+		currentURL = page.NextURL
+	}
+}
+
+// persistUpdate persists the given SiteUpdate of the given SiteDef unless one with the same ref already exists,
+// archiving its images if enabled. Returns true if a new SiteUpdate was created, and false without an error
+// only if it was already persisted.
+func (d *CrawlDaemon) persistUpdate(def store.SiteDef, su store.SiteUpdate) (bool, error) {
+	logWithID := log.WithField("site_def_id", su.SiteDefID)
+
+	if _, found, err := d.siteUpdates.GetSiteUpdate(su.SiteDefID, su.Ref); found {
+		logWithID.WithField("ref", su.Ref).Info("already persisted")
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "checking if site update already persisted")
 	}
+
+	id, err := d.siteUpdates.CreateSiteUpdate(su)
+	if err != nil {
+		return false, err
+	}
+	su.ID = id
+
+	logWithID.WithField("update", su).Info("persisted new update")
+	d.archiveImages(def, su)
+	return true, nil
 }
@@ -0,0 +1,1013 @@
+package crawld
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/blob"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlDaemon_EndToEnd(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 3)
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, CheckIntervalSecs: 3600}, s)
+	require.NoError(t, err)
+
+	require.NoError(t, d.scheduleWorkOnce())
+	pending, err := s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, defID, pending[0].SiteDefID)
+	assert.Equal(t, def.StartURL, pending[0].URL)
+
+	// already pending, so nothing new is scheduled
+	require.NoError(t, d.scheduleWorkOnce())
+	pending, err = s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	require.NoError(t, d.dispatchWorkOnce())
+	d.wg.Wait()
+
+	updates, err := s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	require.Len(t, updates, 3)
+	refs := []string{updates[0].Ref, updates[1].Ref, updates[2].Ref}
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, refs)
+
+	crawls, err := s.GetCrawlInfo(defID)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.True(t, crawls[0].StartedAt.Valid)
+	assert.True(t, crawls[0].EndedAt.Valid)
+	assert.Empty(t, crawls[0].Error, "reaching the latest page is not an error")
+	assert.Equal(t, 3, crawls[0].Seen)
+
+	def.ID = defID
+	lastURL, err := CrawlURL(s, def)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/comic/3", lastURL)
+
+	pending, err = s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestCrawlDaemon_Media(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 2)
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	def.ImageXPath = `//img[@class="comic"]`
+	def.ImageAttr = "src"
+	def.AltTextXPath = `//img[@class="comic"]`
+	def.AltTextAttr = "title"
+	def.PublishedXPath = "//time"
+	def.PublishedAttr = "datetime"
+	def.PublishedFormat = time.RFC3339
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1}, s)
+	require.NoError(t, err)
+	_, err = s.CreateCrawlInfo(defID, def.StartURL)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchWorkOnce())
+	d.wg.Wait()
+
+	su, found, err := s.GetSiteUpdate(defID, "2")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, store.StringList{srv.URL + "/img/2.png"}, su.ImageURLs)
+	assert.Equal(t, "Hover 2", su.AltText)
+	assert.True(t, su.PublishedAt.Valid)
+	assert.Equal(t, time.Date(2024, 3, 2, 5, 0, 0, 0, time.UTC), su.PublishedAt.Time)
+
+	comics, err := s.GetComics()
+	require.NoError(t, err)
+	require.Len(t, comics, 1)
+	assert.Equal(t, su.ImageURLs, comics[0].ImageURLs)
+	assert.Equal(t, "Hover 2", comics[0].AltText)
+}
+
+// newTestFeedServer returns a server with an RSS feed at /feed.xml listing its items newest first.
+// Items whose link starts with / are made absolute. Further items can be published with the returned func.
+func newTestFeedServer(t *testing.T, items ...string) (*httptest.Server, func(string)) {
+	t.Helper()
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, `<rss><channel>`)
+		for i := len(items) - 1; i >= 0; i-- {
+			fmt.Fprint(w, strings.ReplaceAll(items[i], "<link>/", "<link>http://"+r.Host+"/"))
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, func(item string) {
+		mu.Lock()
+		defer mu.Unlock()
+		items = append(items, item)
+	}
+}
+
+func TestCrawlDaemon_Feed(t *testing.T) {
+	t.Parallel()
+
+	srv, publish := newTestFeedServer(t,
+		`<item><title>Page 1</title><link>/comic/1</link><guid>guid-1</guid></item>`,
+		`<item><title>Extra</title><link>/extra/guid</link><guid>guid-extra</guid></item>`,
+		`<item><title>No Link</title><guid>guid-nolink</guid></item>`,
+		`<item><title>Sketch</title><link>/extra/sketch</link></item>`,
+	)
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	def.CrawlStrategy = store.CrawlStrategyFeed
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+
+	crawlURL, err := CrawlURL(s, def)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/feed.xml", crawlURL)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1}, s)
+	require.NoError(t, err)
+	crawl := func() store.CrawlInfo {
+		t.Helper()
+		_, err := s.CreateCrawlInfo(defID, crawlURL)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchWorkOnce())
+		d.wg.Wait()
+		crawls, err := s.GetCrawlInfo(defID)
+		require.NoError(t, err)
+		require.NotEmpty(t, crawls)
+		return crawls[0]
+	}
+
+	ci := crawl()
+	assert.Empty(t, ci.Error)
+	assert.Equal(t, 3, ci.Seen)
+
+	// items are persisted oldest first, so the newest is the latest update. Refs come from the ref
+	// regexp, then the item ID, then the link; items without a link are skipped.
+	updates, err := s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	refs := make([]string, 0, len(updates))
+	for _, su := range updates {
+		refs = append(refs, su.Ref)
+	}
+	assert.Equal(t, []string{srv.URL + "/extra/sketch", "guid-extra", "1"}, refs)
+	comics, err := s.GetComics()
+	require.NoError(t, err)
+	require.Len(t, comics, 1)
+	assert.Equal(t, "Sketch", comics[0].Title)
+
+	// items seen before are not persisted again
+	publish(`<item><title>Page 2</title><link>/comic/2</link><guid>guid-2</guid></item>`)
+	ci = crawl()
+	assert.Empty(t, ci.Error)
+	assert.Equal(t, 1, ci.Seen)
+	updates, err = s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	require.Len(t, updates, 4)
+	assert.Equal(t, "2", updates[0].Ref)
+}
+
+func TestCrawlDaemon_FeedFallback(t *testing.T) {
+	t.Parallel()
+
+	// a SiteDef without a crawl strategy crawls pages, even if it has a feed
+	srv := newTestComicServer(t, 2)
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	def.CrawlStrategy = ""
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+
+	crawlURL, err := CrawlURL(s, def)
+	require.NoError(t, err)
+	assert.Equal(t, def.StartURL, crawlURL)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1}, s)
+	require.NoError(t, err)
+	_, err = s.CreateCrawlInfo(defID, crawlURL)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchWorkOnce())
+	d.wg.Wait()
+
+	updates, err := s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.Equal(t, srv.URL+"/comic/2", updates[0].URL)
+}
+
+func TestCrawlDaemon_ArchiveImages(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 2)
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	// the second image is missing, which shouldn't stop the first being archived
+	def.ImageXPath = "//img"
+	def.ImageAttr = "src"
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, ArchiveImages: true, ImageDir: dir, MaxImageBytes: 1 << 20}, s)
+	require.NoError(t, err)
+	_, err = s.CreateCrawlInfo(defID, def.StartURL)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchWorkOnce())
+	d.wg.Wait()
+
+	crawls, err := s.GetCrawlInfo(defID)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.Empty(t, crawls[0].Error)
+	assert.Equal(t, 2, crawls[0].Seen)
+
+	su, found, err := s.GetSiteUpdate(defID, "1")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Len(t, su.ImageURLs, 2)
+	images, err := s.GetUpdateImages(su.ID)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	img := images[0]
+	assert.Equal(t, 0, img.Position)
+	assert.Equal(t, srv.URL+"/img/1.png", img.URL)
+	assert.Equal(t, "image/png", img.MIMEType)
+	assert.Equal(t, 100, img.Width)
+	assert.Equal(t, 50, img.Height)
+
+	archive, err := blob.New(&blob.Args{Dir: dir})
+	require.NoError(t, err)
+	rc, err := archive.Open(context.Background(), img.Hash)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, img.Hash, blob.Key(data))
+	assert.EqualValues(t, len(data), img.Size)
+}
+
+func TestInspectImage(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 3, 2), color.Palette{color.Black}), nil))
+	img, err := inspectImage(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "image/gif", img.MIMEType)
+	assert.Equal(t, 3, img.Width)
+	assert.Equal(t, 2, img.Height)
+	assert.Equal(t, blob.Key(buf.Bytes()), img.Hash)
+
+	_, err = inspectImage([]byte("<html><body>Not Found</body></html>"))
+	assert.ErrorContains(t, err, "not an image")
+}
+
+func TestCrawlDaemon_NotModified(t *testing.T) {
+	t.Parallel()
+
+	comics := newTestComicServer(t, 2)
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + r.URL.Path + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		comics.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, FetchCacheSize: 10}, s)
+	require.NoError(t, err)
+
+	crawl := func() store.CrawlInfo {
+		t.Helper()
+		crawlURL, err := CrawlURL(s, def)
+		require.NoError(t, err)
+		_, err = s.CreateCrawlInfo(defID, crawlURL)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchWorkOnce())
+		d.wg.Wait()
+		crawls, err := s.GetCrawlInfo(defID)
+		require.NoError(t, err)
+		return crawls[0]
+	}
+
+	first := crawl()
+	assert.Empty(t, first.Error)
+	assert.Equal(t, 2, first.Seen)
+	assert.Equal(t, int32(2), full.Load())
+
+	// the second crawl starts from the latest page, which hasn't changed
+	second := crawl()
+	assert.Empty(t, second.Error)
+	assert.Zero(t, second.Seen)
+	assert.Equal(t, int32(2), full.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestCrawlDaemon_RobotsDisallowed(t *testing.T) {
+	t.Parallel()
+
+	comics := newTestComicServer(t, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: test\nDisallow: /comic/3\n")
+			return
+		}
+		comics.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := store.NewMemStore(nil)
+	def := newTestSiteDef(srv.URL)
+	def.ID = 0
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1}, s)
+	require.NoError(t, err)
+	_, err = s.CreateCrawlInfo(defID, def.StartURL)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchWorkOnce())
+	d.wg.Wait()
+
+	crawls, err := s.GetCrawlInfo(defID)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.Contains(t, crawls[0].Error, "disallowed by robots.txt")
+	assert.Equal(t, 2, crawls[0].Seen)
+}
+
+// newSlowServer returns a server that serves the same single page for every path and takes delay to respond,
+// and a func reporting the highest number of requests it has served concurrently.
+func newSlowServer(t *testing.T, delay time.Duration) (*httptest.Server, func() int32) {
+	t.Helper()
+	var cur, max atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := cur.Add(1)
+		defer cur.Add(-1)
+		for {
+			m := max.Load()
+			if n <= m || max.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		fmt.Fprint(w, `<html><head><title>Page 1</title></head><body></body></html>`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, max.Load
+}
+
+// newSlowSiteDef returns the i-th of several SiteDefs for a server from newSlowServer
+func newSlowSiteDef(srvURL string, i int) store.SiteDef {
+	prefix := fmt.Sprintf("%s/%d", srvURL, i)
+	def := newTestSiteDef(prefix)
+	def.ID = 0
+	def.Name = fmt.Sprintf("Test Comic %d", i)
+	def.FeedURL = ""
+	return def
+}
+
+func TestCrawlDaemon_WorkerPool(t *testing.T) {
+	t.Parallel()
+
+	srvA, maxA := newSlowServer(t, 50*time.Millisecond)
+	srvB, _ := newSlowServer(t, 50*time.Millisecond)
+	s := store.NewMemStore(nil)
+	for i, srvURL := range []string{srvA.URL, srvA.URL, srvB.URL} {
+		def := newSlowSiteDef(srvURL, i)
+		id, err := s.CreateSiteDef(def)
+		require.NoError(t, err)
+		_, err = s.CreateCrawlInfo(id, def.StartURL)
+		require.NoError(t, err)
+	}
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, Workers: 4, MaxCrawlsPerHost: 1}, s)
+	require.NoError(t, err)
+
+	// only one crawl per origin is started even though there are free workers
+	require.NoError(t, d.dispatchWorkOnce())
+	d.mu.Lock()
+	assert.Len(t, d.inFlight, 2)
+	assert.Equal(t, map[string]int{srvA.URL: 1, srvB.URL: 1}, d.hosts)
+	d.mu.Unlock()
+
+	// dispatching again while they are running does not pick up the same work twice
+	require.NoError(t, d.dispatchWorkOnce())
+	d.mu.Lock()
+	assert.Len(t, d.inFlight, 2)
+	d.mu.Unlock()
+
+	// Stop waits for the in-flight crawls
+	d.Stop()
+	d.mu.Lock()
+	assert.Empty(t, d.inFlight)
+	assert.Empty(t, d.hosts)
+	d.mu.Unlock()
+	pending, err := s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, srvA.URL+"/1/comic/1", pending[0].URL)
+
+	d.stop = make(chan struct{})
+	require.NoError(t, d.dispatchWorkOnce())
+	d.Stop()
+	pending, err = s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.Equal(t, int32(1), maxA())
+}
+
+func TestCrawlDaemon_WorkerLimit(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newSlowServer(t, 50*time.Millisecond)
+	s := store.NewMemStore(nil)
+	for i := 0; i < 3; i++ {
+		def := newSlowSiteDef(srv.URL, i)
+		id, err := s.CreateSiteDef(def)
+		require.NoError(t, err)
+		_, err = s.CreateCrawlInfo(id, def.StartURL)
+		require.NoError(t, err)
+	}
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, Workers: 2, MaxCrawlsPerHost: 5}, s)
+	require.NoError(t, err)
+
+	require.NoError(t, d.dispatchWorkOnce())
+	d.mu.Lock()
+	assert.Len(t, d.inFlight, 2)
+	d.mu.Unlock()
+	d.Stop()
+}
+
+func TestCrawlDaemon_Claim(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newSlowServer(t, 150*time.Millisecond)
+	s := store.NewMemStore(nil)
+	def := newSlowSiteDef(srv.URL, 0)
+	id, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	_, err = s.CreateCrawlInfo(id, def.StartURL)
+	require.NoError(t, err)
+
+	d1, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, WorkerID: "d1"}, s)
+	require.NoError(t, err)
+	d1.lease = 30 * time.Millisecond
+	d2, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, WorkerID: "d2"}, s)
+	require.NoError(t, err)
+
+	// a crawl claimed by one daemon is not picked up by another, even after its
+	// initial lease would have expired, as long as the first one is still crawling
+	require.NoError(t, d1.dispatchWorkOnce())
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, d2.dispatchWorkOnce())
+	d1.Stop()
+	d2.Stop()
+
+	assert.Empty(t, d2.inFlight)
+	crawls, err := s.GetCrawlInfo(id)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.Equal(t, "d1", crawls[0].WorkerID)
+	assert.True(t, crawls[0].EndedAt.Valid)
+	assert.Equal(t, 1, crawls[0].Seen)
+}
+
+func TestCrawlDaemon_AbandonStaleCrawls(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemStore(nil)
+	def := newSlowSiteDef("http://example.com", 0)
+	id, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	// a crawl started by a crawld that died before ending it
+	orphan, err := s.CreateCrawlInfo(id, def.StartURL)
+	require.NoError(t, err)
+	require.NoError(t, s.StartCrawlInfo(orphan))
+
+	d, err := New(Config{UserAgent: "test", CheckIntervalSecs: 3600, CrawlTimeoutSecs: 3600}, s)
+	require.NoError(t, err)
+
+	// not stale yet, so the site is still considered to be crawling
+	d.abandonStaleCrawls()
+	require.NoError(t, d.scheduleWorkOnce())
+	crawls, err := s.GetCrawlInfo(id)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.False(t, crawls[0].EndedAt.Valid)
+
+	d.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	d.abandonStaleCrawls()
+	crawls, err = s.GetCrawlInfo(id)
+	require.NoError(t, err)
+	require.Len(t, crawls, 1)
+	assert.True(t, crawls[0].EndedAt.Valid)
+	assert.Equal(t, store.ErrCrawlAbandoned.Error(), crawls[0].Error)
+
+	// the abandoned crawl is now the site's last crawl, which ended over CheckIntervalSecs ago
+	require.NoError(t, d.scheduleWorkOnce())
+	pending, err := s.GetPendingCrawlInfos()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, id, pending[0].SiteDefID)
+}
+
+func newBackfillSiteDef(srvURL string) store.SiteDef {
+	def := newTestSiteDef(srvURL)
+	def.ID = 0
+	def.PrevPageXPath = `//a[@rel="prev"]/@href`
+	def.BackfillURL = srvURL + "/"
+	return def
+}
+
+func TestCrawlDaemon_Backfill(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 5)
+	s := store.NewMemStore(nil)
+	def := newBackfillSiteDef(srv.URL)
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+	// the site was added with its latest pages as the start URL
+	for _, ref := range []string{"4", "5"} {
+		_, err = s.CreateSiteUpdate(store.SiteUpdate{SiteDefID: defID, URL: srv.URL + "/comic/" + ref, Ref: ref, Title: "Page " + ref})
+		require.NoError(t, err)
+	}
+
+	b, err := NewBackfill(s, def, 0)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/", b.URL)
+	require.NoError(t, s.CreateBackfill(b))
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1}, s)
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchBackfillsOnce())
+	d.wg.Wait()
+
+	b, err = s.GetBackfill(defID)
+	require.NoError(t, err)
+	require.NotNil(t, b.EndedAt)
+	assert.Empty(t, b.Error, "reaching the first page is not an error")
+	// the homepage, the latest pages seen before, and the three new ones
+	assert.Equal(t, 5, b.Pages)
+	assert.Equal(t, 3, b.Seen)
+	assert.Equal(t, srv.URL+"/comic/1", b.URL)
+
+	updates, err := s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	require.Len(t, updates, 5)
+	refs := make([]string, 0, len(updates))
+	for _, su := range updates {
+		refs = append(refs, su.Ref)
+	}
+	assert.Equal(t, []string{"5", "4", "3", "2", "1"}, refs, "backfilled updates should be dated before the others")
+
+	// backfilling doesn't move on update checks
+	lastURL, err := CrawlURL(s, def)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/comic/5", lastURL)
+}
+
+func TestCrawlDaemon_BackfillStops(t *testing.T) {
+	t.Parallel()
+
+	t.Run("SeenBefore", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 5)
+		s := store.NewMemStore(nil)
+		def := newBackfillSiteDef(srv.URL)
+		defID, err := s.CreateSiteDef(def)
+		require.NoError(t, err)
+		def.ID = defID
+		// an earlier crawl forwards from page 2 that hasn't caught up
+		_, err = s.CreateSiteUpdate(store.SiteUpdate{SiteDefID: defID, URL: srv.URL + "/comic/2", Ref: "2", Title: "Page 2"})
+		require.NoError(t, err)
+
+		b, err := NewBackfill(s, def, 0)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateBackfill(b))
+		d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1}, s)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchBackfillsOnce())
+		d.wg.Wait()
+
+		b, err = s.GetBackfill(defID)
+		require.NoError(t, err)
+		require.NotNil(t, b.EndedAt)
+		assert.Empty(t, b.Error)
+		// the homepage only leads to the latest page, which is left to update checks
+		assert.Equal(t, 2, b.Seen)
+		assert.Equal(t, srv.URL+"/comic/2", b.URL)
+		_, found, err := s.GetSiteUpdate(defID, "1")
+		require.NoError(t, err)
+		assert.False(t, found, "pages before one seen before should not be crawled")
+	})
+
+	t.Run("MaxPages", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 5)
+		s := store.NewMemStore(nil)
+		def := newBackfillSiteDef(srv.URL)
+		defID, err := s.CreateSiteDef(def)
+		require.NoError(t, err)
+		def.ID = defID
+
+		b, err := NewBackfill(s, def, 3)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateBackfill(b))
+		d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1}, s)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchBackfillsOnce())
+		d.wg.Wait()
+
+		b, err = s.GetBackfill(defID)
+		require.NoError(t, err)
+		require.NotNil(t, b.EndedAt)
+		assert.Equal(t, 3, b.Pages)
+		assert.Equal(t, 2, b.Seen)
+		updates, err := s.GetSiteUpdates(defID)
+		require.NoError(t, err)
+		assert.Len(t, updates, 2)
+	})
+
+	t.Run("BrokenRule", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 2)
+		s := store.NewMemStore(nil)
+		def := newBackfillSiteDef(srv.URL)
+		def.PrevPageXPath = `//a[`
+		defID, err := s.CreateSiteDef(def)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateBackfill(store.Backfill{SiteDefID: defID, URL: def.BackfillURL, DatedBefore: time.Now()}))
+
+		d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1}, s)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchBackfillsOnce())
+		d.wg.Wait()
+
+		b, err := s.GetBackfill(defID)
+		require.NoError(t, err)
+		require.NotNil(t, b.EndedAt)
+		assert.NotEmpty(t, b.Error)
+	})
+}
+
+// failingLookupStore fails to look up SiteUpdates
+type failingLookupStore struct {
+	store.Store
+}
+
+func (failingLookupStore) GetSiteUpdate(store.SiteDefID, string) (store.SiteUpdate, bool, error) {
+	return store.SiteUpdate{}, false, errors.New("connection reset")
+}
+
+func TestCrawlDaemon_BackfillLookupError(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 3)
+	s := store.NewMemStore(nil)
+	def := newBackfillSiteDef(srv.URL)
+	def.BackfillURL = srv.URL + "/comic/3"
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+	b, err := NewBackfill(s, def, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateBackfill(b))
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1}, failingLookupStore{s})
+	require.NoError(t, err)
+	require.NoError(t, d.dispatchBackfillsOnce())
+	d.wg.Wait()
+
+	// a failed lookup is not mistaken for a page seen before
+	b, err = s.GetBackfill(defID)
+	require.NoError(t, err)
+	require.NotNil(t, b.EndedAt)
+	assert.Contains(t, b.Error, "connection reset")
+	assert.Zero(t, b.Seen)
+	updates, err := s.GetSiteUpdates(defID)
+	require.NoError(t, err)
+	assert.Empty(t, updates)
+}
+
+func TestCrawlDaemon_BackfillResume(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestComicServer(t, 3)
+	s := store.NewMemStore(nil)
+	def := newBackfillSiteDef(srv.URL)
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+	b, err := NewBackfill(s, def, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateBackfill(b))
+
+	// a backfill interrupted by crawld stopping is left unfinished
+	d1, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1, WorkerID: "d1"}, s)
+	require.NoError(t, err)
+	d1.lease = 30 * time.Millisecond
+	d1.Stop()
+	require.NoError(t, d1.dispatchBackfillsOnce())
+	d1.wg.Wait()
+	b, err = s.GetBackfill(defID)
+	require.NoError(t, err)
+	assert.Nil(t, b.EndedAt)
+	assert.Equal(t, "d1", b.WorkerID)
+
+	// and picked up by another worker once its lease runs out
+	d2, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, BackfillWorkers: 1, WorkerID: "d2"}, s)
+	require.NoError(t, err)
+	require.NoError(t, d2.dispatchBackfillsOnce())
+	d2.wg.Wait()
+	b, err = s.GetBackfill(defID)
+	require.NoError(t, err)
+	assert.Nil(t, b.EndedAt, "lease still held")
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, d2.dispatchBackfillsOnce())
+	d2.wg.Wait()
+	b, err = s.GetBackfill(defID)
+	require.NoError(t, err)
+	require.NotNil(t, b.EndedAt)
+	assert.Equal(t, "d2", b.WorkerID)
+	assert.Equal(t, 2, b.Seen)
+}
+
+func TestNewBackfill(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemStore(nil)
+	def := newBackfillSiteDef("http://example.com")
+	def.BackfillURL = ""
+	_, err := NewBackfill(s, store.SiteDef{StartURL: def.StartURL}, 0)
+	assert.ErrorIs(t, err, ErrNoPrevPageRule)
+
+	defID, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+	def.ID = defID
+	b, err := NewBackfill(s, def, 10)
+	require.NoError(t, err)
+	assert.Equal(t, def.StartURL, b.URL)
+	assert.Equal(t, 10, b.MaxPages)
+	assert.WithinDuration(t, time.Now(), b.DatedBefore, time.Minute)
+
+	earliest := time.Now().Add(-48 * time.Hour)
+	for _, seenAt := range []time.Time{time.Now().Add(-time.Hour), earliest} {
+		_, err = s.CreateSiteUpdate(store.SiteUpdate{SiteDefID: defID, URL: seenAt.String(), Ref: seenAt.String(), SeenAt: seenAt})
+		require.NoError(t, err)
+	}
+	b, err = NewBackfill(s, def, 0)
+	require.NoError(t, err)
+	assert.True(t, b.DatedBefore.Equal(earliest))
+}
+
+func TestCrawlDaemon_ShouldSchedule(t *testing.T) {
+	t.Parallel()
+
+	// a Saturday
+	ended := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	endedCrawl := []store.CrawlInfo{{ID: 1, EndedAt: pq.NullTime{Time: ended, Valid: true}}}
+	for _, tc := range []struct {
+		name   string
+		def    store.SiteDef
+		crawls []store.CrawlInfo
+		now    time.Time
+		want   bool
+	}{
+		{"NeverCrawled", store.SiteDef{}, nil, ended, true},
+		{"Crawling", store.SiteDef{}, []store.CrawlInfo{{ID: 1, StartedAt: pq.NullTime{Time: ended, Valid: true}}}, ended.Add(48 * time.Hour), false},
+		{"DefaultIntervalNotDue", store.SiteDef{}, endedCrawl, ended.Add(59 * time.Minute), false},
+		{"DefaultIntervalDue", store.SiteDef{}, endedCrawl, ended.Add(time.Hour), true},
+		{"IntervalNotDue", store.SiteDef{CrawlIntervalSecs: 86400}, endedCrawl, ended.Add(23 * time.Hour), false},
+		{"IntervalDue", store.SiteDef{CrawlIntervalSecs: 86400}, endedCrawl, ended.Add(24 * time.Hour), true},
+		{"CronNotDue", store.SiteDef{CrawlCron: "0 5 * * 1,3,5"}, endedCrawl, time.Date(2024, 3, 4, 4, 59, 0, 0, time.UTC), false},
+		{"CronDue", store.SiteDef{CrawlCron: "0 5 * * 1,3,5"}, endedCrawl, time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC), true},
+		{"JitterNotDue", store.SiteDef{CrawlIntervalSecs: 60, CrawlJitterSecs: 600}, endedCrawl, ended.Add(time.Minute).Add(crawlJitter(store.SiteDef{CrawlJitterSecs: 600}, endedCrawl[0]) - time.Second), false},
+		{"JitterDue", store.SiteDef{CrawlIntervalSecs: 60, CrawlJitterSecs: 600}, endedCrawl, ended.Add(11 * time.Minute), true},
+		{"BadCron", store.SiteDef{CrawlCron: "nope"}, endedCrawl, ended.Add(48 * time.Hour), false},
+		{"BackoffNotDue", store.SiteDef{}, emptyRun(ended, 4), ended.Add(8*time.Hour - time.Second), false},
+		{"BackoffDue", store.SiteDef{}, emptyRun(ended, 4), ended.Add(8 * time.Hour), true},
+		{"BackoffMax", store.SiteDef{}, emptyRun(ended, 20), ended.Add(48 * time.Hour), true},
+		{"FailingNotDue", store.SiteDef{CrawlIntervalSecs: 60}, failedRun(ended, 3), ended.Add(4*time.Hour - time.Second), false},
+		{"FailingDue", store.SiteDef{CrawlIntervalSecs: 60}, failedRun(ended, 3), ended.Add(4 * time.Hour), true},
+		{"FailingScheduleLater", store.SiteDef{CrawlIntervalSecs: 86400}, failedRun(ended, 3), ended.Add(23 * time.Hour), false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d, err := New(Config{CheckIntervalSecs: 3600, MinCheckIntervalSecs: 600, MaxCheckIntervalSecs: 172800, WorkerID: "test"}, store.NewMemStore(nil))
+			require.NoError(t, err)
+			d.now = func() time.Time { return tc.now }
+			assert.Equal(t, tc.want, d.shouldSchedule(tc.def, tc.crawls))
+		})
+	}
+}
+
+// emptyRun returns n crawls that found nothing, newest first, the latest of which ended at ended
+func emptyRun(ended time.Time, n int) []store.CrawlInfo {
+	crawls := make([]store.CrawlInfo, 0, n)
+	for i := 0; i < n; i++ {
+		crawls = append(crawls, store.CrawlInfo{
+			ID:      store.CrawlInfoID(n - i),
+			EndedAt: pq.NullTime{Time: ended.Add(-time.Duration(i) * time.Hour), Valid: true},
+		})
+	}
+	return crawls
+}
+
+// failedRun returns n crawls that failed, newest first, the latest of which ended at ended
+func failedRun(ended time.Time, n int) []store.CrawlInfo {
+	crawls := emptyRun(ended, n)
+	for i := range crawls {
+		crawls[i].Error = "boom"
+	}
+	return crawls
+}
+
+func TestCrawlDaemon_ShouldSchedule_HotHour(t *testing.T) {
+	t.Parallel()
+
+	s := store.NewMemStore(nil)
+	defID, err := s.CreateSiteDef(newTestSiteDef("http://example.com"))
+	require.NoError(t, err)
+	// updates seen at 05:20 UTC on Mondays, Wednesdays and Fridays for six weeks
+	monday := time.Date(2024, 1, 1, 5, 20, 0, 0, time.UTC)
+	for w := 0; w < 6; w++ {
+		for _, day := range []int{0, 2, 4} {
+			_, err := s.CreateSiteUpdate(store.SiteUpdate{
+				SiteDefID: defID,
+				Ref:       fmt.Sprintf("%d-%d", w, day),
+				URL:       fmt.Sprintf("http://example.com/%d-%d", w, day),
+				SeenAt:    monday.AddDate(0, 0, 7*w+day),
+			})
+			require.NoError(t, err)
+		}
+	}
+	def, err := s.GetSiteDef(defID)
+	require.NoError(t, err)
+
+	d, err := New(Config{CheckIntervalSecs: 3600, MinCheckIntervalSecs: 600, MaxCheckIntervalSecs: 172800, WorkerID: "test"}, s)
+	require.NoError(t, err)
+
+	// Saturday evening after a long run of empty crawls: backed off until Monday 05:00 UTC
+	ended := time.Date(2024, 3, 2, 20, 0, 0, 0, time.UTC)
+	crawls := emptyRun(ended, 10)
+	d.now = func() time.Time { return time.Date(2024, 3, 4, 4, 59, 0, 0, time.UTC) }
+	assert.False(t, d.shouldSchedule(def, crawls))
+	d.now = func() time.Time { return time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC) }
+	assert.True(t, d.shouldSchedule(def, crawls))
+
+	// within the hot window it is polled every MinCheckIntervalSecs
+	crawls = emptyRun(time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC), 10)
+	d.now = func() time.Time { return time.Date(2024, 3, 4, 5, 9, 0, 0, time.UTC) }
+	assert.False(t, d.shouldSchedule(def, crawls))
+	d.now = func() time.Time { return time.Date(2024, 3, 4, 5, 10, 0, 0, time.UTC) }
+	assert.True(t, d.shouldSchedule(def, crawls))
+}
+
+func TestFailedCrawls(t *testing.T) {
+	t.Parallel()
+
+	ended := pq.NullTime{Time: time.Now(), Valid: true}
+	assert.Equal(t, 0, failedCrawls(nil))
+	assert.Equal(t, 2, failedCrawls([]store.CrawlInfo{
+		{},
+		{EndedAt: ended, Error: "boom"},
+		{EndedAt: ended, Error: store.ErrCrawlAbandoned.Error()},
+		{EndedAt: ended, Error: "boom"},
+		{EndedAt: ended},
+		{EndedAt: ended, Error: "boom"},
+	}))
+	assert.Equal(t, 0, failedCrawls([]store.CrawlInfo{{EndedAt: ended}, {EndedAt: ended, Error: "boom"}}))
+}
+
+func TestCrawlDaemon_MarkBroken(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	s := store.NewMemStore(nil)
+	def := newSlowSiteDef(srv.URL, 0)
+	id, err := s.CreateSiteDef(def)
+	require.NoError(t, err)
+
+	d, err := New(Config{UserAgent: "test", FetchTimeoutSecs: 1, MaxFailures: 2}, s)
+	require.NoError(t, err)
+
+	crawl := func() {
+		t.Helper()
+		_, err := s.CreateCrawlInfo(id, def.StartURL)
+		require.NoError(t, err)
+		require.NoError(t, d.dispatchWorkOnce())
+		d.wg.Wait()
+	}
+
+	crawl()
+	got, err := s.GetSiteDef(id)
+	require.NoError(t, err)
+	assert.True(t, got.Active)
+	assert.Empty(t, got.BrokenReason)
+
+	crawl()
+	got, err = s.GetSiteDef(id)
+	require.NoError(t, err)
+	assert.False(t, got.Active)
+	assert.Contains(t, got.BrokenReason, "2 crawls in a row failed")
+
+	crawls, err := s.GetCrawlInfo(id)
+	require.NoError(t, err)
+	require.Len(t, crawls, 2)
+	assert.NotEmpty(t, crawls[0].Error)
+}
+
+func TestEmptyCrawls(t *testing.T) {
+	t.Parallel()
+
+	ended := pq.NullTime{Time: time.Now(), Valid: true}
+	assert.Equal(t, 0, emptyCrawls(nil))
+	assert.Equal(t, 2, emptyCrawls([]store.CrawlInfo{
+		{EndedAt: ended},
+		{EndedAt: ended, Error: "boom"},
+		{EndedAt: ended},
+		{EndedAt: ended, Seen: 3},
+		{EndedAt: ended},
+	}))
+	assert.Equal(t, 0, emptyCrawls([]store.CrawlInfo{{EndedAt: ended, Seen: 1}, {EndedAt: ended}}))
+}
+
+func TestCrawlJitter(t *testing.T) {
+	t.Parallel()
+
+	def := store.SiteDef{ID: 1, CrawlJitterSecs: 600}
+	seen := make(map[time.Duration]bool)
+	for id := store.CrawlInfoID(1); id <= 20; id++ {
+		j := crawlJitter(def, store.CrawlInfo{ID: id})
+		assert.Equal(t, j, crawlJitter(def, store.CrawlInfo{ID: id}), "jitter should be stable")
+		assert.GreaterOrEqual(t, j, time.Duration(0))
+		assert.LessOrEqual(t, j, 600*time.Second)
+		seen[j] = true
+	}
+	assert.Greater(t, len(seen), 1, "jitter should vary between crawls")
+	assert.Zero(t, crawlJitter(store.SiteDef{ID: 1}, store.CrawlInfo{ID: 1}))
+}
@@ -0,0 +1,83 @@
+package crawld
+
+import (
+	"regexp"
+
+	"github.com/johnstcn/freshcomics/internal/feed"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// crawlFeed reads the RSS or Atom feed of the given SiteDef, persisting a SiteUpdate
+// for each feed item not seen before.
+func (d *CrawlDaemon) crawlFeed(ci *store.CrawlInfo, def store.SiteDef) (int, error) {
+	var seen int
+
+	feedURL := ci.URL
+	if feedURL == "" {
+		feedURL = def.FeedURL
+	}
+
+	logWithID := log.WithField("crawl_id", ci.ID).WithField("feed_url", feedURL)
+
+	refExpr, err := regexp.Compile(def.RefRegexp)
+	if err != nil {
+		return seen, errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
+	}
+
+	items, err := d.fetchFeed(def, feedURL)
+	if err != nil {
+		return seen, err
+	}
+
+	if len(items) == 0 {
+		return seen, errors.New("no items in feed")
+	}
+
+	// Feeds list the newest items first, so persist them oldest first.
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if item.Link == "" {
+			logWithID.WithField("item", item).Debug("skipping feed item without link")
+			continue
+		}
+
+		newUpdate := store.SiteUpdate{
+			SiteDefID: ci.SiteDefID,
+			URL:       item.Link,
+			Ref:       feedItemRef(refExpr, item),
+			Title:     item.Title,
+			SeenAt:    d.now(),
+		}
+		if !item.Published.IsZero() {
+			newUpdate.PublishedAt = pq.NullTime{Time: item.Published, Valid: true}
+		}
+
+		created, err := d.persistUpdate(def, newUpdate)
+		if err != nil {
+			logWithID.WithError(err).Error("persisting site update")
+			return seen, err
+		}
+		if created {
+			seen++
+		}
+	}
+
+	return seen, nil
+}
+
+// feedItemRef extracts the ref for a feed item by applying the ref regexp to its link.
+// Falls back to the item ID and then the link itself if the regexp does not match.
+func feedItemRef(refExpr *regexp.Regexp, item feed.Item) string {
+	if match := refExpr.FindStringSubmatch(item.Link); len(match) > 1 && match[1] != "" {
+		return match[1]
+	}
+
+	if item.ID != "" {
+		return item.ID
+	}
+
+	return item.Link
+}
@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/johnstcn/freshcomics/pkg/crawld (interfaces: Previewer)
+
+// Package mock_crawld is a generated GoMock package.
+package mock_crawld
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	store "github.com/johnstcn/freshcomics/internal/store"
+	crawld "github.com/johnstcn/freshcomics/pkg/crawld"
+)
+
+// MockPreviewer is a mock of Previewer interface.
+type MockPreviewer struct {
+	ctrl     *gomock.Controller
+	recorder *MockPreviewerMockRecorder
+}
+
+// MockPreviewerMockRecorder is the mock recorder for MockPreviewer.
+type MockPreviewerMockRecorder struct {
+	mock *MockPreviewer
+}
+
+// NewMockPreviewer creates a new mock instance.
+func NewMockPreviewer(ctrl *gomock.Controller) *MockPreviewer {
+	mock := &MockPreviewer{ctrl: ctrl}
+	mock.recorder = &MockPreviewerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPreviewer) EXPECT() *MockPreviewerMockRecorder {
+	return m.recorder
+}
+
+// Preview mocks base method.
+func (m *MockPreviewer) Preview(arg0 store.SiteDef, arg1 int) ([]crawld.PreviewPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Preview", arg0, arg1)
+	ret0, _ := ret[0].([]crawld.PreviewPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Preview indicates an expected call of Preview.
+func (mr *MockPreviewerMockRecorder) Preview(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Preview", reflect.TypeOf((*MockPreviewer)(nil).Preview), arg0, arg1)
+}
@@ -0,0 +1,134 @@
+package crawld
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/pkg/errors"
+)
+
+//go:generate mockgen -destination mocks/previewer.go . Previewer
+
+const (
+	// DefaultPreviewPages is the number of pages previewed if not specified
+	DefaultPreviewPages = 5
+	// MaxPreviewPages is the maximum number of pages that may be previewed at once
+	MaxPreviewPages = 20
+)
+
+// PreviewPage holds the values extracted from a single page during a preview
+type PreviewPage struct {
+	URL      string `json:"url"`
+	Ref      string `json:"ref"`
+	Title    string `json:"title"`
+	NextPage string `json:"next_page"`
+	PrevPage string `json:"prev_page,omitempty"`
+	Error    string `json:"error"`
+
+	ImageURLs   []string   `json:"image_urls,omitempty"`
+	AltText     string     `json:"alt_text,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+// Previewer crawls a candidate SiteDef without persisting anything
+type Previewer interface {
+	// Preview crawls up to maxPages pages of the given SiteDef starting from its StartURL
+	Preview(def store.SiteDef, maxPages int) ([]PreviewPage, error)
+}
+
+var _ Previewer = (*siteCrawler)(nil)
+
+// NewPreviewer returns a Previewer using the UserAgent and FetchTimeoutSecs of the given Config
+func NewPreviewer(cfg Config) Previewer {
+	return newSiteCrawler(cfg)
+}
+
+// Preview implements Previewer.Preview
+func (c *siteCrawler) Preview(def store.SiteDef, maxPages int) ([]PreviewPage, error) {
+	if maxPages <= 0 {
+		maxPages = DefaultPreviewPages
+	}
+	if maxPages > MaxPreviewPages {
+		maxPages = MaxPreviewPages
+	}
+
+	refExpr, err := regexp.Compile(def.RefRegexp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
+	}
+
+	if def.CrawlStrategy == store.CrawlStrategyFeed {
+		return c.previewFeed(def, refExpr, maxPages)
+	}
+
+	return c.previewPages(def, refExpr, maxPages), nil
+}
+
+func (c *siteCrawler) previewPages(def store.SiteDef, refExpr *regexp.Regexp, maxPages int) []PreviewPage {
+	pages := make([]PreviewPage, 0, maxPages)
+	visited := make(map[string]bool)
+	currentURL := def.StartURL
+
+	for len(pages) < maxPages && !visited[currentURL] {
+		visited[currentURL] = true
+		page, err := c.crawlPage(def, refExpr, currentURL)
+		preview := PreviewPage{
+			URL:      page.URL,
+			Ref:      page.Ref,
+			Title:    page.Title,
+			NextPage: page.NextURL,
+			PrevPage: page.PrevURL,
+
+			ImageURLs:   page.ImageURLs,
+			AltText:     page.AltText,
+			PublishedAt: page.PublishedAt,
+		}
+
+		for _, e := range []error{err, page.TitleErr, page.NextErr, page.MediaErr} {
+			if e != nil {
+				preview.Error = e.Error()
+				break
+			}
+		}
+
+		pages = append(pages, preview)
+		if err != nil || page.NextErr != nil {
+			break
+		}
+
+		currentURL = page.NextURL
+	}
+
+	return pages
+}
+
+func (c *siteCrawler) previewFeed(def store.SiteDef, refExpr *regexp.Regexp, maxPages int) ([]PreviewPage, error) {
+	items, err := c.fetchFeed(def, def.FeedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]PreviewPage, 0, maxPages)
+	for _, item := range items {
+		if len(pages) >= maxPages {
+			break
+		}
+
+		preview := PreviewPage{
+			URL:   item.Link,
+			Ref:   feedItemRef(refExpr, item),
+			Title: item.Title,
+		}
+		if !item.Published.IsZero() {
+			published := item.Published
+			preview.PublishedAt = &published
+		}
+		if item.Link == "" {
+			preview.Error = "feed item has no link"
+		}
+		pages = append(pages, preview)
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,201 @@
+package crawld
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestComicServer(t *testing.T, lastPage int) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	writePage := func(w http.ResponseWriter, page int) {
+		links := ""
+		if page > 1 {
+			links += fmt.Sprintf(`<a rel="prev" href="/comic/%d">Prev</a>`, page-1)
+		}
+		if page < lastPage {
+			links += fmt.Sprintf(`<a rel="next" href="/comic/%d">Next</a>`, page+1)
+		}
+		fmt.Fprintf(w, `<html><head><title>Page %d</title></head><body>`+
+			`<img class="comic" src="/img/%d.png" title=" Hover %d "><img class="ad" src="/img/0.png">`+
+			`<time datetime="2024-03-%02dT05:00:00Z">Posted 2024-03-%02d</time>%s</body></html>`,
+			page, page, page, page, page, links)
+	}
+	mux.HandleFunc("/comic/{page}", func(w http.ResponseWriter, r *http.Request) {
+		var page int
+		if _, err := fmt.Sscanf(r.PathValue("page"), "%d", &page); err != nil || page < 1 || page > lastPage {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writePage(w, page)
+	})
+	// the homepage shows the latest page
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		writePage(w, lastPage)
+	})
+	mux.HandleFunc("/img/{image}", func(w http.ResponseWriter, r *http.Request) {
+		var page int
+		if _, err := fmt.Sscanf(r.PathValue("image"), "%d.png", &page); err != nil || page < 1 || page > lastPage {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_ = png.Encode(w, image.NewGray(image.Rect(0, 0, 100*page, 50)))
+	})
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<rss><channel>`)
+		for page := lastPage; page >= 1; page-- {
+			fmt.Fprintf(w, `<item><title>Page %d</title><link>http://%s/comic/%d</link></item>`, page, r.Host, page)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestSiteDef(srvURL string) store.SiteDef {
+	return store.SiteDef{
+		ID:            1,
+		Name:          "Test Comic",
+		Active:        true,
+		StartURL:      srvURL + "/comic/1",
+		URLTemplate:   srvURL + "/comic/%s",
+		NextPageXPath: `//a[@rel="next"]/@href`,
+		RefRegexp:     `/comic/(\d+)$`,
+		TitleXPath:    `//title`,
+		TitleRegexp:   `(.+)`,
+		CrawlStrategy: store.CrawlStrategyPage,
+		FeedURL:       srvURL + "/feed.xml",
+	}
+}
+
+func TestPreview(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Pages", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 3)
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(newTestSiteDef(srv.URL), 5)
+		require.NoError(t, err)
+		require.Len(t, pages, 3)
+		assert.Equal(t, srv.URL+"/comic/1", pages[0].URL)
+		assert.Equal(t, "1", pages[0].Ref)
+		assert.Equal(t, "Page 1", pages[0].Title)
+		assert.Equal(t, srv.URL+"/comic/2", pages[0].NextPage)
+		assert.Empty(t, pages[0].Error)
+		assert.Equal(t, "3", pages[2].Ref)
+		assert.Empty(t, pages[2].NextPage)
+		assert.NotEmpty(t, pages[2].Error)
+	})
+
+	t.Run("MaxPages", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 10)
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(newTestSiteDef(srv.URL), 2)
+		require.NoError(t, err)
+		require.Len(t, pages, 2)
+		assert.Empty(t, pages[1].Error)
+	})
+
+	t.Run("PrevPage", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 3)
+		def := newTestSiteDef(srv.URL)
+		def.PrevPageXPath = `//a[@rel="prev"]/@href`
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(def, 2)
+		require.NoError(t, err)
+		require.Len(t, pages, 2)
+		assert.Empty(t, pages[0].PrevPage)
+		assert.Empty(t, pages[0].Error, "the first page has no previous page")
+		assert.Equal(t, srv.URL+"/comic/1", pages[1].PrevPage)
+	})
+
+	t.Run("CSS", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 3)
+		def := newTestSiteDef(srv.URL)
+		def.SelectorType = "css"
+		def.NextPageXPath = `a[rel="next"]`
+		def.NextPageAttr = "href"
+		def.TitleXPath = "head > title"
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(def, 5)
+		require.NoError(t, err)
+		require.Len(t, pages, 3)
+		assert.Equal(t, "Page 1", pages[0].Title)
+		assert.Equal(t, srv.URL+"/comic/2", pages[0].NextPage)
+		assert.Empty(t, pages[0].Error)
+		assert.Empty(t, pages[2].NextPage)
+	})
+
+	t.Run("Media", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 2)
+		def := newTestSiteDef(srv.URL)
+		def.ImageXPath = `//img[@class="comic"]`
+		def.ImageAttr = "src"
+		def.AltTextXPath = `//img[@class="comic"]`
+		def.AltTextAttr = "title"
+		def.PublishedXPath = "//time"
+		def.PublishedRegexp = `Posted (.+)`
+		def.PublishedFormat = "2006-01-02"
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(def, 5)
+		require.NoError(t, err)
+		require.Len(t, pages, 2)
+		assert.Equal(t, []string{srv.URL + "/img/1.png"}, pages[0].ImageURLs)
+		assert.Equal(t, "Hover 1", pages[0].AltText)
+		require.NotNil(t, pages[0].PublishedAt)
+		assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), *pages[0].PublishedAt)
+		assert.Empty(t, pages[0].Error)
+	})
+
+	t.Run("BadPublishedFormat", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 2)
+		def := newTestSiteDef(srv.URL)
+		def.PublishedXPath = "//time/@datetime"
+		def.PublishedFormat = "2006-01-02"
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(def, 5)
+		require.NoError(t, err)
+		require.Len(t, pages, 2, "media errors don't stop the crawl")
+		assert.Nil(t, pages[0].PublishedAt)
+		assert.Contains(t, pages[0].Error, "published rule")
+	})
+
+	t.Run("Feed", func(t *testing.T) {
+		t.Parallel()
+		srv := newTestComicServer(t, 3)
+		def := newTestSiteDef(srv.URL)
+		def.CrawlStrategy = store.CrawlStrategyFeed
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		pages, err := p.Preview(def, 2)
+		require.NoError(t, err)
+		require.Len(t, pages, 2)
+		assert.Equal(t, "3", pages[0].Ref)
+		assert.Equal(t, "Page 3", pages[0].Title)
+	})
+
+	t.Run("InvalidRefRegexp", func(t *testing.T) {
+		t.Parallel()
+		def := newTestSiteDef("http://example.com")
+		def.RefRegexp = "("
+		p := NewPreviewer(Config{UserAgent: "test", FetchTimeoutSecs: 1})
+		_, err := p.Preview(def, 2)
+		require.Error(t, err)
+	})
+}
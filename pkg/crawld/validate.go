@@ -0,0 +1,158 @@
+package crawld
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/johnstcn/freshcomics/internal/parser"
+	"github.com/johnstcn/freshcomics/internal/schedule"
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/pkg/errors"
+)
+
+// ValidateSiteDef checks that the given SiteDef can be crawled, returning the first problem found.
+func ValidateSiteDef(def store.SiteDef) error {
+	if strings.TrimSpace(def.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	if err := validateURL(def.StartURL); err != nil {
+		return errors.Wrap(err, "invalid start url")
+	}
+
+	refExpr, err := regexp.Compile(def.RefRegexp)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ref regexp %q", def.RefRegexp)
+	}
+
+	if refExpr.NumSubexp() < 1 {
+		return errors.Errorf("ref regexp %q must contain a capture group", def.RefRegexp)
+	}
+
+	switch def.CrawlStrategy {
+	case store.CrawlStrategyFeed:
+		if err := validateURL(def.FeedURL); err != nil {
+			return errors.Wrap(err, "invalid feed url")
+		}
+	case store.CrawlStrategyPage:
+		if strings.Count(def.URLTemplate, "%s") != 1 {
+			return errors.Errorf("url template %q must contain exactly one %%s", def.URLTemplate)
+		}
+
+		if err := parser.Validate(nextPageRule(def)); err != nil {
+			return errors.Wrap(err, "invalid next page rule")
+		}
+
+		if err := parser.Validate(titleRule(def)); err != nil {
+			return errors.Wrap(err, "invalid title rule")
+		}
+
+		if err := validateMediaRules(def); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unknown crawl strategy %q", def.CrawlStrategy)
+	}
+
+	if err := validateBackfillRules(def); err != nil {
+		return err
+	}
+
+	return validateSchedule(def)
+}
+
+// validateMediaRules checks the optional image, alt text and published rules of the given SiteDef
+func validateMediaRules(def store.SiteDef) error {
+	if def.ImageXPath != "" {
+		if err := parser.Validate(imageRule(def)); err != nil {
+			return errors.Wrap(err, "invalid image rule")
+		}
+	}
+
+	if def.AltTextXPath != "" {
+		if err := parser.Validate(altTextRule(def)); err != nil {
+			return errors.Wrap(err, "invalid alt text rule")
+		}
+	}
+
+	if def.PublishedXPath == "" {
+		return nil
+	}
+
+	if err := parser.Validate(publishedRule(def)); err != nil {
+		return errors.Wrap(err, "invalid published rule")
+	}
+
+	if def.PublishedFormat == "" {
+		return errors.New("published format is required with a published rule")
+	}
+
+	return nil
+}
+
+// validateBackfillRules checks the optional previous page rule and backfill URL of the given SiteDef.
+// Previous page URLs are built from the URL template whatever the crawl strategy.
+func validateBackfillRules(def store.SiteDef) error {
+	if def.BackfillURL != "" {
+		if err := validateURL(def.BackfillURL); err != nil {
+			return errors.Wrap(err, "invalid backfill url")
+		}
+	}
+
+	if def.PrevPageXPath == "" {
+		return nil
+	}
+
+	if strings.Count(def.URLTemplate, "%s") != 1 {
+		return errors.Errorf("url template %q must contain exactly one %%s", def.URLTemplate)
+	}
+
+	if err := parser.Validate(prevPageRule(def)); err != nil {
+		return errors.Wrap(err, "invalid previous page rule")
+	}
+
+	return nil
+}
+
+func validateSchedule(def store.SiteDef) error {
+	if def.CrawlIntervalSecs < 0 {
+		return errors.New("crawl interval must not be negative")
+	}
+
+	if def.CrawlJitterSecs < 0 {
+		return errors.New("crawl jitter must not be negative")
+	}
+
+	if def.FetchDelaySecs < 0 {
+		return errors.New("fetch delay must not be negative")
+	}
+
+	if def.CrawlCron == "" {
+		return nil
+	}
+
+	if def.CrawlIntervalSecs > 0 {
+		return errors.New("only one of crawl interval and crawl cron may be set")
+	}
+
+	_, err := schedule.ParseCron(def.CrawlCron)
+	return err
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("%q must be an http or https url", raw)
+	}
+
+	if u.Host == "" {
+		return errors.Errorf("%q has no host", raw)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package crawld
+
+import (
+	"testing"
+
+	"github.com/johnstcn/freshcomics/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSiteDef(t *testing.T) {
+	t.Parallel()
+
+	valid := store.SiteDef{
+		Name:          "Test Comic",
+		StartURL:      "http://example.com/1",
+		URLTemplate:   "http://example.com/%s",
+		NextPageXPath: `//a[@rel="next"]/@href`,
+		RefRegexp:     `([^/]+)/?$`,
+		TitleXPath:    `//title/text()`,
+		TitleRegexp:   `(.+)`,
+		CrawlStrategy: store.CrawlStrategyPage,
+	}
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(*store.SiteDef)
+		errStr string
+	}{
+		{"OK", func(*store.SiteDef) {}, ""},
+		{"OKFeed", func(d *store.SiteDef) {
+			d.CrawlStrategy = store.CrawlStrategyFeed
+			d.FeedURL = "https://example.com/feed.xml"
+			d.URLTemplate = ""
+			d.NextPageXPath = ""
+		}, ""},
+		{"NoName", func(d *store.SiteDef) { d.Name = " " }, "name is required"},
+		{"BadStartURL", func(d *store.SiteDef) { d.StartURL = "example.com" }, "invalid start url"},
+		{"BadRefRegexp", func(d *store.SiteDef) { d.RefRegexp = "(" }, "invalid ref regexp"},
+		{"NoRefGroup", func(d *store.SiteDef) { d.RefRegexp = "[^/]+$" }, "must contain a capture group"},
+		{"BadTemplate", func(d *store.SiteDef) { d.URLTemplate = "http://example.com/" }, "must contain exactly one %s"},
+		{"BadNextPageXPath", func(d *store.SiteDef) { d.NextPageXPath = "//a[" }, "invalid next page rule"},
+		{"BadTitleRegexp", func(d *store.SiteDef) { d.TitleRegexp = "(" }, "invalid title rule"},
+		{"OKCSS", func(d *store.SiteDef) {
+			d.SelectorType = "css"
+			d.NextPageXPath = `a[rel="next"]`
+			d.NextPageAttr = "href"
+			d.TitleXPath = "title"
+		}, ""},
+		{"BadCSS", func(d *store.SiteDef) {
+			d.SelectorType = "css"
+			d.NextPageXPath = "a["
+		}, "invalid css selector"},
+		{"OKMedia", func(d *store.SiteDef) {
+			d.ImageXPath = `//img[@id="comic"]`
+			d.ImageAttr = "src"
+			d.AltTextXPath = `//img[@id="comic"]`
+			d.AltTextAttr = "title"
+			d.PublishedXPath = "//time"
+			d.PublishedAttr = "datetime"
+			d.PublishedFormat = "2006-01-02T15:04:05Z07:00"
+		}, ""},
+		{"BadImageXPath", func(d *store.SiteDef) { d.ImageXPath = "//img[" }, "invalid image rule"},
+		{"BadAltTextXPath", func(d *store.SiteDef) { d.AltTextXPath = "//img[" }, "invalid alt text rule"},
+		{"BadPublishedRegexp", func(d *store.SiteDef) {
+			d.PublishedXPath = "//time"
+			d.PublishedRegexp = "("
+			d.PublishedFormat = "2006-01-02"
+		}, "invalid published rule"},
+		{"NoPublishedFormat", func(d *store.SiteDef) { d.PublishedXPath = "//time" }, "published format is required"},
+		{"UnknownSelectorType", func(d *store.SiteDef) { d.SelectorType = "jquery" }, "invalid selector type"},
+		{"BadFeedURL", func(d *store.SiteDef) {
+			d.CrawlStrategy = store.CrawlStrategyFeed
+			d.FeedURL = ""
+		}, "invalid feed url"},
+		{"UnknownStrategy", func(d *store.SiteDef) { d.CrawlStrategy = "magic" }, "unknown crawl strategy"},
+		{"OKBackfill", func(d *store.SiteDef) {
+			d.PrevPageXPath = `//a[@rel="prev"]/@href`
+			d.BackfillURL = "http://example.com/"
+		}, ""},
+		{"BadPrevPageXPath", func(d *store.SiteDef) { d.PrevPageXPath = "//a[" }, "invalid previous page rule"},
+		{"BadBackfillURL", func(d *store.SiteDef) { d.BackfillURL = "example.com" }, "invalid backfill url"},
+		{"BackfillFeedNoTemplate", func(d *store.SiteDef) {
+			d.CrawlStrategy = store.CrawlStrategyFeed
+			d.FeedURL = "https://example.com/feed.xml"
+			d.URLTemplate = ""
+			d.PrevPageXPath = `//a[@rel="prev"]/@href`
+		}, "must contain exactly one %s"},
+		{"OKInterval", func(d *store.SiteDef) { d.CrawlIntervalSecs = 86400 }, ""},
+		{"OKCron", func(d *store.SiteDef) {
+			d.CrawlCron = "0 5 * * 1,3,5"
+			d.CrawlJitterSecs = 600
+		}, ""},
+		{"NegativeInterval", func(d *store.SiteDef) { d.CrawlIntervalSecs = -1 }, "crawl interval must not be negative"},
+		{"NegativeJitter", func(d *store.SiteDef) { d.CrawlJitterSecs = -1 }, "crawl jitter must not be negative"},
+		{"IntervalAndCron", func(d *store.SiteDef) {
+			d.CrawlIntervalSecs = 86400
+			d.CrawlCron = "@daily"
+		}, "only one of crawl interval and crawl cron"},
+		{"BadCron", func(d *store.SiteDef) { d.CrawlCron = "0 25 * * *" }, "invalid cron expression"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			def := valid
+			tc.mutate(&def)
+			err := ValidateSiteDef(def)
+			if tc.errStr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.errStr)
+			}
+		})
+	}
+}